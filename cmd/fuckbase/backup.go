@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/ssig33/fuckbase/internal/logger"
+	"github.com/ssig33/fuckbase/internal/s3"
+)
+
+const backupUsage = `Usage: fuckbase backup <command> [options] <backup>
+
+Commands:
+  inspect   Print a backup's metadata, per-set statistics and integrity problems
+  export    Write the entries of a backup as NDJSON
+  convert   Re-encode a backup with another compression codec or encryption key
+
+<backup> is a local file, or an object name when --storage is given.
+Run "fuckbase backup <command> -h" for the options of a command.
+`
+
+// exportRecord is one line of an NDJSON export
+type exportRecord struct {
+	Database string      `json:"database"`
+	Set      string      `json:"set"`
+	Key      string      `json:"key"`
+	Value    interface{} `json:"value"`
+}
+
+// backupSource holds the options selecting and opening the backup to read
+type backupSource struct {
+	storageURL string
+	keyFile    string
+	env        *config.ServerConfig
+}
+
+// register adds the source options to a flag set
+func (src *backupSource) register(fs *flag.FlagSet) {
+	src.env = config.NewServerConfig()
+	src.env.ParseEnv()
+
+	fs.StringVar(&src.storageURL, "storage", "", "Read the backup object from this storage URL (s3://bucket?..., file:///dir) instead of a local file")
+	fs.StringVar(&src.keyFile, "key-file", src.env.Encryption.KeyFile, "Backup encryption key file used to decrypt the backup")
+}
+
+// open returns a backup manager reading the backup and the backup's object name
+// A local file is read through a storage rooted at its directory, so its manifest is
+// found next to it.
+func (src *backupSource) open(backup string) (*s3.BackupManager, string, error) {
+	var bm *s3.BackupManager
+	objectName := backup
+
+	if src.storageURL != "" {
+		target, err := s3.NewStorageFromURL(src.storageURL, src.env.S3Config)
+		if err != nil {
+			return nil, "", err
+		}
+		bm = s3.NewBackupManager(target.Storage, nil)
+	} else {
+		if _, err := os.Stat(backup); err != nil {
+			return nil, "", err
+		}
+		storage, err := s3.NewLocalStorage(filepath.Dir(backup))
+		if err != nil {
+			return nil, "", err
+		}
+		bm = s3.NewBackupManager(storage, nil)
+		objectName = filepath.Base(backup)
+	}
+
+	keyring, err := loadKeyring(src.keyFile, src.env.Encryption)
+	if err != nil {
+		return nil, "", err
+	}
+	bm.SetKeyring(keyring)
+
+	return bm, objectName, nil
+}
+
+// loadKeyring loads the keys in keyFile, or those configured in the environment
+// It returns nil when no key is configured.
+func loadKeyring(keyFile string, env *config.EncryptionConfig) (*s3.Keyring, error) {
+	cfg := *env
+	if keyFile != "" {
+		cfg.KeyFile = keyFile
+	}
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	return s3.LoadKeyring(&cfg)
+}
+
+// runBackupCommand runs a "fuckbase backup" command and returns the exit status
+func runBackupCommand(args []string) int {
+	// Keep stdout for command output
+	if err := logger.InitLogger("warn", "stderr"); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
+		return 1
+	}
+
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, backupUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "inspect":
+		return runBackupInspect(args[1:])
+	case "export":
+		return runBackupExport(args[1:])
+	case "convert":
+		return runBackupConvert(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(backupUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown backup command: %s\n\n%s", args[0], backupUsage)
+		return 2
+	}
+}
+
+// parseBackupArgs parses the options of a command and returns its single backup argument
+func parseBackupArgs(fs *flag.FlagSet, args []string) (string, bool) {
+	if err := fs.Parse(args); err != nil {
+		return "", false
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: fuckbase backup %s [options] <backup>\n", fs.Name())
+		fs.PrintDefaults()
+		return "", false
+	}
+	return fs.Arg(0), true
+}
+
+// runBackupInspect prints a backup's metadata and statistics
+// The exit status is 1 if the backup has problems.
+func runBackupInspect(args []string) int {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	var src backupSource
+	src.register(fs)
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+
+	backup, ok := parseBackupArgs(fs, args)
+	if !ok {
+		return 2
+	}
+
+	bm, objectName, err := src.open(backup)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open backup: %v\n", err)
+		return 1
+	}
+
+	report, err := bm.VerifyBackup(objectName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read backup: %v\n", err)
+		return 1
+	}
+	manifest, _ := bm.GetManifest(objectName)
+
+	if *asJSON {
+		output := struct {
+			Report   *s3.VerifyReport   `json:"report"`
+			Manifest *s3.BackupManifest `json:"manifest,omitempty"`
+		}{report, manifest}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(output); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write report: %v\n", err)
+			return 1
+		}
+	} else {
+		printInspectReport(os.Stdout, report, manifest)
+	}
+
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+// printInspectReport prints a verification report and manifest for people
+func printInspectReport(out io.Writer, report *s3.VerifyReport, manifest *s3.BackupManifest) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Backup:\t%s\n", report.Object)
+	fmt.Fprintf(w, "Size:\t%d bytes\n", report.Size)
+	fmt.Fprintf(w, "Checksum:\t%s\n", report.Checksum)
+	fmt.Fprintf(w, "Compression:\t%s\n", report.Compression)
+	fmt.Fprintf(w, "Encrypted:\t%v\n", report.Encrypted)
+	if manifest != nil {
+		fmt.Fprintf(w, "Database:\t%s\n", manifest.Database)
+		fmt.Fprintf(w, "Created:\t%s\n", manifest.CreatedAt.Format("2006-01-02T15:04:05Z07:00"))
+		if manifest.FormatVersion > 0 {
+			fmt.Fprintf(w, "Format version:\t%d\n", manifest.FormatVersion)
+		}
+		if manifest.ServerVersion != "" {
+			fmt.Fprintf(w, "Server version:\t%s\n", manifest.ServerVersion)
+		}
+		if manifest.KeyID != "" {
+			fmt.Fprintf(w, "Key ID:\t%s\n", manifest.KeyID)
+		}
+	}
+	fmt.Fprintf(w, "Manifest:\t%s\n", manifestState(report))
+	fmt.Fprintf(w, "Contents:\t%d databases, %d sets, %d entries\n", report.DatabaseCount, report.SetCount, report.EntryCount)
+	fmt.Fprintf(w, "Valid:\t%v\n", report.Valid)
+	w.Flush()
+
+	for _, dbName := range sortedKeys(report.Databases) {
+		stats := report.Databases[dbName]
+		fmt.Fprintf(out, "\nDatabase %s (%d indexes)\n", dbName, stats.Indexes)
+		w = tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.AlignRight)
+		for _, setName := range sortedKeys(stats.Sets) {
+			fmt.Fprintf(w, "  %s\t%d entries\t\n", setName, stats.Sets[setName])
+		}
+		w.Flush()
+	}
+
+	for _, warning := range report.Warnings {
+		fmt.Fprintf(out, "\nWarning: %s\n", warning)
+	}
+	if len(report.Problems) > 0 {
+		fmt.Fprintln(out, "\nProblems:")
+		for _, problem := range report.Problems {
+			fmt.Fprintf(out, "  - %s\n", problem)
+		}
+	}
+}
+
+// manifestState describes how a backup compares to its manifest
+func manifestState(report *s3.VerifyReport) string {
+	switch {
+	case !report.ManifestFound:
+		return "not found"
+	case report.ChecksumVerified:
+		return "checksum verified"
+	default:
+		return "checksum mismatch"
+	}
+}
+
+// runBackupExport writes the entries of a backup as NDJSON
+func runBackupExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var src backupSource
+	src.register(fs)
+	dbName := fs.String("database", "", "Export only this database")
+	setName := fs.String("set", "", "Export only this set")
+	output := fs.String("output", "-", "Output file, or - for standard output")
+	dataKeyFile := fs.String("data-key-file", src.env.DataEncryption.KeyFile, "Master key file that opens the values of encrypted databases")
+
+	backup, ok := parseBackupArgs(fs, args)
+	if !ok {
+		return 2
+	}
+
+	bm, objectName, err := src.open(backup)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open backup: %v\n", err)
+		return 1
+	}
+
+	databases, _, err := bm.ReadBackup(objectName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read backup: %v\n", err)
+		return 1
+	}
+	dataKeys, err := loadKeyring(*dataKeyFile, src.env.DataEncryption)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load data encryption key: %v\n", err)
+		return 1
+	}
+	var wrapper database.KeyWrapper
+	if dataKeys != nil {
+		wrapper = dataKeys
+	}
+	if *dbName != "" {
+		if _, ok := databases[*dbName]; !ok {
+			fmt.Fprintf(os.Stderr, "Database %s is not in the backup\n", *dbName)
+			return 1
+		}
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create output file: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	count, err := writeNDJSON(out, databases, wrapper, *dbName, *setName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export backup: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d entries\n", count)
+	return 0
+}
+
+// writeNDJSON writes one record per entry, sorted by database, set and key
+// Empty dbName or setName select every database or set. The values of encrypted databases
+// are opened with the data keys unwrapped by wrapper; without it, they fail the export.
+func writeNDJSON(out io.Writer, databases map[string]s3.DatabaseBackup, wrapper database.KeyWrapper, dbName string, setName string) (int, error) {
+	buffered := bufio.NewWriter(out)
+	encoder := json.NewEncoder(buffered)
+	count := 0
+
+	for _, name := range sortedKeys(databases) {
+		if dbName != "" && name != dbName {
+			continue
+		}
+		backup := databases[name]
+		for _, set := range sortedKeys(backup.Sets) {
+			if setName != "" && set != setName {
+				continue
+			}
+			data, err := backup.SetValues(set, wrapper)
+			if err != nil {
+				return count, err
+			}
+			for _, key := range sortedKeys(data) {
+				if err := encoder.Encode(exportRecord{Database: name, Set: set, Key: key, Value: data[key]}); err != nil {
+					return count, err
+				}
+				count++
+			}
+		}
+	}
+
+	return count, buffered.Flush()
+}
+
+// runBackupConvert re-encodes a backup
+func runBackupConvert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	var src backupSource
+	src.register(fs)
+	output := fs.String("output", "", "Output file, or object name when --output-storage is given (required)")
+	outputStorage := fs.String("output-storage", "", "Write the converted backup to this storage URL instead of a local file")
+	compression := fs.String("compression", s3.CompressionNone, "Compression codec of the converted backup (none, gzip, zstd)")
+	encryptKeyFile := fs.String("encrypt-key-file", "", "Encrypt the converted backup with the first key in this file")
+	encryptKeyID := fs.String("encrypt-key-id", "", "Key ID recorded with the converted backup (defaults to the key fingerprint)")
+
+	backup, ok := parseBackupArgs(fs, args)
+	if !ok {
+		return 2
+	}
+	if *output == "" {
+		fmt.Fprintln(os.Stderr, "--output is required")
+		return 2
+	}
+
+	source, objectName, err := src.open(backup)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open backup: %v\n", err)
+		return 1
+	}
+
+	var target *s3.BackupManager
+	targetName := *output
+	if *outputStorage != "" {
+		storage, err := s3.NewStorageFromURL(*outputStorage, src.env.S3Config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open output storage: %v\n", err)
+			return 1
+		}
+		target = s3.NewBackupManager(storage.Storage, nil)
+	} else {
+		storage, err := s3.NewLocalStorage(filepath.Dir(*output))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open output directory: %v\n", err)
+			return 1
+		}
+		target = s3.NewBackupManager(storage, nil)
+		targetName = filepath.Base(*output)
+	}
+
+	if err := target.SetCompression(*compression); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	if *encryptKeyFile != "" {
+		keyring, err := s3.LoadKeyring(&config.EncryptionConfig{KeyFile: *encryptKeyFile, KeyID: *encryptKeyID})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load encryption key: %v\n", err)
+			return 1
+		}
+		target.SetKeyring(keyring)
+	}
+
+	converted, err := target.ConvertBackup(source, objectName, targetName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to convert backup: %v\n", err)
+		return 1
+	}
+
+	if *outputStorage == "" {
+		converted = filepath.Join(filepath.Dir(*output), converted)
+	}
+	fmt.Println(converted)
+	return 0
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -14,9 +15,26 @@ import (
 )
 
 func main() {
+	// Subcommands run without starting the server
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backup":
+			os.Exit(runBackupCommand(os.Args[2:]))
+		case "export":
+			os.Exit(runExportCommand(os.Args[2:]))
+		case "import":
+			os.Exit(runImportCommand(os.Args[2:]))
+		case "hash-password":
+			os.Exit(runHashPasswordCommand(os.Args[2:]))
+		}
+	}
+
 	// Create server configuration
 	cfg := config.NewServerConfig()
-	cfg.Parse()
+	if err := cfg.Parse(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse configuration: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Initialize logger
 	if err := logger.InitLogger(cfg.LogLevel, cfg.LogFile); err != nil {
@@ -33,12 +51,27 @@ func main() {
 	dbManager := database.NewManager()
 
 	// Create HTTP server
-	srv := server.NewServer(cfg, dbManager)
+	srv, err := server.NewServer(cfg, dbManager)
+	if err != nil {
+		logger.Error("Failed to create server: %v", err)
+		os.Exit(1)
+	}
 
 	// Handle graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
+	// Reload TLS certificates on SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := srv.ReloadTLS(); err != nil {
+				logger.Error("Failed to reload TLS certificates: %v", err)
+			}
+		}
+	}()
+
 	// Start server in a goroutine
 	go func() {
 		if err := srv.Start(); err != nil {
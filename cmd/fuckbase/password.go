@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ssig33/fuckbase/internal/credential"
+)
+
+// runHashPasswordCommand reads a password from standard input and prints its hash
+// The hash can be given to --admin-password-hash so the password is not passed in plaintext.
+func runHashPasswordCommand(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: fuckbase hash-password < password.txt")
+		return 2
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read password: %v\n", err)
+		} else {
+			fmt.Fprintln(os.Stderr, "Password is empty")
+		}
+		return 1
+	}
+
+	hash, err := credential.HashPassword(password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to hash password: %v\n", err)
+		return 1
+	}
+	fmt.Println(hash)
+	return 0
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ssig33/fuckbase/internal/transfer"
+)
+
+// serverClient holds the options for talking to a running server
+type serverClient struct {
+	server   string
+	database string
+	set      string
+	username string
+	password string
+}
+
+// register adds the server options to a flag set
+func (c *serverClient) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.server, "server", envOrDefault("FUCKBASE_SERVER", "http://localhost:8080"), "Server URL (env FUCKBASE_SERVER)")
+	fs.StringVar(&c.database, "database", "", "Database name")
+	fs.StringVar(&c.set, "set", "", "Set name")
+	fs.StringVar(&c.username, "username", "", "Database username")
+	fs.StringVar(&c.password, "password", os.Getenv("FUCKBASE_PASSWORD"), "Database password (env FUCKBASE_PASSWORD)")
+}
+
+// validate checks that the database and set are given
+func (c *serverClient) validate() error {
+	if c.database == "" {
+		return fmt.Errorf("--database is required")
+	}
+	if c.set == "" {
+		return fmt.Errorf("--set is required")
+	}
+	return nil
+}
+
+// post sends a request to an endpoint, returning an error for non-200 responses
+func (c *serverClient) post(endpoint string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	target := strings.TrimSuffix(c.server, "/") + endpoint
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodPost, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var errResp struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &errResp) == nil && errResp.Code != "" {
+			return nil, fmt.Errorf("%s: %s", errResp.Code, errResp.Message)
+		}
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// runExportCommand streams a set from a running server as NDJSON or CSV
+func runExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var client serverClient
+	client.register(fs)
+	format := fs.String("format", transfer.FormatNDJSON, "Output format: ndjson or csv")
+	columns := fs.String("columns", "", "Comma-separated CSV value columns; every top-level field if empty")
+	keyColumn := fs.String("key-column", "", "CSV key column name (default \"key\")")
+	output := fs.String("output", "-", "Output file, or - for standard output")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := client.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	if err := transfer.ValidateFormat(*format); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	req := map[string]interface{}{
+		"database":   client.database,
+		"set":        client.set,
+		"format":     *format,
+		"key_column": *keyColumn,
+	}
+	if *columns != "" {
+		req["columns"] = strings.Split(*columns, ",")
+	}
+	body, _ := json.Marshal(req)
+
+	resp, err := client.post("/export", nil, "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export set: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	out := io.Writer(os.Stdout)
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create output file: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export set: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runImportCommand loads an NDJSON or CSV file into a set on a running server
+func runImportCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	var client serverClient
+	client.register(fs)
+	format := fs.String("format", "", "Input format: ndjson or csv (default from the file extension, else ndjson)")
+	keyColumn := fs.String("key-column", "", "CSV key column name (default \"key\")")
+	inferTypes := fs.Bool("infer-types", true, "Read CSV numbers, booleans and JSON objects as typed values")
+	skipErrors := fs.Bool("skip-errors", false, "Skip invalid lines instead of stopping")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: fuckbase import [options] <file>")
+		fs.PrintDefaults()
+		return 2
+	}
+	if err := client.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	input := fs.Arg(0)
+	if *format == "" {
+		*format = transfer.FormatNDJSON
+		if strings.EqualFold(filepath.Ext(input), ".csv") {
+			*format = transfer.FormatCSV
+		}
+	}
+	if err := transfer.ValidateFormat(*format); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	in := io.Reader(os.Stdin)
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open input file: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		in = file
+	}
+
+	query := url.Values{
+		"database":    {client.database},
+		"set":         {client.set},
+		"format":      {*format},
+		"infer_types": {strconv.FormatBool(*inferTypes)},
+		"skip_errors": {strconv.FormatBool(*skipErrors)},
+	}
+	if *keyColumn != "" {
+		query.Set("key_column", *keyColumn)
+	}
+
+	resp, err := client.post("/import", query, transfer.ContentType(*format), in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to import set: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data transfer.ImportResult `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read import result: %v\n", err)
+		return 1
+	}
+	for _, lineErr := range result.Data.Errors {
+		fmt.Fprintf(os.Stderr, "Skipped %v\n", &lineErr)
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d entries (%d skipped)\n", result.Data.Imported, result.Data.Skipped)
+	return 0
+}
+
+// envOrDefault returns an environment variable, or def if it is unset
+func envOrDefault(name string, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
@@ -0,0 +1,230 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Results of an audited operation
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Event is one audited operation
+type Event struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"` // X-Request-ID of the request
+	Identity  string    `json:"identity"`             // Who, such as "user:orders/alice", "token:<id>" or "anonymous"
+	Source    string    `json:"source"`               // Client IP address
+	Endpoint  string    `json:"endpoint"`             // Request path
+	Database  string    `json:"database,omitempty"`   // Database the operation is on
+	Set       string    `json:"set,omitempty"`
+	Key       string    `json:"key,omitempty"`
+	Target    string    `json:"target,omitempty"` // Other object, such as an index or backup name
+	Result    string    `json:"result"`           // "success" or "failure"
+	Status    int       `json:"status"`           // HTTP status code
+	Code      string    `json:"code,omitempty"`   // Error code of a failure
+}
+
+// Filter selects events in a query; zero fields match every event
+type Filter struct {
+	Identity string
+	Endpoint string
+	Database string
+	Result   string
+	Since    time.Time
+	Until    time.Time
+	Limit    int // Maximum number of events, newest first
+}
+
+// matches reports whether an event is selected by the filter
+func (f *Filter) matches(e *Event) bool {
+	return (f.Identity == "" || e.Identity == f.Identity) &&
+		(f.Endpoint == "" || e.Endpoint == f.Endpoint) &&
+		(f.Database == "" || e.Database == f.Database) &&
+		(f.Result == "" || e.Result == f.Result) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+// Log is an append-only JSON-lines audit log, rotated by size
+// Rotated files are named like the log with ".1", ".2" and so on appended, ".1" being the newest.
+type Log struct {
+	path     string
+	maxSize  int64 // Size at which the log is rotated; 0 never rotates
+	maxFiles int   // Number of rotated files kept
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+}
+
+// Open opens the audit log at path for appending, creating it if needed
+func Open(path string, maxSize int64, maxFiles int) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	l := &Log{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens the current log file
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Record appends an event to the log, rotating it first if it would grow past the maximum size
+func (l *Log) Record(event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Time = event.Time.UTC()
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	return nil
+}
+
+// rotate moves the current log to ".1", shifting older files and removing the oldest
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	l.file = nil
+
+	if l.maxFiles > 0 {
+		os.Remove(l.rotatedPath(l.maxFiles))
+		for i := l.maxFiles - 1; i >= 1; i-- {
+			if err := os.Rename(l.rotatedPath(i), l.rotatedPath(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to rotate audit log: %w", err)
+			}
+		}
+		if err := os.Rename(l.path, l.rotatedPath(1)); err != nil {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+
+	return l.open()
+}
+
+// rotatedPath returns the path of the nth rotated file
+func (l *Log) rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", l.path, n)
+}
+
+// Query returns the events selected by the filter from the log and its rotated files, newest first
+func (l *Log) Query(filter Filter) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Read the oldest file first so events are in the order they were recorded
+	paths := []string{l.path}
+	for i := 1; i <= l.maxFiles; i++ {
+		paths = append([]string{l.rotatedPath(i)}, paths...)
+	}
+
+	events := []Event{}
+	for _, path := range paths {
+		fileEvents, err := readEvents(path, &filter)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, fileEvents...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.After(events[j].Time)
+	})
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+	return events, nil
+}
+
+// readEvents reads the events selected by the filter from a log file
+// A missing file has no events, and lines that cannot be parsed, such as one cut short by a
+// crash, are skipped.
+func readEvents(path string, filter *Filter) ([]Event, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		if filter.matches(&event) {
+			events = append(events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return events, nil
+}
+
+// Close closes the log
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
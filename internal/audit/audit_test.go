@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	l, err := Open(path, 0, 3)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer l.Close()
+
+	base := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	events := []Event{
+		{Time: base, Identity: "admin:root", Endpoint: "/create", Database: "orders", Result: ResultSuccess, Status: 200},
+		{Time: base.Add(time.Minute), Identity: "user:orders/alice", Endpoint: "/index/create", Database: "orders", Result: ResultFailure, Status: 403, Code: "PERMISSION_DENIED"},
+		{Time: base.Add(2 * time.Minute), Identity: "admin:root", Endpoint: "/drop", Database: "shop", Result: ResultSuccess, Status: 200},
+	}
+	for _, e := range events {
+		if err := l.Record(e); err != nil {
+			t.Fatalf("Failed to record event: %v", err)
+		}
+	}
+
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("Expected 3 JSON lines, got %d", lines)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"all, newest first", Filter{}, []string{"/drop", "/index/create", "/create"}},
+		{"identity", Filter{Identity: "admin:root"}, []string{"/drop", "/create"}},
+		{"database and result", Filter{Database: "orders", Result: ResultFailure}, []string{"/index/create"}},
+		{"time range", Filter{Since: base.Add(time.Minute), Until: base.Add(2 * time.Minute)}, []string{"/index/create"}},
+		{"limit", Filter{Limit: 1}, []string{"/drop"}},
+	}
+	for _, tt := range tests {
+		got, err := l.Query(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: query failed: %v", tt.name, err)
+		}
+		var endpoints []string
+		for _, e := range got {
+			endpoints = append(endpoints, e.Endpoint)
+		}
+		if strings.Join(endpoints, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, endpoints)
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, 200, 2)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+
+	base := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		if err := l.Record(Event{Time: base.Add(time.Duration(i) * time.Second), Identity: "admin:root", Endpoint: "/create", Result: ResultSuccess, Status: 200}); err != nil {
+			t.Fatalf("Failed to record event: %v", err)
+		}
+	}
+	l.Close()
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Errorf("Expected %s to exist: %v", name, err)
+		} else if info.Size() > 200 {
+			t.Errorf("Expected %s to be rotated at 200 bytes, got %d", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 rotated files to be kept")
+	}
+
+	// Reopening appends, and queries cover the rotated files
+	l, err = Open(path, 200, 2)
+	if err != nil {
+		t.Fatalf("Failed to reopen audit log: %v", err)
+	}
+	defer l.Close()
+	events, err := l.Query(Filter{})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(events) < 3 || !events[0].Time.Equal(base.Add(9*time.Second)) {
+		t.Errorf("Expected the newest events from every file, got %d starting at %v", len(events), events[0].Time)
+	}
+}
@@ -2,8 +2,13 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/credential"
 )
 
 // ServerConfig represents the configuration for the FuckBase server
@@ -16,23 +21,176 @@ type ServerConfig struct {
 	LogLevel       string
 	LogFile        string
 	BackupInterval int
+	BackupDir      string
+	BackupReplicas []string // Storage URLs backups are replicated to, such as s3://bucket or file:///dir
+	Retention      *RetentionConfig
+	Encryption     *EncryptionConfig
+	DataEncryption *EncryptionConfig // Master keys of databases encrypted at rest
+	JWT            *JWTConfig
+	TLS            *TLSConfig
+	RateLimit      *RateLimitConfig
+	Audit          *AuditConfig
+	CORS           *CORSConfig
+	MaxBodySize    int // Maximum request body in megabytes; 0 disables the limit
+	MaxImportSize  int // Maximum /import body in megabytes; 0 disables the limit
+	Compression    string
+	RestoreOnStart string // "latest" or a backup object name; empty disables
 }
 
+// RestoreLatest is the RestoreOnStart value selecting the newest full backup
+const RestoreLatest = "latest"
+
 // AdminAuthConfig represents the configuration for admin authentication
+// The password is kept only as a salted hash.
 type AdminAuthConfig struct {
-	Username string
-	Password string
-	Enabled  bool
+	Username     string
+	PasswordHash string
+	Enabled      bool
+
+	password string // Password from flags or environment, until enable hashes it
+}
+
+// setCredentials sets the admin username with a password or a hash from credential.HashPassword
+// Incomplete credentials are ignored. Admin auth is enabled by enable.
+func (a *AdminAuthConfig) setCredentials(username, password, passwordHash string) {
+	if username == "" || (password == "" && passwordHash == "") {
+		return
+	}
+	a.Username = username
+	a.PasswordHash = passwordHash
+	a.password = password
+}
+
+// enable enables admin auth if credentials were set, hashing the password if one was given
+func (a *AdminAuthConfig) enable() error {
+	if a.Username == "" || (a.password == "" && a.PasswordHash == "") {
+		return nil
+	}
+	if a.password != "" {
+		hash, err := credential.HashPassword(a.password)
+		if err != nil {
+			return fmt.Errorf("failed to hash admin password: %w", err)
+		}
+		a.PasswordHash = hash
+		a.password = ""
+	}
+	if !credential.IsPasswordHash(a.PasswordHash) {
+		return fmt.Errorf("admin password hash is not a hash from \"fuckbase hash-password\"")
+	}
+	a.Enabled = true
+	return nil
 }
 
 // S3Config represents the configuration for S3 integration
 type S3Config struct {
-	Endpoint    string
-	Bucket      string
-	AccessKey   string
-	SecretKey   string
-	Region      string
-	Enabled     bool
+	Endpoint     string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	Region       string
+	Enabled      bool
+	UseSSL       bool          // Connect over HTTPS; also enabled by an https:// endpoint
+	CABundle     string        // PEM file of CA certificates trusted in addition to the system ones
+	BucketLookup string        // Bucket addressing: "auto", "path" or "dns" (virtual-host)
+	SSE          string        // Server-side encryption: "none", "sse-s3" or "sse-kms"
+	SSEKMSKeyID  string        // KMS key ID used with "sse-kms"
+	MaxRetries   int           // Number of times a failed operation is retried
+	RetryDelay   time.Duration // Delay before the first retry, doubled after each attempt
+	Timeout      time.Duration // Timeout of each attempt of an operation
+}
+
+// RetentionConfig represents the backup retention policy
+// A zero value for every field disables pruning
+type RetentionConfig struct {
+	KeepLast   int // Number of most recent backups to keep
+	KeepHourly int // Number of hours for which one backup per hour is kept
+	KeepDaily  int // Number of days for which one backup per day is kept
+}
+
+// Enabled reports whether any retention rule is configured
+func (r *RetentionConfig) Enabled() bool {
+	return r != nil && (r.KeepLast > 0 || r.KeepHourly > 0 || r.KeepDaily > 0)
+}
+
+// EncryptionConfig represents the master keys for client-side backup encryption or for
+// databases encrypted at rest
+// Keys are given either as a file path or directly (base64) through the environment
+type EncryptionConfig struct {
+	KeyFile string
+	Key     string
+	KeyID   string
+}
+
+// Enabled reports whether an encryption key is configured
+func (e *EncryptionConfig) Enabled() bool {
+	return e != nil && (e.KeyFile != "" || e.Key != "")
+}
+
+// JWTConfig represents the configuration for JWT authentication
+type JWTConfig struct {
+	KeysFile    string // JWKS document or PEM public keys used to verify tokens
+	Issuer      string // Required iss claim; not checked if empty
+	Audience    string // Required aud claim; not checked if empty
+	ScopesClaim string // Claim holding the token's scopes
+}
+
+// Enabled reports whether JWT verification keys are configured
+func (j *JWTConfig) Enabled() bool {
+	return j != nil && j.KeysFile != ""
+}
+
+// TLSConfig represents the configuration for serving HTTPS
+// The certificate files and client identities are reloaded on SIGHUP.
+type TLSConfig struct {
+	CertFile          string // PEM certificate chain of the server
+	KeyFile           string // PEM private key of the server
+	ClientCAFile      string // PEM CA certificates that client certificates are verified against
+	RequireClientCert bool   // Reject clients without a verified certificate
+	ClientIdentities  string // JSON file mapping client certificate subjects to identities
+}
+
+// Enabled reports whether a server certificate is configured
+func (t *TLSConfig) Enabled() bool {
+	return t != nil && t.CertFile != "" && t.KeyFile != ""
+}
+
+// RateLimitConfig represents the request rate limits and the lockout after failed authentication
+// Rates are requests per second, with bursts of up to one second's worth; zero disables a limit.
+type RateLimitConfig struct {
+	IPRead           float64       // Read requests per client IP
+	IPWrite          float64       // Write requests per client IP
+	CredentialRead   float64       // Read requests per username or token
+	CredentialWrite  float64       // Write requests per username or token
+	DatabaseRead     float64       // Read requests per database
+	DatabaseWrite    float64       // Write requests per database
+	LockoutThreshold int           // Failed authentications from a client IP that lock it out; 0 disables
+	LockoutWindow    time.Duration // Period failed authentications are counted over
+	LockoutDuration  time.Duration // Length of a lockout
+}
+
+// AuditConfig represents the audit log of administrative and data-changing operations
+type AuditConfig struct {
+	File     string // JSON-lines file events are appended to; empty disables the audit log
+	MaxSize  int    // Size in megabytes at which the file is rotated; 0 never rotates
+	MaxFiles int    // Number of rotated files kept
+	Writes   bool   // Also record set writes and imports
+}
+
+// Enabled reports whether the audit log is configured
+func (a *AuditConfig) Enabled() bool {
+	return a != nil && a.File != ""
+}
+
+// CORSConfig represents the cross-origin requests allowed from browsers
+type CORSConfig struct {
+	AllowedOrigins   []string      // Origins allowed to call the API, or "*" for any; empty disables CORS
+	AllowCredentials bool          // Allow requests with cookies or HTTP authentication from origins listed by name
+	MaxAge           time.Duration // How long browsers may cache a preflight response
+}
+
+// Enabled reports whether any cross-origin requests are allowed
+func (c *CORSConfig) Enabled() bool {
+	return c != nil && len(c.AllowedOrigins) > 0
 }
 
 // NewServerConfig creates a new server configuration with default values
@@ -42,22 +200,36 @@ func NewServerConfig() *ServerConfig {
 		Host:           "0.0.0.0",
 		DataDir:        "./data",
 		AdminAuth:      &AdminAuthConfig{Enabled: false},
-		S3Config:       &S3Config{Region: "us-east-1", Enabled: false},
+		S3Config:       &S3Config{Region: "us-east-1", Enabled: false, BucketLookup: "auto", SSE: "none", MaxRetries: 3, RetryDelay: 500 * time.Millisecond, Timeout: time.Minute},
 		LogLevel:       "info",
 		LogFile:        "stdout",
 		BackupInterval: 60,
+		Retention:      &RetentionConfig{},
+		Encryption:     &EncryptionConfig{},
+		DataEncryption: &EncryptionConfig{},
+		JWT:            &JWTConfig{ScopesClaim: "fuckbase"},
+		TLS:            &TLSConfig{},
+		RateLimit:      &RateLimitConfig{LockoutThreshold: 10, LockoutWindow: time.Minute, LockoutDuration: 5 * time.Minute},
+		Audit:          &AuditConfig{MaxSize: 100, MaxFiles: 10},
+		CORS:           &CORSConfig{MaxAge: 10 * time.Minute},
+		MaxBodySize:    10,
+		Compression:    "none",
 	}
 }
 
 // ParseFlags parses command line flags and updates the configuration
+// Admin credentials are only enabled by Parse, once both are applied.
 func (c *ServerConfig) ParseFlags() {
 	flag.IntVar(&c.Port, "port", c.Port, "Server port")
 	flag.StringVar(&c.Host, "host", c.Host, "Server host")
 	flag.StringVar(&c.DataDir, "data-dir", c.DataDir, "Data directory")
 	
 	// Admin auth flags
-	adminUsername := flag.String("admin-username", "", "Admin username")
-	adminPassword := flag.String("admin-password", "", "Admin password")
+	// Credentials rotated through /auth/admin/update are saved to admin_auth.json in the data
+	// directory, which overrides these and FUCKBASE_ADMIN_* until it is deleted.
+	adminUsername := flag.String("admin-username", "", "Admin username (FUCKBASE_ADMIN_USERNAME); overridden by admin_auth.json in the data directory, if present")
+	adminPassword := flag.String("admin-password", "", "Admin password (FUCKBASE_ADMIN_PASSWORD); overridden by admin_auth.json in the data directory, if present")
+	adminPasswordHash := flag.String("admin-password-hash", "", "Admin password hash from \"fuckbase hash-password\" (FUCKBASE_ADMIN_PASSWORD_HASH); overridden by admin_auth.json in the data directory, if present")
 	
 	// S3 flags
 	s3Endpoint := flag.String("s3-endpoint", "", "S3 endpoint URL")
@@ -66,6 +238,76 @@ func (c *ServerConfig) ParseFlags() {
 	s3SecretKey := flag.String("s3-secret-key", "", "S3 secret key")
 	s3Region := flag.String("s3-region", c.S3Config.Region, "S3 region")
 	backupInterval := flag.Int("backup-interval", c.BackupInterval, "Backup interval in minutes")
+
+	// S3 client flags
+	flag.BoolVar(&c.S3Config.UseSSL, "s3-use-ssl", c.S3Config.UseSSL, "Connect to S3 over HTTPS")
+	flag.StringVar(&c.S3Config.CABundle, "s3-ca-bundle", c.S3Config.CABundle, "PEM file of additional CA certificates trusted for S3 HTTPS")
+	flag.StringVar(&c.S3Config.BucketLookup, "s3-bucket-lookup", c.S3Config.BucketLookup, "S3 bucket addressing (auto, path, dns)")
+	flag.StringVar(&c.S3Config.SSE, "s3-sse", c.S3Config.SSE, "S3 server-side encryption (none, sse-s3, sse-kms)")
+	flag.StringVar(&c.S3Config.SSEKMSKeyID, "s3-sse-kms-key-id", c.S3Config.SSEKMSKeyID, "KMS key ID for sse-kms server-side encryption")
+	flag.IntVar(&c.S3Config.MaxRetries, "s3-max-retries", c.S3Config.MaxRetries, "Number of times a failed S3 operation is retried")
+	flag.DurationVar(&c.S3Config.RetryDelay, "s3-retry-delay", c.S3Config.RetryDelay, "Delay before the first S3 retry, doubled after each attempt")
+	flag.DurationVar(&c.S3Config.Timeout, "s3-timeout", c.S3Config.Timeout, "Timeout of each S3 operation attempt")
+
+	// Local backup storage flags
+	flag.StringVar(&c.BackupDir, "backup-dir", c.BackupDir, "Directory for local backups (used when S3 is not configured)")
+	backupReplicas := flag.String("backup-replicas", strings.Join(c.BackupReplicas, ","), "Comma-separated storage URLs to replicate backups to (s3://bucket?endpoint=..., file:///dir)")
+
+	// Backup retention flags
+	flag.IntVar(&c.Retention.KeepLast, "backup-keep-last", c.Retention.KeepLast, "Number of most recent backups to keep (0 disables)")
+	flag.IntVar(&c.Retention.KeepHourly, "backup-keep-hourly", c.Retention.KeepHourly, "Keep one backup per hour for this many hours (0 disables)")
+	flag.IntVar(&c.Retention.KeepDaily, "backup-keep-daily", c.Retention.KeepDaily, "Keep one backup per day for this many days (0 disables)")
+
+	// Backup compression flags
+	flag.StringVar(&c.Compression, "backup-compression", c.Compression, "Backup compression codec (none, gzip, zstd)")
+
+	// Restore on start flag
+	flag.StringVar(&c.RestoreOnStart, "restore-on-start", c.RestoreOnStart, "Restore before serving: 'latest' for the newest full backup, or a backup object name")
+
+	// Backup encryption flags
+	flag.StringVar(&c.Encryption.KeyFile, "backup-encryption-key-file", c.Encryption.KeyFile, "Path to the backup encryption key file")
+	flag.StringVar(&c.Encryption.KeyID, "backup-encryption-key-id", c.Encryption.KeyID, "Key ID recorded with encrypted backups (defaults to the key fingerprint)")
+
+	// Data encryption flags
+	flag.StringVar(&c.DataEncryption.KeyFile, "data-encryption-key-file", c.DataEncryption.KeyFile, "Path to the master key file of databases encrypted at rest")
+	flag.StringVar(&c.DataEncryption.KeyID, "data-encryption-key-id", c.DataEncryption.KeyID, "Key ID recorded with wrapped data keys (defaults to the key fingerprint)")
+
+	// TLS flags
+	flag.StringVar(&c.TLS.CertFile, "tls-cert", c.TLS.CertFile, "PEM certificate file; serves HTTPS when set with --tls-key")
+	flag.StringVar(&c.TLS.KeyFile, "tls-key", c.TLS.KeyFile, "PEM private key file of the TLS certificate")
+	flag.StringVar(&c.TLS.ClientCAFile, "tls-client-ca", c.TLS.ClientCAFile, "PEM CA certificates that client certificates are verified against")
+	flag.BoolVar(&c.TLS.RequireClientCert, "tls-require-client-cert", c.TLS.RequireClientCert, "Reject clients without a certificate signed by --tls-client-ca")
+	flag.StringVar(&c.TLS.ClientIdentities, "tls-client-identities", c.TLS.ClientIdentities, "JSON file mapping client certificate subjects to admin access or scopes")
+
+	// Rate limit flags
+	flag.Float64Var(&c.RateLimit.IPRead, "rate-limit-ip-read", c.RateLimit.IPRead, "Read requests per second per client IP (0 disables)")
+	flag.Float64Var(&c.RateLimit.IPWrite, "rate-limit-ip-write", c.RateLimit.IPWrite, "Write requests per second per client IP (0 disables)")
+	flag.Float64Var(&c.RateLimit.CredentialRead, "rate-limit-credential-read", c.RateLimit.CredentialRead, "Read requests per second per username or token (0 disables)")
+	flag.Float64Var(&c.RateLimit.CredentialWrite, "rate-limit-credential-write", c.RateLimit.CredentialWrite, "Write requests per second per username or token (0 disables)")
+	flag.Float64Var(&c.RateLimit.DatabaseRead, "rate-limit-database-read", c.RateLimit.DatabaseRead, "Read requests per second per database (0 disables)")
+	flag.Float64Var(&c.RateLimit.DatabaseWrite, "rate-limit-database-write", c.RateLimit.DatabaseWrite, "Write requests per second per database (0 disables)")
+	flag.IntVar(&c.RateLimit.LockoutThreshold, "auth-lockout-threshold", c.RateLimit.LockoutThreshold, "Failed authentications from a client IP that lock it out (0 disables)")
+	flag.DurationVar(&c.RateLimit.LockoutWindow, "auth-lockout-window", c.RateLimit.LockoutWindow, "Period failed authentications are counted over")
+	flag.DurationVar(&c.RateLimit.LockoutDuration, "auth-lockout-duration", c.RateLimit.LockoutDuration, "Length of an authentication lockout")
+
+	// Audit log flags
+	flag.StringVar(&c.Audit.File, "audit-log", c.Audit.File, "JSON-lines file recording administrative and data-changing operations (empty disables)")
+	flag.IntVar(&c.Audit.MaxSize, "audit-log-max-size", c.Audit.MaxSize, "Size in megabytes at which the audit log is rotated (0 disables)")
+	flag.IntVar(&c.Audit.MaxFiles, "audit-log-max-files", c.Audit.MaxFiles, "Number of rotated audit log files kept")
+	flag.BoolVar(&c.Audit.Writes, "audit-writes", c.Audit.Writes, "Also record set writes and imports in the audit log")
+
+	// Request flags
+	corsAllowedOrigins := flag.String("cors-allowed-origins", strings.Join(c.CORS.AllowedOrigins, ","), "Comma-separated origins allowed to call the API from browsers, or * for any")
+	flag.BoolVar(&c.CORS.AllowCredentials, "cors-allow-credentials", c.CORS.AllowCredentials, "Allow cross-origin requests with HTTP authentication from origins listed by name (never for *)")
+	flag.DurationVar(&c.CORS.MaxAge, "cors-max-age", c.CORS.MaxAge, "How long browsers may cache a CORS preflight response")
+	flag.IntVar(&c.MaxBodySize, "max-body-size", c.MaxBodySize, "Maximum request body in megabytes (0 disables)")
+	flag.IntVar(&c.MaxImportSize, "max-import-size", c.MaxImportSize, "Maximum /import request body in megabytes (0 disables)")
+
+	// JWT authentication flags
+	flag.StringVar(&c.JWT.KeysFile, "jwt-keys-file", c.JWT.KeysFile, "JWKS or PEM file of keys that verify JWT bearer tokens")
+	flag.StringVar(&c.JWT.Issuer, "jwt-issuer", c.JWT.Issuer, "Required issuer (iss) of JWT bearer tokens")
+	flag.StringVar(&c.JWT.Audience, "jwt-audience", c.JWT.Audience, "Required audience (aud) of JWT bearer tokens")
+	flag.StringVar(&c.JWT.ScopesClaim, "jwt-scopes-claim", c.JWT.ScopesClaim, "JWT claim holding the token's scopes")
 	
 	// Log flags
 	flag.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Log level (debug, info, warn, error)")
@@ -74,11 +316,7 @@ func (c *ServerConfig) ParseFlags() {
 	flag.Parse()
 	
 	// Update admin auth config if provided
-	if *adminUsername != "" && *adminPassword != "" {
-		c.AdminAuth.Username = *adminUsername
-		c.AdminAuth.Password = *adminPassword
-		c.AdminAuth.Enabled = true
-	}
+	c.AdminAuth.setCredentials(*adminUsername, *adminPassword, *adminPasswordHash)
 	
 	// Update S3 config if provided
 	if *s3Endpoint != "" && *s3Bucket != "" && *s3AccessKey != "" && *s3SecretKey != "" {
@@ -88,11 +326,16 @@ func (c *ServerConfig) ParseFlags() {
 		c.S3Config.SecretKey = *s3SecretKey
 		c.S3Config.Region = *s3Region
 		c.S3Config.Enabled = true
-		c.BackupInterval = *backupInterval
 	}
+
+	// Defaults to the value from the environment, so it can be applied unconditionally
+	c.BackupInterval = *backupInterval
+	c.BackupReplicas = splitList(*backupReplicas)
+	c.CORS.AllowedOrigins = splitList(*corsAllowedOrigins)
 }
 
 // ParseEnv parses environment variables and updates the configuration
+// Admin credentials are only enabled by Parse, once both are applied.
 func (c *ServerConfig) ParseEnv() {
 	// Server config
 	if port := os.Getenv("FUCKBASE_PORT"); port != "" {
@@ -110,13 +353,11 @@ func (c *ServerConfig) ParseEnv() {
 	}
 	
 	// Admin auth config
+	// Overridden by admin_auth.json in the data directory once credentials are rotated at runtime
 	adminUsername := os.Getenv("FUCKBASE_ADMIN_USERNAME")
 	adminPassword := os.Getenv("FUCKBASE_ADMIN_PASSWORD")
-	if adminUsername != "" && adminPassword != "" {
-		c.AdminAuth.Username = adminUsername
-		c.AdminAuth.Password = adminPassword
-		c.AdminAuth.Enabled = true
-	}
+	adminPasswordHash := os.Getenv("FUCKBASE_ADMIN_PASSWORD_HASH")
+	c.AdminAuth.setCredentials(adminUsername, adminPassword, adminPasswordHash)
 	
 	// S3 config
 	s3Endpoint := os.Getenv("FUCKBASE_S3_ENDPOINT")
@@ -136,12 +377,243 @@ func (c *ServerConfig) ParseEnv() {
 		}
 	}
 	
+	// S3 client config
+	if useSSL := os.Getenv("FUCKBASE_S3_USE_SSL"); useSSL != "" {
+		if b, err := strconv.ParseBool(useSSL); err == nil {
+			c.S3Config.UseSSL = b
+		}
+	}
+
+	if caBundle := os.Getenv("FUCKBASE_S3_CA_BUNDLE"); caBundle != "" {
+		c.S3Config.CABundle = caBundle
+	}
+
+	if bucketLookup := os.Getenv("FUCKBASE_S3_BUCKET_LOOKUP"); bucketLookup != "" {
+		c.S3Config.BucketLookup = bucketLookup
+	}
+
+	if sse := os.Getenv("FUCKBASE_S3_SSE"); sse != "" {
+		c.S3Config.SSE = sse
+	}
+
+	if kmsKeyID := os.Getenv("FUCKBASE_S3_SSE_KMS_KEY_ID"); kmsKeyID != "" {
+		c.S3Config.SSEKMSKeyID = kmsKeyID
+	}
+
+	if maxRetries := os.Getenv("FUCKBASE_S3_MAX_RETRIES"); maxRetries != "" {
+		if n, err := strconv.Atoi(maxRetries); err == nil {
+			c.S3Config.MaxRetries = n
+		}
+	}
+
+	if retryDelay := os.Getenv("FUCKBASE_S3_RETRY_DELAY"); retryDelay != "" {
+		if d, err := time.ParseDuration(retryDelay); err == nil {
+			c.S3Config.RetryDelay = d
+		}
+	}
+
+	if timeout := os.Getenv("FUCKBASE_S3_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.S3Config.Timeout = d
+		}
+	}
+
 	if backupInterval := os.Getenv("FUCKBASE_BACKUP_INTERVAL"); backupInterval != "" {
 		if bi, err := strconv.Atoi(backupInterval); err == nil {
 			c.BackupInterval = bi
 		}
 	}
 	
+	// Local backup storage config
+	if backupDir := os.Getenv("FUCKBASE_BACKUP_DIR"); backupDir != "" {
+		c.BackupDir = backupDir
+	}
+
+	if backupReplicas := os.Getenv("FUCKBASE_BACKUP_REPLICAS"); backupReplicas != "" {
+		c.BackupReplicas = splitList(backupReplicas)
+	}
+
+	// Backup retention config
+	if keepLast := os.Getenv("FUCKBASE_BACKUP_KEEP_LAST"); keepLast != "" {
+		if n, err := strconv.Atoi(keepLast); err == nil {
+			c.Retention.KeepLast = n
+		}
+	}
+
+	if keepHourly := os.Getenv("FUCKBASE_BACKUP_KEEP_HOURLY"); keepHourly != "" {
+		if n, err := strconv.Atoi(keepHourly); err == nil {
+			c.Retention.KeepHourly = n
+		}
+	}
+
+	if keepDaily := os.Getenv("FUCKBASE_BACKUP_KEEP_DAILY"); keepDaily != "" {
+		if n, err := strconv.Atoi(keepDaily); err == nil {
+			c.Retention.KeepDaily = n
+		}
+	}
+
+	// Backup compression config
+	if compression := os.Getenv("FUCKBASE_BACKUP_COMPRESSION"); compression != "" {
+		c.Compression = compression
+	}
+
+	// Restore on start config
+	if restoreOnStart := os.Getenv("FUCKBASE_RESTORE_ON_START"); restoreOnStart != "" {
+		c.RestoreOnStart = restoreOnStart
+	}
+
+	// Backup encryption config
+	if keyFile := os.Getenv("FUCKBASE_BACKUP_ENCRYPTION_KEY_FILE"); keyFile != "" {
+		c.Encryption.KeyFile = keyFile
+	}
+
+	if key := os.Getenv("FUCKBASE_BACKUP_ENCRYPTION_KEY"); key != "" {
+		c.Encryption.Key = key
+	}
+
+	if keyID := os.Getenv("FUCKBASE_BACKUP_ENCRYPTION_KEY_ID"); keyID != "" {
+		c.Encryption.KeyID = keyID
+	}
+
+	// Data encryption config
+	if keyFile := os.Getenv("FUCKBASE_DATA_ENCRYPTION_KEY_FILE"); keyFile != "" {
+		c.DataEncryption.KeyFile = keyFile
+	}
+
+	if key := os.Getenv("FUCKBASE_DATA_ENCRYPTION_KEY"); key != "" {
+		c.DataEncryption.Key = key
+	}
+
+	if keyID := os.Getenv("FUCKBASE_DATA_ENCRYPTION_KEY_ID"); keyID != "" {
+		c.DataEncryption.KeyID = keyID
+	}
+
+	// TLS config
+	if certFile := os.Getenv("FUCKBASE_TLS_CERT"); certFile != "" {
+		c.TLS.CertFile = certFile
+	}
+
+	if keyFile := os.Getenv("FUCKBASE_TLS_KEY"); keyFile != "" {
+		c.TLS.KeyFile = keyFile
+	}
+
+	if clientCA := os.Getenv("FUCKBASE_TLS_CLIENT_CA"); clientCA != "" {
+		c.TLS.ClientCAFile = clientCA
+	}
+
+	if requireClientCert := os.Getenv("FUCKBASE_TLS_REQUIRE_CLIENT_CERT"); requireClientCert != "" {
+		if b, err := strconv.ParseBool(requireClientCert); err == nil {
+			c.TLS.RequireClientCert = b
+		}
+	}
+
+	if identities := os.Getenv("FUCKBASE_TLS_CLIENT_IDENTITIES"); identities != "" {
+		c.TLS.ClientIdentities = identities
+	}
+
+	// Rate limit config
+	for name, dest := range map[string]*float64{
+		"FUCKBASE_RATE_LIMIT_IP_READ":          &c.RateLimit.IPRead,
+		"FUCKBASE_RATE_LIMIT_IP_WRITE":         &c.RateLimit.IPWrite,
+		"FUCKBASE_RATE_LIMIT_CREDENTIAL_READ":  &c.RateLimit.CredentialRead,
+		"FUCKBASE_RATE_LIMIT_CREDENTIAL_WRITE": &c.RateLimit.CredentialWrite,
+		"FUCKBASE_RATE_LIMIT_DATABASE_READ":    &c.RateLimit.DatabaseRead,
+		"FUCKBASE_RATE_LIMIT_DATABASE_WRITE":   &c.RateLimit.DatabaseWrite,
+	} {
+		if value := os.Getenv(name); value != "" {
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				*dest = f
+			}
+		}
+	}
+
+	if threshold := os.Getenv("FUCKBASE_AUTH_LOCKOUT_THRESHOLD"); threshold != "" {
+		if n, err := strconv.Atoi(threshold); err == nil {
+			c.RateLimit.LockoutThreshold = n
+		}
+	}
+
+	if window := os.Getenv("FUCKBASE_AUTH_LOCKOUT_WINDOW"); window != "" {
+		if d, err := time.ParseDuration(window); err == nil {
+			c.RateLimit.LockoutWindow = d
+		}
+	}
+
+	if duration := os.Getenv("FUCKBASE_AUTH_LOCKOUT_DURATION"); duration != "" {
+		if d, err := time.ParseDuration(duration); err == nil {
+			c.RateLimit.LockoutDuration = d
+		}
+	}
+
+	// Audit log config
+	if auditLog := os.Getenv("FUCKBASE_AUDIT_LOG"); auditLog != "" {
+		c.Audit.File = auditLog
+	}
+
+	if maxSize := os.Getenv("FUCKBASE_AUDIT_LOG_MAX_SIZE"); maxSize != "" {
+		if n, err := strconv.Atoi(maxSize); err == nil {
+			c.Audit.MaxSize = n
+		}
+	}
+
+	if maxFiles := os.Getenv("FUCKBASE_AUDIT_LOG_MAX_FILES"); maxFiles != "" {
+		if n, err := strconv.Atoi(maxFiles); err == nil {
+			c.Audit.MaxFiles = n
+		}
+	}
+
+	if writes := os.Getenv("FUCKBASE_AUDIT_WRITES"); writes != "" {
+		if b, err := strconv.ParseBool(writes); err == nil {
+			c.Audit.Writes = b
+		}
+	}
+
+	// Request config
+	if origins := os.Getenv("FUCKBASE_CORS_ALLOWED_ORIGINS"); origins != "" {
+		c.CORS.AllowedOrigins = splitList(origins)
+	}
+
+	if allowCredentials := os.Getenv("FUCKBASE_CORS_ALLOW_CREDENTIALS"); allowCredentials != "" {
+		if b, err := strconv.ParseBool(allowCredentials); err == nil {
+			c.CORS.AllowCredentials = b
+		}
+	}
+
+	if maxAge := os.Getenv("FUCKBASE_CORS_MAX_AGE"); maxAge != "" {
+		if d, err := time.ParseDuration(maxAge); err == nil {
+			c.CORS.MaxAge = d
+		}
+	}
+
+	if maxBodySize := os.Getenv("FUCKBASE_MAX_BODY_SIZE"); maxBodySize != "" {
+		if n, err := strconv.Atoi(maxBodySize); err == nil {
+			c.MaxBodySize = n
+		}
+	}
+
+	if maxImportSize := os.Getenv("FUCKBASE_MAX_IMPORT_SIZE"); maxImportSize != "" {
+		if n, err := strconv.Atoi(maxImportSize); err == nil {
+			c.MaxImportSize = n
+		}
+	}
+
+	// JWT authentication config
+	if keysFile := os.Getenv("FUCKBASE_JWT_KEYS_FILE"); keysFile != "" {
+		c.JWT.KeysFile = keysFile
+	}
+
+	if issuer := os.Getenv("FUCKBASE_JWT_ISSUER"); issuer != "" {
+		c.JWT.Issuer = issuer
+	}
+
+	if audience := os.Getenv("FUCKBASE_JWT_AUDIENCE"); audience != "" {
+		c.JWT.Audience = audience
+	}
+
+	if scopesClaim := os.Getenv("FUCKBASE_JWT_SCOPES_CLAIM"); scopesClaim != "" {
+		c.JWT.ScopesClaim = scopesClaim
+	}
+
 	// Log config
 	if logLevel := os.Getenv("FUCKBASE_LOG_LEVEL"); logLevel != "" {
 		c.LogLevel = logLevel
@@ -153,8 +625,24 @@ func (c *ServerConfig) ParseEnv() {
 }
 
 // Parse parses both command line flags and environment variables
-// Command line flags take precedence over environment variables
-func (c *ServerConfig) Parse() {
+// Command line flags take precedence over environment variables. The admin password is
+// hashed once both are applied; invalid admin credentials are an error.
+func (c *ServerConfig) Parse() error {
 	c.ParseEnv()
 	c.ParseFlags()
-}
\ No newline at end of file
+	if err := c.AdminAuth.enable(); err != nil {
+		return fmt.Errorf("invalid admin credentials: %w", err)
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
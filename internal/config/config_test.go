@@ -3,6 +3,9 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/credential"
 )
 
 func TestNewServerConfig(t *testing.T) {
@@ -54,6 +57,9 @@ func TestParseEnv(t *testing.T) {
 	// Create a new config and parse environment variables
 	cfg := NewServerConfig()
 	cfg.ParseEnv()
+	if err := cfg.AdminAuth.enable(); err != nil {
+		t.Fatalf("Failed to enable admin auth: %v", err)
+	}
 
 	// Check parsed values
 	if cfg.Port != 9090 {
@@ -65,7 +71,7 @@ func TestParseEnv(t *testing.T) {
 	if cfg.DataDir != "/tmp/data" {
 		t.Errorf("Expected data directory to be '/tmp/data', got '%s'", cfg.DataDir)
 	}
-	if !cfg.AdminAuth.Enabled || cfg.AdminAuth.Username != "admin" || cfg.AdminAuth.Password != "password" {
+	if !cfg.AdminAuth.Enabled || cfg.AdminAuth.Username != "admin" || !credential.VerifyPassword(cfg.AdminAuth.PasswordHash, "password") {
 		t.Errorf("Expected admin auth to be enabled with username 'admin' and password 'password'")
 	}
 	if !cfg.S3Config.Enabled || cfg.S3Config.Endpoint != "https://s3.example.com" || cfg.S3Config.Bucket != "my-bucket" || cfg.S3Config.AccessKey != "access-key" || cfg.S3Config.SecretKey != "secret-key" || cfg.S3Config.Region != "us-west-2" {
@@ -150,4 +156,230 @@ func TestPartialEnvConfig(t *testing.T) {
 	os.Unsetenv("FUCKBASE_PORT")
 	os.Unsetenv("FUCKBASE_ADMIN_USERNAME")
 	os.Unsetenv("FUCKBASE_S3_ENDPOINT")
-}
\ No newline at end of file
+}
+func TestRetentionEnv(t *testing.T) {
+	os.Setenv("FUCKBASE_BACKUP_KEEP_LAST", "5")
+	os.Setenv("FUCKBASE_BACKUP_KEEP_HOURLY", "24")
+	os.Setenv("FUCKBASE_BACKUP_KEEP_DAILY", "30")
+
+	cfg := NewServerConfig()
+	if cfg.Retention.Enabled() {
+		t.Errorf("Expected retention to be disabled by default")
+	}
+	cfg.ParseEnv()
+
+	if cfg.Retention.KeepLast != 5 || cfg.Retention.KeepHourly != 24 || cfg.Retention.KeepDaily != 30 {
+		t.Errorf("Expected retention 5/24/30, got %d/%d/%d", cfg.Retention.KeepLast, cfg.Retention.KeepHourly, cfg.Retention.KeepDaily)
+	}
+	if !cfg.Retention.Enabled() {
+		t.Errorf("Expected retention to be enabled")
+	}
+
+	os.Unsetenv("FUCKBASE_BACKUP_KEEP_LAST")
+	os.Unsetenv("FUCKBASE_BACKUP_KEEP_HOURLY")
+	os.Unsetenv("FUCKBASE_BACKUP_KEEP_DAILY")
+}
+
+func TestRestoreOnStartEnv(t *testing.T) {
+	cfg := NewServerConfig()
+	if cfg.RestoreOnStart != "" {
+		t.Errorf("Expected restore on start to be disabled by default, got %s", cfg.RestoreOnStart)
+	}
+
+	os.Setenv("FUCKBASE_RESTORE_ON_START", RestoreLatest)
+	cfg.ParseEnv()
+	os.Unsetenv("FUCKBASE_RESTORE_ON_START")
+
+	if cfg.RestoreOnStart != RestoreLatest {
+		t.Errorf("Expected restore on start %s, got %s", RestoreLatest, cfg.RestoreOnStart)
+	}
+}
+
+func TestS3ClientEnv(t *testing.T) {
+	cfg := NewServerConfig()
+	if cfg.S3Config.UseSSL || cfg.S3Config.BucketLookup != "auto" || cfg.S3Config.SSE != "none" || cfg.S3Config.MaxRetries != 3 {
+		t.Errorf("Unexpected S3 client defaults: %+v", cfg.S3Config)
+	}
+
+	os.Setenv("FUCKBASE_S3_USE_SSL", "true")
+	os.Setenv("FUCKBASE_S3_CA_BUNDLE", "/etc/ssl/minio-ca.pem")
+	os.Setenv("FUCKBASE_S3_BUCKET_LOOKUP", "path")
+	os.Setenv("FUCKBASE_S3_SSE", "sse-kms")
+	os.Setenv("FUCKBASE_S3_SSE_KMS_KEY_ID", "backup-key")
+	os.Setenv("FUCKBASE_S3_MAX_RETRIES", "5")
+	os.Setenv("FUCKBASE_S3_RETRY_DELAY", "2s")
+	os.Setenv("FUCKBASE_S3_TIMEOUT", "invalid")
+	cfg.ParseEnv()
+
+	s3 := cfg.S3Config
+	if !s3.UseSSL || s3.CABundle != "/etc/ssl/minio-ca.pem" || s3.BucketLookup != "path" || s3.SSE != "sse-kms" || s3.SSEKMSKeyID != "backup-key" {
+		t.Errorf("Unexpected S3 client config: %+v", s3)
+	}
+	if s3.MaxRetries != 5 || s3.RetryDelay != 2*time.Second {
+		t.Errorf("Expected 5 retries from 2s, got %d from %s", s3.MaxRetries, s3.RetryDelay)
+	}
+	if s3.Timeout != time.Minute {
+		t.Errorf("Expected invalid timeout to be ignored, got %s", s3.Timeout)
+	}
+
+	os.Unsetenv("FUCKBASE_S3_USE_SSL")
+	os.Unsetenv("FUCKBASE_S3_CA_BUNDLE")
+	os.Unsetenv("FUCKBASE_S3_BUCKET_LOOKUP")
+	os.Unsetenv("FUCKBASE_S3_SSE")
+	os.Unsetenv("FUCKBASE_S3_SSE_KMS_KEY_ID")
+	os.Unsetenv("FUCKBASE_S3_MAX_RETRIES")
+	os.Unsetenv("FUCKBASE_S3_RETRY_DELAY")
+	os.Unsetenv("FUCKBASE_S3_TIMEOUT")
+}
+
+func TestAdminPasswordHashEnv(t *testing.T) {
+	hash, err := credential.HashPassword("password")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	t.Setenv("FUCKBASE_ADMIN_USERNAME", "admin")
+	t.Setenv("FUCKBASE_ADMIN_PASSWORD", "")
+	t.Setenv("FUCKBASE_ADMIN_PASSWORD_HASH", hash)
+	cfg := NewServerConfig()
+	cfg.ParseEnv()
+	if err := cfg.AdminAuth.enable(); err != nil || !cfg.AdminAuth.Enabled || cfg.AdminAuth.PasswordHash != hash {
+		t.Errorf("Expected admin auth to use the given hash, got %+v", cfg.AdminAuth)
+	}
+
+	// Later credentials replace earlier ones before the password is hashed
+	auth := &AdminAuthConfig{}
+	auth.setCredentials("admin", "password", "")
+	auth.setCredentials("root", "", hash)
+	if err := auth.enable(); err != nil || auth.Username != "root" || auth.PasswordHash != hash {
+		t.Errorf("Expected the later credentials to be used, got %+v (%v)", auth, err)
+	}
+
+	// A value that is not a hash is an error rather than leaving admin auth disabled
+	auth = &AdminAuthConfig{}
+	auth.setCredentials("admin", "", "password")
+	if err := auth.enable(); err == nil || auth.Enabled {
+		t.Errorf("Expected an invalid hash to be rejected, got %v", err)
+	}
+}
+
+func TestJWTEnv(t *testing.T) {
+	cfg := NewServerConfig()
+	if cfg.JWT.Enabled() || cfg.JWT.ScopesClaim != "fuckbase" {
+		t.Errorf("Unexpected JWT defaults: %+v", cfg.JWT)
+	}
+
+	t.Setenv("FUCKBASE_JWT_KEYS_FILE", "/etc/fuckbase/jwks.json")
+	t.Setenv("FUCKBASE_JWT_ISSUER", "https://idp.example.com")
+	t.Setenv("FUCKBASE_JWT_AUDIENCE", "fuckbase")
+	t.Setenv("FUCKBASE_JWT_SCOPES_CLAIM", "permissions")
+	cfg.ParseEnv()
+
+	jwt := cfg.JWT
+	if !jwt.Enabled() || jwt.KeysFile != "/etc/fuckbase/jwks.json" || jwt.Issuer != "https://idp.example.com" || jwt.Audience != "fuckbase" || jwt.ScopesClaim != "permissions" {
+		t.Errorf("Unexpected JWT config: %+v", jwt)
+	}
+}
+
+func TestTLSEnv(t *testing.T) {
+	cfg := NewServerConfig()
+	if cfg.TLS.Enabled() {
+		t.Errorf("Expected TLS to be disabled by default")
+	}
+
+	t.Setenv("FUCKBASE_TLS_CERT", "/etc/fuckbase/server.pem")
+	t.Setenv("FUCKBASE_TLS_KEY", "/etc/fuckbase/server-key.pem")
+	t.Setenv("FUCKBASE_TLS_CLIENT_CA", "/etc/fuckbase/ca.pem")
+	t.Setenv("FUCKBASE_TLS_REQUIRE_CLIENT_CERT", "true")
+	t.Setenv("FUCKBASE_TLS_CLIENT_IDENTITIES", "/etc/fuckbase/identities.json")
+	cfg.ParseEnv()
+
+	tls := cfg.TLS
+	if !tls.Enabled() || tls.ClientCAFile != "/etc/fuckbase/ca.pem" || !tls.RequireClientCert || tls.ClientIdentities != "/etc/fuckbase/identities.json" {
+		t.Errorf("Unexpected TLS config: %+v", tls)
+	}
+}
+
+func TestRateLimitEnv(t *testing.T) {
+	cfg := NewServerConfig()
+	limits := cfg.RateLimit
+	if limits.IPRead != 0 || limits.LockoutThreshold != 10 || limits.LockoutWindow != time.Minute || limits.LockoutDuration != 5*time.Minute {
+		t.Errorf("Unexpected rate limit defaults: %+v", limits)
+	}
+
+	t.Setenv("FUCKBASE_RATE_LIMIT_IP_READ", "50")
+	t.Setenv("FUCKBASE_RATE_LIMIT_DATABASE_WRITE", "2.5")
+	t.Setenv("FUCKBASE_RATE_LIMIT_CREDENTIAL_WRITE", "invalid")
+	t.Setenv("FUCKBASE_AUTH_LOCKOUT_THRESHOLD", "5")
+	t.Setenv("FUCKBASE_AUTH_LOCKOUT_DURATION", "15m")
+	cfg.ParseEnv()
+
+	if limits.IPRead != 50 || limits.DatabaseWrite != 2.5 || limits.CredentialWrite != 0 {
+		t.Errorf("Unexpected rates: %+v", limits)
+	}
+	if limits.LockoutThreshold != 5 || limits.LockoutDuration != 15*time.Minute {
+		t.Errorf("Unexpected lockout: %+v", limits)
+	}
+}
+
+func TestAuditEnv(t *testing.T) {
+	cfg := NewServerConfig()
+	if cfg.Audit.Enabled() || cfg.Audit.MaxSize != 100 || cfg.Audit.MaxFiles != 10 {
+		t.Errorf("Unexpected audit defaults: %+v", cfg.Audit)
+	}
+
+	t.Setenv("FUCKBASE_AUDIT_LOG", "/var/log/fuckbase/audit.log")
+	t.Setenv("FUCKBASE_AUDIT_LOG_MAX_SIZE", "20")
+	t.Setenv("FUCKBASE_AUDIT_LOG_MAX_FILES", "invalid")
+	t.Setenv("FUCKBASE_AUDIT_WRITES", "true")
+	cfg.ParseEnv()
+
+	if !cfg.Audit.Enabled() || cfg.Audit.File != "/var/log/fuckbase/audit.log" {
+		t.Errorf("Expected the audit log to be enabled, got %+v", cfg.Audit)
+	}
+	if cfg.Audit.MaxSize != 20 || cfg.Audit.MaxFiles != 10 || !cfg.Audit.Writes {
+		t.Errorf("Unexpected audit config: %+v", cfg.Audit)
+	}
+}
+
+func TestRequestEnv(t *testing.T) {
+	cfg := NewServerConfig()
+	if cfg.CORS.Enabled() || cfg.CORS.MaxAge != 10*time.Minute || cfg.MaxBodySize != 10 || cfg.MaxImportSize != 0 {
+		t.Errorf("Unexpected request defaults: %+v, %d, %d", cfg.CORS, cfg.MaxBodySize, cfg.MaxImportSize)
+	}
+
+	t.Setenv("FUCKBASE_CORS_ALLOWED_ORIGINS", "https://app.example.com, https://admin.example.com")
+	t.Setenv("FUCKBASE_CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("FUCKBASE_CORS_MAX_AGE", "invalid")
+	t.Setenv("FUCKBASE_MAX_BODY_SIZE", "1")
+	t.Setenv("FUCKBASE_MAX_IMPORT_SIZE", "512")
+	cfg.ParseEnv()
+
+	if len(cfg.CORS.AllowedOrigins) != 2 || cfg.CORS.AllowedOrigins[1] != "https://admin.example.com" {
+		t.Errorf("Unexpected allowed origins: %q", cfg.CORS.AllowedOrigins)
+	}
+	if !cfg.CORS.AllowCredentials || cfg.CORS.MaxAge != 10*time.Minute {
+		t.Errorf("Unexpected CORS config: %+v", cfg.CORS)
+	}
+	if cfg.MaxBodySize != 1 || cfg.MaxImportSize != 512 {
+		t.Errorf("Expected body limits 1 and 512, got %d and %d", cfg.MaxBodySize, cfg.MaxImportSize)
+	}
+}
+
+func TestDataEncryptionEnv(t *testing.T) {
+	cfg := NewServerConfig()
+	if cfg.DataEncryption.Enabled() {
+		t.Errorf("Expected data encryption to be disabled by default")
+	}
+
+	t.Setenv("FUCKBASE_DATA_ENCRYPTION_KEY_FILE", "/etc/fuckbase/data.key")
+	t.Setenv("FUCKBASE_DATA_ENCRYPTION_KEY_ID", "data-2026")
+	cfg.ParseEnv()
+
+	if !cfg.DataEncryption.Enabled() || cfg.DataEncryption.KeyFile != "/etc/fuckbase/data.key" || cfg.DataEncryption.KeyID != "data-2026" {
+		t.Errorf("Unexpected data encryption config: %+v", cfg.DataEncryption)
+	}
+	if cfg.Encryption.Enabled() {
+		t.Errorf("Expected backup encryption to be configured separately")
+	}
+}
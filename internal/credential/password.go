@@ -0,0 +1,173 @@
+package credential
+
+import (
+	"container/list"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Password hash parameters
+// The iteration count follows the OWASP recommendation for PBKDF2-HMAC-SHA256.
+const (
+	hashScheme     = "pbkdf2-sha256"
+	hashIterations = 600000
+	saltLength     = 16
+	keyLength      = 32
+)
+
+// verifiedCacheSize is the number of hashes whose last verified password is cached
+const verifiedCacheSize = 1024
+
+// verified caches a digest of the last password verified against each hash, so repeated
+// requests with the right password skip the key derivation. Wrong passwords always pay
+// the full cost. Every user has a hash of their own, so entries are per user.
+var verified = newVerifiedCache(verifiedCacheSize)
+
+// verifiedCache is a least recently used cache of password digests by hash
+type verifiedCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // Most recently used first
+	entries map[string]*list.Element
+}
+
+// verifiedEntry is the digest of the password last verified against a hash
+type verifiedEntry struct {
+	hash   string
+	digest [sha256.Size]byte
+}
+
+// newVerifiedCache creates a cache holding up to size hashes
+func newVerifiedCache(size int) *verifiedCache {
+	return &verifiedCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// matches reports whether digest is the one cached for hash, in constant time
+func (c *verifiedCache) matches(hash string, digest [sha256.Size]byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[hash]
+	if !ok {
+		return false
+	}
+	c.order.MoveToFront(elem)
+	last := elem.Value.(*verifiedEntry).digest
+	return subtle.ConstantTimeCompare(last[:], digest[:]) == 1
+}
+
+// store caches digest for hash, evicting the least recently used hash if the cache is full
+func (c *verifiedCache) store(hash string, digest [sha256.Size]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[hash]; ok {
+		elem.Value.(*verifiedEntry).digest = digest
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[hash] = c.order.PushFront(&verifiedEntry{hash: hash, digest: digest})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*verifiedEntry).hash)
+	}
+}
+
+// forget removes the entry of hash
+func (c *verifiedCache) forget(hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[hash]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, hash)
+	}
+}
+
+// HashPassword returns a salted PBKDF2 hash of a password
+// The hash has the form "pbkdf2-sha256$<iterations>$<salt>$<key>" with base64 salt and key.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, hashIterations, keyLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	return fmt.Sprintf("%s$%d$%s$%s", hashScheme, hashIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// IsPasswordHash reports whether a string is a password hash produced by HashPassword
+func IsPasswordHash(s string) bool {
+	_, _, _, err := parseHash(s)
+	return err == nil
+}
+
+// VerifyPassword reports whether a password matches a hash, in constant time
+// Malformed hashes never match.
+func VerifyPassword(hash string, password string) bool {
+	iterations, salt, key, err := parseHash(hash)
+	if err != nil {
+		return false
+	}
+
+	digest := sha256.Sum256([]byte(hash + "\x00" + password))
+	if verified.matches(hash, digest) {
+		return true
+	}
+
+	derived, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(key))
+	if err != nil || subtle.ConstantTimeCompare(derived, key) != 1 {
+		return false
+	}
+
+	verified.store(hash, digest)
+	return true
+}
+
+// ForgetPassword drops the cached verification of a hash
+// It is called when the user holding the hash is removed or given new credentials, so the
+// old password is not kept in memory.
+func ForgetPassword(hash string) {
+	verified.forget(hash)
+}
+
+// EqualStrings compares two strings in constant time
+func EqualStrings(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// parseHash splits a password hash into its iteration count, salt and key
+func parseHash(hash string) (int, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != hashScheme {
+		return 0, nil, nil, fmt.Errorf("unsupported password hash")
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return 0, nil, nil, fmt.Errorf("invalid iteration count: %s", parts[1])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil || len(salt) == 0 {
+		return 0, nil, nil, fmt.Errorf("invalid salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return 0, nil, nil, fmt.Errorf("invalid key")
+	}
+
+	return iterations, salt, key, nil
+}
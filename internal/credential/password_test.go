@@ -0,0 +1,96 @@
+package credential
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$600000$") || strings.Contains(hash, "secret") {
+		t.Errorf("Unexpected hash: %s", hash)
+	}
+	if !IsPasswordHash(hash) {
+		t.Errorf("Expected %s to be recognized as a hash", hash)
+	}
+
+	// Each hash has its own salt
+	other, _ := HashPassword("secret")
+	if other == hash {
+		t.Errorf("Expected different hashes for the same password")
+	}
+
+	for _, s := range []string{"", "secret", "pbkdf2-sha256$0$c2FsdA$a2V5", "md5$1$c2FsdA$a2V5", "pbkdf2-sha256$1$!!$a2V5"} {
+		if IsPasswordHash(s) {
+			t.Errorf("Expected %q not to be recognized as a hash", s)
+		}
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	hash, _ := HashPassword("secret")
+
+	// Twice, so the second check is answered from the cache
+	for i := 0; i < 2; i++ {
+		if !VerifyPassword(hash, "secret") {
+			t.Errorf("Expected the right password to match")
+		}
+		if VerifyPassword(hash, "wrong") {
+			t.Errorf("Expected a wrong password not to match")
+		}
+	}
+
+	// A cached password for one hash does not match another
+	other, _ := HashPassword("other")
+	if VerifyPassword(other, "secret") {
+		t.Errorf("Expected the password not to match another hash")
+	}
+
+	if VerifyPassword("secret", "secret") {
+		t.Errorf("Expected a plaintext password never to match")
+	}
+}
+
+func TestForgetPassword(t *testing.T) {
+	hash, _ := HashPassword("secret")
+	VerifyPassword(hash, "secret")
+	if _, ok := verified.entries[hash]; !ok {
+		t.Fatalf("Expected the verified password to be cached")
+	}
+
+	ForgetPassword(hash)
+	if _, ok := verified.entries[hash]; ok {
+		t.Errorf("Expected the cached password to be forgotten")
+	}
+	if !VerifyPassword(hash, "secret") {
+		t.Errorf("Expected the password to match after being forgotten")
+	}
+}
+
+func TestVerifiedCacheEviction(t *testing.T) {
+	cache := newVerifiedCache(2)
+	digest := func(s string) [32]byte { return sha256.Sum256([]byte(s)) }
+
+	cache.store("a", digest("a"))
+	cache.store("b", digest("b"))
+	cache.matches("a", digest("a"))
+	cache.store("c", digest("c"))
+
+	// The least recently used hash is evicted
+	if cache.matches("b", digest("b")) || !cache.matches("a", digest("a")) || !cache.matches("c", digest("c")) {
+		t.Errorf("Expected b to be evicted and a and c to be kept")
+	}
+	if cache.order.Len() != 2 || len(cache.entries) != 2 {
+		t.Errorf("Expected the cache to hold 2 entries, got %d", len(cache.entries))
+	}
+}
+
+func TestEqualStrings(t *testing.T) {
+	if !EqualStrings("admin", "admin") || EqualStrings("admin", "Admin") || EqualStrings("admin", "admin2") {
+		t.Errorf("Unexpected comparison results")
+	}
+}
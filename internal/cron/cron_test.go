@@ -0,0 +1,80 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// A Tuesday
+	base := time.Date(2025, 3, 18, 14, 9, 47, 0, time.UTC)
+
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2025, 3, 18, 14, 10, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, 3, 18, 15, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 3, 19, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2025, 3, 23, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 3, 18, 14, 15, 0, 0, time.UTC)},
+		{"30 3 * * *", time.Date(2025, 3, 19, 3, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2025, 3, 18, 17, 0, 0, 0, time.UTC)},
+		{"0 0 * * mon-fri", time.Date(2025, 3, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 3, 23, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Day of month or day of week when both are restricted
+		{"0 0 1 * fri", time.Date(2025, 3, 21, 0, 0, 0, 0, time.UTC)},
+		{"@every 90m", base.Add(90 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", tt.spec, err)
+			continue
+		}
+		if next := schedule.Next(base); !next.Equal(tt.expected) {
+			t.Errorf("Expected next run of %q to be %v, got %v", tt.spec, tt.expected, next)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@sometimes",
+		"@every soon",
+		"@every 10s",
+	}
+
+	for _, spec := range specs {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Expected error parsing %q", spec)
+		}
+	}
+}
+
+func TestNextNoMatch(t *testing.T) {
+	schedule, err := Parse("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Expected no next run, got %v", next)
+	}
+}
@@ -1,15 +1,53 @@
 package database
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync"
+
+	"github.com/ssig33/fuckbase/internal/credential"
 )
 
 // AuthConfig represents the authentication configuration for a database
+// Only a salted hash of the password is kept, so it is safe to write to backups.
 type AuthConfig struct {
-	Username string
-	Password string
-	Enabled  bool
+	Username     string
+	PasswordHash string
+	Enabled      bool
+	Users        map[string]User `json:",omitempty"` // Additional users by name
+}
+
+// NewAuthConfig creates an enabled authentication configuration, hashing the password
+func NewAuthConfig(username, password string) (*AuthConfig, error) {
+	hash, err := credential.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthConfig{Username: username, PasswordHash: hash, Enabled: true}, nil
+}
+
+// UnmarshalJSON reads an authentication configuration
+// Configurations written before hashes were stored hold a plaintext Password, which is
+// hashed here so it is never kept in memory or written out again.
+func (a *AuthConfig) UnmarshalJSON(data []byte) error {
+	type authConfig AuthConfig
+	var legacy struct {
+		authConfig
+		Password string
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+
+	*a = AuthConfig(legacy.authConfig)
+	if a.PasswordHash == "" && legacy.Password != "" {
+		hash, err := credential.HashPassword(legacy.Password)
+		if err != nil {
+			return fmt.Errorf("failed to hash legacy password: %w", err)
+		}
+		a.PasswordHash = hash
+	}
+	return nil
 }
 
 // IndexType represents the type of an index
@@ -42,6 +80,7 @@ type Database struct {
 	Sets    map[string]*Set
 	Indexes map[string]Index
 	Auth    *AuthConfig
+	keys    *dataKeyring // Data keys sealing the values, if the database is encrypted
 	mu      sync.RWMutex
 }
 
@@ -65,6 +104,7 @@ func (db *Database) CreateSet(name string) (*Set, error) {
 	}
 
 	set := NewSet(name)
+	set.keys = db.keys
 	db.Sets[name] = set
 	return set, nil
 }
@@ -218,6 +258,67 @@ func (db *Database) RebuildIndex(name string) error {
 	return nil
 }
 
+// ReplaceSetsFrom atomically replaces the named sets, and the indexes on them, with those of src
+// Sets of this database that are not named are left untouched. src must not be in use elsewhere.
+// The data keys of an encrypted src are added to this database's, which becomes encrypted if it
+// was not; values of an unencrypted src are sealed by ReencryptValues.
+func (db *Database) ReplaceSetsFrom(src *Database, setNames []string) error {
+	src.mu.RLock()
+	defer src.mu.RUnlock()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	replaced := make(map[string]bool, len(setNames))
+	for _, name := range setNames {
+		if _, exists := src.Sets[name]; !exists {
+			return fmt.Errorf("set not found: %s", name)
+		}
+		replaced[name] = true
+	}
+
+	// Check for index name collisions before changing anything
+	for name, index := range src.Indexes {
+		if !replaced[index.GetSetName()] {
+			continue
+		}
+		if existing, exists := db.Indexes[name]; exists && !replaced[existing.GetSetName()] {
+			return fmt.Errorf("index already exists on another set: %s", name)
+		}
+	}
+
+	// Keep the values of src readable before changing anything
+	keys := db.keys
+	if src.keys != nil {
+		if keys == nil {
+			keys = newDataKeyring(src.keys.wrapper)
+		}
+		if err := keys.merge(src.keys); err != nil {
+			return err
+		}
+	}
+
+	for name, index := range db.Indexes {
+		if replaced[index.GetSetName()] {
+			delete(db.Indexes, name)
+		}
+	}
+	for name := range replaced {
+		db.Sets[name] = src.Sets[name]
+	}
+	if keys != nil {
+		db.setKeyring(keys)
+		keys.touch()
+	}
+	for name, index := range src.Indexes {
+		if replaced[index.GetSetName()] {
+			db.Indexes[name] = index
+		}
+	}
+
+	return nil
+}
+
 // ListIndexes returns a list of all index names in the database
 func (db *Database) ListIndexes() []string {
 	db.mu.RLock()
@@ -233,11 +334,8 @@ func (db *Database) ListIndexes() []string {
 
 // Authenticate authenticates a user against the database's authentication configuration
 func (db *Database) Authenticate(username, password string) bool {
-	if db.Auth == nil || !db.Auth.Enabled {
-		return true
-	}
-
-	return db.Auth.Username == username && db.Auth.Password == password
+	_, ok := db.UserRole(username, password)
+	return ok
 }
 
 // Put adds or updates a value in a set and updates all related indexes
@@ -1,7 +1,11 @@
 package database
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
+
+	"github.com/ssig33/fuckbase/internal/credential"
 )
 
 func TestDatabaseOperations(t *testing.T) {
@@ -75,10 +79,9 @@ func TestDatabaseAuthentication(t *testing.T) {
 	}
 
 	// Create a database with authentication
-	auth := &AuthConfig{
-		Username: "admin",
-		Password: "password",
-		Enabled:  true,
+	auth, err := NewAuthConfig("admin", "password")
+	if err != nil {
+		t.Fatalf("Failed to create auth config: %v", err)
 	}
 	db = NewDatabase("test_db", auth)
 
@@ -98,6 +101,34 @@ func TestDatabaseAuthentication(t *testing.T) {
 	}
 }
 
+func TestAuthConfigJSON(t *testing.T) {
+	auth, _ := NewAuthConfig("admin", "password")
+	data, err := json.Marshal(auth)
+	if err != nil {
+		t.Fatalf("Failed to marshal auth config: %v", err)
+	}
+	if strings.Contains(string(data), `"password"`) || strings.Contains(string(data), "Password\":") {
+		t.Errorf("Expected no plaintext password to be written, got %s", data)
+	}
+
+	var decoded AuthConfig
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.PasswordHash != auth.PasswordHash {
+		t.Errorf("Expected the hash to round trip, got %+v (%v)", decoded, err)
+	}
+
+	// Configurations written before hashes were stored are hashed on load
+	var legacy AuthConfig
+	if err := json.Unmarshal([]byte(`{"Username":"admin","Password":"password","Enabled":true}`), &legacy); err != nil {
+		t.Fatalf("Failed to unmarshal legacy auth config: %v", err)
+	}
+	if !credential.IsPasswordHash(legacy.PasswordHash) {
+		t.Errorf("Expected the legacy password to be hashed, got %+v", legacy)
+	}
+	if db := NewDatabase("test_db", &legacy); !db.Authenticate("admin", "password") {
+		t.Errorf("Expected the legacy password to still authenticate")
+	}
+}
+
 func TestDatabaseIndex(t *testing.T) {
 	// Create a new database
 	db := NewDatabase("test_db", nil)
@@ -173,4 +204,55 @@ func TestDatabaseIndex(t *testing.T) {
 	if err == nil {
 		t.Errorf("Expected error when dropping a nonexistent index")
 	}
-}
\ No newline at end of file
+}
+
+func TestReplaceSetsFrom(t *testing.T) {
+	db := NewDatabase("test_db", nil)
+	db.CreateSet("users")
+	db.CreateSet("orders")
+	db.Put("users", "u1", map[string]interface{}{"name": "Alice"})
+	db.Put("orders", "o1", map[string]interface{}{"item": "book"})
+	db.CreateIndex("users_by_name", "users", "name")
+	db.CreateIndex("orders_by_item", "orders", "item")
+
+	src := NewDatabase("test_db", nil)
+	src.CreateSet("users")
+	src.Put("users", "u2", map[string]interface{}{"name": "Bob"})
+	src.CreateIndex("users_by_name", "users", "name")
+
+	if err := db.ReplaceSetsFrom(src, []string{"users"}); err != nil {
+		t.Fatalf("Failed to replace sets: %v", err)
+	}
+
+	users, _ := db.GetSet("users")
+	if users.Has("u1") || !users.Has("u2") {
+		t.Errorf("Expected users set to be replaced")
+	}
+	orders, _ := db.GetSet("orders")
+	if !orders.Has("o1") {
+		t.Errorf("Expected orders set to be untouched")
+	}
+
+	index, err := db.GetIndex("users_by_name")
+	if err != nil {
+		t.Fatalf("Expected users index to exist: %v", err)
+	}
+	keys, _ := index.Query("Bob")
+	if len(keys) != 1 {
+		t.Errorf("Expected replaced index to find Bob, got %v", keys)
+	}
+	if _, err := db.GetIndex("orders_by_item"); err != nil {
+		t.Errorf("Expected orders index to be untouched")
+	}
+
+	// Index name collision with an index on another set
+	conflict := NewDatabase("test_db", nil)
+	conflict.CreateSet("users")
+	conflict.CreateIndex("orders_by_item", "users", "name")
+	if err := db.ReplaceSetsFrom(conflict, []string{"users"}); err == nil {
+		t.Errorf("Expected error for an index name collision")
+	}
+	if err := db.ReplaceSetsFrom(src, []string{"missing"}); err == nil {
+		t.Errorf("Expected error for a set missing from the source")
+	}
+}
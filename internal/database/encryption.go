@@ -0,0 +1,469 @@
+package database
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// sealedValueMarker starts every sealed value
+// 0xc1 is never used in MessagePack, so sealed values can be told apart from values stored
+// before their database was encrypted.
+const sealedValueMarker = 0xc1
+
+// sealedHeaderSize is the size of the marker and data key ID in front of a sealed value
+const sealedHeaderSize = 5
+
+// ErrReencryptionRunning is returned by ReencryptValues when a pass is already running
+var ErrReencryptionRunning = errors.New("re-encryption is already running")
+
+// KeyWrapper wraps the data keys of encrypted databases with a master key
+// The active master key wraps new data keys; every master key can unwrap the keys it wrapped.
+type KeyWrapper interface {
+	ActiveKeyID() string
+	WrapKey(dataKey []byte) (masterKeyID string, wrapped []byte, err error)
+	UnwrapKey(masterKeyID string, wrapped []byte) ([]byte, error)
+}
+
+// DataKey is a key sealing the values of a database, as wrapped by a master key
+// Only wrapped keys leave the server, so the values in a backup of an encrypted database
+// can only be read with the master key.
+type DataKey struct {
+	ID          uint32    `json:"id"`
+	MasterKeyID string    `json:"master_key_id"`
+	WrappedKey  []byte    `json:"wrapped_key"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// dataKeyEntry is a data key with its unwrapped key
+type dataKeyEntry struct {
+	DataKey
+	secret []byte
+	aead   cipher.AEAD
+}
+
+// dataKeyring holds the data keys of an encrypted database
+// The newest key, the last one, seals new values; every key opens the values it sealed.
+type dataKeyring struct {
+	wrapper      KeyWrapper
+	mu           sync.RWMutex
+	keys         []*dataKeyEntry
+	generation   int // Changes whenever values may need re-sealing
+	reencrypting bool
+}
+
+// newDataKeyring creates a keyring without keys
+func newDataKeyring(wrapper KeyWrapper) *dataKeyring {
+	return &dataKeyring{wrapper: wrapper}
+}
+
+// newDataKeyEntry creates a data key entry from an unwrapped key
+func newDataKeyEntry(key DataKey, secret []byte) (*dataKeyEntry, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key %d: %w", key.ID, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key %d: %w", key.ID, err)
+	}
+	return &dataKeyEntry{DataKey: key, secret: secret, aead: aead}, nil
+}
+
+// addKey generates a data key wrapped by the active master key and makes it the newest
+func (k *dataKeyring) addKey() (DataKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return DataKey{}, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	masterKeyID, wrapped, err := k.wrapper.WrapKey(secret)
+	if err != nil {
+		return DataKey{}, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key := DataKey{MasterKeyID: masterKeyID, WrappedKey: wrapped, CreatedAt: time.Now().UTC()}
+	for key.ID == 0 || k.find(key.ID) != nil {
+		var id [4]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			return DataKey{}, fmt.Errorf("failed to generate data key ID: %w", err)
+		}
+		key.ID = binary.BigEndian.Uint32(id[:])
+	}
+
+	entry, err := newDataKeyEntry(key, secret)
+	if err != nil {
+		return DataKey{}, err
+	}
+	k.keys = append(k.keys, entry)
+	k.generation++
+	return key, nil
+}
+
+// load unwraps data keys from a backup; the last key becomes the newest
+func (k *dataKeyring) load(keys []DataKey) error {
+	entries := make([]*dataKeyEntry, 0, len(keys))
+	for _, key := range keys {
+		secret, err := k.wrapper.UnwrapKey(key.MasterKeyID, key.WrappedKey)
+		if err != nil {
+			return fmt.Errorf("failed to unwrap data key %d: %w", key.ID, err)
+		}
+		entry, err := newDataKeyEntry(key, secret)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys = entries
+	k.generation++
+	return nil
+}
+
+// merge adds the keys of another keyring, behind this keyring's newest key
+// Keys already held are skipped; a different key under the same ID is an error.
+func (k *dataKeyring) merge(other *dataKeyring) error {
+	if k == other {
+		return nil
+	}
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var added []*dataKeyEntry
+	for _, entry := range other.keys {
+		existing := k.find(entry.ID)
+		if existing == nil {
+			added = append(added, entry)
+		} else if !bytes.Equal(existing.secret, entry.secret) {
+			return fmt.Errorf("data key %d differs between the databases", entry.ID)
+		}
+	}
+
+	if len(k.keys) == 0 {
+		k.keys = added
+	} else {
+		newest := k.keys[len(k.keys)-1]
+		k.keys = append(append(k.keys[:len(k.keys)-1:len(k.keys)-1], added...), newest)
+	}
+	k.generation++
+	return nil
+}
+
+// rewrap wraps every data key with the active master key
+func (k *dataKeyring) rewrap() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	activeID := k.wrapper.ActiveKeyID()
+	for _, entry := range k.keys {
+		if entry.MasterKeyID == activeID {
+			continue
+		}
+		masterKeyID, wrapped, err := k.wrapper.WrapKey(entry.secret)
+		if err != nil {
+			return fmt.Errorf("failed to rewrap data key %d: %w", entry.ID, err)
+		}
+		entry.MasterKeyID = masterKeyID
+		entry.WrappedKey = wrapped
+	}
+	return nil
+}
+
+// retain removes the data keys other than the newest that no value is sealed with
+// Nothing is removed if the generation changed since the keys in use were collected, as
+// values may have been sealed with a key that is no longer the newest.
+func (k *dataKeyring) retain(used map[uint32]bool, generation int) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.generation != generation {
+		return 0
+	}
+
+	kept := make([]*dataKeyEntry, 0, len(k.keys))
+	for i, entry := range k.keys {
+		if used[entry.ID] || i == len(k.keys)-1 {
+			kept = append(kept, entry)
+		}
+	}
+	removed := len(k.keys) - len(kept)
+	k.keys = kept
+	return removed
+}
+
+// find returns the data key with an ID; the caller holds the lock
+func (k *dataKeyring) find(id uint32) *dataKeyEntry {
+	for _, entry := range k.keys {
+		if entry.ID == id {
+			return entry
+		}
+	}
+	return nil
+}
+
+// newest returns the data key sealing new values
+func (k *dataKeyring) newest() *dataKeyEntry {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.keys[len(k.keys)-1]
+}
+
+// dataKeys returns a copy of the data keys, oldest first
+func (k *dataKeyring) dataKeys() []DataKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]DataKey, len(k.keys))
+	for i, entry := range k.keys {
+		keys[i] = entry.DataKey
+	}
+	return keys
+}
+
+// currentGeneration returns the generation of the keyring
+func (k *dataKeyring) currentGeneration() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.generation
+}
+
+// touch records that values may need re-sealing, such as after sets were moved in
+func (k *dataKeyring) touch() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.generation++
+}
+
+// seal encrypts a value with the newest data key
+// The additional data binds the sealed value to where it is stored.
+func (k *dataKeyring) seal(additionalData, plaintext []byte) ([]byte, error) {
+	entry := k.newest()
+
+	nonceSize := entry.aead.NonceSize()
+	sealed := make([]byte, sealedHeaderSize+nonceSize, sealedHeaderSize+nonceSize+len(plaintext)+entry.aead.Overhead())
+	sealed[0] = sealedValueMarker
+	binary.BigEndian.PutUint32(sealed[1:sealedHeaderSize], entry.ID)
+	nonce := sealed[sealedHeaderSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return entry.aead.Seal(sealed, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts a sealed value; values that are not sealed are returned as they are
+func (k *dataKeyring) open(additionalData, value []byte) ([]byte, error) {
+	id, sealed := sealedKeyID(value)
+	if !sealed {
+		return value, nil
+	}
+
+	k.mu.RLock()
+	entry := k.find(id)
+	k.mu.RUnlock()
+	if entry == nil {
+		return nil, fmt.Errorf("value is sealed with unknown data key %d", id)
+	}
+
+	nonceSize := entry.aead.NonceSize()
+	if len(value) < sealedHeaderSize+nonceSize {
+		return nil, fmt.Errorf("sealed value is truncated")
+	}
+	nonce := value[sealedHeaderSize : sealedHeaderSize+nonceSize]
+	plaintext, err := entry.aead.Open(nil, nonce, value[sealedHeaderSize+nonceSize:], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// sealedKeyID returns the ID of the data key a value is sealed with, and whether it is sealed
+func sealedKeyID(value []byte) (uint32, bool) {
+	if len(value) < sealedHeaderSize || value[0] != sealedValueMarker {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(value[1:sealedHeaderSize]), true
+}
+
+// EnableEncryption seals the database's values with a new data key wrapped by wrapper
+// New values are sealed at once; values stored before are sealed by ReencryptValues.
+func (db *Database) EnableEncryption(wrapper KeyWrapper) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.keys != nil {
+		return fmt.Errorf("database is already encrypted: %s", db.Name)
+	}
+
+	keys := newDataKeyring(wrapper)
+	if _, err := keys.addKey(); err != nil {
+		return err
+	}
+	db.setKeyring(keys)
+	return nil
+}
+
+// LoadDataKeys makes the database encrypted with data keys from a backup, unwrapped by wrapper
+func (db *Database) LoadDataKeys(wrapper KeyWrapper, keys []DataKey) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no data keys")
+	}
+
+	keyring := newDataKeyring(wrapper)
+	if err := keyring.load(keys); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.setKeyring(keyring)
+	return nil
+}
+
+// setKeyring makes every set of the database use a keyring; the caller holds the lock
+func (db *Database) setKeyring(keys *dataKeyring) {
+	db.keys = keys
+	for _, set := range db.Sets {
+		set.setKeyring(keys)
+	}
+}
+
+// Encrypted reports whether the database's values are sealed
+func (db *Database) Encrypted() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.keys != nil
+}
+
+// DataKeys returns the wrapped data keys of the database, oldest first, or nil if it is not encrypted
+func (db *Database) DataKeys() []DataKey {
+	db.mu.RLock()
+	keys := db.keys
+	db.mu.RUnlock()
+
+	if keys == nil {
+		return nil
+	}
+	return keys.dataKeys()
+}
+
+// Reencrypting reports whether ReencryptValues is running for the database
+func (db *Database) Reencrypting() bool {
+	db.mu.RLock()
+	keys := db.keys
+	db.mu.RUnlock()
+
+	if keys == nil {
+		return false
+	}
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+	return keys.reencrypting
+}
+
+// RotateDataKey adds a data key that seals new values, and wraps every data key with the
+// active master key
+// Values sealed with older keys are re-sealed by ReencryptValues.
+func (db *Database) RotateDataKey() (DataKey, error) {
+	db.mu.RLock()
+	keys := db.keys
+	db.mu.RUnlock()
+
+	if keys == nil {
+		return DataKey{}, fmt.Errorf("database is not encrypted: %s", db.Name)
+	}
+	if err := keys.rewrap(); err != nil {
+		return DataKey{}, err
+	}
+	return keys.addKey()
+}
+
+// ReencryptValues seals every value of the database with its newest data key, then removes
+// the data keys no value is sealed with any more
+// Writes continue while it runs. Passes are repeated until no key was added and no set moved
+// in during one, so values are left sealed with the newest key. It returns the number of
+// values sealed, or ErrReencryptionRunning if another call is running.
+func (db *Database) ReencryptValues() (int, error) {
+	db.mu.RLock()
+	keys := db.keys
+	db.mu.RUnlock()
+
+	if keys == nil {
+		return 0, fmt.Errorf("database is not encrypted: %s", db.Name)
+	}
+
+	keys.mu.Lock()
+	if keys.reencrypting {
+		keys.mu.Unlock()
+		return 0, ErrReencryptionRunning
+	}
+	keys.reencrypting = true
+	keys.mu.Unlock()
+	defer func() {
+		keys.mu.Lock()
+		keys.reencrypting = false
+		keys.mu.Unlock()
+	}()
+
+	sealed := 0
+	for {
+		generation := keys.currentGeneration()
+		newest := keys.newest().ID
+
+		db.mu.RLock()
+		sets := make([]*Set, 0, len(db.Sets))
+		for _, set := range db.Sets {
+			sets = append(sets, set)
+		}
+		db.mu.RUnlock()
+
+		for _, set := range sets {
+			n, err := set.reseal(newest)
+			sealed += n
+			if err != nil {
+				return sealed, fmt.Errorf("failed to re-encrypt set %s: %w", set.Name, err)
+			}
+		}
+
+		if keys.currentGeneration() == generation {
+			break
+		}
+	}
+
+	// Sets cannot be moved in while the keys in use are collected
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	generation := keys.currentGeneration()
+	used := make(map[uint32]bool)
+	for _, set := range db.Sets {
+		set.mu.RLock()
+		for _, value := range set.Data {
+			if id, ok := sealedKeyID(value); ok {
+				used[id] = true
+			}
+		}
+		set.mu.RUnlock()
+	}
+	keys.retain(used, generation)
+
+	return sealed, nil
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"testing"
+)
+
+// testWrapper wraps data keys with in-memory master keys; the last added key is active
+type testWrapper struct {
+	keys   map[string][]byte
+	active string
+}
+
+func newTestWrapper(ids ...string) *testWrapper {
+	w := &testWrapper{keys: make(map[string][]byte)}
+	for _, id := range ids {
+		w.addKey(id)
+	}
+	return w
+}
+
+func (w *testWrapper) addKey(id string) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	w.keys[id] = key
+	w.active = id
+}
+
+func (w *testWrapper) aead(id string) (cipher.AEAD, error) {
+	key, ok := w.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %s", id)
+	}
+	block, _ := aes.NewCipher(key)
+	return cipher.NewGCM(block)
+}
+
+func (w *testWrapper) ActiveKeyID() string {
+	return w.active
+}
+
+func (w *testWrapper) WrapKey(dataKey []byte) (string, []byte, error) {
+	aead, err := w.aead(w.active)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return w.active, aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+func (w *testWrapper) UnwrapKey(id string, wrapped []byte) ([]byte, error) {
+	aead, err := w.aead(id)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+}
+
+type person struct {
+	Name  string `msgpack:"name"`
+	Email string `msgpack:"email"`
+}
+
+func TestEncryptedSet(t *testing.T) {
+	db := NewDatabase("customers", nil)
+	if err := db.EnableEncryption(newTestWrapper("master-1")); err != nil {
+		t.Fatalf("Failed to enable encryption: %v", err)
+	}
+	db.CreateSet("people")
+	db.CreateIndex("by_email", "people", "email")
+
+	if err := db.Put("people", "p1", person{Name: "Alice", Email: "alice@example.com"}); err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+
+	// Values are stored sealed
+	set, _ := db.GetSet("people")
+	stored := set.Data["p1"]
+	if stored[0] != sealedValueMarker || bytes.Contains(stored, []byte("alice@example.com")) {
+		t.Errorf("Expected the stored value to be sealed, got %q", stored)
+	}
+
+	// and read transparently, including by indexes
+	var got person
+	if err := set.Get("p1", &got); err != nil || got.Email != "alice@example.com" {
+		t.Errorf("Expected the value to be opened, got %+v, %v", got, err)
+	}
+	index, _ := db.GetIndex("by_email")
+	if keys, _ := index.(*BasicIndex).Query("alice@example.com"); len(keys) != 1 || keys[0] != "p1" {
+		t.Errorf("Expected the index to find p1, got %v", keys)
+	}
+
+	// A sealed value cannot be moved to another key
+	set.Data["p2"] = stored
+	if _, err := set.GetRaw("p2"); err == nil {
+		t.Errorf("Expected a value moved to another key not to open")
+	}
+}
+
+func TestEnableEncryptionSealsExistingValues(t *testing.T) {
+	db := NewDatabase("customers", nil)
+	db.CreateSet("people")
+	db.Put("people", "p1", person{Name: "Alice", Email: "alice@example.com"})
+
+	if err := db.EnableEncryption(newTestWrapper("master-1")); err != nil {
+		t.Fatalf("Failed to enable encryption: %v", err)
+	}
+	if err := db.EnableEncryption(newTestWrapper("master-1")); err == nil {
+		t.Errorf("Expected enabling encryption twice to fail")
+	}
+
+	// Values stored before are readable until they are sealed
+	set, _ := db.GetSet("people")
+	var got person
+	if err := set.Get("p1", &got); err != nil || got.Name != "Alice" {
+		t.Errorf("Expected the plaintext value to be readable, got %+v, %v", got, err)
+	}
+
+	sealed, err := db.ReencryptValues()
+	if err != nil || sealed != 1 {
+		t.Fatalf("Expected 1 value to be sealed, got %d, %v", sealed, err)
+	}
+	if _, ok := sealedKeyID(set.Data["p1"]); !ok {
+		t.Errorf("Expected the value to be sealed")
+	}
+}
+
+func TestRotateDataKey(t *testing.T) {
+	wrapper := newTestWrapper("master-1")
+	db := NewDatabase("customers", nil)
+	db.EnableEncryption(wrapper)
+	db.CreateSet("people")
+	for i := 0; i < 10; i++ {
+		db.Put("people", fmt.Sprintf("p%d", i), person{Name: fmt.Sprintf("Person %d", i)})
+	}
+	oldKey := db.DataKeys()[0]
+
+	// A new master key wraps every data key after rotation
+	wrapper.addKey("master-2")
+	newKey, err := db.RotateDataKey()
+	if err != nil {
+		t.Fatalf("Failed to rotate data key: %v", err)
+	}
+	keys := db.DataKeys()
+	if len(keys) != 2 || keys[0].MasterKeyID != "master-2" || keys[1].ID != newKey.ID {
+		t.Errorf("Expected both data keys wrapped by master-2, got %+v", keys)
+	}
+
+	sealed, err := db.ReencryptValues()
+	if err != nil || sealed != 10 {
+		t.Fatalf("Expected 10 values to be re-sealed, got %d, %v", sealed, err)
+	}
+
+	// The old data key is removed once no value is sealed with it
+	keys = db.DataKeys()
+	if len(keys) != 1 || keys[0].ID != newKey.ID || keys[0].ID == oldKey.ID {
+		t.Errorf("Expected only the new data key to be left, got %+v", keys)
+	}
+	set, _ := db.GetSet("people")
+	var got person
+	if err := set.Get("p3", &got); err != nil || got.Name != "Person 3" {
+		t.Errorf("Expected the re-sealed value to be readable, got %+v, %v", got, err)
+	}
+}
+
+func TestSealedValuesMoveWithDataKeys(t *testing.T) {
+	wrapper := newTestWrapper("master-1")
+	src := NewDatabase("customers", nil)
+	src.EnableEncryption(wrapper)
+	src.CreateSet("people")
+	src.Put("people", "p1", person{Name: "Alice"})
+	srcSet, _ := src.GetSet("people")
+
+	// A copy restored from sealed values and wrapped data keys
+	restored := NewDatabase("customers", nil)
+	if err := restored.LoadDataKeys(wrapper, src.DataKeys()); err != nil {
+		t.Fatalf("Failed to load data keys: %v", err)
+	}
+	set, _ := restored.CreateSet("people")
+	if err := srcSet.ForEachSealed(set.PutSealed); err != nil {
+		t.Fatalf("Failed to copy sealed values: %v", err)
+	}
+	if err := set.PutSealed("p2", []byte("plaintext")); err == nil {
+		t.Errorf("Expected an unsealed value to be rejected")
+	}
+
+	// Sets moved into an unencrypted database stay readable
+	live := NewDatabase("customers", nil)
+	live.CreateSet("people")
+	live.CreateSet("orders")
+	live.Put("orders", "o1", map[string]interface{}{"total": 10})
+	if err := live.ReplaceSetsFrom(restored, []string{"people"}); err != nil {
+		t.Fatalf("Failed to replace sets: %v", err)
+	}
+	if !live.Encrypted() {
+		t.Errorf("Expected the database to become encrypted")
+	}
+	people, _ := live.GetSet("people")
+	var got person
+	if err := people.Get("p1", &got); err != nil || got.Name != "Alice" {
+		t.Errorf("Expected the moved value to be readable, got %+v, %v", got, err)
+	}
+
+	if sealed, err := live.ReencryptValues(); err != nil || sealed != 1 {
+		t.Errorf("Expected the existing order to be sealed, got %d, %v", sealed, err)
+	}
+}
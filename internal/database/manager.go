@@ -10,6 +10,7 @@ import (
 // Manager manages multiple databases
 type Manager struct {
 	Databases map[string]*Database
+	wrapper   KeyWrapper
 	mu        sync.RWMutex
 }
 
@@ -35,6 +36,65 @@ func (m *Manager) CreateDatabase(name string, auth *AuthConfig) (*Database, erro
 	return db, nil
 }
 
+// AddDatabase adds a database created with NewDatabase, such as one encrypted before it is used
+func (m *Manager) AddDatabase(db *Database) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.Databases[db.Name]; exists {
+		return fmt.Errorf("database already exists: %s", db.Name)
+	}
+
+	m.Databases[db.Name] = db
+	logger.Info("Created database: %s", db.Name)
+	return nil
+}
+
+// SetKeyWrapper sets the master keys wrapping the data keys of encrypted databases
+func (m *Manager) SetKeyWrapper(wrapper KeyWrapper) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.wrapper = wrapper
+}
+
+// KeyWrapper returns the master keys wrapping the data keys of encrypted databases, or nil
+// if no master key is configured
+func (m *Manager) KeyWrapper() KeyWrapper {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.wrapper
+}
+
+// ReplaceDatabase adds a database, atomically replacing any existing database with the same name
+func (m *Manager) ReplaceDatabase(db *Database) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, replaced := m.Databases[db.Name]
+	m.Databases[db.Name] = db
+	if replaced {
+		logger.Info("Replaced database: %s", db.Name)
+	} else {
+		logger.Info("Created database: %s", db.Name)
+	}
+}
+
+// ReplaceAllDatabases atomically replaces every database with the given ones
+func (m *Manager) ReplaceAllDatabases(dbs []*Database) {
+	databases := make(map[string]*Database, len(dbs))
+	for _, db := range dbs {
+		databases[db.Name] = db
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Databases = databases
+	logger.Info("Replaced all databases with %d databases", len(databases))
+}
+
 // GetDatabase returns a database by name
 func (m *Manager) GetDatabase(name string) (*Database, error) {
 	m.mu.RLock()
@@ -88,10 +88,9 @@ func TestManagerAuthentication(t *testing.T) {
 	manager.CreateDatabase("db_no_auth", nil)
 
 	// Create a database with authentication
-	auth := &AuthConfig{
-		Username: "admin",
-		Password: "password",
-		Enabled:  true,
+	auth, err := NewAuthConfig("admin", "password")
+	if err != nil {
+		t.Fatalf("Failed to create auth config: %v", err)
 	}
 	manager.CreateDatabase("db_with_auth", auth)
 
@@ -127,4 +126,47 @@ func TestManagerAuthentication(t *testing.T) {
 	if err == nil {
 		t.Errorf("Expected error when authenticating against a nonexistent database")
 	}
-}
\ No newline at end of file
+}
+
+func TestManagerReplaceDatabase(t *testing.T) {
+	manager := NewManager()
+	original, _ := manager.CreateDatabase("test_db", nil)
+	original.CreateSet("old_set")
+
+	// Replace an existing database
+	replacement := NewDatabase("test_db", nil)
+	replacement.CreateSet("new_set")
+	manager.ReplaceDatabase(replacement)
+
+	db, err := manager.GetDatabase("test_db")
+	if err != nil {
+		t.Fatalf("Failed to get database: %v", err)
+	}
+	if db != replacement {
+		t.Errorf("Expected the replacement database to be returned")
+	}
+	if _, err := db.GetSet("old_set"); err == nil {
+		t.Errorf("Expected old set to be gone after replacement")
+	}
+
+	// Replace a database that does not exist yet
+	manager.ReplaceDatabase(NewDatabase("other_db", nil))
+	if manager.GetDatabaseCount() != 2 {
+		t.Errorf("Expected 2 databases, got %d", manager.GetDatabaseCount())
+	}
+}
+
+func TestManagerReplaceAllDatabases(t *testing.T) {
+	manager := NewManager()
+	manager.CreateDatabase("db1", nil)
+	manager.CreateDatabase("db2", nil)
+
+	manager.ReplaceAllDatabases([]*Database{NewDatabase("db3", nil)})
+
+	if manager.GetDatabaseCount() != 1 {
+		t.Errorf("Expected 1 database, got %d", manager.GetDatabaseCount())
+	}
+	if !manager.DatabaseExists("db3") || manager.DatabaseExists("db1") {
+		t.Errorf("Expected only db3 to exist")
+	}
+}
@@ -8,9 +8,11 @@ import (
 )
 
 // Set represents a collection of key-value pairs
+// In an encrypted database the values in Data are sealed; the methods seal and open them.
 type Set struct {
 	Name string
 	Data map[string][]byte // Key to MessagePack encoded value
+	keys *dataKeyring      // Data keys of an encrypted database, or nil
 	mu   sync.RWMutex
 }
 
@@ -33,6 +35,13 @@ func (s *Set) Put(key string, value interface{}) error {
 		return fmt.Errorf("failed to encode value: %w", err)
 	}
 
+	if s.keys != nil {
+		encoded, err = s.keys.seal(s.additionalData(key), encoded)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt value: %w", err)
+		}
+	}
+
 	s.Data[key] = encoded
 	return nil
 }
@@ -42,9 +51,9 @@ func (s *Set) Get(key string, dest interface{}) error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	encoded, exists := s.Data[key]
-	if !exists {
-		return fmt.Errorf("key not found: %s", key)
+	encoded, err := s.value(key)
+	if err != nil {
+		return err
 	}
 
 	// Decode the value using MessagePack
@@ -60,12 +69,33 @@ func (s *Set) GetRaw(key string) ([]byte, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	encoded, exists := s.Data[key]
+	return s.value(key)
+}
+
+// value returns the opened value for a key; the caller holds the lock
+func (s *Set) value(key string) ([]byte, error) {
+	stored, exists := s.Data[key]
 	if !exists {
 		return nil, fmt.Errorf("key not found: %s", key)
 	}
+	return s.open(key, stored)
+}
+
+// open decrypts a stored value if the set is encrypted
+func (s *Set) open(key string, stored []byte) ([]byte, error) {
+	if s.keys == nil {
+		return stored, nil
+	}
+	value, err := s.keys.open(s.additionalData(key), stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value for key %s: %w", key, err)
+	}
+	return value, nil
+}
 
-	return encoded, nil
+// additionalData binds a sealed value to its set and key, so it cannot be moved to another
+func (s *Set) additionalData(key string) []byte {
+	return []byte(s.Name + "\x00" + key)
 }
 
 // Delete removes a key-value pair
@@ -117,7 +147,11 @@ func (s *Set) ForEach(callback func(key string, value []byte) error) error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	for key, value := range s.Data {
+	for key, stored := range s.Data {
+		value, err := s.open(key, stored)
+		if err != nil {
+			return err
+		}
 		if err := callback(key, value); err != nil {
 			return err
 		}
@@ -126,6 +160,85 @@ func (s *Set) ForEach(callback func(key string, value []byte) error) error {
 	return nil
 }
 
+// ForEachSealed iterates over the sealed values of a set in an encrypted database
+// Values stored before the database was encrypted are sealed for the callback.
+func (s *Set) ForEachSealed(callback func(key string, sealed []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.keys == nil {
+		return fmt.Errorf("set is not encrypted: %s", s.Name)
+	}
+
+	for key, stored := range s.Data {
+		sealed := stored
+		if _, ok := sealedKeyID(stored); !ok {
+			var err error
+			sealed, err = s.keys.seal(s.additionalData(key), stored)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt value: %w", err)
+			}
+		}
+		if err := callback(key, sealed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PutSealed stores a value sealed by ForEachSealed, such as one from a backup
+// The value must open with the data keys of the set's database.
+func (s *Set) PutSealed(key string, sealed []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keys == nil {
+		return fmt.Errorf("set is not encrypted: %s", s.Name)
+	}
+	if _, ok := sealedKeyID(sealed); !ok {
+		return fmt.Errorf("value for key %s is not sealed", key)
+	}
+	if _, err := s.open(key, sealed); err != nil {
+		return err
+	}
+
+	s.Data[key] = sealed
+	return nil
+}
+
+// setKeyring makes the set seal its values with a database's data keys
+func (s *Set) setKeyring(keys *dataKeyring) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = keys
+}
+
+// reseal seals the values not yet sealed with a data key with the newest one
+// Each value is re-sealed under its own lock, so writes to the set are not held up.
+func (s *Set) reseal(newest uint32) (int, error) {
+	resealed := 0
+	for _, key := range s.Keys() {
+		s.mu.Lock()
+		stored, exists := s.Data[key]
+		if id, ok := sealedKeyID(stored); exists && (!ok || id != newest) {
+			value, err := s.open(key, stored)
+			if err == nil {
+				stored, err = s.keys.seal(s.additionalData(key), value)
+			}
+			if err != nil {
+				s.mu.Unlock()
+				return resealed, err
+			}
+			s.Data[key] = stored
+			resealed++
+		}
+		s.mu.Unlock()
+	}
+	return resealed, nil
+}
+
 // Clear removes all key-value pairs from the set
 func (s *Set) Clear() {
 	s.mu.Lock()
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ssig33/fuckbase/internal/credential"
+)
+
+// Role is the access level of a database user
+type Role string
+
+const (
+	RoleReader Role = "reader" // Read entries, list sets and query indexes
+	RoleWriter Role = "writer" // Also create sets and write or delete entries
+	RoleAdmin  Role = "admin"  // Also create and drop indexes
+)
+
+// ParseRole returns the role with the given name
+func ParseRole(name string) (Role, error) {
+	switch role := Role(name); role {
+	case RoleReader, RoleWriter, RoleAdmin:
+		return role, nil
+	default:
+		return "", fmt.Errorf("unknown role: %s (expected reader, writer or admin)", name)
+	}
+}
+
+// Allows reports whether the role includes the access of the required role
+func (r Role) Allows(required Role) bool {
+	return r.level() >= required.level()
+}
+
+// level orders roles by access, with unknown roles below every other
+func (r Role) level() int {
+	switch r {
+	case RoleReader:
+		return 1
+	case RoleWriter:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// User is an additional user of a database, with a role
+// The user from the database's own credentials always has the admin role.
+type User struct {
+	Username     string
+	PasswordHash string
+	Role         Role
+}
+
+// UserInfo describes a database user without its credentials
+type UserInfo struct {
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
+	Owner    bool   `json:"owner,omitempty"` // The user from the database's own credentials
+}
+
+// AddUser adds a user with a role to a database with authentication enabled
+func (db *Database) AddUser(username, password string, role Role) error {
+	if username == "" || password == "" {
+		return fmt.Errorf("username and password are required")
+	}
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+
+	// Hash before taking the lock, as it is slow
+	hash, err := credential.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.Auth == nil || !db.Auth.Enabled {
+		return fmt.Errorf("authentication is not enabled for database: %s", db.Name)
+	}
+	if _, exists := db.Auth.Users[username]; exists || username == db.Auth.Username {
+		return fmt.Errorf("user already exists: %s", username)
+	}
+
+	if db.Auth.Users == nil {
+		db.Auth.Users = make(map[string]User)
+	}
+	db.Auth.Users[username] = User{Username: username, PasswordHash: hash, Role: role}
+	return nil
+}
+
+// RemoveUser removes a user added with AddUser
+func (db *Database) RemoveUser(username string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.Auth == nil {
+		return fmt.Errorf("user not found: %s", username)
+	}
+	if username == db.Auth.Username {
+		return fmt.Errorf("cannot remove the database owner: %s", username)
+	}
+	user, exists := db.Auth.Users[username]
+	if !exists {
+		return fmt.Errorf("user not found: %s", username)
+	}
+
+	delete(db.Auth.Users, username)
+	credential.ForgetPassword(user.PasswordHash)
+	return nil
+}
+
+// ListUsers returns the users of a database sorted by name, starting with the owner
+func (db *Database) ListUsers() []UserInfo {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	users := []UserInfo{}
+	if db.Auth == nil {
+		return users
+	}
+	for _, user := range db.Auth.Users {
+		users = append(users, UserInfo{Username: user.Username, Role: user.Role})
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	if db.Auth.Username != "" {
+		users = append([]UserInfo{{Username: db.Auth.Username, Role: RoleAdmin, Owner: true}}, users...)
+	}
+	return users
+}
+
+// UserRole authenticates a user and returns their role
+// Every request has the admin role when authentication is not enabled.
+func (db *Database) UserRole(username, password string) (Role, bool) {
+	db.mu.RLock()
+	if db.Auth == nil || !db.Auth.Enabled {
+		db.mu.RUnlock()
+		return RoleAdmin, true
+	}
+	role := RoleAdmin
+	hash := db.Auth.PasswordHash
+	known := true
+	if !credential.EqualStrings(db.Auth.Username, username) {
+		user, exists := db.Auth.Users[username]
+		if exists {
+			role, hash = user.Role, user.PasswordHash
+		} else {
+			// Verify against the owner anyway, so unknown users take as long as wrong passwords
+			known = false
+		}
+	}
+	db.mu.RUnlock()
+
+	// Verify outside the lock, as it is slow
+	if !credential.VerifyPassword(hash, password) || !known {
+		return "", false
+	}
+	return role, true
+}
+
+// SetOwner replaces the database's own credentials, enabling authentication
+// Users added with AddUser are kept.
+func (db *Database) SetOwner(username, password string) error {
+	if username == "" || password == "" {
+		return fmt.Errorf("username and password are required")
+	}
+
+	// Hash before taking the lock, as it is slow
+	hash, err := credential.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.Auth == nil {
+		db.Auth = &AuthConfig{}
+	}
+	if _, exists := db.Auth.Users[username]; exists {
+		return fmt.Errorf("user already exists: %s", username)
+	}
+	if db.Auth.PasswordHash != "" {
+		credential.ForgetPassword(db.Auth.PasswordHash)
+	}
+	db.Auth.Username = username
+	db.Auth.PasswordHash = hash
+	db.Auth.Enabled = true
+	return nil
+}
+
+// DisableAuth disables authentication, so every request has the admin role
+// The credentials and users are kept, and apply again once SetOwner enables authentication.
+func (db *Database) DisableAuth() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.Auth != nil {
+		db.Auth.Enabled = false
+	}
+}
+
+// AuthEnabled reports whether the database requires credentials
+func (db *Database) AuthEnabled() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.Auth != nil && db.Auth.Enabled
+}
+
+// CopyAuth returns a copy of the database's authentication configuration, or nil if it has none
+func (db *Database) CopyAuth() *AuthConfig {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.Auth == nil {
+		return nil
+	}
+	auth := *db.Auth
+	if db.Auth.Users != nil {
+		auth.Users = make(map[string]User, len(db.Auth.Users))
+		for name, user := range db.Auth.Users {
+			auth.Users[name] = user
+		}
+	}
+	return &auth
+}
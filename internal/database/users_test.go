@@ -0,0 +1,148 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{RoleReader, RoleReader, true},
+		{RoleReader, RoleWriter, false},
+		{RoleWriter, RoleReader, true},
+		{RoleWriter, RoleAdmin, false},
+		{RoleAdmin, RoleWriter, true},
+		{Role("unknown"), RoleReader, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.want {
+			t.Errorf("Expected %s allows %s to be %v, got %v", tt.role, tt.required, tt.want, got)
+		}
+	}
+
+	if _, err := ParseRole("owner"); err == nil {
+		t.Errorf("Expected error for an unknown role")
+	}
+}
+
+func TestDatabaseUsers(t *testing.T) {
+	// Users need authentication to be enabled
+	open := NewDatabase("open_db", nil)
+	if err := open.AddUser("reporter", "secret", RoleReader); err == nil {
+		t.Errorf("Expected error adding a user to a database without authentication")
+	}
+
+	auth, _ := NewAuthConfig("owner", "password")
+	db := NewDatabase("test_db", auth)
+	if err := db.AddUser("reporter", "secret", RoleReader); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+	if err := db.AddUser("loader", "secret2", RoleWriter); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+	if err := db.AddUser("reporter", "other", RoleAdmin); err == nil {
+		t.Errorf("Expected error adding an existing user")
+	}
+	if err := db.AddUser("owner", "other", RoleReader); err == nil {
+		t.Errorf("Expected error adding a user with the owner's name")
+	}
+	if err := db.AddUser("bad", "secret", Role("superuser")); err == nil {
+		t.Errorf("Expected error adding a user with an unknown role")
+	}
+
+	tests := []struct {
+		username string
+		password string
+		role     Role
+		ok       bool
+	}{
+		{"owner", "password", RoleAdmin, true},
+		{"reporter", "secret", RoleReader, true},
+		{"loader", "secret2", RoleWriter, true},
+		{"reporter", "password", "", false},
+		{"nobody", "password", "", false},
+	}
+	for _, tt := range tests {
+		role, ok := db.UserRole(tt.username, tt.password)
+		if role != tt.role || ok != tt.ok {
+			t.Errorf("Expected %s to have role %q (%v), got %q (%v)", tt.username, tt.role, tt.ok, role, ok)
+		}
+	}
+
+	users := db.ListUsers()
+	if len(users) != 3 || users[0].Username != "owner" || !users[0].Owner || users[1].Username != "loader" || users[2].Role != RoleReader {
+		t.Errorf("Unexpected users: %+v", users)
+	}
+
+	// Users are kept in backups of the auth config
+	data, _ := json.Marshal(db.CopyAuth())
+	var restored AuthConfig
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Failed to unmarshal auth config: %v", err)
+	}
+	if role, ok := NewDatabase("restored", &restored).UserRole("reporter", "secret"); !ok || role != RoleReader {
+		t.Errorf("Expected the user to survive a round trip, got %q (%v)", role, ok)
+	}
+
+	if err := db.RemoveUser("reporter"); err != nil {
+		t.Errorf("Failed to remove user: %v", err)
+	}
+	if _, ok := db.UserRole("reporter", "secret"); ok {
+		t.Errorf("Expected a removed user not to authenticate")
+	}
+	if err := db.RemoveUser("reporter"); err == nil {
+		t.Errorf("Expected error removing a missing user")
+	}
+	if err := db.RemoveUser("owner"); err == nil {
+		t.Errorf("Expected error removing the owner")
+	}
+}
+
+func TestSetOwnerAndDisableAuth(t *testing.T) {
+	db := NewDatabase("test_db", nil)
+	if role, ok := db.UserRole("", ""); !ok || role != RoleAdmin {
+		t.Errorf("Expected an open database to allow every request")
+	}
+
+	// Setting the owner enables authentication
+	if err := db.SetOwner("owner", "first"); err != nil {
+		t.Fatalf("Failed to set owner: %v", err)
+	}
+	if _, ok := db.UserRole("", ""); ok {
+		t.Errorf("Expected authentication to be enabled")
+	}
+	if err := db.AddUser("reporter", "secret", RoleReader); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+
+	// Rotating the owner's password keeps other users
+	if err := db.SetOwner("owner", "second"); err != nil {
+		t.Fatalf("Failed to rotate password: %v", err)
+	}
+	if _, ok := db.UserRole("owner", "first"); ok {
+		t.Errorf("Expected the old password to be rejected")
+	}
+	if role, ok := db.UserRole("owner", "second"); !ok || role != RoleAdmin {
+		t.Errorf("Expected the new password to be accepted")
+	}
+	if _, ok := db.UserRole("reporter", "secret"); !ok {
+		t.Errorf("Expected other users to be kept")
+	}
+	if err := db.SetOwner("reporter", "x"); err == nil {
+		t.Errorf("Expected error making an existing user the owner")
+	}
+
+	// Disabling keeps the users for when authentication is enabled again
+	db.DisableAuth()
+	if role, ok := db.UserRole("", ""); !ok || role != RoleAdmin {
+		t.Errorf("Expected authentication to be disabled")
+	}
+	db.SetOwner("owner", "third")
+	if _, ok := db.UserRole("reporter", "secret"); !ok {
+		t.Errorf("Expected users to apply again once authentication is enabled")
+	}
+}
@@ -0,0 +1,396 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/ssig33/fuckbase/internal/token"
+)
+
+// Supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+// DefaultScopesClaim is the claim holding a token's scopes unless configured otherwise
+const DefaultScopesClaim = "fuckbase"
+
+// Leeway is the clock skew allowed when checking exp and nbf
+const Leeway = 30 * time.Second
+
+// ErrInvalidToken is returned for every token that fails verification
+var ErrInvalidToken = errors.New("invalid token")
+
+// Key is a verification key, usable with one algorithm
+type Key struct {
+	ID        string
+	Algorithm string
+	key       interface{} // []byte, *rsa.PublicKey or *ecdsa.PublicKey
+}
+
+// Claims are the verified claims of a token
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	Scopes    []token.Scope
+}
+
+// Allows reports whether the token's scopes grant the required access to a set of a database
+func (c *Claims) Allows(dbName, setName string, required database.Role) bool {
+	return token.ScopesAllow(c.Scopes, dbName, setName, required)
+}
+
+// Verifier verifies tokens signed with any of its keys
+type Verifier struct {
+	keys        []Key
+	issuer      string
+	audience    string
+	scopesClaim string
+	now         func() time.Time
+}
+
+// LoadVerifier loads the verification keys from the configuration
+// The key file is either a JWKS document or PEM encoded public keys or certificates. HMAC
+// keys can only be given in a JWKS document, as "oct" keys.
+func LoadVerifier(cfg *config.JWTConfig) (*Verifier, error) {
+	if !cfg.Enabled() {
+		return nil, fmt.Errorf("JWT authentication is not configured")
+	}
+
+	data, err := os.ReadFile(cfg.KeysFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key file: %w", err)
+	}
+	keys, err := ParseKeys(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewVerifier(keys, cfg.Issuer, cfg.Audience, cfg.ScopesClaim), nil
+}
+
+// NewVerifier creates a verifier for the given keys
+// Empty issuer and audience values are not checked; an empty scopes claim uses DefaultScopesClaim.
+func NewVerifier(keys []Key, issuer, audience, scopesClaim string) *Verifier {
+	if scopesClaim == "" {
+		scopesClaim = DefaultScopesClaim
+	}
+	return &Verifier{
+		keys:        keys,
+		issuer:      issuer,
+		audience:    audience,
+		scopesClaim: scopesClaim,
+		now:         time.Now,
+	}
+}
+
+// ParseKeys parses a JWKS document or PEM encoded public keys and certificates
+func ParseKeys(data []byte) ([]Key, error) {
+	var keys []Key
+	var err error
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		keys, err = parseJWKS([]byte(trimmed))
+	} else {
+		keys, err = parsePEM(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no JWT verification keys found")
+	}
+	return keys, nil
+}
+
+// jwk is a key of a JWKS document
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// parseJWKS parses the signature keys of a JWKS document, skipping encryption keys
+func parseJWKS(data []byte) ([]Key, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS document: %w", err)
+	}
+
+	var keys []Key
+	for i, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.toKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %d: %w", i, err)
+		}
+		if k.Alg != "" && k.Alg != key.Algorithm {
+			return nil, fmt.Errorf("invalid JWKS key %d: unsupported algorithm %s for %s key", i, k.Alg, k.Kty)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// toKey converts a JWKS key to a verification key
+func (k jwk) toKey() (Key, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "oct":
+		secret, err := decode(k.K)
+		if err != nil || len(secret) == 0 {
+			return Key{}, fmt.Errorf("invalid oct key")
+		}
+		return Key{ID: k.Kid, Algorithm: AlgHS256, key: secret}, nil
+	case "RSA":
+		n, errN := decode(k.N)
+		e, errE := decode(k.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return Key{}, fmt.Errorf("invalid RSA key")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return Key{ID: k.Kid, Algorithm: AlgRS256, key: pub}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return Key{}, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, errX := decode(k.X)
+		y, errY := decode(k.Y)
+		if errX != nil || errY != nil {
+			return Key{}, fmt.Errorf("invalid EC key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return Key{}, fmt.Errorf("invalid EC key")
+		}
+		return Key{ID: k.Kid, Algorithm: AlgES256, key: pub}, nil
+	default:
+		return Key{}, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// parsePEM parses PEM encoded public keys and certificates
+// A "kid" PEM header sets the key ID.
+func parsePEM(data []byte) ([]Key, error) {
+	var keys []Key
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		var pub interface{}
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				pub = cert.PublicKey
+			}
+		default:
+			return nil, fmt.Errorf("unsupported PEM block %q in JWT key file", block.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWT key: %w", err)
+		}
+
+		key := Key{ID: block.Headers["kid"], key: pub}
+		switch pub := pub.(type) {
+		case *rsa.PublicKey:
+			key.Algorithm = AlgRS256
+		case *ecdsa.PublicKey:
+			if pub.Curve != elliptic.P256() {
+				return nil, fmt.Errorf("unsupported curve %s in JWT key file", pub.Curve.Params().Name)
+			}
+			key.Algorithm = AlgES256
+		default:
+			return nil, fmt.Errorf("unsupported key type %T in JWT key file", pub)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// LooksLikeToken reports whether a bearer credential has the shape of a JWT
+func LooksLikeToken(s string) bool {
+	return strings.Count(s, ".") == 2
+}
+
+// Verify checks a token's signature and claims and returns the claims
+// The exp claim is required; nbf is checked if present, and iss and aud if configured.
+// Errors wrap ErrInvalidToken and give the reason for logging.
+func (v *Verifier) Verify(tokenString string) (*Claims, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	if err := v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var payload map[string]json.RawMessage
+	if err := decodeSegment(parts[1], &payload); err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", ErrInvalidToken)
+	}
+	claims, err := v.parseClaims(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// verifySignature checks a signature against the keys for the algorithm
+// The algorithm of each key is fixed by its type, so a token cannot choose how a key is used.
+func (v *Verifier) verifySignature(alg, kid, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	found := false
+	for _, key := range v.keys {
+		if key.Algorithm != alg || (kid != "" && key.ID != "" && key.ID != kid) {
+			continue
+		}
+		found = true
+
+		var ok bool
+		switch pub := key.key.(type) {
+		case []byte:
+			mac := hmac.New(sha256.New, pub)
+			mac.Write([]byte(signed))
+			ok = hmac.Equal(mac.Sum(nil), signature)
+		case *rsa.PublicKey:
+			ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+		case *ecdsa.PublicKey:
+			if len(signature) == 64 {
+				r := new(big.Int).SetBytes(signature[:32])
+				s := new(big.Int).SetBytes(signature[32:])
+				ok = ecdsa.Verify(pub, digest[:], r, s)
+			}
+		}
+		if ok {
+			return nil
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("%w: no key for algorithm %q and key ID %q", ErrInvalidToken, alg, kid)
+	}
+	return fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+}
+
+// parseClaims reads and checks the registered claims and the scopes claim
+func (v *Verifier) parseClaims(payload map[string]json.RawMessage) (*Claims, error) {
+	claims := &Claims{}
+	for name, dest := range map[string]*string{"sub": &claims.Subject, "iss": &claims.Issuer} {
+		if raw, ok := payload[name]; ok {
+			if err := json.Unmarshal(raw, dest); err != nil {
+				return nil, fmt.Errorf("invalid %s claim", name)
+			}
+		}
+	}
+	if raw, ok := payload["aud"]; ok {
+		var single string
+		if err := json.Unmarshal(raw, &single); err == nil {
+			claims.Audience = []string{single}
+		} else if err := json.Unmarshal(raw, &claims.Audience); err != nil {
+			return nil, fmt.Errorf("invalid aud claim")
+		}
+	}
+	for name, dest := range map[string]*time.Time{"exp": &claims.ExpiresAt, "nbf": &claims.NotBefore} {
+		if raw, ok := payload[name]; ok {
+			var seconds float64
+			if err := json.Unmarshal(raw, &seconds); err != nil {
+				return nil, fmt.Errorf("invalid %s claim", name)
+			}
+			*dest = time.Unix(0, int64(seconds*float64(time.Second)))
+		}
+	}
+	if raw, ok := payload[v.scopesClaim]; ok {
+		if err := json.Unmarshal(raw, &claims.Scopes); err != nil {
+			return nil, fmt.Errorf("invalid %s claim: %v", v.scopesClaim, err)
+		}
+	}
+
+	now := v.now()
+	if claims.ExpiresAt.IsZero() {
+		return nil, fmt.Errorf("exp claim is required")
+	}
+	if !now.Before(claims.ExpiresAt.Add(Leeway)) {
+		return nil, fmt.Errorf("token has expired")
+	}
+	if !claims.NotBefore.IsZero() && now.Add(Leeway).Before(claims.NotBefore) {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if v.audience != "" && !contains(claims.Audience, v.audience) {
+		return nil, fmt.Errorf("token is not intended for audience %q", v.audience)
+	}
+	return claims, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// contains reports whether a list contains a value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
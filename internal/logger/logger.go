@@ -67,6 +67,8 @@ func NewLogger(level string, output string) (*Logger, error) {
 	
 	if output == "stdout" {
 		writer = os.Stdout
+	} else if output == "stderr" {
+		writer = os.Stderr
 	} else {
 		file, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 		if err != nil {
@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle entries are removed, so keys such as client IPs do not accumulate
+const sweepInterval = time.Minute
+
+// Limiter is a set of token buckets, one per key
+type Limiter struct {
+	rate      float64 // Tokens added per second
+	burst     float64 // Capacity of each bucket
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// bucket is the state of one key's token bucket
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewLimiter creates a limiter allowing rate requests per second per key, in bursts of up to burst
+// A burst below one allows bursts of one second's worth of requests.
+func NewLimiter(rate float64, burst int) *Limiter {
+	b := float64(burst)
+	if burst < 1 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   b,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// SetClock replaces the clock the buckets are refilled by, so tests can control time
+func (l *Limiter) SetClock(now func() time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.now = now
+}
+
+// Allow takes a token from the key's bucket
+// If the bucket is empty, it returns false with the time until the next token.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, wait := l.refill(key)
+	if wait > 0 {
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Check reports whether the key's bucket has a token without taking it
+// If the bucket is empty, it returns false with the time until the next token.
+func (l *Limiter) Check(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, wait := l.refill(key)
+	return wait == 0, wait
+}
+
+// refill adds the tokens earned since the key's bucket was last used and returns the bucket,
+// with the time until the next token if it is empty
+// The caller must hold l.mu.
+func (l *Limiter) refill(key string) (*bucket, time.Duration) {
+	now := l.now()
+	l.sweep(now)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return b, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	return b, 0
+}
+
+// sweep removes the buckets that have refilled, as they are the same as new ones
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Lockout locks out keys after repeated failures
+type Lockout struct {
+	threshold int           // Failures within the window that start a lockout
+	window    time.Duration // Period failures are counted over
+	duration  time.Duration // Length of a lockout
+	mu        sync.Mutex
+	entries   map[string]*failures
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// failures is the failure count of one key
+type failures struct {
+	count       int
+	first       time.Time // Start of the current window
+	lockedUntil time.Time
+}
+
+// NewLockout creates a lockout that locks a key for duration after threshold failures within window
+func NewLockout(threshold int, window, duration time.Duration) *Lockout {
+	return &Lockout{
+		threshold: threshold,
+		window:    window,
+		duration:  duration,
+		entries:   make(map[string]*failures),
+		now:       time.Now,
+	}
+}
+
+// Locked reports whether a key is locked out, with the time until the lockout ends
+func (l *Lockout) Locked(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, exists := l.entries[key]
+	if !exists {
+		return 0, false
+	}
+	if remaining := f.lockedUntil.Sub(l.now()); remaining > 0 {
+		return remaining, true
+	}
+	return 0, false
+}
+
+// Fail records a failure for a key and reports whether it started a lockout
+func (l *Lockout) Fail(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	f, exists := l.entries[key]
+	if !exists {
+		f = &failures{first: now}
+		l.entries[key] = f
+	}
+	if now.Sub(f.first) > l.window {
+		f.count = 0
+		f.first = now
+	}
+
+	f.count++
+	if f.count < l.threshold {
+		return false
+	}
+
+	f.count = 0
+	f.lockedUntil = now.Add(l.duration)
+	return true
+}
+
+// sweep removes the entries whose window and lockout have ended
+func (l *Lockout) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, f := range l.entries {
+		if now.Sub(f.first) > l.window && now.After(f.lockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock advanced by tests
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func TestLimiter(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	l := NewLimiter(2, 3)
+	l.now = clock.now
+
+	// The burst is allowed at once, then the bucket is empty
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("Expected request %d of the burst to be allowed", i+1)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait 500ms for the next token, got %v %s", ok, wait)
+	}
+
+	// Checking an empty bucket does not take a token
+	if ok, wait := l.Check("a"); ok || wait != 500*time.Millisecond {
+		t.Errorf("Expected the check to wait 500ms, got %v %s", ok, wait)
+	}
+	if ok, _ := l.Check("b"); !ok || l.buckets["b"].tokens != 3 {
+		t.Errorf("Expected the check to leave the tokens of a full bucket")
+	}
+
+	// Keys have separate buckets
+	if ok, _ := l.Allow("b"); !ok {
+		t.Errorf("Expected another key to be allowed")
+	}
+
+	// Tokens are added at the rate, up to the burst
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Errorf("Expected a token after 500ms")
+	}
+	clock.t = clock.t.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		l.Allow("a")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Errorf("Expected the bucket to hold no more than the burst")
+	}
+
+	// Idle buckets are removed
+	clock.t = clock.t.Add(time.Hour)
+	l.Allow("c")
+	if len(l.buckets) != 1 {
+		t.Errorf("Expected idle buckets to be removed, got %d", len(l.buckets))
+	}
+
+	// Without a burst, one second's worth of requests is allowed
+	if l := NewLimiter(0.5, 0); l.burst != 1 {
+		t.Errorf("Expected a burst of 1, got %v", l.burst)
+	}
+	if l := NewLimiter(10, 0); l.burst != 10 {
+		t.Errorf("Expected a burst of 10, got %v", l.burst)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	l := NewLockout(3, time.Minute, 5*time.Minute)
+	l.now = clock.now
+
+	if l.Fail("ip") || l.Fail("ip") {
+		t.Errorf("Expected no lockout below the threshold")
+	}
+	if _, locked := l.Locked("ip"); locked {
+		t.Errorf("Expected no lockout below the threshold")
+	}
+
+	// Failures outside the window are not counted
+	clock.t = clock.t.Add(2 * time.Minute)
+	if l.Fail("ip") || l.Fail("ip") {
+		t.Errorf("Expected the failure count to restart after the window")
+	}
+	if !l.Fail("ip") {
+		t.Errorf("Expected a lockout at the threshold")
+	}
+	if remaining, locked := l.Locked("ip"); !locked || remaining != 5*time.Minute {
+		t.Errorf("Expected a 5m lockout, got %v %s", locked, remaining)
+	}
+	if _, locked := l.Locked("other"); locked {
+		t.Errorf("Expected other keys not to be locked out")
+	}
+
+	clock.t = clock.t.Add(5 * time.Minute)
+	if _, locked := l.Locked("ip"); locked {
+		t.Errorf("Expected the lockout to end")
+	}
+}
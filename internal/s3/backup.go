@@ -1,103 +1,215 @@
 package s3
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/ssig33/fuckbase/internal/config"
 	"github.com/ssig33/fuckbase/internal/database"
 	"github.com/ssig33/fuckbase/internal/logger"
 )
 
 // BackupMetadata represents metadata about a backup
 type BackupMetadata struct {
-	Timestamp   time.Time `json:"timestamp"`
-	Version     string    `json:"version"`
-	DatabaseCount int     `json:"database_count"`
-	SetCount    int       `json:"set_count"`
-	EntryCount  int       `json:"entry_count"`
+	Timestamp     time.Time `json:"timestamp"`
+	Version       string    `json:"version"`
+	DatabaseCount int       `json:"database_count"`
+	SetCount      int       `json:"set_count"`
+	EntryCount    int       `json:"entry_count"`
+}
+
+// legacyBackupVersion is the metadata version of full backups written before format versions were recorded
+const legacyBackupVersion = "1.0.0"
+
+// FormatVersion returns the backup format version recorded in full backup metadata
+// Backups written before format versions were recorded are version 1.
+func (m BackupMetadata) FormatVersion() (int, error) {
+	if m.Version == "" || m.Version == legacyBackupVersion {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(m.Version)
+	if err != nil {
+		return 0, fmt.Errorf("unknown backup format version %q", m.Version)
+	}
+	return version, nil
+}
+
+// checkFormatVersion checks that full backup metadata has a format this server can read
+func checkFormatVersion(metadata BackupMetadata) error {
+	version, err := metadata.FormatVersion()
+	if err != nil {
+		return err
+	}
+	if version > BackupFormatVersion {
+		return fmt.Errorf("backup format version %d is newer than the supported version %d", version, BackupFormatVersion)
+	}
+	return nil
 }
 
 // DatabaseBackup represents a backup of a single database
 type DatabaseBackup struct {
-	Name    string                     `json:"name"`
-	Sets    map[string]SetBackup       `json:"sets"`
-	Indexes map[string]IndexBackup     `json:"indexes"`
-	Auth    *database.AuthConfig       `json:"auth,omitempty"`
+	Name     string                 `json:"name"`
+	Sets     map[string]SetBackup   `json:"sets"`
+	Indexes  map[string]IndexBackup `json:"indexes"`
+	Auth     *database.AuthConfig   `json:"auth,omitempty"`
+	DataKeys []database.DataKey     `json:"data_keys,omitempty"` // Wrapped data keys of an encrypted database
 }
 
 // SetBackup represents a backup of a single set
+// The values of an encrypted database are kept sealed, in Sealed instead of Data.
 type SetBackup struct {
-	Name  string                 `json:"name"`
-	Data  map[string]interface{} `json:"data"`
+	Name   string                 `json:"name"`
+	Data   map[string]interface{} `json:"data"`
+	Sealed map[string][]byte      `json:"sealed,omitempty"`
+}
+
+// Len returns the number of entries in a set backup
+func (s SetBackup) Len() int {
+	return len(s.Data) + len(s.Sealed)
+}
+
+// SetValues returns the entries of a set in a database backup by key
+// Sealed values are opened with the backup's data keys, unwrapped by wrapper, which may be
+// nil if the set has none. It fails if any value cannot be opened.
+func (b DatabaseBackup) SetValues(setName string, wrapper database.KeyWrapper) (map[string]interface{}, error) {
+	setBackup, ok := b.Sets[setName]
+	if !ok {
+		return nil, fmt.Errorf("set not found: %s", setName)
+	}
+	if len(setBackup.Sealed) == 0 {
+		return setBackup.Data, nil
+	}
+	if wrapper == nil {
+		return nil, fmt.Errorf("set %s of database %s is encrypted but no data encryption key is configured", setName, b.Name)
+	}
+
+	db := database.NewDatabase(b.Name, nil)
+	if err := db.LoadDataKeys(wrapper, b.DataKeys); err != nil {
+		return nil, err
+	}
+	set, err := db.CreateSet(setName)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{}, setBackup.Len())
+	for key, value := range setBackup.Data {
+		values[key] = value
+	}
+	for key, sealed := range setBackup.Sealed {
+		if err := set.PutSealed(key, sealed); err != nil {
+			return nil, fmt.Errorf("failed to read sealed value for key %s in set %s: %w", key, setName, err)
+		}
+		var value interface{}
+		if err := set.Get(key, &value); err != nil {
+			return nil, fmt.Errorf("failed to open value for key %s in set %s: %w", key, setName, err)
+		}
+		values[key] = value
+	}
+	return values, nil
 }
 
 // IndexBackup represents a backup of a single index
 type IndexBackup struct {
-	Name        string   `json:"name"`
-	SetName     string   `json:"set_name"`
-	Field       string   `json:"field"`
-	Type        int      `json:"type"`
-	SortFields  []string `json:"sort_fields,omitempty"`
+	Name       string   `json:"name"`
+	SetName    string   `json:"set_name"`
+	Field      string   `json:"field"`
+	Type       int      `json:"type"`
+	SortFields []string `json:"sort_fields,omitempty"`
 }
 
 // FullBackup represents a full backup of all databases
 type FullBackup struct {
-	Metadata  BackupMetadata           `json:"metadata"`
+	Metadata  BackupMetadata            `json:"metadata"`
 	Databases map[string]DatabaseBackup `json:"databases"`
 }
 
-// BackupManager handles database backups to S3
+// ErrNoBackups is returned when there is no backup to choose from
+var ErrNoBackups = errors.New("no backups found")
+
+// BackupManager handles database backups to a storage backend
 type BackupManager struct {
-	s3Client *Client
-	dbManager *database.Manager
+	storage     Storage
+	dbManager   *database.Manager
+	retention   *config.RetentionConfig
+	keyring     *Keyring
+	compression string
 }
 
-// NewBackupManager creates a new backup manager
-func NewBackupManager(s3Client *Client, dbManager *database.Manager) *BackupManager {
+// NewBackupManager creates a new backup manager writing to the given storage backend
+func NewBackupManager(storage Storage, dbManager *database.Manager) *BackupManager {
 	return &BackupManager{
-		s3Client:  s3Client,
+		storage:   storage,
 		dbManager: dbManager,
 	}
 }
 
-// BackupDatabase backs up a single database to S3
+// Storage returns the storage backend backups are written to
+func (bm *BackupManager) Storage() Storage {
+	return bm.storage
+}
+
+// BackupDatabase backs up a single database to backup storage
 func (bm *BackupManager) BackupDatabase(dbName string) error {
+	_, err := bm.BackupDatabaseContext(context.Background(), dbName, nil)
+	return err
+}
+
+// BackupDatabaseContext backs up a single database and returns the name of the backup object
+// Progress is reported to progress, which may be nil. Nothing is written if ctx is
+// cancelled before the upload starts.
+func (bm *BackupManager) BackupDatabaseContext(ctx context.Context, dbName string, progress *Progress) (string, error) {
 	db, err := bm.dbManager.GetDatabase(dbName)
 	if err != nil {
-		return fmt.Errorf("failed to get database: %w", err)
+		return "", fmt.Errorf("failed to get database: %w", err)
 	}
 
-	backup, err := bm.createDatabaseBackup(db)
+	backup, err := bm.createDatabaseBackup(ctx, db, progress)
 	if err != nil {
-		return fmt.Errorf("failed to create database backup: %w", err)
+		return "", fmt.Errorf("failed to create database backup: %w", err)
 	}
 
 	// Convert backup to JSON
 	data, err := json.MarshalIndent(backup, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal backup data: %w", err)
+		return "", fmt.Errorf("failed to marshal backup data: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
 	}
 
-	// Upload to S3
-	objectName := GenerateBackupObjectName(dbName)
-	err = bm.s3Client.UploadFile(objectName, data, "application/json")
+	// Upload to backup storage
+	manifest := newManifest(dbName, map[string]DatabaseStats{dbName: computeDatabaseStats(backup)})
+	objectName, err := bm.uploadBackup(ctx, GenerateBackupObjectName(dbName), data, manifest, progress)
 	if err != nil {
-		return fmt.Errorf("failed to upload backup: %w", err)
+		return "", err
 	}
 
-	logger.Info("Successfully backed up database %s to S3", dbName)
-	return nil
+	logger.Info("Successfully backed up database %s", dbName)
+	return objectName, nil
 }
 
-// BackupAllDatabases backs up all databases to S3
+// BackupAllDatabases backs up all databases to backup storage
 func (bm *BackupManager) BackupAllDatabases() error {
+	_, err := bm.BackupAllDatabasesContext(context.Background(), nil)
+	return err
+}
+
+// BackupAllDatabasesContext backs up all databases and returns the name of the backup object
+// Progress is reported to progress, which may be nil. Nothing is written if ctx is
+// cancelled before the upload starts.
+func (bm *BackupManager) BackupAllDatabasesContext(ctx context.Context, progress *Progress) (string, error) {
 	dbNames := bm.dbManager.ListDatabases()
-	
+
 	fullBackup := FullBackup{
 		Metadata: BackupMetadata{
 			Timestamp:     time.Now().UTC(),
-			Version:       "1.0.0",
+			Version:       strconv.Itoa(BackupFormatVersion),
 			DatabaseCount: len(dbNames),
 		},
 		Databases: make(map[string]DatabaseBackup),
@@ -113,8 +225,11 @@ func (bm *BackupManager) BackupAllDatabases() error {
 			continue
 		}
 
-		backup, err := bm.createDatabaseBackup(db)
+		backup, err := bm.createDatabaseBackup(ctx, db, progress)
 		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
 			logger.Error("Failed to create backup for database %s: %v", dbName, err)
 			continue
 		}
@@ -124,41 +239,153 @@ func (bm *BackupManager) BackupAllDatabases() error {
 		// Count sets and entries
 		totalSets += len(backup.Sets)
 		for _, set := range backup.Sets {
-			totalEntries += len(set.Data)
+			totalEntries += set.Len()
 		}
 	}
 
+	fullBackup.Metadata.DatabaseCount = len(fullBackup.Databases)
 	fullBackup.Metadata.SetCount = totalSets
 	fullBackup.Metadata.EntryCount = totalEntries
 
 	// Convert backup to JSON
 	data, err := json.MarshalIndent(fullBackup, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal backup data: %w", err)
+		return "", fmt.Errorf("failed to marshal backup data: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
 	}
 
-	// Upload to S3
-	objectName := GenerateFullBackupObjectName()
-	err = bm.s3Client.UploadFile(objectName, data, "application/json")
+	// Upload to backup storage
+	stats := make(map[string]DatabaseStats, len(fullBackup.Databases))
+	for dbName, backup := range fullBackup.Databases {
+		stats[dbName] = computeDatabaseStats(backup)
+	}
+	objectName, err := bm.uploadBackup(ctx, GenerateFullBackupObjectName(), data, newManifest(AllDatabases, stats), progress)
 	if err != nil {
-		return fmt.Errorf("failed to upload backup: %w", err)
+		return "", err
 	}
 
-	logger.Info("Successfully backed up all %d databases to S3", len(dbNames))
+	logger.Info("Successfully backed up all %d databases", len(dbNames))
+	return objectName, nil
+}
+
+// SetKeyring sets the keyring used to encrypt new backups and decrypt existing ones
+// A nil keyring disables encryption of new backups
+func (bm *BackupManager) SetKeyring(keyring *Keyring) {
+	bm.keyring = keyring
+}
+
+// SetCompression sets the codec used to compress new backups
+func (bm *BackupManager) SetCompression(codec string) error {
+	if err := ValidateCompression(codec); err != nil {
+		return err
+	}
+	bm.compression = codec
 	return nil
 }
 
+// uploadBackup encodes backup data and uploads it under the given object name, followed by its manifest
+// It returns the final object name, which carries a suffix for each applied encoding. When
+// replicating, the backup succeeds if any target stores it; failed targets are reported
+// as warnings to progress, which may be nil.
+func (bm *BackupManager) uploadBackup(ctx context.Context, objectName string, data []byte, manifest *BackupManifest, progress *Progress) (string, error) {
+	contentType := "application/json"
+	metadata := make(map[string]string)
+
+	// Compress before encrypting; ciphertext does not compress
+	if suffix := CompressionSuffix(bm.compression); suffix != "" {
+		compressed, err := Compress(bm.compression, data)
+		if err != nil {
+			return "", err
+		}
+		data = compressed
+		objectName += suffix
+		contentType = "application/octet-stream"
+		metadata[MetadataCompression] = bm.compression
+		manifest.Compression = bm.compression
+	}
+
+	if bm.keyring != nil {
+		encrypted, err := bm.keyring.Encrypt(data)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt backup: %w", err)
+		}
+		data = encrypted
+		objectName += EncryptedBackupSuffix
+		contentType = "application/octet-stream"
+		metadata[MetadataEncryption] = encryptionAlgorithm
+		metadata[MetadataKeyID] = bm.keyring.ActiveKeyID()
+		manifest.KeyID = bm.keyring.ActiveKeyID()
+	}
+
+	// Record the manifest with the object too, so the catalog can be listed without downloads
+	manifest.Checksum = Checksum(data)
+	for key, value := range catalogMetadata(manifest) {
+		metadata[key] = value
+	}
+
+	if err := bm.storage.UploadFile(ctx, objectName, data, contentType, metadata); err != nil {
+		if !isPartialReplication(err) {
+			return "", fmt.Errorf("failed to upload backup: %w", err)
+		}
+		logger.Error("Backup %s was not stored on every target: %v", objectName, err)
+		progress.addWarning(err.Error())
+	}
+
+	if err := bm.uploadManifest(ctx, objectName, data, manifest); err != nil {
+		if !isPartialReplication(err) {
+			return "", err
+		}
+		logger.Error("Manifest of backup %s was not stored on every target: %v", objectName, err)
+		progress.addWarning(err.Error())
+	}
+
+	return objectName, nil
+}
+
+// isPartialReplication reports whether err is a replication error that left at least one good copy
+func isPartialReplication(err error) bool {
+	var replErr *ReplicationError
+	return errors.As(err, &replErr) && replErr.Partial()
+}
+
+// DecodeBackup decrypts and decompresses a stored backup object into its JSON payload
+// The keyring may be nil when the backup is not encrypted
+func DecodeBackup(data []byte, keyring *Keyring) ([]byte, error) {
+	var err error
+	if IsEncryptedBackup(data) {
+		data, err = keyring.Decrypt(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return Decompress(data)
+}
+
 // createDatabaseBackup creates a backup of a database
-func (bm *BackupManager) createDatabaseBackup(db *database.Database) (DatabaseBackup, error) {
+// It stops with ctx.Err() when ctx is cancelled between sets
+func (bm *BackupManager) createDatabaseBackup(ctx context.Context, db *database.Database, progress *Progress) (DatabaseBackup, error) {
 	backup := DatabaseBackup{
 		Name:    db.Name,
 		Sets:    make(map[string]SetBackup),
 		Indexes: make(map[string]IndexBackup),
-		Auth:    db.Auth,
+		Auth:    db.CopyAuth(),
 	}
 
+	// The data keys are taken before and after the sets, so the backup has every key its
+	// values are sealed with even if the keys are rotated meanwhile
+	encrypted := db.Encrypted()
+	dataKeys := db.DataKeys()
+
 	// Backup sets
 	for _, setName := range db.ListSets() {
+		if err := ctx.Err(); err != nil {
+			return DatabaseBackup{}, err
+		}
+
 		set, err := db.GetSet(setName)
 		if err != nil {
 			return DatabaseBackup{}, fmt.Errorf("failed to get set %s: %w", setName, err)
@@ -169,6 +396,21 @@ func (bm *BackupManager) createDatabaseBackup(db *database.Database) (DatabaseBa
 			Data: make(map[string]interface{}),
 		}
 
+		// Values of encrypted databases are backed up as they are sealed
+		if encrypted {
+			setBackup.Sealed = make(map[string][]byte)
+			err := set.ForEachSealed(func(key string, sealed []byte) error {
+				setBackup.Sealed[key] = sealed
+				return nil
+			})
+			if err != nil {
+				return DatabaseBackup{}, fmt.Errorf("failed to back up set %s: %w", setName, err)
+			}
+			backup.Sets[setName] = setBackup
+			progress.addSet(setBackup.Len())
+			continue
+		}
+
 		// Get all keys in the set
 		keys := set.Keys()
 		for _, key := range keys {
@@ -181,6 +423,11 @@ func (bm *BackupManager) createDatabaseBackup(db *database.Database) (DatabaseBa
 		}
 
 		backup.Sets[setName] = setBackup
+		progress.addSet(len(setBackup.Data))
+	}
+
+	if encrypted {
+		backup.DataKeys = mergeDataKeys(dataKeys, db.DataKeys())
 	}
 
 	// Backup indexes
@@ -210,81 +457,238 @@ func (bm *BackupManager) createDatabaseBackup(db *database.Database) (DatabaseBa
 	return backup, nil
 }
 
-// RestoreDatabase restores a database from S3
+// Restore modes
+const (
+	RestoreModeReplace = "replace"
+	RestoreModeMerge   = "merge"
+)
+
+// RestoreOptions controls how a database is restored from a backup
+type RestoreOptions struct {
+	Database   string   // Database to take from a full backup; may be empty for single-database backups
+	TargetName string   // Restore under this name instead of the name in the backup
+	Sets       []string // Restore only these sets; all sets if empty
+	Mode       string   // RestoreModeReplace (default) or RestoreModeMerge
+}
+
+// RestoreDatabase restores a database from backup storage
+// The database is built and validated off to the side and then swapped in atomically;
+// on any failure the existing database is left untouched.
 func (bm *BackupManager) RestoreDatabase(objectName string) error {
-	// Download from S3
-	data, err := bm.s3Client.DownloadFile(objectName)
+	return bm.RestoreDatabaseWithOptions(objectName, RestoreOptions{})
+}
+
+// RestoreDatabaseWithOptions restores a single database from a full or single-database backup
+// In replace mode the target database is replaced atomically; when sets are selected and the
+// target exists, only those sets (and their indexes) are replaced. In merge mode the backup is
+// written into the target key by key, keeping data that is not in the backup.
+func (bm *BackupManager) RestoreDatabaseWithOptions(objectName string, opts RestoreOptions) error {
+	return bm.RestoreDatabaseContext(context.Background(), objectName, opts, nil)
+}
+
+// RestoreDatabaseContext is RestoreDatabaseWithOptions with cancellation and progress reporting
+// Progress is reported to progress, which may be nil. If ctx is cancelled before the new
+// database is swapped in, the live database is left untouched; a merge cancelled midway
+// keeps the entries written so far.
+func (bm *BackupManager) RestoreDatabaseContext(ctx context.Context, objectName string, opts RestoreOptions, progress *Progress) error {
+	if opts.Mode == "" {
+		opts.Mode = RestoreModeReplace
+	}
+	if opts.Mode != RestoreModeReplace && opts.Mode != RestoreModeMerge {
+		return fmt.Errorf("unknown restore mode: %s", opts.Mode)
+	}
+
+	// Download from backup storage
+	data, err := bm.loadBackup(ctx, objectName, progress)
 	if err != nil {
-		return fmt.Errorf("failed to download backup: %w", err)
+		return err
 	}
 
 	// Parse backup data
+	databases, _, err := parseBackupPayload(objectName, data)
+	if err != nil {
+		return err
+	}
+
+	backup, err := selectDatabaseBackup(databases, opts)
+	if err != nil {
+		return err
+	}
+
+	// Progress counts the sets and entries of the backup as it is loaded
+	db, err := buildDatabase(ctx, backup, bm.dbManager.KeyWrapper(), progress)
+	if err != nil {
+		return fmt.Errorf("failed to restore database %s: %w", backup.Name, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	live, err := bm.dbManager.GetDatabase(backup.Name)
+	switch {
+	case err != nil:
+		// Nothing to replace or merge into
+		bm.dbManager.ReplaceDatabase(db)
+	case opts.Mode == RestoreModeMerge:
+		if err := mergeDatabase(ctx, live, db, backup); err != nil {
+			return fmt.Errorf("failed to merge into database %s: %w", backup.Name, err)
+		}
+	case len(opts.Sets) > 0:
+		if err := live.ReplaceSetsFrom(db, opts.Sets); err != nil {
+			return fmt.Errorf("failed to replace sets in database %s: %w", backup.Name, err)
+		}
+		// Values of unencrypted sets restored into an encrypted database are sealed now
+		if live.Encrypted() {
+			if _, err := live.ReencryptValues(); err != nil && !errors.Is(err, database.ErrReencryptionRunning) {
+				return fmt.Errorf("failed to encrypt restored sets in database %s: %w", backup.Name, err)
+			}
+		}
+	default:
+		bm.dbManager.ReplaceDatabase(db)
+	}
+
+	logger.Info("Successfully restored database %s (mode: %s)", backup.Name, opts.Mode)
+	return nil
+}
+
+// selectDatabaseBackup picks the database to restore from a backup and applies the set selection and renaming
+func selectDatabaseBackup(databases map[string]DatabaseBackup, opts RestoreOptions) (DatabaseBackup, error) {
 	var backup DatabaseBackup
-	if err := json.Unmarshal(data, &backup); err != nil {
-		return fmt.Errorf("failed to unmarshal backup data: %w", err)
+	if opts.Database != "" {
+		var ok bool
+		backup, ok = databases[opts.Database]
+		if !ok {
+			return DatabaseBackup{}, fmt.Errorf("database %s not found in backup", opts.Database)
+		}
+	} else if len(databases) == 1 {
+		for _, b := range databases {
+			backup = b
+		}
+	} else {
+		return DatabaseBackup{}, fmt.Errorf("backup contains %d databases; a database must be specified", len(databases))
 	}
 
-	// Check if database already exists
-	if bm.dbManager.DatabaseExists(backup.Name) {
-		// Delete existing database
-		if err := bm.dbManager.DeleteDatabase(backup.Name); err != nil {
-			return fmt.Errorf("failed to delete existing database: %w", err)
+	if len(opts.Sets) > 0 {
+		sets := make(map[string]SetBackup, len(opts.Sets))
+		for _, setName := range opts.Sets {
+			set, ok := backup.Sets[setName]
+			if !ok {
+				return DatabaseBackup{}, fmt.Errorf("set %s not found in backup", setName)
+			}
+			sets[setName] = set
 		}
+
+		indexes := make(map[string]IndexBackup)
+		for name, index := range backup.Indexes {
+			if _, ok := sets[index.SetName]; ok {
+				indexes[name] = index
+			}
+		}
+
+		backup.Sets = sets
+		backup.Indexes = indexes
 	}
 
-	// Create database
-	db, err := bm.dbManager.CreateDatabase(backup.Name, backup.Auth)
-	if err != nil {
-		return fmt.Errorf("failed to create database: %w", err)
+	if opts.TargetName != "" {
+		backup.Name = opts.TargetName
 	}
 
-	// Restore sets
-	for _, setBackup := range backup.Sets {
-		set, err := db.CreateSet(setBackup.Name)
+	return backup, nil
+}
+
+// mergeDatabase writes the contents of a backup, as built into src, into a live database key by key
+// Existing keys are overwritten, other keys are kept, and indexes missing from the
+// live database are created. Indexes are maintained through Database.Put, which seals
+// the values if the live database is encrypted.
+// It stops with ctx.Err() when ctx is cancelled between sets.
+func mergeDatabase(ctx context.Context, live, src *database.Database, backup DatabaseBackup) error {
+	var entries int
+
+	for setName := range backup.Sets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		set, err := src.GetSet(setName)
 		if err != nil {
-			logger.Error("Failed to create set %s: %v", setBackup.Name, err)
-			continue
+			return fmt.Errorf("set %s missing after restore", setName)
 		}
 
-		// Restore data
-		for key, value := range setBackup.Data {
-			if err := set.Put(key, value); err != nil {
-				logger.Error("Failed to put value for key %s in set %s: %v", key, setBackup.Name, err)
-				continue
+		if _, err := live.GetSet(setName); err != nil {
+			if _, err := live.CreateSet(setName); err != nil {
+				return fmt.Errorf("failed to create set %s: %w", setName, err)
 			}
 		}
+
+		for _, key := range set.Keys() {
+			var value interface{}
+			if err := set.Get(key, &value); err != nil {
+				return fmt.Errorf("failed to get value for key %s in set %s: %w", key, setName, err)
+			}
+			if err := live.Put(setName, key, value); err != nil {
+				return fmt.Errorf("failed to put value for key %s in set %s: %w", key, setName, err)
+			}
+			entries++
+		}
 	}
 
-	// Restore indexes
-	for _, indexBackup := range backup.Indexes {
-		var err error
-		
-		// Create the appropriate type of index
-		if indexBackup.Type == int(database.BasicIndexType) {
-			_, err = db.CreateIndex(indexBackup.Name, indexBackup.SetName, indexBackup.Field)
-		} else if indexBackup.Type == int(database.SortableIndexType) {
-			_, err = db.CreateSortableIndex(indexBackup.Name, indexBackup.SetName, indexBackup.Field, indexBackup.SortFields)
-		} else {
-			logger.Error("Unknown index type %d for index %s", indexBackup.Type, indexBackup.Name)
+	for indexName, indexBackup := range backup.Indexes {
+		if _, err := live.GetIndex(indexName); err == nil {
 			continue
 		}
-		
+
+		var err error
+		switch database.IndexType(indexBackup.Type) {
+		case database.BasicIndexType:
+			_, err = live.CreateIndex(indexName, indexBackup.SetName, indexBackup.Field)
+		case database.SortableIndexType:
+			_, err = live.CreateSortableIndex(indexName, indexBackup.SetName, indexBackup.Field, indexBackup.SortFields)
+		default:
+			err = fmt.Errorf("unknown index type %d", indexBackup.Type)
+		}
 		if err != nil {
-			logger.Error("Failed to create index %s: %v", indexBackup.Name, err)
-			continue
+			return fmt.Errorf("failed to create index %s: %w", indexName, err)
 		}
 	}
 
-	logger.Info("Successfully restored database %s from S3", backup.Name)
+	logger.Info("Merged %d entries into database %s", entries, live.Name)
 	return nil
 }
 
+// mergeDataKeys returns the data keys of both lists, with those of later lists replacing
+// earlier ones with the same ID
+func mergeDataKeys(lists ...[]database.DataKey) []database.DataKey {
+	var keys []database.DataKey
+	index := make(map[uint32]int)
+	for _, list := range lists {
+		for _, key := range list {
+			if i, ok := index[key.ID]; ok {
+				keys[i] = key
+				continue
+			}
+			index[key.ID] = len(keys)
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
 // RestoreAllDatabases restores all databases from a full backup
+// Every database is built and validated before any live database is replaced;
+// on any failure the existing databases are left untouched.
 func (bm *BackupManager) RestoreAllDatabases(objectName string) error {
-	// Download from S3
-	data, err := bm.s3Client.DownloadFile(objectName)
+	return bm.RestoreAllDatabasesContext(context.Background(), objectName, nil)
+}
+
+// RestoreAllDatabasesContext is RestoreAllDatabases with cancellation and progress reporting
+// Progress is reported to progress, which may be nil. If ctx is cancelled before the
+// databases are swapped in, the live databases are left untouched.
+func (bm *BackupManager) RestoreAllDatabasesContext(ctx context.Context, objectName string, progress *Progress) error {
+	// Download from backup storage
+	data, err := bm.loadBackup(ctx, objectName, progress)
 	if err != nil {
-		return fmt.Errorf("failed to download backup: %w", err)
+		return err
 	}
 
 	// Parse backup data
@@ -292,76 +696,211 @@ func (bm *BackupManager) RestoreAllDatabases(objectName string) error {
 	if err := json.Unmarshal(data, &fullBackup); err != nil {
 		return fmt.Errorf("failed to unmarshal backup data: %w", err)
 	}
-
-	// Delete all existing databases
-	for _, dbName := range bm.dbManager.ListDatabases() {
-		if err := bm.dbManager.DeleteDatabase(dbName); err != nil {
-			logger.Error("Failed to delete existing database %s: %v", dbName, err)
-		}
+	if err := checkFormatVersion(fullBackup.Metadata); err != nil {
+		return err
 	}
 
-	// Restore each database
+	// Build each database
+	dbs := make([]*database.Database, 0, len(fullBackup.Databases))
 	for dbName, dbBackup := range fullBackup.Databases {
-		// Create database
-		db, err := bm.dbManager.CreateDatabase(dbName, dbBackup.Auth)
+		if dbBackup.Name != dbName {
+			return fmt.Errorf("database %s is stored under name %s", dbBackup.Name, dbName)
+		}
+
+		db, err := buildDatabase(ctx, dbBackup, bm.dbManager.KeyWrapper(), progress)
 		if err != nil {
-			logger.Error("Failed to create database %s: %v", dbName, err)
-			continue
+			return fmt.Errorf("failed to restore database %s: %w", dbName, err)
 		}
+		dbs = append(dbs, db)
+	}
 
-		// Restore sets
-		for _, setBackup := range dbBackup.Sets {
-			set, err := db.CreateSet(setBackup.Name)
-			if err != nil {
-				logger.Error("Failed to create set %s: %v", setBackup.Name, err)
-				continue
-			}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-			// Restore data
-			for key, value := range setBackup.Data {
-				if err := set.Put(key, value); err != nil {
-					logger.Error("Failed to put value for key %s in set %s: %v", key, setBackup.Name, err)
-					continue
-				}
-			}
+	bm.dbManager.ReplaceAllDatabases(dbs)
+
+	logger.Info("Successfully restored %d databases", len(dbs))
+	return nil
+}
+
+// loadBackup downloads a backup, checks it against its manifest when there is one,
+// and returns its decoded JSON payload
+// When replicating, each target is tried in order until one holds a copy that passes
+// these checks, so a missing or corrupted copy falls back to the next target. Fallbacks
+// are reported as warnings to progress, which may be nil.
+func (bm *BackupManager) loadBackup(ctx context.Context, objectName string, progress *Progress) ([]byte, error) {
+	var lastErr error
+	for _, target := range storageTargets(bm.storage) {
+		data, err := bm.loadBackupFrom(ctx, target.Storage, objectName)
+		if err == nil {
+			return data, nil
+		}
+		if target.Name != "" {
+			logger.Warn("Failed to load backup %s from %s: %v", objectName, target.Name, err)
+			progress.addWarning(fmt.Sprintf("failed to load backup from %s: %v", target.Name, err))
+			err = fmt.Errorf("%s: %w", target.Name, err)
 		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
 
-		// Restore indexes
-		for _, indexBackup := range dbBackup.Indexes {
-			var err error
-			
-			// Create the appropriate type of index
-			if indexBackup.Type == int(database.BasicIndexType) {
-				_, err = db.CreateIndex(indexBackup.Name, indexBackup.SetName, indexBackup.Field)
-			} else if indexBackup.Type == int(database.SortableIndexType) {
-				_, err = db.CreateSortableIndex(indexBackup.Name, indexBackup.SetName, indexBackup.Field, indexBackup.SortFields)
-			} else {
-				logger.Error("Unknown index type %d for index %s", indexBackup.Type, indexBackup.Name)
-				continue
+// loadBackupFrom loads a backup from a single storage target
+func (bm *BackupManager) loadBackupFrom(ctx context.Context, storage Storage, objectName string) ([]byte, error) {
+	stored, err := storage.DownloadFile(ctx, objectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download backup: %w", err)
+	}
+
+	if manifest, err := getManifest(ctx, storage, objectName); err == nil {
+		if checksum := Checksum(stored); manifest.Checksum != checksum {
+			return nil, fmt.Errorf("backup checksum %s does not match manifest checksum %s", checksum, manifest.Checksum)
+		}
+	}
+
+	return DecodeBackup(stored, bm.keyring)
+}
+
+// buildDatabase creates a detached database from a backup and validates it
+// The data keys of an encrypted database are unwrapped by wrapper, which may be nil if the
+// backup is not encrypted. The returned database is not registered with any manager. It
+// stops with ctx.Err() when ctx is cancelled between sets.
+func buildDatabase(ctx context.Context, backup DatabaseBackup, wrapper database.KeyWrapper, progress *Progress) (*database.Database, error) {
+	db := database.NewDatabase(backup.Name, backup.Auth)
+
+	if len(backup.DataKeys) > 0 {
+		if wrapper == nil {
+			return nil, fmt.Errorf("database is encrypted but no data encryption key is configured")
+		}
+		if err := db.LoadDataKeys(wrapper, backup.DataKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	// Restore sets
+	for setName, setBackup := range backup.Sets {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		set, err := db.CreateSet(setName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create set %s: %w", setName, err)
+		}
+
+		// Restore data
+		for key, value := range setBackup.Data {
+			if err := set.Put(key, value); err != nil {
+				return nil, fmt.Errorf("failed to put value for key %s in set %s: %w", key, setName, err)
 			}
-			
-			if err != nil {
-				logger.Error("Failed to create index %s: %v", indexBackup.Name, err)
-				continue
+		}
+		if len(setBackup.Sealed) > 0 && len(backup.DataKeys) == 0 {
+			return nil, fmt.Errorf("set %s has sealed values but the backup has no data keys", setName)
+		}
+		for key, sealed := range setBackup.Sealed {
+			if err := set.PutSealed(key, sealed); err != nil {
+				return nil, fmt.Errorf("failed to restore sealed value for key %s in set %s: %w", key, setName, err)
 			}
 		}
+		progress.addSet(setBackup.Len())
+	}
+
+	// Restore indexes; they are built from the restored data
+	for indexName, indexBackup := range backup.Indexes {
+		var err error
+
+		// Create the appropriate type of index
+		switch database.IndexType(indexBackup.Type) {
+		case database.BasicIndexType:
+			_, err = db.CreateIndex(indexName, indexBackup.SetName, indexBackup.Field)
+		case database.SortableIndexType:
+			_, err = db.CreateSortableIndex(indexName, indexBackup.SetName, indexBackup.Field, indexBackup.SortFields)
+		default:
+			err = fmt.Errorf("unknown index type %d", indexBackup.Type)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create index %s: %w", indexName, err)
+		}
+	}
+
+	if err := validateDatabase(db, backup); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// validateDatabase checks that a restored database holds everything in its backup
+func validateDatabase(db *database.Database, backup DatabaseBackup) error {
+	if len(db.ListSets()) != len(backup.Sets) {
+		return fmt.Errorf("restored %d sets, backup has %d", len(db.ListSets()), len(backup.Sets))
+	}
+
+	for setName, setBackup := range backup.Sets {
+		set, err := db.GetSet(setName)
+		if err != nil {
+			return fmt.Errorf("set %s missing after restore", setName)
+		}
+		if set.Size() != setBackup.Len() {
+			return fmt.Errorf("set %s has %d entries after restore, backup has %d", setName, set.Size(), setBackup.Len())
+		}
+	}
+
+	if len(db.ListIndexes()) != len(backup.Indexes) {
+		return fmt.Errorf("restored %d indexes, backup has %d", len(db.ListIndexes()), len(backup.Indexes))
 	}
 
-	logger.Info("Successfully restored %d databases from S3", len(fullBackup.Databases))
 	return nil
 }
 
-// ListBackups lists all backups in S3
+// ListBackups lists all backups in backup storage
 func (bm *BackupManager) ListBackups() ([]string, error) {
-	return bm.s3Client.ListFiles("backups/")
+	return bm.listBackupObjects("backups/")
 }
 
 // ListDatabaseBackups lists all backups for a specific database
 func (bm *BackupManager) ListDatabaseBackups(dbName string) ([]string, error) {
-	return bm.s3Client.ListFiles(fmt.Sprintf("backups/%s/", dbName))
+	return bm.listBackupObjects(fmt.Sprintf("backups/%s/", dbName))
 }
 
 // ListFullBackups lists all full backups
 func (bm *BackupManager) ListFullBackups() ([]string, error) {
-	return bm.s3Client.ListFiles("backups/full/")
-}
\ No newline at end of file
+	return bm.listBackupObjects("backups/full/")
+}
+
+// LatestFullBackup returns the name of the newest full backup, judged by the timestamp in its name
+// Objects whose name has no timestamp are ignored.
+func (bm *BackupManager) LatestFullBackup() (string, error) {
+	objects, err := bm.ListFullBackups()
+	if err != nil {
+		return "", fmt.Errorf("failed to list full backups: %w", err)
+	}
+
+	var latest string
+	var latestTime time.Time
+	for _, objectName := range objects {
+		timestamp, ok := ParseBackupTimestamp(objectName)
+		if !ok {
+			continue
+		}
+		if latest == "" || timestamp.After(latestTime) {
+			latest, latestTime = objectName, timestamp
+		}
+	}
+
+	if latest == "" {
+		return "", ErrNoBackups
+	}
+	return latest, nil
+}
+
+// listBackupObjects lists backup objects under a prefix, leaving out their manifests
+func (bm *BackupManager) listBackupObjects(prefix string) ([]string, error) {
+	objects, err := bm.storage.ListFiles(context.Background(), prefix)
+	if err != nil {
+		return nil, err
+	}
+	return filterBackupObjects(objects), nil
+}
@@ -0,0 +1,397 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+func testDatabaseBackup() DatabaseBackup {
+	return DatabaseBackup{
+		Name: "test_db",
+		Sets: map[string]SetBackup{
+			"users": {Name: "users", Data: map[string]interface{}{
+				"u1": map[string]interface{}{"name": "Alice", "age": 30},
+				"u2": map[string]interface{}{"name": "Bob", "age": 25},
+			}},
+		},
+		Indexes: map[string]IndexBackup{
+			"by_name": {Name: "by_name", SetName: "users", Field: "name", Type: int(database.BasicIndexType)},
+		},
+	}
+}
+
+func TestBuildDatabase(t *testing.T) {
+	db, err := buildDatabase(context.Background(), testDatabaseBackup(), nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to build database: %v", err)
+	}
+
+	set, err := db.GetSet("users")
+	if err != nil {
+		t.Fatalf("Expected set 'users' to exist: %v", err)
+	}
+	if set.Size() != 2 {
+		t.Errorf("Expected 2 entries, got %d", set.Size())
+	}
+
+	index, err := db.GetIndex("by_name")
+	if err != nil {
+		t.Fatalf("Expected index 'by_name' to exist: %v", err)
+	}
+	keys, _ := index.Query("Alice")
+	if len(keys) != 1 || keys[0] != "u1" {
+		t.Errorf("Expected index to be built from restored data, got %v", keys)
+	}
+}
+
+func TestBuildDatabaseFailsOnInvalidBackup(t *testing.T) {
+	backup := testDatabaseBackup()
+	backup.Indexes["orphaned"] = IndexBackup{Name: "orphaned", SetName: "missing", Field: "id", Type: int(database.BasicIndexType)}
+	if _, err := buildDatabase(context.Background(), backup, nil, nil); err == nil {
+		t.Errorf("Expected error for an index on a missing set")
+	}
+
+	backup = testDatabaseBackup()
+	backup.Indexes["by_name"] = IndexBackup{Name: "by_name", SetName: "users", Field: "name", Type: 99}
+	if _, err := buildDatabase(context.Background(), backup, nil, nil); err == nil {
+		t.Errorf("Expected error for an unknown index type")
+	}
+}
+
+func TestSelectDatabaseBackup(t *testing.T) {
+	backup := testDatabaseBackup()
+	backup.Sets["orders"] = SetBackup{Name: "orders", Data: map[string]interface{}{"o1": map[string]interface{}{"item": "book"}}}
+	databases := map[string]DatabaseBackup{"test_db": backup, "other_db": {Name: "other_db"}}
+
+	if _, err := selectDatabaseBackup(databases, RestoreOptions{}); err == nil {
+		t.Errorf("Expected error when a full backup has several databases and none is chosen")
+	}
+
+	selected, err := selectDatabaseBackup(databases, RestoreOptions{Database: "test_db", TargetName: "clone", Sets: []string{"orders"}})
+	if err != nil {
+		t.Fatalf("Failed to select database: %v", err)
+	}
+	if selected.Name != "clone" {
+		t.Errorf("Expected target name 'clone', got '%s'", selected.Name)
+	}
+	if len(selected.Sets) != 1 || selected.Sets["orders"].Name != "orders" {
+		t.Errorf("Expected only the orders set, got %v", selected.Sets)
+	}
+	if len(selected.Indexes) != 0 {
+		t.Errorf("Expected indexes on unselected sets to be dropped, got %v", selected.Indexes)
+	}
+
+	if _, err := selectDatabaseBackup(databases, RestoreOptions{Database: "test_db", Sets: []string{"missing"}}); err == nil {
+		t.Errorf("Expected error for a set missing from the backup")
+	}
+}
+
+func TestMergeDatabase(t *testing.T) {
+	live := database.NewDatabase("test_db", nil)
+	live.CreateSet("users")
+	live.Put("users", "u1", map[string]interface{}{"name": "Old Alice"})
+	live.Put("users", "u3", map[string]interface{}{"name": "Carol"})
+
+	src, err := buildDatabase(context.Background(), testDatabaseBackup(), nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to build database: %v", err)
+	}
+	if err := mergeDatabase(context.Background(), live, src, testDatabaseBackup()); err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+
+	users, _ := live.GetSet("users")
+	if users.Size() != 3 {
+		t.Errorf("Expected 3 entries after merge, got %d", users.Size())
+	}
+
+	var value map[string]interface{}
+	users.Get("u1", &value)
+	if value["name"] != "Alice" {
+		t.Errorf("Expected u1 to be overwritten by the backup, got %v", value["name"])
+	}
+
+	index, err := live.GetIndex("by_name")
+	if err != nil {
+		t.Fatalf("Expected index from backup to be created: %v", err)
+	}
+	if keys, _ := index.Query("Carol"); len(keys) != 1 {
+		t.Errorf("Expected index to cover data kept from the live database, got %v", keys)
+	}
+}
+
+func newTestBackupManager(t *testing.T) (*BackupManager, *database.Manager, *MemoryStorage) {
+	dbManager := database.NewManager()
+	storage := NewMemoryStorage()
+	return NewBackupManager(storage, dbManager), dbManager, storage
+}
+
+func TestBackupAndRestoreRoundTrip(t *testing.T) {
+	bm, dbManager, storage := newTestBackupManager(t)
+	bm.SetCompression(CompressionGzip)
+	bm.SetKeyring(NewKeyring(&EncryptionKey{ID: "k1", Key: testKey(1)}))
+
+	db, _ := dbManager.CreateDatabase("test_db", nil)
+	db.CreateSet("users")
+	db.Put("users", "u1", map[string]interface{}{"name": "Alice"})
+	db.CreateIndex("by_name", "users", "name")
+
+	if err := bm.BackupDatabase("test_db"); err != nil {
+		t.Fatalf("Failed to back up database: %v", err)
+	}
+
+	backups, err := bm.ListDatabaseBackups("test_db")
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("Expected one backup, got %v (%v)", backups, err)
+	}
+	objectName := backups[0]
+	if _, err := storage.GetFileInfo(context.Background(), ManifestObjectName(objectName)); err != nil {
+		t.Errorf("Expected a manifest next to the backup: %v", err)
+	}
+
+	report, err := bm.VerifyBackup(objectName)
+	if err != nil {
+		t.Fatalf("Failed to verify backup: %v", err)
+	}
+	if !report.Valid || !report.ChecksumVerified || report.EntryCount != 1 || report.Compression != CompressionGzip || !report.Encrypted {
+		t.Errorf("Unexpected verify report: %+v", report)
+	}
+
+	// Change live data, then restore
+	db.Put("users", "u2", map[string]interface{}{"name": "Bob"})
+	if err := bm.RestoreDatabase(objectName); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	restored, _ := dbManager.GetDatabase("test_db")
+	users, _ := restored.GetSet("users")
+	if users.Size() != 1 || !users.Has("u1") {
+		t.Errorf("Expected restored database to match the backup")
+	}
+}
+
+func TestBackupEncryptedDatabase(t *testing.T) {
+	bm, dbManager, storage := newTestBackupManager(t)
+	dbManager.SetKeyWrapper(NewKeyring(&EncryptionKey{ID: "master", Key: testKey(1)}))
+
+	db, _ := dbManager.CreateDatabase("test_db", nil)
+	db.EnableEncryption(dbManager.KeyWrapper())
+	db.CreateSet("users")
+	db.Put("users", "u1", map[string]interface{}{"email": "alice@example.com"})
+	db.CreateIndex("by_email", "users", "email")
+
+	objectName, err := bm.BackupDatabaseContext(t.Context(), "test_db", nil)
+	if err != nil {
+		t.Fatalf("Failed to back up database: %v", err)
+	}
+
+	// Values are backed up sealed, with the wrapped data keys
+	data, _ := storage.DownloadFile(context.Background(), objectName)
+	if strings.Contains(string(data), "alice@example.com") {
+		t.Errorf("Expected the backup not to hold plaintext values")
+	}
+	if report, err := bm.VerifyBackup(objectName); err != nil || !report.Valid || report.EntryCount != 1 {
+		t.Errorf("Unexpected verify report: %+v (%v)", report, err)
+	}
+
+	// Restoring needs the master key
+	dbManager.SetKeyWrapper(nil)
+	if err := bm.RestoreDatabase(objectName); err == nil {
+		t.Errorf("Expected restoring without the master key to fail")
+	}
+	dbManager.SetKeyWrapper(NewKeyring(&EncryptionKey{ID: "master", Key: testKey(1)}))
+	if err := bm.RestoreDatabase(objectName); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+
+	// Sealed values are read back only with the master key
+	databases, _, err := bm.ReadBackup(objectName)
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+	if _, err := databases["test_db"].SetValues("users", nil); err == nil {
+		t.Errorf("Expected reading sealed values without the master key to fail")
+	}
+	values, err := databases["test_db"].SetValues("users", dbManager.KeyWrapper())
+	if user, ok := values["u1"].(map[string]interface{}); err != nil || !ok || user["email"] != "alice@example.com" {
+		t.Errorf("Expected the sealed value to be opened, got %v (%v)", values, err)
+	}
+
+	restored, _ := dbManager.GetDatabase("test_db")
+	if !restored.Encrypted() {
+		t.Errorf("Expected the restored database to be encrypted")
+	}
+	index, _ := restored.GetIndex("by_email")
+	if keys, _ := index.Query("alice@example.com"); len(keys) != 1 {
+		t.Errorf("Expected the index to be built from the opened values, got %v", keys)
+	}
+}
+
+func TestRestoreLegacyPlaintextPassword(t *testing.T) {
+	bm, dbManager, storage := newTestBackupManager(t)
+
+	// Backups written before format version 3 hold the plaintext password
+	legacy := `{"name":"test_db","sets":{},"indexes":{},"auth":{"Username":"admin","Password":"secret","Enabled":true}}`
+	objectName := "backups/test_db/20240101-000000.json"
+	storage.UploadFile(context.Background(), objectName, []byte(legacy), "application/json", nil)
+
+	if err := bm.RestoreDatabase(objectName); err != nil {
+		t.Fatalf("Failed to restore legacy backup: %v", err)
+	}
+	db, _ := dbManager.GetDatabase("test_db")
+	if !db.Authenticate("admin", "secret") || db.Authenticate("admin", "wrong") {
+		t.Errorf("Expected the legacy password to authenticate the restored database")
+	}
+
+	// Backing up again writes only the hash
+	newName, err := bm.BackupDatabaseContext(t.Context(), "test_db", nil)
+	if err != nil {
+		t.Fatalf("Failed to back up database: %v", err)
+	}
+	data, err := storage.DownloadFile(context.Background(), newName)
+	if err != nil {
+		t.Fatalf("Failed to download backup: %v", err)
+	}
+	if strings.Contains(string(data), "secret") || !strings.Contains(string(data), db.Auth.PasswordHash) {
+		t.Errorf("Expected the backup to hold only the password hash, got %s", data)
+	}
+}
+
+func TestFullBackupFormatVersion(t *testing.T) {
+	bm, dbManager, storage := newTestBackupManager(t)
+	dbManager.CreateDatabase("test_db", nil)
+
+	// Full backups record the format version they were written in
+	objectName, err := bm.BackupAllDatabasesContext(t.Context(), nil)
+	if err != nil {
+		t.Fatalf("Failed to back up databases: %v", err)
+	}
+	_, metadata, err := bm.ReadBackup(objectName)
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+	if version, err := metadata.FormatVersion(); err != nil || version != BackupFormatVersion {
+		t.Errorf("Expected format version %d, got %d (%v)", BackupFormatVersion, version, err)
+	}
+
+	// Backups from before format versions were recorded are still restored
+	legacy := `{"metadata":{"version":"1.0.0"},"databases":{"test_db":{"name":"test_db","sets":{},"indexes":{}}}}`
+	objectName = "backups/full/20240101-000000.json"
+	storage.UploadFile(context.Background(), objectName, []byte(legacy), "application/json", nil)
+	if err := bm.RestoreAllDatabases(objectName); err != nil {
+		t.Errorf("Failed to restore legacy backup: %v", err)
+	}
+
+	// Backups in a newer format are refused rather than restored incompletely
+	newer := fmt.Sprintf(`{"metadata":{"version":"%d"},"databases":{}}`, BackupFormatVersion+1)
+	objectName = "backups/full/20240102-000000.json"
+	storage.UploadFile(context.Background(), objectName, []byte(newer), "application/json", nil)
+	if err := bm.RestoreAllDatabases(objectName); err == nil {
+		t.Errorf("Expected a backup in a newer format to be refused")
+	}
+	if _, _, err := bm.ReadBackup(objectName); err == nil {
+		t.Errorf("Expected a backup in a newer format to fail to read")
+	}
+}
+
+func TestRestoreLeavesDatabaseUntouchedOnFailure(t *testing.T) {
+	bm, dbManager, storage := newTestBackupManager(t)
+
+	db, _ := dbManager.CreateDatabase("test_db", nil)
+	db.CreateSet("users")
+	db.Put("users", "u1", map[string]interface{}{"name": "Alice"})
+
+	if err := bm.BackupDatabase("test_db"); err != nil {
+		t.Fatalf("Failed to back up database: %v", err)
+	}
+	backups, _ := bm.ListDatabaseBackups("test_db")
+	objectName := backups[0]
+
+	// Corrupt the stored backup
+	data, _ := storage.DownloadFile(context.Background(), objectName)
+	data[len(data)/2] ^= 0xff
+	storage.UploadFile(context.Background(), objectName, data, "application/json", nil)
+
+	report, err := bm.VerifyBackup(objectName)
+	if err != nil {
+		t.Fatalf("Failed to verify backup: %v", err)
+	}
+	if report.Valid || report.ChecksumVerified {
+		t.Errorf("Expected corrupted backup to be reported as invalid")
+	}
+
+	db.Put("users", "u2", map[string]interface{}{"name": "Bob"})
+	if err := bm.RestoreDatabase(objectName); err == nil {
+		t.Fatalf("Expected restore of a corrupted backup to fail")
+	}
+
+	live, _ := dbManager.GetDatabase("test_db")
+	if live != db {
+		t.Errorf("Expected the live database to be left in place")
+	}
+	users, _ := live.GetSet("users")
+	if users.Size() != 2 {
+		t.Errorf("Expected live data to be untouched, got %d entries", users.Size())
+	}
+}
+
+func TestPruneBackupsDeletesManifests(t *testing.T) {
+	bm, _, storage := newTestBackupManager(t)
+	bm.SetRetentionPolicy(&config.RetentionConfig{KeepLast: 1})
+
+	for _, name := range []string{"backups/full/20250101-000000.json", "backups/full/20250102-000000.json"} {
+		storage.UploadFile(context.Background(), name, []byte(`{}`), "application/json", nil)
+		storage.UploadFile(context.Background(), ManifestObjectName(name), []byte(`{}`), "application/json", nil)
+	}
+
+	result, err := bm.PruneBackups(true)
+	if err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	if len(result.Pruned) != 1 {
+		t.Errorf("Expected one backup to be pruned in the dry run, got %v", result.Pruned)
+	}
+	if objects, _ := storage.ListFiles(context.Background(), "backups/"); len(objects) != 4 {
+		t.Errorf("Expected a dry run to delete nothing, got %v", objects)
+	}
+
+	if _, err := bm.PruneBackups(false); err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	objects, _ := storage.ListFiles(context.Background(), "backups/")
+	if len(objects) != 2 || objects[0] != "backups/full/20250102-000000.json" {
+		t.Errorf("Expected only the newest backup and its manifest to remain, got %v", objects)
+	}
+}
+
+func TestLatestFullBackup(t *testing.T) {
+	bm, _, storage := newTestBackupManager(t)
+
+	if _, err := bm.LatestFullBackup(); !errors.Is(err, ErrNoBackups) {
+		t.Errorf("Expected ErrNoBackups, got %v", err)
+	}
+
+	for _, name := range []string{
+		"backups/full/20250102-000000.json.zst.enc",
+		"backups/full/20250103-000000.json",
+		"backups/full/20250101-000000.json.gz",
+		"backups/full/latest.json",
+		"backups/test_db/20250201-000000.json",
+	} {
+		storage.UploadFile(context.Background(), name, []byte(`{}`), "application/json", nil)
+	}
+	storage.UploadFile(context.Background(), ManifestObjectName("backups/full/20250103-000000.json"), []byte(`{}`), "application/json", nil)
+
+	latest, err := bm.LatestFullBackup()
+	if err != nil {
+		t.Fatalf("Failed to find latest full backup: %v", err)
+	}
+	if latest != "backups/full/20250103-000000.json" {
+		t.Errorf("Expected backups/full/20250103-000000.json, got %s", latest)
+	}
+}
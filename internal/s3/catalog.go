@@ -0,0 +1,224 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/logger"
+)
+
+// BackupFormatVersion is the version of the backup format written by this server
+// Backups written before format versions were recorded are reported as version 1. Version 3
+// stores database password hashes; the plaintext passwords of older backups are hashed
+// when they are read.
+const BackupFormatVersion = 3
+
+// AllDatabases is the database recorded for full backups
+const AllDatabases = "all"
+
+// Object metadata keys describing a backup for the catalog
+const (
+	MetadataFormatVersion = "Fuckbase-Format-Version"
+	MetadataServerVersion = "Fuckbase-Server-Version"
+	MetadataDatabase      = "Fuckbase-Database"
+	MetadataCreatedAt     = "Fuckbase-Created-At"
+	MetadataDatabaseCount = "Fuckbase-Database-Count"
+	MetadataSetCount      = "Fuckbase-Set-Count"
+	MetadataEntryCount    = "Fuckbase-Entry-Count"
+	MetadataChecksum      = "Fuckbase-Checksum"
+)
+
+// BackupEntry describes a backup in the catalog
+type BackupEntry struct {
+	Name          string    `json:"name"`
+	Database      string    `json:"database"` // "all" for full backups
+	Timestamp     time.Time `json:"timestamp"`
+	Size          int64     `json:"size"`
+	FormatVersion int       `json:"format_version"`
+	ServerVersion string    `json:"server_version,omitempty"`
+	DatabaseCount int       `json:"database_count"`
+	SetCount      int       `json:"set_count"`
+	EntryCount    int       `json:"entry_count"`
+	Checksum      string    `json:"checksum,omitempty"`
+	Compression   string    `json:"compression,omitempty"`
+	Encrypted     bool      `json:"encrypted"`
+	KeyID         string    `json:"key_id,omitempty"`
+}
+
+// CatalogQuery selects backups from the catalog
+type CatalogQuery struct {
+	Database string    // "all" for full backups only; empty for every backup
+	Since    time.Time // Only backups taken at or after this time; zero for no bound
+	Until    time.Time // Only backups taken before this time; zero for no bound
+	Offset   int
+	Limit    int // Zero for no limit
+}
+
+// Catalog lists backups matching the query, newest first
+// It returns one page of entries and the total number of matching backups. Backups
+// whose information cannot be read are logged and skipped.
+func (bm *BackupManager) Catalog(query CatalogQuery) ([]BackupEntry, int, error) {
+	prefix := "backups/"
+	switch query.Database {
+	case "":
+	case AllDatabases:
+		prefix = "backups/full/"
+	default:
+		prefix = fmt.Sprintf("backups/%s/", query.Database)
+	}
+
+	objects, err := bm.listBackupObjects(prefix)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]BackupEntry, 0, len(objects))
+	for _, objectName := range objects {
+		entry, err := bm.catalogEntry(objectName)
+		if err != nil {
+			logger.Error("Failed to get info for backup %s: %v", objectName, err)
+			continue
+		}
+		if query.Database != "" && entry.Database != query.Database {
+			continue
+		}
+		if !query.Since.IsZero() && entry.Timestamp.Before(query.Since) {
+			continue
+		}
+		if !query.Until.IsZero() && !entry.Timestamp.Before(query.Until) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Timestamp.Equal(entries[j].Timestamp) {
+			return entries[i].Timestamp.After(entries[j].Timestamp)
+		}
+		return entries[i].Name > entries[j].Name
+	})
+
+	total := len(entries)
+	if query.Offset >= total {
+		return []BackupEntry{}, total, nil
+	}
+	entries = entries[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(entries) {
+		entries = entries[:query.Limit]
+	}
+	return entries, total, nil
+}
+
+// catalogEntry describes a backup from its object metadata
+// Backups written before catalog metadata existed are described from their manifest,
+// or failing that from their name and the object's modification time.
+func (bm *BackupManager) catalogEntry(objectName string) (BackupEntry, error) {
+	info, err := bm.storage.GetFileInfo(context.Background(), objectName)
+	if err != nil {
+		return BackupEntry{}, err
+	}
+
+	entry := BackupEntry{
+		Name:          objectName,
+		Size:          info.Size,
+		FormatVersion: 1,
+		Encrypted:     strings.HasSuffix(objectName, EncryptedBackupSuffix),
+		Compression:   metadataValue(info.Metadata, MetadataCompression),
+		KeyID:         metadataValue(info.Metadata, MetadataKeyID),
+	}
+	if entry.Compression == "" {
+		entry.Compression = compressionFromName(objectName)
+	}
+
+	if version, err := strconv.Atoi(metadataValue(info.Metadata, MetadataFormatVersion)); err == nil {
+		entry.FormatVersion = version
+		entry.ServerVersion = metadataValue(info.Metadata, MetadataServerVersion)
+		entry.Database = metadataValue(info.Metadata, MetadataDatabase)
+		entry.Checksum = metadataValue(info.Metadata, MetadataChecksum)
+		entry.DatabaseCount, _ = strconv.Atoi(metadataValue(info.Metadata, MetadataDatabaseCount))
+		entry.SetCount, _ = strconv.Atoi(metadataValue(info.Metadata, MetadataSetCount))
+		entry.EntryCount, _ = strconv.Atoi(metadataValue(info.Metadata, MetadataEntryCount))
+		entry.Timestamp, _ = time.Parse(time.RFC3339Nano, metadataValue(info.Metadata, MetadataCreatedAt))
+	} else if manifest, err := getManifest(context.Background(), bm.storage, objectName); err == nil {
+		if manifest.FormatVersion > 0 {
+			entry.FormatVersion = manifest.FormatVersion
+		}
+		entry.ServerVersion = manifest.ServerVersion
+		entry.Checksum = manifest.Checksum
+		entry.DatabaseCount = manifest.DatabaseCount
+		entry.SetCount = manifest.SetCount
+		entry.EntryCount = manifest.EntryCount
+		entry.Timestamp = manifest.CreatedAt
+		if entry.KeyID == "" {
+			entry.KeyID = manifest.KeyID
+		}
+	}
+
+	if entry.Database == "" {
+		entry.Database = databaseFromName(objectName)
+	}
+	if entry.Timestamp.IsZero() {
+		if timestamp, ok := ParseBackupTimestamp(objectName); ok {
+			entry.Timestamp = timestamp
+		} else {
+			entry.Timestamp = info.LastModified
+		}
+	}
+
+	return entry, nil
+}
+
+// catalogMetadata returns the object metadata recording a backup's manifest for the catalog
+func catalogMetadata(manifest *BackupManifest) map[string]string {
+	return map[string]string{
+		MetadataFormatVersion: strconv.Itoa(manifest.FormatVersion),
+		MetadataServerVersion: manifest.ServerVersion,
+		MetadataDatabase:      manifest.Database,
+		MetadataCreatedAt:     manifest.CreatedAt.Format(time.RFC3339Nano),
+		MetadataDatabaseCount: strconv.Itoa(manifest.DatabaseCount),
+		MetadataSetCount:      strconv.Itoa(manifest.SetCount),
+		MetadataEntryCount:    strconv.Itoa(manifest.EntryCount),
+		MetadataChecksum:      manifest.Checksum,
+	}
+}
+
+// metadataValue looks up an object metadata key
+// S3 returns keys in canonical header form, so the lookup ignores case.
+func metadataValue(metadata map[string]string, key string) string {
+	if value, ok := metadata[key]; ok {
+		return value
+	}
+	for k, value := range metadata {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+	return ""
+}
+
+// databaseFromName returns the database of a backup from its object name
+func databaseFromName(objectName string) string {
+	if IsFullBackupObject(objectName) {
+		return AllDatabases
+	}
+	parts := strings.Split(objectName, "/")
+	if len(parts) >= 3 {
+		return parts[1]
+	}
+	return ""
+}
+
+// compressionFromName returns the compression codec of a backup from its object name suffix
+func compressionFromName(objectName string) string {
+	name := strings.TrimSuffix(objectName, EncryptedBackupSuffix)
+	for _, codec := range []string{CompressionGzip, CompressionZstd} {
+		if strings.HasSuffix(name, CompressionSuffix(codec)) {
+			return codec
+		}
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/version"
+)
+
+func TestCatalog(t *testing.T) {
+	bm, dbManager, storage := newTestBackupManager(t)
+	bm.SetCompression(CompressionZstd)
+
+	db, _ := dbManager.CreateDatabase("test_db", nil)
+	db.CreateSet("users")
+	db.Put("users", "u1", map[string]interface{}{"name": "Alice"})
+	db.Put("users", "u2", map[string]interface{}{"name": "Bob"})
+
+	objectName, err := bm.BackupDatabaseContext(t.Context(), "test_db", nil)
+	if err != nil {
+		t.Fatalf("Failed to back up database: %v", err)
+	}
+
+	// A backup written before catalog metadata existed, described by its manifest
+	legacyManifest, _ := json.Marshal(BackupManifest{
+		Object:        "backups/full/20240101-000000.json",
+		Checksum:      "sha256:legacy",
+		CreatedAt:     time.Date(2024, 1, 1, 0, 0, 5, 0, time.UTC),
+		DatabaseCount: 2,
+		SetCount:      3,
+		EntryCount:    4,
+	})
+	storage.UploadFile(context.Background(), "backups/full/20240101-000000.json", []byte("{}"), "application/json", nil)
+	storage.UploadFile(context.Background(), ManifestObjectName("backups/full/20240101-000000.json"), legacyManifest, "application/json", nil)
+
+	// A backup with neither metadata nor manifest, described by its name
+	storage.UploadFile(context.Background(), "backups/test_db/20230601-120000.json", []byte("{}"), "application/json", nil)
+
+	entries, total, err := bm.Catalog(CatalogQuery{})
+	if err != nil {
+		t.Fatalf("Failed to list catalog: %v", err)
+	}
+	if total != 3 || len(entries) != 3 {
+		t.Fatalf("Expected 3 backups, got %d of %d", len(entries), total)
+	}
+
+	// Newest first
+	current := entries[0]
+	if current.Name != objectName || current.Database != "test_db" {
+		t.Errorf("Expected the new backup first, got %+v", current)
+	}
+	if current.FormatVersion != BackupFormatVersion || current.ServerVersion != version.Version {
+		t.Errorf("Unexpected versions: %+v", current)
+	}
+	if current.DatabaseCount != 1 || current.SetCount != 1 || current.EntryCount != 2 || current.Compression != CompressionZstd {
+		t.Errorf("Unexpected counts or compression: %+v", current)
+	}
+	manifest, err := bm.GetManifest(objectName)
+	if err != nil || current.Checksum != manifest.Checksum || !current.Timestamp.Equal(manifest.CreatedAt) {
+		t.Errorf("Expected catalog to match the manifest %+v, got %+v", manifest, current)
+	}
+
+	legacy := entries[1]
+	if legacy.Database != AllDatabases || legacy.FormatVersion != 1 || legacy.EntryCount != 4 || legacy.Checksum != "sha256:legacy" {
+		t.Errorf("Unexpected legacy entry: %+v", legacy)
+	}
+	if !legacy.Timestamp.Equal(time.Date(2024, 1, 1, 0, 0, 5, 0, time.UTC)) {
+		t.Errorf("Expected the manifest time, got %s", legacy.Timestamp)
+	}
+
+	bare := entries[2]
+	if bare.Database != "test_db" || !bare.Timestamp.Equal(time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected entry for a backup without metadata: %+v", bare)
+	}
+
+	// Filter by database
+	entries, total, _ = bm.Catalog(CatalogQuery{Database: AllDatabases})
+	if total != 1 || entries[0].Name != "backups/full/20240101-000000.json" {
+		t.Errorf("Expected only the full backup, got %+v", entries)
+	}
+
+	// Filter by time range
+	entries, total, _ = bm.Catalog(CatalogQuery{
+		Since: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC),
+		Until: time.Date(2024, 1, 1, 0, 0, 5, 0, time.UTC),
+	})
+	if total != 1 || entries[0].Name != "backups/test_db/20230601-120000.json" {
+		t.Errorf("Expected since to be inclusive and until exclusive, got %+v", entries)
+	}
+
+	// Paginate
+	entries, total, _ = bm.Catalog(CatalogQuery{Offset: 1, Limit: 1})
+	if total != 3 || len(entries) != 1 || entries[0].Name != legacy.Name {
+		t.Errorf("Expected the second backup on the second page, got %+v of %d", entries, total)
+	}
+	entries, total, _ = bm.Catalog(CatalogQuery{Offset: 5})
+	if total != 3 || len(entries) != 0 {
+		t.Errorf("Expected an empty page past the end, got %+v of %d", entries, total)
+	}
+}
+
+func TestMetadataValue(t *testing.T) {
+	metadata := map[string]string{"fuckbase-database": "test_db"}
+	if v := metadataValue(metadata, MetadataDatabase); v != "test_db" {
+		t.Errorf("Expected lookup to ignore case, got %q", v)
+	}
+	if v := metadataValue(metadata, MetadataChecksum); v != "" {
+		t.Errorf("Expected empty value for a missing key, got %q", v)
+	}
+}
@@ -3,12 +3,20 @@ package s3
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 	"github.com/ssig33/fuckbase/internal/config"
 	"github.com/ssig33/fuckbase/internal/logger"
 )
@@ -18,19 +26,45 @@ type Client struct {
 	client     *minio.Client
 	config     *config.S3Config
 	bucketName string
+	sse        encrypt.ServerSide
 }
 
+// maxRetryDelay caps the delay between retries of an operation
+const maxRetryDelay = 30 * time.Second
+
 // NewClient creates a new S3 client with the given configuration
 func NewClient(cfg *config.S3Config) (*Client, error) {
 	if !cfg.Enabled {
 		return nil, fmt.Errorf("S3 is not enabled in configuration")
 	}
 
+	endpoint, secure := splitEndpoint(cfg.Endpoint, cfg.UseSSL)
+
+	lookup, err := parseBucketLookup(cfg.BucketLookup)
+	if err != nil {
+		return nil, err
+	}
+
+	sse, err := newServerSideEncryption(cfg.SSE, cfg.SSEKMSKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := newTransport(secure, cfg.CABundle)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize MinIO client
-	minioClient, err := minio.New(cfg.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
-		Secure: false, // Set to true for HTTPS
-		Region: cfg.Region,
+	minioClient, err := minio.New(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       secure,
+		Transport:    transport,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+		// Operations are retried by withRetry with the configured policy; minio-go's own
+		// retries of each request would multiply the attempts and ignore that policy.
+		MaxRetries: 1,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create S3 client: %w", err)
@@ -40,28 +74,191 @@ func NewClient(cfg *config.S3Config) (*Client, error) {
 		client:     minioClient,
 		config:     cfg,
 		bucketName: cfg.Bucket,
+		sse:        sse,
 	}
 
 	// Ensure bucket exists
-	if err := client.ensureBucketExists(); err != nil {
+	if err := client.ensureBucketExists(context.Background()); err != nil {
 		return nil, fmt.Errorf("failed to ensure bucket exists: %w", err)
 	}
 
 	return client, nil
 }
 
+// splitEndpoint strips the scheme from an endpoint URL
+// minio-go expects a bare host:port; an https:// scheme enables HTTPS.
+func splitEndpoint(endpoint string, useSSL bool) (string, bool) {
+	switch {
+	case strings.HasPrefix(endpoint, "https://"):
+		return strings.TrimSuffix(strings.TrimPrefix(endpoint, "https://"), "/"), true
+	case strings.HasPrefix(endpoint, "http://"):
+		return strings.TrimSuffix(strings.TrimPrefix(endpoint, "http://"), "/"), useSSL
+	default:
+		return endpoint, useSSL
+	}
+}
+
+// parseBucketLookup converts a bucket addressing style to its minio-go type
+func parseBucketLookup(lookup string) (minio.BucketLookupType, error) {
+	switch strings.ToLower(lookup) {
+	case "", "auto":
+		return minio.BucketLookupAuto, nil
+	case "path":
+		return minio.BucketLookupPath, nil
+	case "dns", "virtual-host":
+		return minio.BucketLookupDNS, nil
+	default:
+		return minio.BucketLookupAuto, fmt.Errorf("unsupported S3 bucket lookup: %s", lookup)
+	}
+}
+
+// newServerSideEncryption returns the server-side encryption requested for uploads
+// It returns nil when server-side encryption is disabled.
+func newServerSideEncryption(mode string, kmsKeyID string) (encrypt.ServerSide, error) {
+	switch strings.ToLower(mode) {
+	case "", "none":
+		return nil, nil
+	case "sse-s3":
+		return encrypt.NewSSE(), nil
+	case "sse-kms":
+		if kmsKeyID == "" {
+			return nil, fmt.Errorf("sse-kms requires a KMS key ID")
+		}
+		sse, err := encrypt.NewSSEKMS(kmsKeyID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSE-KMS configuration: %w", err)
+		}
+		return sse, nil
+	default:
+		return nil, fmt.Errorf("unsupported S3 server-side encryption: %s", mode)
+	}
+}
+
+// newTransport creates the HTTP transport of the client
+// The certificates in caBundle, if set, are trusted in addition to the system ones.
+func newTransport(secure bool, caBundle string) (*http.Transport, error) {
+	transport, err := minio.DefaultTransport(secure)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 transport: %w", err)
+	}
+	if caBundle == "" {
+		return transport, nil
+	}
+
+	pem, err := os.ReadFile(caBundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read S3 CA bundle: %w", err)
+	}
+
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		rootCAs = x509.NewCertPool()
+	}
+	if !rootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in S3 CA bundle %s", caBundle)
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	transport.TLSClientConfig.RootCAs = rootCAs
+	return transport, nil
+}
+
+// withRetry runs an operation, retrying it with exponential backoff while it fails with a transient error
+// Each attempt gets its own context derived from ctx and bounded by the configured timeout.
+// Once ctx is done, no further attempt is made.
+func (c *Client) withRetry(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := c.attemptContext(ctx)
+		err := fn(attemptCtx)
+		cancel()
+
+		if err == nil || ctx.Err() != nil || attempt >= c.config.MaxRetries || !isRetryable(err) {
+			return err
+		}
+
+		delay := retryBackoff(c.config.RetryDelay, attempt)
+		logger.Warn("S3 %s failed (attempt %d of %d), retrying in %s: %v", op, attempt+1, c.config.MaxRetries+1, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// attemptContext returns the context of one attempt of an operation
+func (c *Client) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.config.Timeout > 0 {
+		return context.WithTimeout(ctx, c.config.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// retryBackoff returns the delay before the retry following the given attempt
+// The base delay doubles after each attempt, up to maxRetryDelay.
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// isRetryable reports whether an operation that failed with err may succeed if retried
+// Client errors such as a missing object or denied access are permanent, except for
+// request timeouts and throttling.
+func isRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	resp := minio.ToErrorResponse(err)
+	switch resp.Code {
+	case "NoSuchKey", "NoSuchBucket", "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "InvalidBucketName":
+		return false
+	}
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return false
+	}
+
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalidCert x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &invalidCert) || errors.As(err, &hostname) {
+		return false
+	}
+	return true
+}
+
 // ensureBucketExists checks if the bucket exists and creates it if it doesn't
-func (c *Client) ensureBucketExists() error {
-	ctx := context.Background()
-	exists, err := c.client.BucketExists(ctx, c.bucketName)
+func (c *Client) ensureBucketExists(ctx context.Context) error {
+	var exists bool
+	err := c.withRetry(ctx, "bucket check", func(ctx context.Context) error {
+		var err error
+		exists, err = c.client.BucketExists(ctx, c.bucketName)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to check if bucket exists: %w", err)
 	}
 
 	if !exists {
 		logger.Info("Creating bucket: %s", c.bucketName)
-		err = c.client.MakeBucket(ctx, c.bucketName, minio.MakeBucketOptions{
-			Region: c.config.Region,
+		err = c.withRetry(ctx, "bucket creation", func(ctx context.Context) error {
+			return c.client.MakeBucket(ctx, c.bucketName, minio.MakeBucketOptions{
+				Region: c.config.Region,
+			})
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create bucket: %w", err)
@@ -72,11 +269,14 @@ func (c *Client) ensureBucketExists() error {
 }
 
 // UploadFile uploads a file to S3
-func (c *Client) UploadFile(objectName string, data []byte, contentType string) error {
-	ctx := context.Background()
-	reader := bytes.NewReader(data)
-	_, err := c.client.PutObject(ctx, c.bucketName, objectName, reader, int64(len(data)),
-		minio.PutObjectOptions{ContentType: contentType})
+// The metadata is stored as user-defined object metadata and may be nil
+func (c *Client) UploadFile(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	err := c.withRetry(ctx, "upload of "+objectName, func(ctx context.Context) error {
+		reader := bytes.NewReader(data)
+		_, err := c.client.PutObject(ctx, c.bucketName, objectName, reader, int64(len(data)),
+			minio.PutObjectOptions{ContentType: contentType, UserMetadata: metadata, ServerSideEncryption: c.sse})
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to upload file: %w", err)
 	}
@@ -86,17 +286,23 @@ func (c *Client) UploadFile(objectName string, data []byte, contentType string)
 }
 
 // DownloadFile downloads a file from S3
-func (c *Client) DownloadFile(objectName string) ([]byte, error) {
-	ctx := context.Background()
-	obj, err := c.client.GetObject(ctx, c.bucketName, objectName, minio.GetObjectOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get object: %w", err)
-	}
-	defer obj.Close()
+func (c *Client) DownloadFile(ctx context.Context, objectName string) ([]byte, error) {
+	var data []byte
+	err := c.withRetry(ctx, "download of "+objectName, func(ctx context.Context) error {
+		obj, err := c.client.GetObject(ctx, c.bucketName, objectName, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		defer obj.Close()
 
-	data, err := io.ReadAll(obj)
+		data, err = io.ReadAll(obj)
+		return err
+	})
+	if isNoSuchKey(err) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectName)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to read object data: %w", err)
+		return nil, fmt.Errorf("failed to download object: %w", err)
 	}
 
 	logger.Info("Successfully downloaded %s from %s", objectName, c.bucketName)
@@ -104,28 +310,35 @@ func (c *Client) DownloadFile(objectName string) ([]byte, error) {
 }
 
 // ListFiles lists all files in the bucket with the given prefix
-func (c *Client) ListFiles(prefix string) ([]string, error) {
-	ctx := context.Background()
-	objectCh := c.client.ListObjects(ctx, c.bucketName, minio.ListObjectsOptions{
-		Prefix:    prefix,
-		Recursive: true,
-	})
-
+func (c *Client) ListFiles(ctx context.Context, prefix string) ([]string, error) {
 	var objects []string
-	for object := range objectCh {
-		if object.Err != nil {
-			return nil, fmt.Errorf("error listing objects: %w", object.Err)
+	err := c.withRetry(ctx, "listing of "+prefix, func(ctx context.Context) error {
+		objects = nil
+		objectCh := c.client.ListObjects(ctx, c.bucketName, minio.ListObjectsOptions{
+			Prefix:    prefix,
+			Recursive: true,
+		})
+
+		for object := range objectCh {
+			if object.Err != nil {
+				return object.Err
+			}
+			objects = append(objects, object.Key)
 		}
-		objects = append(objects, object.Key)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing objects: %w", err)
 	}
 
 	return objects, nil
 }
 
 // DeleteFile deletes a file from S3
-func (c *Client) DeleteFile(objectName string) error {
-	ctx := context.Background()
-	err := c.client.RemoveObject(ctx, c.bucketName, objectName, minio.RemoveObjectOptions{})
+func (c *Client) DeleteFile(ctx context.Context, objectName string) error {
+	err := c.withRetry(ctx, "deletion of "+objectName, func(ctx context.Context) error {
+		return c.client.RemoveObject(ctx, c.bucketName, objectName, minio.RemoveObjectOptions{})
+	})
 	if err != nil {
 		return fmt.Errorf("failed to delete object: %w", err)
 	}
@@ -135,24 +348,61 @@ func (c *Client) DeleteFile(objectName string) error {
 }
 
 // GetFileInfo gets information about a file in S3
-func (c *Client) GetFileInfo(objectName string) (*minio.ObjectInfo, error) {
-	ctx := context.Background()
-	info, err := c.client.StatObject(ctx, c.bucketName, objectName, minio.StatObjectOptions{})
+func (c *Client) GetFileInfo(ctx context.Context, objectName string) (*FileInfo, error) {
+	var info minio.ObjectInfo
+	err := c.withRetry(ctx, "stat of "+objectName, func(ctx context.Context) error {
+		var err error
+		info, err = c.client.StatObject(ctx, c.bucketName, objectName, minio.StatObjectOptions{})
+		return err
+	})
+	if isNoSuchKey(err) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectName)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get object info: %w", err)
 	}
 
-	return &info, nil
+	return &FileInfo{
+		Name:         info.Key,
+		Size:         info.Size,
+		LastModified: info.LastModified,
+		ContentType:  info.ContentType,
+		Metadata:     info.UserMetadata,
+	}, nil
+}
+
+// isNoSuchKey reports whether err is an S3 error for a missing object
+func isNoSuchKey(err error) bool {
+	return err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey"
 }
 
 // GenerateBackupObjectName generates a unique object name for a backup
 func GenerateBackupObjectName(databaseName string) string {
-	timestamp := time.Now().UTC().Format("20060102-150405")
+	timestamp := time.Now().UTC().Format(backupTimestampLayout)
 	return fmt.Sprintf("backups/%s/%s.json", databaseName, timestamp)
 }
 
 // GenerateFullBackupObjectName generates a unique object name for a full backup
 func GenerateFullBackupObjectName() string {
-	timestamp := time.Now().UTC().Format("20060102-150405")
+	timestamp := time.Now().UTC().Format(backupTimestampLayout)
 	return fmt.Sprintf("backups/full/%s.json", timestamp)
-}
\ No newline at end of file
+}
+
+// backupTimestampLayout is the timestamp format used in backup object names
+const backupTimestampLayout = "20060102-150405"
+
+// ParseBackupTimestamp extracts the timestamp from a backup object name
+// It returns false if the object name does not follow the backup naming scheme
+func ParseBackupTimestamp(objectName string) (time.Time, bool) {
+	fileName := path.Base(objectName)
+	if len(fileName) < len(backupTimestampLayout) {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(backupTimestampLayout, fileName[:len(backupTimestampLayout)])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
@@ -0,0 +1,190 @@
+package s3
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/ssig33/fuckbase/internal/config"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	base := 100 * time.Millisecond
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond}
+	for attempt, want := range expected {
+		if got := retryBackoff(base, attempt); got != want {
+			t.Errorf("Expected backoff %s after attempt %d, got %s", want, attempt, got)
+		}
+	}
+	if got := retryBackoff(base, 50); got != maxRetryDelay {
+		t.Errorf("Expected backoff to be capped at %s, got %s", maxRetryDelay, got)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"network error", errors.New("connection reset by peer"), true},
+		{"timeout", context.DeadlineExceeded, true},
+		{"server error", minio.ErrorResponse{Code: "InternalError", StatusCode: http.StatusInternalServerError}, true},
+		{"throttling", minio.ErrorResponse{Code: "SlowDown", StatusCode: http.StatusServiceUnavailable}, true},
+		{"too many requests", minio.ErrorResponse{StatusCode: http.StatusTooManyRequests}, true},
+		{"missing object", minio.ErrorResponse{Code: "NoSuchKey", StatusCode: http.StatusNotFound}, false},
+		{"access denied", minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}, false},
+		{"bad request", minio.ErrorResponse{Code: "InvalidArgument", StatusCode: http.StatusBadRequest}, false},
+		{"canceled", context.Canceled, false},
+	}
+
+	for _, tt := range tests {
+		if got := isRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: expected retryable %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	c := &Client{config: &config.S3Config{MaxRetries: 2, RetryDelay: time.Millisecond, Timeout: time.Second}}
+
+	// Transient failures are retried until the operation succeeds
+	attempts := 0
+	err := c.withRetry(context.Background(), "test", func(ctx context.Context) error {
+		attempts++
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("Expected each attempt to have a deadline")
+		}
+		if attempts < 3 {
+			return errors.New("connection reset by peer")
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected success after 3 attempts, got %d attempts and error %v", attempts, err)
+	}
+
+	// Retries stop after MaxRetries
+	attempts = 0
+	err = c.withRetry(context.Background(), "test", func(ctx context.Context) error {
+		attempts++
+		return errors.New("connection reset by peer")
+	})
+	if err == nil || attempts != 3 {
+		t.Errorf("Expected failure after 3 attempts, got %d attempts and error %v", attempts, err)
+	}
+
+	// Permanent failures are not retried
+	attempts = 0
+	err = c.withRetry(context.Background(), "test", func(ctx context.Context) error {
+		attempts++
+		return minio.ErrorResponse{Code: "NoSuchKey", StatusCode: http.StatusNotFound}
+	})
+	if !isNoSuchKey(err) || attempts != 1 {
+		t.Errorf("Expected a single attempt for a missing object, got %d attempts and error %v", attempts, err)
+	}
+	// Cancelling the caller's context stops the backoff and further attempts
+	slow := &Client{config: &config.S3Config{MaxRetries: 5, RetryDelay: time.Hour}}
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	time.AfterFunc(10*time.Millisecond, cancel)
+	err = slow.withRetry(ctx, "test", func(attemptCtx context.Context) error {
+		attempts++
+		if attemptCtx.Done() == nil {
+			t.Errorf("Expected each attempt to be cancelled with the caller's context")
+		}
+		return errors.New("connection reset by peer")
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("Expected cancellation after 1 attempt, got %d attempts and error %v", attempts, err)
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	endpoint, secure := splitEndpoint("https://s3.example.com/", false)
+	if endpoint != "s3.example.com" || !secure {
+		t.Errorf("Expected https endpoint to enable TLS, got %s %v", endpoint, secure)
+	}
+	endpoint, secure = splitEndpoint("minio:9000", true)
+	if endpoint != "minio:9000" || !secure {
+		t.Errorf("Expected bare endpoint to keep the TLS setting, got %s %v", endpoint, secure)
+	}
+
+	for lookup, want := range map[string]minio.BucketLookupType{"": minio.BucketLookupAuto, "path": minio.BucketLookupPath, "dns": minio.BucketLookupDNS} {
+		got, err := parseBucketLookup(lookup)
+		if err != nil || got != want {
+			t.Errorf("Expected bucket lookup %q to be %v, got %v (%v)", lookup, want, got, err)
+		}
+	}
+	if _, err := parseBucketLookup("sideways"); err == nil {
+		t.Errorf("Expected error for an unknown bucket lookup")
+	}
+
+	if sse, err := newServerSideEncryption("none", ""); err != nil || sse != nil {
+		t.Errorf("Expected no server-side encryption, got %v (%v)", sse, err)
+	}
+	if sse, err := newServerSideEncryption("sse-s3", ""); err != nil || sse == nil || sse.Type() != encrypt.S3 {
+		t.Errorf("Expected SSE-S3, got %v (%v)", sse, err)
+	}
+	if sse, err := newServerSideEncryption("sse-kms", "key-1"); err != nil || sse == nil || sse.Type() != encrypt.KMS {
+		t.Errorf("Expected SSE-KMS, got %v (%v)", sse, err)
+	}
+	if _, err := newServerSideEncryption("sse-kms", ""); err == nil {
+		t.Errorf("Expected error for SSE-KMS without a key ID")
+	}
+	if _, err := newServerSideEncryption("rot13", ""); err == nil {
+		t.Errorf("Expected error for an unknown server-side encryption")
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	// Answers every request with success, which is enough for the bucket check
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caBundle, certPEM, 0600); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+
+	cfg := &config.S3Config{
+		Endpoint:   server.URL,
+		Bucket:     "backups",
+		AccessKey:  "ak",
+		SecretKey:  "sk",
+		Region:     "us-east-1",
+		Enabled:    true,
+		MaxRetries: 3,
+		RetryDelay: time.Millisecond,
+		Timeout:    5 * time.Second,
+	}
+
+	// The test server's certificate is not trusted without the CA bundle
+	if _, err := NewClient(cfg); err == nil {
+		t.Errorf("Expected error connecting without the CA bundle")
+	}
+
+	cfg.CABundle = caBundle
+	if _, err := NewClient(cfg); err != nil {
+		t.Errorf("Failed to connect with the CA bundle: %v", err)
+	}
+
+	invalid := filepath.Join(t.TempDir(), "invalid.pem")
+	os.WriteFile(invalid, []byte("not a certificate"), 0600)
+	cfg.CABundle = invalid
+	if _, err := NewClient(cfg); err == nil || !strings.Contains(err.Error(), "no certificates") {
+		t.Errorf("Expected error for a CA bundle without certificates, got %v", err)
+	}
+}
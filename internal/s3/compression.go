@@ -0,0 +1,124 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported backup compression codecs
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// MetadataCompression is the object metadata key recording the compression codec
+const MetadataCompression = "Fuckbase-Compression"
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ValidateCompression checks that codec names a supported compression codec
+func ValidateCompression(codec string) error {
+	switch codec {
+	case "", CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression codec: %s", codec)
+	}
+}
+
+// CompressionSuffix returns the object name suffix for a compression codec
+func CompressionSuffix(codec string) string {
+	switch codec {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// Compress compresses data with the given codec
+func Compress(codec string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch codec {
+	case "", CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to gzip backup: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip backup: %w", err)
+		}
+	case CompressionZstd:
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			w.Close()
+			return nil, fmt.Errorf("failed to zstd compress backup: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("failed to zstd compress backup: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compression codec: %s", codec)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DetectCompression returns the codec data was compressed with, judging by its magic bytes
+func DetectCompression(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(data, zstdMagic):
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// Decompress decompresses data, detecting the codec from its magic bytes
+// Uncompressed data is returned unchanged
+func Decompress(data []byte) ([]byte, error) {
+	switch DetectCompression(data) {
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip backup: %w", err)
+		}
+		defer r.Close()
+		out, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress gzip backup: %w", err)
+		}
+		return out, nil
+	case CompressionZstd:
+		r, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zstd backup: %w", err)
+		}
+		defer r.Close()
+		out, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress zstd backup: %w", err)
+		}
+		return out, nil
+	default:
+		return data, nil
+	}
+}
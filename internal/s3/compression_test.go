@@ -0,0 +1,62 @@
+package s3
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"name":"test","value":42},`), 200)
+
+	for _, codec := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		compressed, err := Compress(codec, data)
+		if err != nil {
+			t.Fatalf("Failed to compress with %s: %v", codec, err)
+		}
+		if DetectCompression(compressed) != codec {
+			t.Errorf("Expected %s to be detected, got %s", codec, DetectCompression(compressed))
+		}
+		if codec != CompressionNone && len(compressed) >= len(data) {
+			t.Errorf("Expected %s output to be smaller than the input", codec)
+		}
+
+		decompressed, err := Decompress(compressed)
+		if err != nil {
+			t.Fatalf("Failed to decompress %s: %v", codec, err)
+		}
+		if !bytes.Equal(decompressed, data) {
+			t.Errorf("Round trip with %s changed the data", codec)
+		}
+	}
+}
+
+func TestDecodeBackupCompressedAndEncrypted(t *testing.T) {
+	keyring := NewKeyring(&EncryptionKey{ID: "k1", Key: testKey(1)})
+	data := []byte(`{"name":"test_db","sets":{}}`)
+
+	compressed, err := Compress(CompressionZstd, data)
+	if err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	encrypted, err := keyring.Encrypt(compressed)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	decoded, err := DecodeBackup(encrypted, keyring)
+	if err != nil {
+		t.Fatalf("Failed to decode backup: %v", err)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Errorf("Expected %s, got %s", data, decoded)
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	if err := ValidateCompression("gzip"); err != nil {
+		t.Errorf("Expected gzip to be valid: %v", err)
+	}
+	if err := ValidateCompression("lz4"); err == nil {
+		t.Errorf("Expected lz4 to be rejected")
+	}
+}
@@ -0,0 +1,80 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ssig33/fuckbase/internal/logger"
+)
+
+// ReadBackup downloads a backup and parses its databases without restoring them
+// The checksum is checked against the manifest when there is one. The returned metadata
+// is nil for single-database backups.
+func (bm *BackupManager) ReadBackup(objectName string) (map[string]DatabaseBackup, *BackupMetadata, error) {
+	data, err := bm.loadBackup(context.Background(), objectName, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseBackupPayload(objectName, data)
+}
+
+// ConvertBackup copies a backup from source into this manager's storage, re-encoded with
+// this manager's compression and encryption settings
+// The backup is checked before it is written, and gets a new manifest that keeps the time
+// it was originally taken. Encoding suffixes are stripped from targetName and replaced
+// by those of the new encoding; the final object name is returned.
+func (bm *BackupManager) ConvertBackup(source *BackupManager, objectName string, targetName string) (string, error) {
+	data, err := source.loadBackup(context.Background(), objectName, nil)
+	if err != nil {
+		return "", err
+	}
+
+	databases, metadata, err := parseBackupPayload(objectName, data)
+	if err != nil {
+		return "", err
+	}
+
+	var problems []string
+	stats := make(map[string]DatabaseStats, len(databases))
+	for name, backup := range databases {
+		problems = append(problems, checkDatabaseBackup(name, backup)...)
+		stats[name] = computeDatabaseStats(backup)
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return "", fmt.Errorf("backup %s is invalid: %s", objectName, strings.Join(problems, "; "))
+	}
+
+	database := AllDatabases
+	if metadata == nil {
+		for name := range databases {
+			database = name
+		}
+	}
+
+	manifest := newManifest(database, stats)
+	if metadata != nil && !metadata.Timestamp.IsZero() {
+		manifest.CreatedAt = metadata.Timestamp
+	} else if timestamp, ok := ParseBackupTimestamp(objectName); ok {
+		manifest.CreatedAt = timestamp
+	}
+
+	converted, err := bm.uploadBackup(context.Background(), BaseBackupObjectName(targetName), data, manifest, nil)
+	if err != nil {
+		return "", err
+	}
+
+	logger.Info("Converted backup %s to %s", objectName, converted)
+	return converted, nil
+}
+
+// BaseBackupObjectName strips the encryption and compression suffixes from a backup object name
+func BaseBackupObjectName(objectName string) string {
+	name := strings.TrimSuffix(objectName, EncryptedBackupSuffix)
+	for _, codec := range []string{CompressionGzip, CompressionZstd} {
+		name = strings.TrimSuffix(name, CompressionSuffix(codec))
+	}
+	return name
+}
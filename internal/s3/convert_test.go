@@ -0,0 +1,80 @@
+package s3
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConvertBackup(t *testing.T) {
+	source, dbManager, _ := newTestBackupManager(t)
+	source.SetCompression(CompressionGzip)
+	source.SetKeyring(NewKeyring(&EncryptionKey{ID: "old", Key: testKey(1)}))
+
+	db, _ := dbManager.CreateDatabase("test_db", nil)
+	db.CreateSet("users")
+	db.Put("users", "u1", map[string]interface{}{"name": "Alice"})
+
+	objectName, err := source.BackupAllDatabasesContext(t.Context(), nil)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+
+	// Convert to zstd under a new key, into another storage with a local-copy name
+	target := NewBackupManager(NewMemoryStorage(), nil)
+	target.SetCompression(CompressionZstd)
+	target.SetKeyring(NewKeyring(&EncryptionKey{ID: "new", Key: testKey(2)}))
+
+	converted, err := target.ConvertBackup(source, objectName, "copy.json.gz.enc")
+	if err != nil {
+		t.Fatalf("Failed to convert backup: %v", err)
+	}
+	if converted != "copy.json.zst.enc" {
+		t.Errorf("Expected encoding suffixes to be replaced, got %s", converted)
+	}
+
+	report, err := target.VerifyBackup(converted)
+	if err != nil {
+		t.Fatalf("Failed to verify converted backup: %v", err)
+	}
+	if !report.Valid || !report.ChecksumVerified || report.Compression != CompressionZstd || report.EntryCount != 1 {
+		t.Errorf("Unexpected report for converted backup: %+v", report)
+	}
+
+	manifest, err := target.GetManifest(converted)
+	if err != nil {
+		t.Fatalf("Expected a manifest for the converted backup: %v", err)
+	}
+	if manifest.KeyID != "new" || manifest.Database != AllDatabases {
+		t.Errorf("Unexpected manifest for converted backup: %+v", manifest)
+	}
+
+	// The converted copy is still a full backup, although its name does not say so
+	databases, metadata, err := target.ReadBackup(converted)
+	if err != nil {
+		t.Fatalf("Failed to read converted backup: %v", err)
+	}
+	if metadata == nil || len(databases["test_db"].Sets["users"].Data) != 1 {
+		t.Fatalf("Expected the full backup to be read back, got %v %+v", metadata, databases)
+	}
+	if !manifest.CreatedAt.Equal(metadata.Timestamp) {
+		t.Errorf("Expected the manifest to keep the backup time %s, got %s", metadata.Timestamp, manifest.CreatedAt)
+	}
+
+	// The source cannot be read without its key
+	noKey := NewBackupManager(source.Storage(), nil)
+	if _, err := target.ConvertBackup(noKey, objectName, "copy.json"); err == nil || !strings.Contains(err.Error(), "old") {
+		t.Errorf("Expected error naming the missing key, got %v", err)
+	}
+}
+
+func TestBaseBackupObjectName(t *testing.T) {
+	for name, want := range map[string]string{
+		"backups/full/20250318-140947.json":            "backups/full/20250318-140947.json",
+		"backups/full/20250318-140947.json.gz":         "backups/full/20250318-140947.json",
+		"backups/test_db/20250318-140947.json.zst.enc": "backups/test_db/20250318-140947.json",
+	} {
+		if got := BaseBackupObjectName(name); got != want {
+			t.Errorf("Expected %s for %s, got %s", want, name, got)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+// encryptedBackupMagic prefixes every encrypted backup object
+var encryptedBackupMagic = []byte("FBENC\x01")
+
+// EncryptedBackupSuffix is appended to the names of encrypted backup objects
+const EncryptedBackupSuffix = ".enc"
+
+// Object metadata keys recorded with encrypted backups
+const (
+	MetadataEncryption = "Fuckbase-Encryption"
+	MetadataKeyID      = "Fuckbase-Key-Id"
+)
+
+// encryptionAlgorithm is the only supported envelope algorithm
+const encryptionAlgorithm = "AES-256-GCM"
+
+// EncryptionKey is a master key used to wrap per-backup data keys
+type EncryptionKey struct {
+	ID  string
+	Key []byte
+}
+
+// Keyring holds the master keys known to the server
+// The active key encrypts new backups; every key can decrypt
+type Keyring struct {
+	active *EncryptionKey
+	keys   map[string]*EncryptionKey
+}
+
+// envelopeHeader is stored in front of the ciphertext of an encrypted backup
+type envelopeHeader struct {
+	Algorithm  string `json:"alg"`
+	KeyID      string `json:"kid"`
+	WrappedKey []byte `json:"wrapped_key"`
+	KeyNonce   []byte `json:"key_nonce"`
+	Nonce      []byte `json:"nonce"`
+}
+
+// LoadKeyring loads the backup encryption keys from the configuration
+// Each non-empty line of the key material is either a base64 encoded 32-byte key or "id:key".
+// The first key is the active one.
+func LoadKeyring(cfg *config.EncryptionConfig) (*Keyring, error) {
+	if !cfg.Enabled() {
+		return nil, fmt.Errorf("backup encryption is not configured")
+	}
+
+	material := cfg.Key
+	if cfg.KeyFile != "" {
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		material = string(data)
+	}
+
+	keyring := &Keyring{keys: make(map[string]*EncryptionKey)}
+	for _, line := range strings.Split(material, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id := ""
+		encoded := line
+		if i := strings.Index(line, ":"); i >= 0 {
+			id = line[:i]
+			encoded = line[i+1:]
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode encryption key: %w", err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+		}
+
+		if id == "" {
+			if keyring.active == nil && cfg.KeyID != "" {
+				id = cfg.KeyID
+			} else {
+				id = KeyFingerprint(key)
+			}
+		}
+
+		encKey := &EncryptionKey{ID: id, Key: key}
+		if _, exists := keyring.keys[id]; exists {
+			return nil, fmt.Errorf("duplicate encryption key ID: %s", id)
+		}
+		keyring.keys[id] = encKey
+		if keyring.active == nil {
+			keyring.active = encKey
+		}
+	}
+
+	if keyring.active == nil {
+		return nil, fmt.Errorf("no encryption key found")
+	}
+
+	return keyring, nil
+}
+
+// NewKeyring creates a keyring from the given keys; the first key is the active one
+func NewKeyring(keys ...*EncryptionKey) *Keyring {
+	keyring := &Keyring{keys: make(map[string]*EncryptionKey)}
+	for _, key := range keys {
+		keyring.keys[key.ID] = key
+		if keyring.active == nil {
+			keyring.active = key
+		}
+	}
+	return keyring
+}
+
+// KeyFingerprint returns a short identifier derived from a key
+func KeyFingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ActiveKeyID returns the ID of the key used to encrypt new backups
+func (k *Keyring) ActiveKeyID() string {
+	return k.active.ID
+}
+
+// The keyring also wraps the data keys of encrypted databases
+var _ database.KeyWrapper = (*Keyring)(nil)
+
+// WrapKey seals a data key of an encrypted database with the active master key
+func (k *Keyring) WrapKey(dataKey []byte) (string, []byte, error) {
+	nonce, wrapped, err := sealAESGCM(k.active.Key, dataKey, []byte(k.active.ID))
+	if err != nil {
+		return "", nil, err
+	}
+	return k.active.ID, append(nonce, wrapped...), nil
+}
+
+// UnwrapKey opens a data key sealed by WrapKey with the given master key
+func (k *Keyring) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	masterKey, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("data key is wrapped with unknown key %s", keyID)
+	}
+
+	nonceSize := 12 // The standard AES-GCM nonce size used by sealAESGCM
+	if len(wrapped) < nonceSize {
+		return nil, fmt.Errorf("wrapped data key is truncated")
+	}
+	return openAESGCM(masterKey.Key, wrapped[:nonceSize], wrapped[nonceSize:], []byte(keyID))
+}
+
+// IsEncryptedBackup reports whether data is an encrypted backup envelope
+func IsEncryptedBackup(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedBackupMagic)
+}
+
+// Encrypt seals plaintext with a fresh data key wrapped by the active master key
+func (k *Keyring) Encrypt(plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	header := envelopeHeader{
+		Algorithm: encryptionAlgorithm,
+		KeyID:     k.active.ID,
+	}
+
+	// Wrap the data key with the master key
+	var err error
+	header.KeyNonce, header.WrappedKey, err = sealAESGCM(k.active.Key, dataKey, []byte(header.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	// Encrypt the payload with the data key
+	var ciphertext []byte
+	header.Nonce, ciphertext, err = sealAESGCM(dataKey, plaintext, []byte(header.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+
+	headerData, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal envelope header: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(encryptedBackupMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(len(headerData)))
+	buf.Write(headerData)
+	buf.Write(ciphertext)
+	return buf.Bytes(), nil
+}
+
+// Decrypt opens an encrypted backup envelope
+func (k *Keyring) Decrypt(data []byte) ([]byte, error) {
+	header, ciphertext, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if k == nil {
+		return nil, fmt.Errorf("backup is encrypted with key %s but no encryption key is configured", header.KeyID)
+	}
+
+	masterKey, ok := k.keys[header.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("backup is encrypted with unknown key %s", header.KeyID)
+	}
+
+	dataKey, err := openAESGCM(masterKey.Key, header.KeyNonce, header.WrappedKey, []byte(header.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	plaintext, err := openAESGCM(dataKey, header.Nonce, ciphertext, []byte(header.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt backup: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// EncryptedBackupKeyID returns the ID of the master key an encrypted backup was sealed with
+func EncryptedBackupKeyID(data []byte) (string, error) {
+	header, _, err := parseEnvelope(data)
+	if err != nil {
+		return "", err
+	}
+	return header.KeyID, nil
+}
+
+// parseEnvelope splits an encrypted backup into its header and ciphertext
+func parseEnvelope(data []byte) (*envelopeHeader, []byte, error) {
+	if !IsEncryptedBackup(data) {
+		return nil, nil, fmt.Errorf("data is not an encrypted backup")
+	}
+	data = data[len(encryptedBackupMagic):]
+
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("encrypted backup is truncated")
+	}
+	headerLen := binary.BigEndian.Uint32(data[:4])
+	data = data[4:]
+	if uint64(len(data)) < uint64(headerLen) {
+		return nil, nil, fmt.Errorf("encrypted backup is truncated")
+	}
+
+	var header envelopeHeader
+	if err := json.Unmarshal(data[:headerLen], &header); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse envelope header: %w", err)
+	}
+	if header.Algorithm != encryptionAlgorithm {
+		return nil, nil, fmt.Errorf("unsupported encryption algorithm: %s", header.Algorithm)
+	}
+
+	return &header, data[headerLen:], nil
+}
+
+// sealAESGCM encrypts plaintext with AES-GCM and a random nonce
+func sealAESGCM(key, plaintext, additionalData []byte) ([]byte, []byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+
+	return nonce, gcm.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+// openAESGCM decrypts ciphertext produced by sealAESGCM
+func openAESGCM(key, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size")
+	}
+
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
@@ -0,0 +1,135 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ssig33/fuckbase/internal/config"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestKeyringEncryptDecrypt(t *testing.T) {
+	keyring := NewKeyring(&EncryptionKey{ID: "k1", Key: testKey(1)})
+	plaintext := []byte(`{"name":"test_db"}`)
+
+	encrypted, err := keyring.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if !IsEncryptedBackup(encrypted) {
+		t.Errorf("Expected encrypted data to be recognized as an encrypted backup")
+	}
+	if bytes.Contains(encrypted, plaintext) {
+		t.Errorf("Expected plaintext not to appear in the encrypted data")
+	}
+
+	keyID, err := EncryptedBackupKeyID(encrypted)
+	if err != nil || keyID != "k1" {
+		t.Errorf("Expected key ID 'k1', got '%s' (%v)", keyID, err)
+	}
+
+	decrypted, err := keyring.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Expected %s, got %s", plaintext, decrypted)
+	}
+}
+
+func TestKeyringDecryptFailures(t *testing.T) {
+	keyring := NewKeyring(&EncryptionKey{ID: "k1", Key: testKey(1)})
+	encrypted, err := keyring.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	// Unknown key ID
+	other := NewKeyring(&EncryptionKey{ID: "k2", Key: testKey(2)})
+	if _, err := other.Decrypt(encrypted); err == nil {
+		t.Errorf("Expected error when decrypting with an unknown key")
+	}
+
+	// Same ID, wrong key material
+	wrong := NewKeyring(&EncryptionKey{ID: "k1", Key: testKey(3)})
+	if _, err := wrong.Decrypt(encrypted); err == nil {
+		t.Errorf("Expected error when decrypting with the wrong key")
+	}
+
+	// No keyring configured
+	var none *Keyring
+	if _, err := none.Decrypt(encrypted); err == nil {
+		t.Errorf("Expected error when decrypting without a keyring")
+	}
+
+	// Tampered ciphertext
+	encrypted[len(encrypted)-1] ^= 0xff
+	if _, err := keyring.Decrypt(encrypted); err == nil {
+		t.Errorf("Expected error when decrypting tampered data")
+	}
+}
+
+func TestKeyringWrapKey(t *testing.T) {
+	keyring := NewKeyring(&EncryptionKey{ID: "k2", Key: testKey(2)}, &EncryptionKey{ID: "k1", Key: testKey(1)})
+	dataKey := testKey(9)
+
+	keyID, wrapped, err := keyring.WrapKey(dataKey)
+	if err != nil || keyID != "k2" {
+		t.Fatalf("Expected the key to be wrapped with k2, got %s (%v)", keyID, err)
+	}
+	unwrapped, err := keyring.UnwrapKey(keyID, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("Expected the data key back, got %x (%v)", unwrapped, err)
+	}
+
+	if _, err := keyring.UnwrapKey("k1", wrapped); err == nil {
+		t.Errorf("Expected unwrapping with the wrong master key to fail")
+	}
+	if _, err := keyring.UnwrapKey("unknown", wrapped); err == nil {
+		t.Errorf("Expected unwrapping with an unknown master key to fail")
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	key1 := base64.StdEncoding.EncodeToString(testKey(1))
+	key2 := base64.StdEncoding.EncodeToString(testKey(2))
+
+	// Key from the environment with an explicit ID
+	keyring, err := LoadKeyring(&config.EncryptionConfig{Key: key1, KeyID: "primary"})
+	if err != nil {
+		t.Fatalf("Failed to load keyring: %v", err)
+	}
+	if keyring.ActiveKeyID() != "primary" {
+		t.Errorf("Expected active key 'primary', got '%s'", keyring.ActiveKeyID())
+	}
+
+	// Key file with a retired key kept for decryption
+	keyFile := filepath.Join(t.TempDir(), "backup.key")
+	if err := os.WriteFile(keyFile, []byte("new:"+key2+"\n# retired\nold:"+key1+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	keyring, err = LoadKeyring(&config.EncryptionConfig{KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("Failed to load keyring from file: %v", err)
+	}
+	if keyring.ActiveKeyID() != "new" {
+		t.Errorf("Expected active key 'new', got '%s'", keyring.ActiveKeyID())
+	}
+
+	oldKeyring := NewKeyring(&EncryptionKey{ID: "old", Key: testKey(1)})
+	encrypted, _ := oldKeyring.Encrypt([]byte("data"))
+	if _, err := keyring.Decrypt(encrypted); err != nil {
+		t.Errorf("Expected retired key to decrypt old backups: %v", err)
+	}
+
+	// Invalid key length
+	if _, err := LoadKeyring(&config.EncryptionConfig{Key: base64.StdEncoding.EncodeToString([]byte("short"))}); err == nil {
+		t.Errorf("Expected error for a short key")
+	}
+}
@@ -0,0 +1,344 @@
+package s3
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/logger"
+)
+
+// Job types
+const (
+	JobTypeBackup  = "backup"
+	JobTypeRestore = "restore"
+)
+
+// Job statuses
+const (
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCanceled  = "canceled"
+)
+
+// maxFinishedJobs is the number of finished jobs kept for status queries
+const maxFinishedJobs = 100
+
+// ErrJobNotFound is returned when a job ID is unknown
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobFinished is returned when cancelling a job that has already finished
+var ErrJobFinished = errors.New("job has already finished")
+
+// Progress counts the sets and entries processed by a backup or restore
+// A nil *Progress is valid and discards all updates.
+type Progress struct {
+	sets    atomic.Int64
+	entries atomic.Int64
+
+	mu       sync.Mutex
+	warnings []string
+}
+
+// addSet records that a set with the given number of entries was processed
+func (p *Progress) addSet(entries int) {
+	if p == nil {
+		return
+	}
+	p.sets.Add(1)
+	p.entries.Add(int64(entries))
+}
+
+// addWarning records a problem that did not stop the job
+func (p *Progress) addWarning(warning string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.warnings = append(p.warnings, warning)
+}
+
+// Warnings returns the problems recorded so far that did not stop the job
+func (p *Progress) Warnings() []string {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.warnings...)
+}
+
+// Sets returns the number of sets processed so far
+func (p *Progress) Sets() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.sets.Load()
+}
+
+// Entries returns the number of entries processed so far
+func (p *Progress) Entries() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.entries.Load()
+}
+
+// JobFunc performs the work of a job and returns the name of the backup object it wrote or read
+type JobFunc func(ctx context.Context, progress *Progress) (string, error)
+
+// Job is a backup or restore running in the background
+type Job struct {
+	id       string
+	jobType  string
+	database string
+	progress Progress
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mu         sync.Mutex
+	status     string
+	object     string
+	err        error
+	startedAt  time.Time
+	finishedAt time.Time
+}
+
+// JobInfo is a snapshot of the state of a job
+type JobInfo struct {
+	ID               string     `json:"id"`
+	Type             string     `json:"type"`
+	Status           string     `json:"status"`
+	Database         string     `json:"database,omitempty"`
+	BackupName       string     `json:"backup_name,omitempty"`
+	SetsProcessed    int64      `json:"sets_processed"`
+	EntriesProcessed int64      `json:"entries_processed"`
+	Error            string     `json:"error,omitempty"`
+	Warnings         []string   `json:"warnings,omitempty"`
+	StartedAt        time.Time  `json:"started_at"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+	DurationMs       int64      `json:"duration_ms"`
+}
+
+// ID returns the job ID
+func (j *Job) ID() string {
+	return j.id
+}
+
+// Done returns a channel that is closed when the job finishes
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait blocks until the job finishes and returns its error
+func (j *Job) Wait() error {
+	<-j.done
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// Info returns a snapshot of the job's state
+func (j *Job) Info() JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	info := JobInfo{
+		ID:               j.id,
+		Type:             j.jobType,
+		Status:           j.status,
+		Database:         j.database,
+		BackupName:       j.object,
+		SetsProcessed:    j.progress.Sets(),
+		EntriesProcessed: j.progress.Entries(),
+		Warnings:         j.progress.Warnings(),
+		StartedAt:        j.startedAt,
+	}
+	if j.err != nil {
+		info.Error = j.err.Error()
+	}
+	if j.finishedAt.IsZero() {
+		info.DurationMs = time.Since(j.startedAt).Milliseconds()
+	} else {
+		finishedAt := j.finishedAt
+		info.FinishedAt = &finishedAt
+		info.DurationMs = finishedAt.Sub(j.startedAt).Milliseconds()
+	}
+	return info
+}
+
+// finish records the outcome of the job
+func (j *Job) finish(object string, err error, canceled bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if object != "" {
+		j.object = object
+	}
+	j.err = err
+	j.finishedAt = time.Now().UTC()
+	switch {
+	case err == nil:
+		j.status = JobStatusSucceeded
+	case canceled && errors.Is(err, context.Canceled):
+		j.status = JobStatusCanceled
+	default:
+		j.status = JobStatusFailed
+	}
+}
+
+// JobManager runs backups and restores in the background and tracks their state
+type JobManager struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewJobManager creates a new job manager
+func NewJobManager() *JobManager {
+	return &JobManager{
+		jobs: make(map[string]*Job),
+	}
+}
+
+// Start runs fn in the background as a new job
+// The database and object describe the job's target and may be empty; the object is
+// replaced by the one fn returns.
+func (jm *JobManager) Start(jobType string, database string, object string, fn JobFunc) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		id:        newJobID(),
+		jobType:   jobType,
+		database:  database,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		status:    JobStatusRunning,
+		object:    object,
+		startedAt: time.Now().UTC(),
+	}
+
+	jm.mu.Lock()
+	jm.jobs[job.id] = job
+	jm.pruneLocked()
+	jm.mu.Unlock()
+
+	logger.Info("Started %s job %s", jobType, job.id)
+
+	go func() {
+		defer close(job.done)
+		defer cancel()
+
+		result, err := fn(ctx, &job.progress)
+		job.finish(result, err, ctx.Err() != nil)
+
+		info := job.Info()
+		if err != nil {
+			logger.Error("%s job %s %s after %dms: %v", jobType, job.id, info.Status, info.DurationMs, err)
+		} else {
+			logger.Info("%s job %s succeeded after %dms", jobType, job.id, info.DurationMs)
+		}
+	}()
+
+	return job
+}
+
+// Get returns the job with the given ID
+func (jm *JobManager) Get(id string) (*Job, error) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	job, ok := jm.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// List returns a snapshot of all tracked jobs, newest first
+func (jm *JobManager) List() []JobInfo {
+	jm.mu.Lock()
+	jobs := make([]*Job, 0, len(jm.jobs))
+	for _, job := range jm.jobs {
+		jobs = append(jobs, job)
+	}
+	jm.mu.Unlock()
+
+	infos := make([]JobInfo, 0, len(jobs))
+	for _, job := range jobs {
+		infos = append(infos, job.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].StartedAt.After(infos[j].StartedAt)
+	})
+	return infos
+}
+
+// Cancel asks a running job to stop
+// Cancellation takes effect at the next set boundary; a restore cancelled before its
+// data is swapped in leaves the live databases untouched.
+func (jm *JobManager) Cancel(id string) error {
+	job, err := jm.Get(id)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-job.done:
+		return ErrJobFinished
+	default:
+	}
+
+	job.cancel()
+	logger.Info("Cancelling job %s", id)
+	return nil
+}
+
+// CancelAll asks every running job to stop
+func (jm *JobManager) CancelAll() {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	for _, job := range jm.jobs {
+		job.cancel()
+	}
+}
+
+// pruneLocked forgets the oldest finished jobs beyond maxFinishedJobs
+// The caller must hold jm.mu
+func (jm *JobManager) pruneLocked() {
+	var finished []*Job
+	for _, job := range jm.jobs {
+		select {
+		case <-job.done:
+			finished = append(finished, job)
+		default:
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].startedAt.Before(finished[j].startedAt)
+	})
+	for _, job := range finished[:len(finished)-maxFinishedJobs] {
+		delete(jm.jobs, job.id)
+	}
+}
+
+// newJobID returns a random job ID
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,111 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestJobManager(t *testing.T) {
+	jm := NewJobManager()
+
+	job := jm.Start(JobTypeBackup, "test_db", "", func(ctx context.Context, progress *Progress) (string, error) {
+		progress.addSet(3)
+		progress.addSet(2)
+		return "backups/test_db/20250101-000000.json", nil
+	})
+	if err := job.Wait(); err != nil {
+		t.Fatalf("Expected job to succeed, got %v", err)
+	}
+
+	info := job.Info()
+	if info.Status != JobStatusSucceeded {
+		t.Errorf("Expected status %s, got %s", JobStatusSucceeded, info.Status)
+	}
+	if info.SetsProcessed != 2 || info.EntriesProcessed != 5 {
+		t.Errorf("Expected 2 sets and 5 entries processed, got %d and %d", info.SetsProcessed, info.EntriesProcessed)
+	}
+	if info.BackupName != "backups/test_db/20250101-000000.json" || info.FinishedAt == nil {
+		t.Errorf("Unexpected job info: %+v", info)
+	}
+
+	failed := jm.Start(JobTypeRestore, "", "backups/full/x.json", func(ctx context.Context, progress *Progress) (string, error) {
+		return "", errors.New("boom")
+	})
+	failed.Wait()
+	if info := failed.Info(); info.Status != JobStatusFailed || info.Error != "boom" || info.BackupName != "backups/full/x.json" {
+		t.Errorf("Unexpected failed job info: %+v", info)
+	}
+
+	if got, err := jm.Get(job.ID()); err != nil || got != job {
+		t.Errorf("Expected to find job %s", job.ID())
+	}
+	if _, err := jm.Get("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+	if jobs := jm.List(); len(jobs) != 2 || jobs[0].ID != failed.ID() {
+		t.Errorf("Expected two jobs, newest first, got %+v", jobs)
+	}
+	if err := jm.Cancel(job.ID()); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("Expected ErrJobFinished, got %v", err)
+	}
+}
+
+func TestJobManagerCancel(t *testing.T) {
+	jm := NewJobManager()
+	started := make(chan struct{})
+
+	job := jm.Start(JobTypeBackup, "", "", func(ctx context.Context, progress *Progress) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	<-started
+
+	if err := jm.Cancel(job.ID()); err != nil {
+		t.Fatalf("Failed to cancel job: %v", err)
+	}
+	if err := job.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if status := job.Info().Status; status != JobStatusCanceled {
+		t.Errorf("Expected status %s, got %s", JobStatusCanceled, status)
+	}
+}
+
+func TestCancelledBackupAndRestore(t *testing.T) {
+	bm, dbManager, storage := newTestBackupManager(t)
+
+	db, _ := dbManager.CreateDatabase("test_db", nil)
+	db.CreateSet("users")
+	db.Put("users", "u1", map[string]interface{}{"name": "Alice"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := bm.BackupAllDatabasesContext(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if objects, _ := storage.ListFiles(context.Background(), ""); len(objects) != 0 {
+		t.Errorf("Expected a cancelled backup to write nothing, got %v", objects)
+	}
+
+	var progress Progress
+	objectName, err := bm.BackupAllDatabasesContext(context.Background(), &progress)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	if progress.Sets() != 1 || progress.Entries() != 1 {
+		t.Errorf("Expected 1 set and 1 entry processed, got %d and %d", progress.Sets(), progress.Entries())
+	}
+
+	db.Put("users", "u2", map[string]interface{}{"name": "Bob"})
+	if err := bm.RestoreAllDatabasesContext(ctx, objectName, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	live, _ := dbManager.GetDatabase("test_db")
+	users, _ := live.GetSet("users")
+	if live != db || users.Size() != 2 {
+		t.Errorf("Expected a cancelled restore to leave the live database untouched")
+	}
+}
@@ -0,0 +1,219 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ssig33/fuckbase/internal/logger"
+)
+
+// localMetadataDir is the directory, relative to the storage root, holding object metadata
+const localMetadataDir = ".meta"
+
+// LocalStorage is a backup storage backend that writes objects under a local directory
+type LocalStorage struct {
+	dir string
+}
+
+// localMetadata is stored next to each object written by LocalStorage
+type localMetadata struct {
+	ContentType string            `json:"content_type"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// NewLocalStorage creates a local filesystem storage backend rooted at dir
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("backup directory is not configured")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	return &LocalStorage{dir: dir}, nil
+}
+
+// objectPath returns the file path for an object, rejecting names that escape the root
+func (l *LocalStorage) objectPath(root string, objectName string) (string, error) {
+	cleaned := path.Clean("/" + objectName)
+	if cleaned == "/" || strings.HasPrefix(cleaned, "/"+localMetadataDir+"/") {
+		return "", fmt.Errorf("invalid object name: %s", objectName)
+	}
+	return filepath.Join(root, filepath.FromSlash(cleaned[1:])), nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place
+func writeFileAtomic(filePath string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// UploadFile writes data to a file under the storage directory
+func (l *LocalStorage) UploadFile(_ context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	filePath, err := l.objectPath(l.dir, objectName)
+	if err != nil {
+		return err
+	}
+	metaPath, err := l.objectPath(filepath.Join(l.dir, localMetadataDir), objectName)
+	if err != nil {
+		return err
+	}
+
+	meta, err := json.Marshal(localMetadata{ContentType: contentType, Metadata: metadata})
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	if err := writeFileAtomic(filePath, data); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := writeFileAtomic(metaPath+".json", meta); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	logger.Info("Successfully wrote %s to %s", objectName, l.dir)
+	return nil
+}
+
+// DownloadFile reads a file from the storage directory
+func (l *LocalStorage) DownloadFile(_ context.Context, objectName string) ([]byte, error) {
+	filePath, err := l.objectPath(l.dir, objectName)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return data, nil
+}
+
+// ListFiles lists all files under the storage directory with the given prefix
+func (l *LocalStorage) ListFiles(_ context.Context, prefix string) ([]string, error) {
+	var objects []string
+
+	err := filepath.WalkDir(l.dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(l.dir, filePath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if name == localMetadataDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(path.Base(name), ".tmp-") {
+			return nil
+		}
+
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing files: %w", err)
+	}
+
+	sort.Strings(objects)
+	return objects, nil
+}
+
+// DeleteFile deletes a file and its metadata from the storage directory
+func (l *LocalStorage) DeleteFile(_ context.Context, objectName string) error {
+	filePath, err := l.objectPath(l.dir, objectName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filePath); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, objectName)
+	} else if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	if metaPath, err := l.objectPath(filepath.Join(l.dir, localMetadataDir), objectName); err == nil {
+		os.Remove(metaPath + ".json")
+	}
+
+	logger.Info("Successfully deleted %s from %s", objectName, l.dir)
+	return nil
+}
+
+// GetFileInfo gets information about a file in the storage directory
+func (l *LocalStorage) GetFileInfo(_ context.Context, objectName string) (*FileInfo, error) {
+	filePath, err := l.objectPath(l.dir, objectName)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	info := &FileInfo{
+		Name:         objectName,
+		Size:         stat.Size(),
+		LastModified: stat.ModTime().UTC(),
+	}
+
+	// Files copied into the directory by hand have no metadata
+	metaPath, err := l.objectPath(filepath.Join(l.dir, localMetadataDir), objectName)
+	if err == nil {
+		if data, err := os.ReadFile(metaPath + ".json"); err == nil {
+			var meta localMetadata
+			if err := json.Unmarshal(data, &meta); err == nil {
+				info.ContentType = meta.ContentType
+				info.Metadata = meta.Metadata
+			}
+		}
+	}
+
+	return info, nil
+}
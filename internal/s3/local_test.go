@@ -0,0 +1,85 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewLocalStorage(filepath.Join(dir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to create local storage: %v", err)
+	}
+	testStorage(t, storage)
+
+	if err := storage.UploadFile(context.Background(), "../outside.json", []byte("x"), "application/json", nil); err != nil {
+		t.Fatalf("Expected names with '..' to be confined to the storage directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "outside.json")); err == nil {
+		t.Errorf("Expected object not to be written outside the storage directory")
+	}
+	if objects, _ := storage.ListFiles(context.Background(), "outside"); len(objects) != 1 || objects[0] != "outside.json" {
+		t.Errorf("Expected object to be stored inside the storage directory, got %v", objects)
+	}
+	if err := storage.UploadFile(context.Background(), ".meta/x.json", []byte("x"), "application/json", nil); err == nil {
+		t.Errorf("Expected error when writing into the metadata directory")
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, NewMemoryStorage())
+}
+
+// testStorage exercises the Storage interface contract
+func testStorage(t *testing.T, storage Storage) {
+	data := []byte(`{"name":"test_db"}`)
+	metadata := map[string]string{MetadataCompression: CompressionGzip}
+
+	if err := storage.UploadFile(context.Background(), "backups/test_db/20250101-000000.json", data, "application/json", metadata); err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+	if err := storage.UploadFile(context.Background(), "backups/full/20250101-000000.json", data, "application/json", nil); err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+
+	downloaded, err := storage.DownloadFile(context.Background(), "backups/test_db/20250101-000000.json")
+	if err != nil {
+		t.Fatalf("Failed to download: %v", err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Errorf("Expected %s, got %s", data, downloaded)
+	}
+
+	objects, err := storage.ListFiles(context.Background(), "backups/test_db/")
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	if len(objects) != 1 || objects[0] != "backups/test_db/20250101-000000.json" {
+		t.Errorf("Expected one object under the prefix, got %v", objects)
+	}
+	if objects, _ := storage.ListFiles(context.Background(), "backups/"); len(objects) != 2 {
+		t.Errorf("Expected two objects, got %v", objects)
+	}
+
+	info, err := storage.GetFileInfo(context.Background(), "backups/test_db/20250101-000000.json")
+	if err != nil {
+		t.Fatalf("Failed to get file info: %v", err)
+	}
+	if info.Size != int64(len(data)) || info.ContentType != "application/json" || info.Metadata[MetadataCompression] != CompressionGzip {
+		t.Errorf("Unexpected file info: %+v", info)
+	}
+
+	if err := storage.DeleteFile(context.Background(), "backups/test_db/20250101-000000.json"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, err := storage.DownloadFile(context.Background(), "backups/test_db/20250101-000000.json"); err == nil {
+		t.Errorf("Expected error when downloading a deleted object")
+	}
+	if err := storage.DeleteFile(context.Background(), "backups/test_db/20250101-000000.json"); err == nil {
+		t.Errorf("Expected error when deleting a missing object")
+	}
+}
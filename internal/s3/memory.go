@@ -0,0 +1,112 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage is a backup storage backend that keeps objects in memory
+// It is intended for tests.
+type MemoryStorage struct {
+	objects map[string]*memoryObject
+	mu      sync.RWMutex
+}
+
+// memoryObject is an object held by MemoryStorage
+type memoryObject struct {
+	data []byte
+	info FileInfo
+}
+
+// NewMemoryStorage creates an empty in-memory storage backend
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		objects: make(map[string]*memoryObject),
+	}
+}
+
+// UploadFile stores a copy of data under objectName
+func (m *MemoryStorage) UploadFile(_ context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := make([]byte, len(data))
+	copy(stored, data)
+
+	meta := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		meta[k] = v
+	}
+
+	m.objects[objectName] = &memoryObject{
+		data: stored,
+		info: FileInfo{
+			Name:         objectName,
+			Size:         int64(len(data)),
+			LastModified: time.Now().UTC(),
+			ContentType:  contentType,
+			Metadata:     meta,
+		},
+	}
+	return nil
+}
+
+// DownloadFile returns a copy of the data stored under objectName
+func (m *MemoryStorage) DownloadFile(_ context.Context, objectName string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	object, exists := m.objects[objectName]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectName)
+	}
+
+	data := make([]byte, len(object.data))
+	copy(data, object.data)
+	return data, nil
+}
+
+// ListFiles lists all objects with the given prefix in name order
+func (m *MemoryStorage) ListFiles(_ context.Context, prefix string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var objects []string
+	for name := range m.objects {
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, name)
+		}
+	}
+	sort.Strings(objects)
+	return objects, nil
+}
+
+// DeleteFile deletes the object stored under objectName
+func (m *MemoryStorage) DeleteFile(_ context.Context, objectName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.objects[objectName]; !exists {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, objectName)
+	}
+	delete(m.objects, objectName)
+	return nil
+}
+
+// GetFileInfo returns information about the object stored under objectName
+func (m *MemoryStorage) GetFileInfo(_ context.Context, objectName string) (*FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	object, exists := m.objects[objectName]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectName)
+	}
+
+	info := object.info
+	return &info, nil
+}
@@ -0,0 +1,317 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/logger"
+)
+
+// StorageTarget is a named backup storage backend
+type StorageTarget struct {
+	Name    string
+	Storage Storage
+}
+
+// MultiStorage replicates backups to several storage targets
+// Writes and deletes go to every target. Reads try the targets in order and fall back to
+// the next one on failure, and listings are the union of all targets that respond.
+type MultiStorage struct {
+	targets []StorageTarget
+}
+
+// ReplicationError reports the targets on which an operation failed
+// Succeeded lists the targets on which it succeeded; it may be empty.
+type ReplicationError struct {
+	Op        string
+	Object    string
+	Failed    map[string]error
+	Succeeded []string
+}
+
+// Error implements the error interface
+func (e *ReplicationError) Error() string {
+	names := make([]string, 0, len(e.Failed))
+	for name := range e.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failures := make([]string, 0, len(names))
+	for _, name := range names {
+		failures = append(failures, fmt.Sprintf("%s: %v", name, e.Failed[name]))
+	}
+
+	total := len(e.Failed) + len(e.Succeeded)
+	return fmt.Sprintf("%s of %s failed on %d of %d targets (%s)", e.Op, e.Object, len(e.Failed), total, strings.Join(failures, "; "))
+}
+
+// Partial reports whether the operation succeeded on at least one target
+func (e *ReplicationError) Partial() bool {
+	return len(e.Succeeded) > 0
+}
+
+// NewMultiStorage creates a storage backend replicating to the given targets
+// The first target is the primary one, and reads try it first.
+func NewMultiStorage(targets ...StorageTarget) *MultiStorage {
+	return &MultiStorage{targets: targets}
+}
+
+// Targets returns the storage targets in read order
+func (m *MultiStorage) Targets() []StorageTarget {
+	return m.targets
+}
+
+// UploadFile uploads data to every target in parallel
+// A *ReplicationError is returned if any target fails.
+func (m *MultiStorage) UploadFile(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	return m.writeAll("upload", objectName, func(storage Storage) error {
+		return storage.UploadFile(ctx, objectName, data, contentType, metadata)
+	})
+}
+
+// DeleteFile deletes an object from every target in parallel
+// Targets that do not have the object are not counted as failures, unless no target has it.
+func (m *MultiStorage) DeleteFile(ctx context.Context, objectName string) error {
+	var missing atomic.Int64
+	err := m.writeAll("delete", objectName, func(storage Storage) error {
+		err := storage.DeleteFile(ctx, objectName)
+		if errors.Is(err, ErrObjectNotFound) {
+			missing.Add(1)
+			return nil
+		}
+		return err
+	})
+	if err == nil && missing.Load() == int64(len(m.targets)) {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, objectName)
+	}
+	return err
+}
+
+// writeAll runs a write operation on every target in parallel and collects the failures
+func (m *MultiStorage) writeAll(op string, objectName string, fn func(Storage) error) error {
+	errs := make([]error, len(m.targets))
+
+	var wg sync.WaitGroup
+	for i, target := range m.targets {
+		wg.Add(1)
+		go func(i int, storage Storage) {
+			defer wg.Done()
+			errs[i] = fn(storage)
+		}(i, target.Storage)
+	}
+	wg.Wait()
+
+	replErr := &ReplicationError{Op: op, Object: objectName, Failed: make(map[string]error)}
+	for i, target := range m.targets {
+		if errs[i] != nil {
+			replErr.Failed[target.Name] = errs[i]
+		} else {
+			replErr.Succeeded = append(replErr.Succeeded, target.Name)
+		}
+	}
+
+	if len(replErr.Failed) > 0 {
+		return replErr
+	}
+	return nil
+}
+
+// DownloadFile downloads an object from the first target that has it
+func (m *MultiStorage) DownloadFile(ctx context.Context, objectName string) ([]byte, error) {
+	var data []byte
+	err := m.readFirst("download", objectName, func(storage Storage) error {
+		var err error
+		data, err = storage.DownloadFile(ctx, objectName)
+		return err
+	})
+	return data, err
+}
+
+// GetFileInfo returns information about an object from the first target that has it
+func (m *MultiStorage) GetFileInfo(ctx context.Context, objectName string) (*FileInfo, error) {
+	var info *FileInfo
+	err := m.readFirst("stat", objectName, func(storage Storage) error {
+		var err error
+		info, err = storage.GetFileInfo(ctx, objectName)
+		return err
+	})
+	return info, err
+}
+
+// readFirst runs a read operation on each target in order until one succeeds
+// If every target reports the object missing, the error wraps ErrObjectNotFound.
+func (m *MultiStorage) readFirst(op string, objectName string, fn func(Storage) error) error {
+	replErr := &ReplicationError{Op: op, Object: objectName, Failed: make(map[string]error)}
+	notFound := 0
+
+	for _, target := range m.targets {
+		err := fn(target.Storage)
+		if err == nil {
+			if len(replErr.Failed) > 0 && notFound < len(replErr.Failed) {
+				logger.Warn("Read %s from %s after failures on other targets: %v", objectName, target.Name, replErr)
+			}
+			return nil
+		}
+		if errors.Is(err, ErrObjectNotFound) {
+			notFound++
+		}
+		replErr.Failed[target.Name] = err
+	}
+
+	if notFound == len(m.targets) {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, objectName)
+	}
+	return replErr
+}
+
+// ListFiles lists the objects found on any target, in name order
+// Targets that fail are skipped; an error is returned only if every target fails.
+func (m *MultiStorage) ListFiles(ctx context.Context, prefix string) ([]string, error) {
+	seen := make(map[string]bool)
+	replErr := &ReplicationError{Op: "list", Object: prefix, Failed: make(map[string]error)}
+
+	for _, target := range m.targets {
+		objects, err := target.Storage.ListFiles(ctx, prefix)
+		if err != nil {
+			replErr.Failed[target.Name] = err
+			continue
+		}
+		replErr.Succeeded = append(replErr.Succeeded, target.Name)
+		for _, object := range objects {
+			seen[object] = true
+		}
+	}
+
+	if !replErr.Partial() {
+		return nil, replErr
+	}
+	if len(replErr.Failed) > 0 {
+		logger.Warn("Listing is incomplete: %v", replErr)
+	}
+
+	objects := make([]string, 0, len(seen))
+	for object := range seen {
+		objects = append(objects, object)
+	}
+	sort.Strings(objects)
+	return objects, nil
+}
+
+// storageTargets returns the targets of a storage backend in read order
+func storageTargets(storage Storage) []StorageTarget {
+	if multi, ok := storage.(*MultiStorage); ok {
+		return multi.Targets()
+	}
+	return []StorageTarget{{Storage: storage}}
+}
+
+// NewStorageFromURL creates a storage target from a replica URL
+// Supported URLs are "file:///path/to/dir" for a local directory and
+// "s3://bucket?endpoint=host:port&region=r&access_key=k&secret_key=s" for S3, where
+// the query parameters default to the primary S3 configuration. S3 URLs also accept
+// use_ssl, ca_bundle, bucket_lookup, sse and sse_kms_key_id.
+func NewStorageFromURL(raw string, defaults *config.S3Config) (StorageTarget, error) {
+	name, s3Config, dir, err := parseStorageURL(raw, defaults)
+	if err != nil {
+		return StorageTarget{}, err
+	}
+
+	if s3Config != nil {
+		client, err := NewClient(s3Config)
+		if err != nil {
+			return StorageTarget{}, fmt.Errorf("%s: %w", name, err)
+		}
+		return StorageTarget{Name: name, Storage: client}, nil
+	}
+
+	local, err := NewLocalStorage(dir)
+	if err != nil {
+		return StorageTarget{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return StorageTarget{Name: name, Storage: local}, nil
+}
+
+// parseStorageURL parses a replica URL into a target name and either an S3 configuration or a directory
+// The name never includes credentials.
+func parseStorageURL(raw string, defaults *config.S3Config) (string, *config.S3Config, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("invalid storage URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		dir := u.Host + u.Path
+		if dir == "" {
+			return "", nil, "", fmt.Errorf("storage URL %s has no directory", raw)
+		}
+		return "file://" + dir, nil, dir, nil
+
+	case "s3":
+		if u.Host == "" {
+			return "", nil, "", fmt.Errorf("storage URL %s has no bucket", u.Redacted())
+		}
+
+		// Client settings such as TLS, retries and server-side encryption are inherited
+		cfg := &config.S3Config{Region: "us-east-1"}
+		if defaults != nil {
+			*cfg = *defaults
+			if cfg.Region == "" {
+				cfg.Region = "us-east-1"
+			}
+		}
+		cfg.Bucket = u.Host
+		cfg.Enabled = true
+
+		query := u.Query()
+		if v := query.Get("endpoint"); v != "" {
+			cfg.Endpoint = v
+		}
+		if v := query.Get("region"); v != "" {
+			cfg.Region = v
+		}
+		if v := query.Get("access_key"); v != "" {
+			cfg.AccessKey = v
+		}
+		if v := query.Get("secret_key"); v != "" {
+			cfg.SecretKey = v
+		}
+		if v := query.Get("use_ssl"); v != "" {
+			useSSL, err := strconv.ParseBool(v)
+			if err != nil {
+				return "", nil, "", fmt.Errorf("storage URL s3://%s has an invalid use_ssl value: %s", cfg.Bucket, v)
+			}
+			cfg.UseSSL = useSSL
+		}
+		if v := query.Get("ca_bundle"); v != "" {
+			cfg.CABundle = v
+		}
+		if v := query.Get("bucket_lookup"); v != "" {
+			cfg.BucketLookup = v
+		}
+		if v := query.Get("sse"); v != "" {
+			cfg.SSE = v
+		}
+		if v := query.Get("sse_kms_key_id"); v != "" {
+			cfg.SSEKMSKeyID = v
+		}
+
+		if cfg.Endpoint == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+			return "", nil, "", fmt.Errorf("storage URL s3://%s needs an endpoint and credentials", cfg.Bucket)
+		}
+		endpoint, _ := splitEndpoint(cfg.Endpoint, false)
+		return fmt.Sprintf("s3://%s/%s", endpoint, cfg.Bucket), cfg, "", nil
+
+	default:
+		return "", nil, "", fmt.Errorf("unsupported storage URL scheme: %q", u.Scheme)
+	}
+}
@@ -0,0 +1,176 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+// failingStorage is a storage backend whose every operation fails
+type failingStorage struct{}
+
+func (failingStorage) UploadFile(context.Context, string, []byte, string, map[string]string) error {
+	return errors.New("unavailable")
+}
+func (failingStorage) DownloadFile(context.Context, string) ([]byte, error) {
+	return nil, errors.New("unavailable")
+}
+func (failingStorage) ListFiles(context.Context, string) ([]string, error) {
+	return nil, errors.New("unavailable")
+}
+func (failingStorage) DeleteFile(context.Context, string) error {
+	return errors.New("unavailable")
+}
+func (failingStorage) GetFileInfo(context.Context, string) (*FileInfo, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestMultiStorage(t *testing.T) {
+	testStorage(t, NewMultiStorage(
+		StorageTarget{Name: "primary", Storage: NewMemoryStorage()},
+		StorageTarget{Name: "replica", Storage: NewMemoryStorage()},
+	))
+}
+
+func TestMultiStoragePartialFailure(t *testing.T) {
+	primary := NewMemoryStorage()
+	multi := NewMultiStorage(
+		StorageTarget{Name: "primary", Storage: primary},
+		StorageTarget{Name: "dr", Storage: failingStorage{}},
+	)
+
+	err := multi.UploadFile(context.Background(), "backups/full/20250101-000000.json", []byte("{}"), "application/json", nil)
+	var replErr *ReplicationError
+	if !errors.As(err, &replErr) {
+		t.Fatalf("Expected a ReplicationError, got %v", err)
+	}
+	if !replErr.Partial() || len(replErr.Failed) != 1 || replErr.Failed["dr"] == nil {
+		t.Errorf("Expected the upload to fail only on dr, got %+v", replErr)
+	}
+
+	// Reads and listings fall back to targets that work
+	if _, err := multi.DownloadFile(context.Background(), "backups/full/20250101-000000.json"); err != nil {
+		t.Errorf("Expected download to succeed from the primary target: %v", err)
+	}
+	if objects, err := multi.ListFiles(context.Background(), "backups/"); err != nil || len(objects) != 1 {
+		t.Errorf("Expected one object listed, got %v (%v)", objects, err)
+	}
+
+	all := NewMultiStorage(StorageTarget{Name: "a", Storage: failingStorage{}}, StorageTarget{Name: "b", Storage: failingStorage{}})
+	if err := all.UploadFile(context.Background(), "x", nil, "", nil); !errors.As(err, &replErr) || replErr.Partial() {
+		t.Errorf("Expected a total replication failure, got %v", err)
+	}
+	if _, err := all.ListFiles(context.Background(), ""); err == nil {
+		t.Errorf("Expected listing to fail when every target fails")
+	}
+
+	// Objects missing everywhere are reported as not found
+	if _, err := multi.DownloadFile(context.Background(), "missing"); errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Expected a failing target not to be reported as a missing object")
+	}
+	both := NewMultiStorage(StorageTarget{Name: "a", Storage: NewMemoryStorage()}, StorageTarget{Name: "b", Storage: NewMemoryStorage()})
+	if _, err := both.DownloadFile(context.Background(), "missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Expected ErrObjectNotFound, got %v", err)
+	}
+	if err := both.UploadFile(context.Background(), "only", []byte("x"), "", nil); err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+	both.Targets()[1].Storage.DeleteFile(context.Background(), "only")
+	if err := both.DeleteFile(context.Background(), "only"); err != nil {
+		t.Errorf("Expected deleting an object missing on one target to succeed, got %v", err)
+	}
+}
+
+func TestBackupReplication(t *testing.T) {
+	dbManager := database.NewManager()
+	db, _ := dbManager.CreateDatabase("test_db", nil)
+	db.CreateSet("users")
+	db.Put("users", "u1", map[string]interface{}{"name": "Alice"})
+
+	primary, replica := NewMemoryStorage(), NewMemoryStorage()
+	bm := NewBackupManager(NewMultiStorage(
+		StorageTarget{Name: "primary", Storage: primary},
+		StorageTarget{Name: "replica", Storage: replica},
+	), dbManager)
+
+	if err := bm.BackupDatabase("test_db"); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	objects, _ := replica.ListFiles(context.Background(), "backups/")
+	if len(objects) != 2 {
+		t.Fatalf("Expected the backup and its manifest on the replica, got %v", objects)
+	}
+	objectName := filterBackupObjects(objects)[0]
+
+	// Corrupt the primary copy; the restore falls back to the replica
+	data, _ := primary.DownloadFile(context.Background(), objectName)
+	data[0] ^= 0xff
+	primary.UploadFile(context.Background(), objectName, data, "application/json", nil)
+
+	var progress Progress
+	if err := bm.RestoreDatabaseContext(t.Context(), objectName, RestoreOptions{}, &progress); err != nil {
+		t.Fatalf("Expected restore to fall back to the replica: %v", err)
+	}
+	if len(progress.Warnings()) != 1 {
+		t.Errorf("Expected the fallback to be reported, got %v", progress.Warnings())
+	}
+
+	// A backup succeeds with a warning when a replica fails
+	bm = NewBackupManager(NewMultiStorage(
+		StorageTarget{Name: "primary", Storage: primary},
+		StorageTarget{Name: "dr", Storage: failingStorage{}},
+	), dbManager)
+	progress = Progress{}
+	if _, err := bm.BackupDatabaseContext(t.Context(), "test_db", &progress); err != nil {
+		t.Fatalf("Expected backup to succeed on the primary target: %v", err)
+	}
+	if len(progress.Warnings()) != 2 {
+		t.Errorf("Expected warnings for the backup and its manifest, got %v", progress.Warnings())
+	}
+}
+
+func TestParseStorageURL(t *testing.T) {
+	defaults := &config.S3Config{Endpoint: "minio:9000", AccessKey: "ak", SecretKey: "sk", Region: "us-east-1", UseSSL: true, SSE: "sse-s3", MaxRetries: 5}
+
+	name, cfg, _, err := parseStorageURL("s3://dr-bucket?endpoint=s3.eu-west-1.amazonaws.com&region=eu-west-1&secret_key=other", defaults)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if name != "s3://s3.eu-west-1.amazonaws.com/dr-bucket" {
+		t.Errorf("Unexpected name: %s", name)
+	}
+	if cfg.Bucket != "dr-bucket" || cfg.Region != "eu-west-1" || cfg.AccessKey != "ak" || cfg.SecretKey != "other" || !cfg.Enabled {
+		t.Errorf("Unexpected S3 config: %+v", cfg)
+	}
+	if !cfg.UseSSL || cfg.SSE != "sse-s3" || cfg.MaxRetries != 5 {
+		t.Errorf("Expected client settings to be inherited, got %+v", cfg)
+	}
+
+	_, cfg, _, err = parseStorageURL("s3://dr-bucket?use_ssl=false&bucket_lookup=path&sse=sse-kms&sse_kms_key_id=key-1", defaults)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if cfg.UseSSL || cfg.BucketLookup != "path" || cfg.SSE != "sse-kms" || cfg.SSEKMSKeyID != "key-1" {
+		t.Errorf("Expected client settings from the query, got %+v", cfg)
+	}
+	if defaults.Bucket != "" || defaults.SSE != "sse-s3" {
+		t.Errorf("Expected defaults to be left untouched, got %+v", defaults)
+	}
+
+	name, cfg, dir, err := parseStorageURL("file:///var/backups", defaults)
+	if err != nil || cfg != nil || dir != "/var/backups" || name != "file:///var/backups" {
+		t.Errorf("Unexpected result for file URL: %s %+v %s %v", name, cfg, dir, err)
+	}
+
+	for _, raw := range []string{"ftp://host/dir", "s3://", "file://", "://bad", "s3://bucket?use_ssl=maybe"} {
+		if _, _, _, err := parseStorageURL(raw, defaults); err == nil {
+			t.Errorf("Expected error parsing %q", raw)
+		}
+	}
+	if _, _, _, err := parseStorageURL("s3://bucket", nil); err == nil {
+		t.Errorf("Expected error for an S3 URL without endpoint or credentials")
+	}
+}
@@ -0,0 +1,160 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/logger"
+)
+
+// PruneResult represents the outcome of applying a retention policy
+type PruneResult struct {
+	DryRun   bool     `json:"dry_run"`
+	Pruned   []string `json:"pruned"`
+	Retained []string `json:"retained"`
+	Failed   []string `json:"failed,omitempty"`
+}
+
+// backupObject is a backup object name paired with the timestamp parsed from it
+type backupObject struct {
+	name      string
+	timestamp time.Time
+}
+
+// SetRetentionPolicy sets the retention policy used by PruneBackups
+func (bm *BackupManager) SetRetentionPolicy(policy *config.RetentionConfig) {
+	bm.retention = policy
+}
+
+// RetentionPolicy returns the configured retention policy
+func (bm *BackupManager) RetentionPolicy() *config.RetentionConfig {
+	return bm.retention
+}
+
+// PruneBackups deletes backups that are not retained by the configured policy
+func (bm *BackupManager) PruneBackups(dryRun bool) (*PruneResult, error) {
+	return bm.PruneBackupsWithPolicy(bm.retention, "", dryRun)
+}
+
+// PruneBackupsWithPolicy deletes backups that are not retained by the given policy
+// If dbName is not empty, only backups of that database are considered
+// ("full" selects full backups)
+func (bm *BackupManager) PruneBackupsWithPolicy(policy *config.RetentionConfig, dbName string, dryRun bool) (*PruneResult, error) {
+	if !policy.Enabled() {
+		return nil, fmt.Errorf("no retention policy configured")
+	}
+
+	prefix := "backups/"
+	if dbName != "" {
+		prefix = fmt.Sprintf("backups/%s/", dbName)
+	}
+
+	objects, err := bm.listBackupObjects(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	retained, pruned := SelectBackupsToPrune(objects, policy, time.Now().UTC())
+
+	result := &PruneResult{
+		DryRun:   dryRun,
+		Pruned:   make([]string, 0, len(pruned)),
+		Retained: retained,
+	}
+
+	for _, objectName := range pruned {
+		if !dryRun {
+			if err := bm.storage.DeleteFile(context.Background(), objectName); err != nil {
+				logger.Error("Failed to prune backup %s: %v", objectName, err)
+				result.Failed = append(result.Failed, objectName)
+				continue
+			}
+			// Backups written before manifests existed have none, so failures are not reported
+			if err := bm.storage.DeleteFile(context.Background(), ManifestObjectName(objectName)); err != nil {
+				logger.Debug("No manifest deleted for backup %s: %v", objectName, err)
+			}
+		}
+		result.Pruned = append(result.Pruned, objectName)
+	}
+
+	if dryRun {
+		logger.Info("Retention dry run: %d backups would be pruned, %d retained", len(result.Pruned), len(result.Retained))
+	} else {
+		logger.Info("Pruned %d backups, retained %d", len(result.Pruned), len(result.Retained))
+	}
+
+	return result, nil
+}
+
+// SelectBackupsToPrune splits backup object names into those retained by the policy and those to prune
+// Backups are grouped by directory (one group per database plus one for full backups) and the
+// policy is applied to each group independently. The newest backup of a group and objects whose
+// timestamp cannot be parsed are always retained.
+func SelectBackupsToPrune(objectNames []string, policy *config.RetentionConfig, now time.Time) (retained []string, pruned []string) {
+	retained = make([]string, 0, len(objectNames))
+	pruned = make([]string, 0)
+
+	groups := make(map[string][]backupObject)
+	for _, name := range objectNames {
+		timestamp, ok := ParseBackupTimestamp(name)
+		if !ok {
+			retained = append(retained, name)
+			continue
+		}
+		dir := path.Dir(name)
+		groups[dir] = append(groups[dir], backupObject{name: name, timestamp: timestamp})
+	}
+
+	for _, group := range groups {
+		// Newest first
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].timestamp.After(group[j].timestamp)
+		})
+
+		keep := make(map[string]bool)
+		keep[group[0].name] = true
+
+		for i := 0; i < policy.KeepLast && i < len(group); i++ {
+			keep[group[i].name] = true
+		}
+
+		keepBuckets(group, keep, now.Add(-time.Duration(policy.KeepHourly)*time.Hour), func(t time.Time) string {
+			return t.Format("2006010215")
+		})
+		keepBuckets(group, keep, now.AddDate(0, 0, -policy.KeepDaily), func(t time.Time) string {
+			return t.Format("20060102")
+		})
+
+		for _, object := range group {
+			if keep[object.name] {
+				retained = append(retained, object.name)
+			} else {
+				pruned = append(pruned, object.name)
+			}
+		}
+	}
+
+	sort.Strings(retained)
+	sort.Strings(pruned)
+	return retained, pruned
+}
+
+// keepBuckets marks the newest backup in each time bucket newer than cutoff as retained
+// The group must be sorted newest first
+func keepBuckets(group []backupObject, keep map[string]bool, cutoff time.Time, bucket func(time.Time) string) {
+	seen := make(map[string]bool)
+	for _, object := range group {
+		if !object.timestamp.After(cutoff) {
+			break
+		}
+		b := bucket(object.timestamp)
+		if !seen[b] {
+			seen[b] = true
+			keep[object.name] = true
+		}
+	}
+}
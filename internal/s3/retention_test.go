@@ -0,0 +1,93 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/config"
+)
+
+func TestParseBackupTimestamp(t *testing.T) {
+	ts, ok := ParseBackupTimestamp("backups/test_db/20250318-140947.json")
+	if !ok {
+		t.Fatalf("Expected timestamp to be parsed")
+	}
+	expected := time.Date(2025, 3, 18, 14, 9, 47, 0, time.UTC)
+	if !ts.Equal(expected) {
+		t.Errorf("Expected timestamp %v, got %v", expected, ts)
+	}
+
+	if _, ok := ParseBackupTimestamp("backups/test_db/latest.json"); ok {
+		t.Errorf("Expected parsing to fail for an object without a timestamp")
+	}
+}
+
+func TestSelectBackupsToPruneKeepLast(t *testing.T) {
+	objects := []string{
+		"backups/db/20250101-000000.json",
+		"backups/db/20250102-000000.json",
+		"backups/db/20250103-000000.json",
+		"backups/db/20250104-000000.json",
+	}
+	now := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	retained, pruned := SelectBackupsToPrune(objects, &config.RetentionConfig{KeepLast: 2}, now)
+
+	if len(retained) != 2 || retained[0] != objects[2] || retained[1] != objects[3] {
+		t.Errorf("Expected the two newest backups to be retained, got %v", retained)
+	}
+	if len(pruned) != 2 || pruned[0] != objects[0] || pruned[1] != objects[1] {
+		t.Errorf("Expected the two oldest backups to be pruned, got %v", pruned)
+	}
+}
+
+func TestSelectBackupsToPruneHourlyAndDaily(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 30, 0, 0, time.UTC)
+	objects := []string{
+		"backups/full/20250110-120000.json", // newest, this hour
+		"backups/full/20250110-111500.json", // hour 11, newest in bucket
+		"backups/full/20250110-110000.json", // hour 11, older duplicate
+		"backups/full/20250109-230000.json", // yesterday
+		"backups/full/20250109-010000.json", // yesterday, older
+		"backups/full/20250101-000000.json", // outside daily window
+	}
+
+	retained, pruned := SelectBackupsToPrune(objects, &config.RetentionConfig{KeepHourly: 24, KeepDaily: 3}, now)
+
+	expectedPruned := map[string]bool{
+		"backups/full/20250110-110000.json": true,
+		"backups/full/20250109-010000.json": true,
+		"backups/full/20250101-000000.json": true,
+	}
+	if len(pruned) != len(expectedPruned) {
+		t.Fatalf("Expected %d pruned backups, got %v", len(expectedPruned), pruned)
+	}
+	for _, name := range pruned {
+		if !expectedPruned[name] {
+			t.Errorf("Unexpected pruned backup: %s", name)
+		}
+	}
+	if len(retained) != 3 {
+		t.Errorf("Expected 3 retained backups, got %v", retained)
+	}
+}
+
+func TestSelectBackupsToPruneGroupsAndUnknownNames(t *testing.T) {
+	now := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	objects := []string{
+		"backups/a/20250101-000000.json",
+		"backups/a/20250102-000000.json",
+		"backups/b/20250101-000000.json",
+		"backups/a/manual-copy.json",
+	}
+
+	retained, pruned := SelectBackupsToPrune(objects, &config.RetentionConfig{KeepLast: 1}, now)
+
+	// The newest backup of each group and unparseable names are kept
+	if len(pruned) != 1 || pruned[0] != "backups/a/20250101-000000.json" {
+		t.Errorf("Expected only the oldest backup of database a to be pruned, got %v", pruned)
+	}
+	if len(retained) != 3 {
+		t.Errorf("Expected 3 retained backups, got %v", retained)
+	}
+}
@@ -0,0 +1,388 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/cron"
+	"github.com/ssig33/fuckbase/internal/logger"
+)
+
+// SchedulesObjectName is the storage object holding the schedules added at runtime
+// It lives outside the backups/ prefix so it is never listed or pruned as a backup.
+const SchedulesObjectName = "config/backup-schedules.json"
+
+// DefaultScheduleName is the name of the schedule created from the backup interval
+const DefaultScheduleName = "default"
+
+// ErrScheduleNotFound is returned when a schedule name is unknown
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// BackupSchedule describes when to back up a database, or all databases
+type BackupSchedule struct {
+	Name     string `json:"name"`
+	Database string `json:"database,omitempty"` // If empty, back up all databases
+	Cron     string `json:"cron"`               // Cron expression, evaluated in UTC
+}
+
+// ScheduleStatus is a snapshot of a schedule and its last run
+type ScheduleStatus struct {
+	BackupSchedule
+	NextRun *time.Time `json:"next_run,omitempty"`
+	LastRun *JobInfo   `json:"last_run,omitempty"`
+}
+
+// scheduleEntry is a schedule with its parsed expression and run state
+type scheduleEntry struct {
+	schedule BackupSchedule
+	cron     *cron.Schedule
+	next     time.Time
+	last     *Job
+	persist  bool // Saved to storage; false for the schedule created from the backup interval
+}
+
+// Scheduler runs backups on cron schedules
+// Each run is a backup job, and the configured retention policy is applied after
+// each successful run.
+type Scheduler struct {
+	bm   *BackupManager
+	jobs *JobManager
+
+	mu      sync.Mutex
+	entries map[string]*scheduleEntry
+	wake    chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+	now     func() time.Time
+}
+
+// NewScheduler creates a scheduler running backups through the given job manager
+func NewScheduler(bm *BackupManager, jobs *JobManager) *Scheduler {
+	return &Scheduler{
+		bm:      bm,
+		jobs:    jobs,
+		entries: make(map[string]*scheduleEntry),
+		wake:    make(chan struct{}, 1),
+		now:     func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// SetDefault installs a schedule that is not saved to storage
+// It is used for the schedule created from the backup interval; a saved schedule of
+// the same name replaces it when schedules are loaded.
+func (s *Scheduler) SetDefault(schedule BackupSchedule) error {
+	entry, err := s.newEntry(schedule, false)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.entries[schedule.Name] = entry
+	s.mu.Unlock()
+
+	s.notify()
+	return nil
+}
+
+// Load reads the schedules saved in backup storage
+// A missing schedules object is not an error.
+func (s *Scheduler) Load() error {
+	data, err := s.bm.storage.DownloadFile(context.Background(), SchedulesObjectName)
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download schedules: %w", err)
+	}
+
+	var schedules []BackupSchedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return fmt.Errorf("failed to parse schedules: %w", err)
+	}
+
+	s.mu.Lock()
+	for _, schedule := range schedules {
+		entry, err := s.newEntry(schedule, true)
+		if err != nil {
+			logger.Error("Ignoring invalid backup schedule %s: %v", schedule.Name, err)
+			continue
+		}
+		s.entries[schedule.Name] = entry
+	}
+	s.mu.Unlock()
+
+	s.notify()
+	logger.Info("Loaded %d backup schedules", len(schedules))
+	return nil
+}
+
+// Add adds a schedule, replacing any schedule with the same name, and saves it to storage
+func (s *Scheduler) Add(schedule BackupSchedule) error {
+	if schedule.Name == "" {
+		return fmt.Errorf("schedule name is required")
+	}
+
+	entry, err := s.newEntry(schedule, true)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.entries[schedule.Name]
+	if existed {
+		// Keep the last run when a schedule is updated
+		entry.last = previous.last
+	}
+	s.entries[schedule.Name] = entry
+
+	if err := s.saveLocked(); err != nil {
+		if existed {
+			s.entries[schedule.Name] = previous
+		} else {
+			delete(s.entries, schedule.Name)
+		}
+		return err
+	}
+
+	s.notify()
+	logger.Info("Added backup schedule %s (%s)", schedule.Name, schedule.Cron)
+	return nil
+}
+
+// Remove removes a schedule and saves the remaining schedules to storage
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[name]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	delete(s.entries, name)
+
+	if err := s.saveLocked(); err != nil {
+		s.entries[name] = entry
+		return err
+	}
+
+	s.notify()
+	logger.Info("Removed backup schedule %s", name)
+	return nil
+}
+
+// List returns a snapshot of all schedules, sorted by name
+func (s *Scheduler) List() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]ScheduleStatus, 0, len(s.entries))
+	for _, entry := range s.entries {
+		status := ScheduleStatus{BackupSchedule: entry.schedule}
+		if !entry.next.IsZero() {
+			next := entry.next
+			status.NextRun = &next
+		}
+		if entry.last != nil {
+			info := entry.last.Info()
+			status.LastRun = &info
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Start starts running schedules in the background
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	s.stopped = make(chan struct{})
+	s.mu.Unlock()
+
+	go s.run()
+}
+
+// Stop stops running schedules; running backups are left to the job manager
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	stop, stopped := s.stop, s.stopped
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-stopped
+}
+
+// run waits for the next due schedule and starts its backup
+func (s *Scheduler) run() {
+	defer close(s.stopped)
+
+	s.mu.Lock()
+	stop := s.stop
+	s.mu.Unlock()
+
+	logger.Info("Starting backup scheduler")
+	for {
+		timer := time.NewTimer(s.untilNext())
+		select {
+		case <-timer.C:
+			s.runDue()
+		case <-s.wake:
+			timer.Stop()
+		case <-stop:
+			timer.Stop()
+			logger.Info("Stopping backup scheduler")
+			return
+		}
+	}
+}
+
+// untilNext returns the time until the earliest scheduled run
+func (s *Scheduler) untilNext() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, entry := range s.entries {
+		if !entry.next.IsZero() && (next.IsZero() || entry.next.Before(next)) {
+			next = entry.next
+		}
+	}
+
+	if next.IsZero() {
+		// Nothing scheduled; wait for a change
+		return 24 * time.Hour
+	}
+	if d := next.Sub(s.now()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// runDue starts the backups of all schedules that are due
+func (s *Scheduler) runDue() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, entry := range s.entries {
+		if entry.next.IsZero() || entry.next.After(now) {
+			continue
+		}
+		entry.next = entry.cron.Next(now)
+
+		// Do not overlap runs of the same schedule
+		if entry.last != nil {
+			select {
+			case <-entry.last.Done():
+			default:
+				logger.Warn("Skipping backup schedule %s: previous run still in progress", entry.schedule.Name)
+				continue
+			}
+		}
+
+		entry.last = s.startBackup(entry.schedule)
+	}
+}
+
+// startBackup starts the backup job of a schedule and prunes old backups when it succeeds
+func (s *Scheduler) startBackup(schedule BackupSchedule) *Job {
+	logger.Info("Running backup schedule %s", schedule.Name)
+
+	var job *Job
+	if schedule.Database != "" {
+		dbName := schedule.Database
+		job = s.jobs.Start(JobTypeBackup, dbName, "", func(ctx context.Context, progress *Progress) (string, error) {
+			return s.bm.BackupDatabaseContext(ctx, dbName, progress)
+		})
+	} else {
+		job = s.jobs.Start(JobTypeBackup, "", "", s.bm.BackupAllDatabasesContext)
+	}
+
+	go func() {
+		if err := job.Wait(); err != nil {
+			logger.Error("Backup schedule %s failed: %v", schedule.Name, err)
+			return
+		}
+
+		policy := s.bm.RetentionPolicy()
+		if !policy.Enabled() {
+			return
+		}
+		// Schedules of all databases prune all backups, as the backup interval always has
+		if _, err := s.bm.PruneBackupsWithPolicy(policy, schedule.Database, false); err != nil {
+			logger.Error("Pruning after backup schedule %s failed: %v", schedule.Name, err)
+		}
+	}()
+
+	return job
+}
+
+// newEntry validates a schedule and computes its first run
+func (s *Scheduler) newEntry(schedule BackupSchedule, persist bool) (*scheduleEntry, error) {
+	parsed, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression: %w", err)
+	}
+
+	next := parsed.Next(s.now())
+	if next.IsZero() {
+		return nil, fmt.Errorf("cron expression %q never runs", schedule.Cron)
+	}
+
+	return &scheduleEntry{
+		schedule: schedule,
+		cron:     parsed,
+		next:     next,
+		persist:  persist,
+	}, nil
+}
+
+// saveLocked writes the persisted schedules to storage
+// The caller must hold s.mu
+func (s *Scheduler) saveLocked() error {
+	schedules := make([]BackupSchedule, 0, len(s.entries))
+	for _, entry := range s.entries {
+		if entry.persist {
+			schedules = append(schedules, entry.schedule)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Name < schedules[j].Name
+	})
+
+	data, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedules: %w", err)
+	}
+
+	if err := s.bm.storage.UploadFile(context.Background(), SchedulesObjectName, data, "application/json", nil); err != nil {
+		return fmt.Errorf("failed to save schedules: %w", err)
+	}
+	return nil
+}
+
+// notify wakes the scheduler so it picks up changed schedules
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,98 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSchedulerAddListRemove(t *testing.T) {
+	bm, _, storage := newTestBackupManager(t)
+	scheduler := NewScheduler(bm, NewJobManager())
+
+	if err := scheduler.SetDefault(BackupSchedule{Name: DefaultScheduleName, Cron: "@every 60m"}); err != nil {
+		t.Fatalf("Failed to set default schedule: %v", err)
+	}
+	if err := scheduler.Add(BackupSchedule{Name: "orders", Database: "orders", Cron: "0 * * * *"}); err != nil {
+		t.Fatalf("Failed to add schedule: %v", err)
+	}
+	if err := scheduler.Add(BackupSchedule{Name: "bad", Cron: "every now and then"}); err == nil {
+		t.Errorf("Expected error adding a schedule with an invalid cron expression")
+	}
+	if err := scheduler.Add(BackupSchedule{Name: "never", Cron: "0 0 31 2 *"}); err == nil {
+		t.Errorf("Expected error adding a schedule that never runs")
+	}
+
+	schedules := scheduler.List()
+	if len(schedules) != 2 || schedules[0].Name != DefaultScheduleName || schedules[1].Name != "orders" {
+		t.Fatalf("Unexpected schedules: %+v", schedules)
+	}
+	if schedules[1].NextRun == nil || schedules[1].NextRun.Minute() != 0 {
+		t.Errorf("Expected next run on the hour, got %v", schedules[1].NextRun)
+	}
+
+	// Only schedules added at runtime are saved
+	reloaded := NewScheduler(bm, NewJobManager())
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Failed to load schedules: %v", err)
+	}
+	if schedules := reloaded.List(); len(schedules) != 1 || schedules[0].Database != "orders" {
+		t.Errorf("Expected the saved schedule to be loaded, got %+v", schedules)
+	}
+	if objects, _ := storage.ListFiles(context.Background(), "backups/"); len(objects) != 0 {
+		t.Errorf("Expected schedules to be stored outside the backups prefix, got %v", objects)
+	}
+
+	if err := scheduler.Remove("orders"); err != nil {
+		t.Fatalf("Failed to remove schedule: %v", err)
+	}
+	if err := scheduler.Remove("orders"); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("Expected ErrScheduleNotFound, got %v", err)
+	}
+	if len(scheduler.List()) != 1 {
+		t.Errorf("Expected one schedule after removal")
+	}
+}
+
+func TestSchedulerRunDue(t *testing.T) {
+	bm, dbManager, _ := newTestBackupManager(t)
+	db, _ := dbManager.CreateDatabase("orders", nil)
+	db.CreateSet("orders")
+	db.Put("orders", "o1", map[string]interface{}{"total": 10})
+
+	now := time.Date(2025, 3, 18, 14, 9, 0, 0, time.UTC)
+	scheduler := NewScheduler(bm, NewJobManager())
+	scheduler.now = func() time.Time { return now }
+
+	scheduler.Add(BackupSchedule{Name: "orders", Database: "orders", Cron: "@hourly"})
+	scheduler.Add(BackupSchedule{Name: "missing", Database: "missing", Cron: "@daily"})
+
+	// Nothing is due yet
+	scheduler.runDue()
+	if schedules := scheduler.List(); schedules[0].LastRun != nil || schedules[1].LastRun != nil {
+		t.Fatalf("Expected no runs before the schedules are due")
+	}
+
+	now = time.Date(2025, 3, 19, 0, 0, 30, 0, time.UTC)
+	scheduler.runDue()
+
+	for _, schedule := range scheduler.List() {
+		if schedule.LastRun == nil {
+			t.Fatalf("Expected schedule %s to have run", schedule.Name)
+		}
+		job, _ := scheduler.jobs.Get(schedule.LastRun.ID)
+		job.Wait()
+	}
+
+	schedules := scheduler.List()
+	if last := schedules[0]; last.Name != "missing" || last.LastRun.Status != JobStatusFailed {
+		t.Errorf("Expected the schedule of a missing database to fail, got %+v", last.LastRun)
+	}
+	if last := schedules[1]; last.LastRun.Status != JobStatusSucceeded || last.LastRun.BackupName == "" {
+		t.Errorf("Expected the orders schedule to succeed, got %+v", last.LastRun)
+	}
+	if next := schedules[1].NextRun; next == nil || !next.Equal(time.Date(2025, 3, 19, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the next run to be the following hour, got %v", next)
+	}
+}
@@ -0,0 +1,35 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrObjectNotFound is returned, wrapped, by storage backends when an object does not exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// Storage is implemented by every backup storage backend
+// Object names are slash-separated paths such as "backups/full/20250318-140947.json".
+// Backends that call out to a remote service stop when ctx is cancelled.
+type Storage interface {
+	// UploadFile stores data under objectName, replacing any existing object
+	UploadFile(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error
+	// DownloadFile returns the data stored under objectName
+	DownloadFile(ctx context.Context, objectName string) ([]byte, error)
+	// ListFiles lists the names of all objects whose name starts with prefix
+	ListFiles(ctx context.Context, prefix string) ([]string, error)
+	// DeleteFile deletes the object stored under objectName
+	DeleteFile(ctx context.Context, objectName string) error
+	// GetFileInfo returns information about the object stored under objectName
+	GetFileInfo(ctx context.Context, objectName string) (*FileInfo, error)
+}
+
+// FileInfo describes a stored object
+type FileInfo struct {
+	Name         string
+	Size         int64
+	LastModified time.Time
+	ContentType  string
+	Metadata     map[string]string
+}
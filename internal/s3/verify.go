@@ -0,0 +1,355 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/ssig33/fuckbase/internal/logger"
+	"github.com/ssig33/fuckbase/internal/version"
+)
+
+// ManifestSuffix is appended to a backup object name to form the name of its manifest
+const ManifestSuffix = ".manifest"
+
+// BackupManifest is stored alongside each backup object and describes its contents
+type BackupManifest struct {
+	FormatVersion int                      `json:"format_version,omitempty"`
+	ServerVersion string                   `json:"server_version,omitempty"`
+	Object        string                   `json:"object"`
+	Database      string                   `json:"database,omitempty"` // "all" for full backups
+	Checksum      string                   `json:"checksum"`           // SHA-256 of the stored object, "sha256:<hex>"
+	Size          int64                    `json:"size"`
+	Compression   string                   `json:"compression,omitempty"`
+	KeyID         string                   `json:"key_id,omitempty"`
+	CreatedAt     time.Time                `json:"created_at"`
+	DatabaseCount int                      `json:"database_count"`
+	SetCount      int                      `json:"set_count"`
+	EntryCount    int                      `json:"entry_count"`
+	Databases     map[string]DatabaseStats `json:"databases"`
+}
+
+// DatabaseStats holds per-database counts of a backup
+type DatabaseStats struct {
+	Sets    map[string]int `json:"sets"` // Set name to entry count
+	Indexes int            `json:"indexes"`
+}
+
+// VerifyReport is the result of verifying a backup
+type VerifyReport struct {
+	Object           string                   `json:"object"`
+	Valid            bool                     `json:"valid"`
+	ManifestFound    bool                     `json:"manifest_found"`
+	ChecksumVerified bool                     `json:"checksum_verified"`
+	Checksum         string                   `json:"checksum"`
+	Size             int64                    `json:"size"`
+	Encrypted        bool                     `json:"encrypted"`
+	Compression      string                   `json:"compression"`
+	DatabaseCount    int                      `json:"database_count"`
+	SetCount         int                      `json:"set_count"`
+	EntryCount       int                      `json:"entry_count"`
+	Databases        map[string]DatabaseStats `json:"databases"`
+	Problems         []string                 `json:"problems"`
+	Warnings         []string                 `json:"warnings,omitempty"`
+}
+
+// ManifestObjectName returns the name of the manifest for a backup object
+func ManifestObjectName(objectName string) string {
+	return objectName + ManifestSuffix
+}
+
+// IsManifestObject reports whether an object name refers to a backup manifest
+func IsManifestObject(objectName string) bool {
+	return strings.HasSuffix(objectName, ManifestSuffix)
+}
+
+// filterBackupObjects removes manifests from a list of object names
+func filterBackupObjects(objects []string) []string {
+	backups := make([]string, 0, len(objects))
+	for _, object := range objects {
+		if !IsManifestObject(object) {
+			backups = append(backups, object)
+		}
+	}
+	return backups
+}
+
+// Checksum returns the checksum of stored backup data in manifest format
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// computeDatabaseStats counts the sets, entries and indexes of a database backup
+func computeDatabaseStats(backup DatabaseBackup) DatabaseStats {
+	stats := DatabaseStats{
+		Sets:    make(map[string]int, len(backup.Sets)),
+		Indexes: len(backup.Indexes),
+	}
+	for name, set := range backup.Sets {
+		stats.Sets[name] = set.Len()
+	}
+	return stats
+}
+
+// newManifest creates a manifest describing the given databases
+// The database is the name of the backed up database, or "all" for a full backup.
+func newManifest(database string, databases map[string]DatabaseStats) *BackupManifest {
+	manifest := &BackupManifest{
+		FormatVersion: BackupFormatVersion,
+		ServerVersion: version.Version,
+		Database:      database,
+		CreatedAt:     time.Now().UTC(),
+		DatabaseCount: len(databases),
+		Databases:     databases,
+	}
+	for _, stats := range databases {
+		manifest.SetCount += len(stats.Sets)
+		for _, count := range stats.Sets {
+			manifest.EntryCount += count
+		}
+	}
+	return manifest
+}
+
+// uploadManifest completes a manifest for stored backup data and uploads it next to the backup
+func (bm *BackupManager) uploadManifest(ctx context.Context, objectName string, stored []byte, manifest *BackupManifest) error {
+	manifest.Object = objectName
+	manifest.Checksum = Checksum(stored)
+	manifest.Size = int64(len(stored))
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+
+	if err := bm.storage.UploadFile(ctx, ManifestObjectName(objectName), data, "application/json", nil); err != nil {
+		return fmt.Errorf("failed to upload backup manifest: %w", err)
+	}
+
+	return nil
+}
+
+// GetManifest downloads the manifest of a backup object
+func (bm *BackupManager) GetManifest(objectName string) (*BackupManifest, error) {
+	return getManifest(context.Background(), bm.storage, objectName)
+}
+
+// getManifest downloads the manifest of a backup object from a storage backend
+func getManifest(ctx context.Context, storage Storage, objectName string) (*BackupManifest, error) {
+	data, err := storage.DownloadFile(ctx, ManifestObjectName(objectName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download backup manifest: %w", err)
+	}
+
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse backup manifest: %w", err)
+	}
+
+	return &manifest, nil
+}
+
+// VerifyBackup downloads a backup and checks its integrity without touching live data
+// Problems found in the backup are reported in the returned report; an error is only
+// returned when the backup cannot be downloaded at all. Backups written before manifests
+// existed are checked for internal consistency only.
+func (bm *BackupManager) VerifyBackup(objectName string) (*VerifyReport, error) {
+	stored, err := bm.storage.DownloadFile(context.Background(), objectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download backup: %w", err)
+	}
+
+	report := &VerifyReport{
+		Object:    objectName,
+		Checksum:  Checksum(stored),
+		Size:      int64(len(stored)),
+		Encrypted: IsEncryptedBackup(stored),
+		Databases: make(map[string]DatabaseStats),
+		Problems:  []string{},
+	}
+
+	// Compare against the manifest when there is one
+	manifest, err := bm.GetManifest(objectName)
+	if err != nil {
+		report.Warnings = append(report.Warnings, "no manifest found; checksum and counts cannot be verified")
+	} else {
+		report.ManifestFound = true
+		if manifest.Checksum == report.Checksum && manifest.Size == report.Size {
+			report.ChecksumVerified = true
+		} else {
+			report.Problems = append(report.Problems, fmt.Sprintf("checksum mismatch: manifest has %s (%d bytes), object has %s (%d bytes)",
+				manifest.Checksum, manifest.Size, report.Checksum, report.Size))
+		}
+	}
+
+	// Decode the payload
+	payload := stored
+	if report.Encrypted {
+		payload, err = bm.keyring.Decrypt(stored)
+		if err != nil {
+			report.Problems = append(report.Problems, "failed to decrypt backup: "+err.Error())
+			return report, nil
+		}
+	}
+	report.Compression = DetectCompression(payload)
+	data, err := Decompress(payload)
+	if err != nil {
+		report.Problems = append(report.Problems, err.Error())
+		return report, nil
+	}
+
+	databases, metadata, err := parseBackupPayload(objectName, data)
+	if err != nil {
+		report.Problems = append(report.Problems, err.Error())
+		return report, nil
+	}
+
+	for name, backup := range databases {
+		report.Problems = append(report.Problems, checkDatabaseBackup(name, backup)...)
+		stats := computeDatabaseStats(backup)
+		report.Databases[name] = stats
+		report.SetCount += len(stats.Sets)
+		for _, count := range stats.Sets {
+			report.EntryCount += count
+		}
+	}
+	report.DatabaseCount = len(databases)
+
+	// Full backups carry their own counts
+	if metadata != nil {
+		if metadata.DatabaseCount != report.DatabaseCount || metadata.SetCount != report.SetCount || metadata.EntryCount != report.EntryCount {
+			report.Problems = append(report.Problems, fmt.Sprintf("backup metadata counts %d/%d/%d do not match contents %d/%d/%d (databases/sets/entries)",
+				metadata.DatabaseCount, metadata.SetCount, metadata.EntryCount, report.DatabaseCount, report.SetCount, report.EntryCount))
+		}
+	}
+
+	if manifest != nil {
+		report.Problems = append(report.Problems, compareManifestStats(manifest, report)...)
+	}
+
+	report.Valid = len(report.Problems) == 0
+	logger.Info("Verified backup %s: valid=%v, %d problems", objectName, report.Valid, len(report.Problems))
+	return report, nil
+}
+
+// parseBackupPayload parses the JSON payload of a full or single-database backup
+// The returned metadata is nil for single-database backups. The kind of backup is
+// told by its object name, or by its contents for copies outside the backups/ layout.
+func parseBackupPayload(objectName string, data []byte) (map[string]DatabaseBackup, *BackupMetadata, error) {
+	if IsFullBackupObject(objectName) || (!strings.HasPrefix(objectName, "backups/") && isFullBackupPayload(data)) {
+		var fullBackup FullBackup
+		if err := json.Unmarshal(data, &fullBackup); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse full backup: %w", err)
+		}
+		if err := checkFormatVersion(fullBackup.Metadata); err != nil {
+			return nil, nil, err
+		}
+		if fullBackup.Databases == nil {
+			fullBackup.Databases = make(map[string]DatabaseBackup)
+		}
+		return fullBackup.Databases, &fullBackup.Metadata, nil
+	}
+
+	var backup DatabaseBackup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse database backup: %w", err)
+	}
+	if backup.Name == "" {
+		return nil, nil, fmt.Errorf("database backup has no name")
+	}
+	return map[string]DatabaseBackup{backup.Name: backup}, nil, nil
+}
+
+// isFullBackupPayload reports whether a JSON payload holds a full backup rather than a single database
+func isFullBackupPayload(data []byte) bool {
+	var probe struct {
+		Name      *string         `json:"name"`
+		Databases json.RawMessage `json:"databases"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+	return probe.Name == nil && probe.Databases != nil
+}
+
+// IsFullBackupObject reports whether an object name refers to a full backup
+func IsFullBackupObject(objectName string) bool {
+	return strings.HasPrefix(objectName, "backups/full/")
+}
+
+// checkDatabaseBackup checks the internal consistency of a database backup
+func checkDatabaseBackup(name string, backup DatabaseBackup) []string {
+	var problems []string
+
+	if backup.Name != name {
+		problems = append(problems, fmt.Sprintf("database %s is stored under name %s", backup.Name, name))
+	}
+
+	for setName, set := range backup.Sets {
+		if set.Name != setName {
+			problems = append(problems, fmt.Sprintf("database %s: set %s is stored under name %s", name, set.Name, setName))
+		}
+		if len(set.Sealed) > 0 && len(backup.DataKeys) == 0 {
+			problems = append(problems, fmt.Sprintf("database %s: set %s has sealed values but no data keys", name, setName))
+		}
+	}
+
+	for indexName, index := range backup.Indexes {
+		if index.Name != indexName {
+			problems = append(problems, fmt.Sprintf("database %s: index %s is stored under name %s", name, index.Name, indexName))
+		}
+		if _, ok := backup.Sets[index.SetName]; !ok {
+			problems = append(problems, fmt.Sprintf("database %s: index %s refers to missing set %s", name, indexName, index.SetName))
+		}
+		switch database.IndexType(index.Type) {
+		case database.BasicIndexType:
+		case database.SortableIndexType:
+			if len(index.SortFields) == 0 {
+				problems = append(problems, fmt.Sprintf("database %s: sortable index %s has no sort fields", name, indexName))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("database %s: index %s has unknown type %d", name, indexName, index.Type))
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// compareManifestStats compares the counts recorded in a manifest with those found in the backup
+func compareManifestStats(manifest *BackupManifest, report *VerifyReport) []string {
+	var problems []string
+
+	if manifest.DatabaseCount != report.DatabaseCount || manifest.SetCount != report.SetCount || manifest.EntryCount != report.EntryCount {
+		problems = append(problems, fmt.Sprintf("manifest counts %d/%d/%d do not match contents %d/%d/%d (databases/sets/entries)",
+			manifest.DatabaseCount, manifest.SetCount, manifest.EntryCount, report.DatabaseCount, report.SetCount, report.EntryCount))
+	}
+
+	for dbName, expected := range manifest.Databases {
+		actual, ok := report.Databases[dbName]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("database %s is listed in the manifest but missing from the backup", dbName))
+			continue
+		}
+		for setName, count := range expected.Sets {
+			if actualCount, ok := actual.Sets[setName]; !ok {
+				problems = append(problems, fmt.Sprintf("database %s: set %s is listed in the manifest but missing from the backup", dbName, setName))
+			} else if actualCount != count {
+				problems = append(problems, fmt.Sprintf("database %s: set %s has %d entries, manifest expects %d", dbName, setName, actualCount, count))
+			}
+		}
+		if expected.Indexes != actual.Indexes {
+			problems = append(problems, fmt.Sprintf("database %s has %d indexes, manifest expects %d", dbName, actual.Indexes, expected.Indexes))
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
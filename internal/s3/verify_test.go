@@ -0,0 +1,67 @@
+package s3
+
+import (
+	"testing"
+
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+func TestCheckDatabaseBackup(t *testing.T) {
+	backup := DatabaseBackup{
+		Name: "test_db",
+		Sets: map[string]SetBackup{
+			"users": {Name: "users", Data: map[string]interface{}{"u1": map[string]interface{}{"name": "Alice"}}},
+		},
+		Indexes: map[string]IndexBackup{
+			"by_name":  {Name: "by_name", SetName: "users", Field: "name", Type: int(database.BasicIndexType)},
+			"orphaned": {Name: "orphaned", SetName: "orders", Field: "id", Type: int(database.BasicIndexType)},
+			"sorted":   {Name: "sorted", SetName: "users", Field: "name", Type: int(database.SortableIndexType)},
+		},
+	}
+
+	problems := checkDatabaseBackup("test_db", backup)
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems (missing set, missing sort fields), got %v", problems)
+	}
+
+	if problems := checkDatabaseBackup("other_name", DatabaseBackup{Name: "test_db"}); len(problems) != 1 {
+		t.Errorf("Expected a name mismatch problem, got %v", problems)
+	}
+}
+
+func TestCompareManifestStats(t *testing.T) {
+	stats := map[string]DatabaseStats{
+		"test_db": {Sets: map[string]int{"users": 2, "orders": 1}, Indexes: 1},
+	}
+	manifest := newManifest("test_db", stats)
+	if manifest.DatabaseCount != 1 || manifest.SetCount != 2 || manifest.EntryCount != 3 {
+		t.Errorf("Expected manifest counts 1/2/3, got %d/%d/%d", manifest.DatabaseCount, manifest.SetCount, manifest.EntryCount)
+	}
+
+	report := &VerifyReport{
+		DatabaseCount: 1,
+		SetCount:      2,
+		EntryCount:    3,
+		Databases:     map[string]DatabaseStats{"test_db": {Sets: map[string]int{"users": 2, "orders": 1}, Indexes: 1}},
+	}
+	if problems := compareManifestStats(manifest, report); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+
+	report.EntryCount = 2
+	report.Databases["test_db"].Sets["users"] = 1
+	if problems := compareManifestStats(manifest, report); len(problems) != 2 {
+		t.Errorf("Expected total and per-set count problems, got %v", problems)
+	}
+}
+
+func TestFilterBackupObjects(t *testing.T) {
+	objects := []string{
+		"backups/full/20250101-000000.json",
+		"backups/full/20250101-000000.json.manifest",
+	}
+	backups := filterBackupObjects(objects)
+	if len(backups) != 1 || backups[0] != objects[0] {
+		t.Errorf("Expected manifests to be filtered out, got %v", backups)
+	}
+}
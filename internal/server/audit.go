@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/audit"
+	"github.com/ssig33/fuckbase/internal/jwt"
+	"github.com/ssig33/fuckbase/internal/logger"
+	"github.com/ssig33/fuckbase/internal/token"
+)
+
+// auditedEndpoints are the administrative and data-changing endpoints recorded in the audit log
+var auditedEndpoints = map[string]bool{
+	"/create":                 true,
+	"/drop":                   true,
+	"/set/create":             true,
+	"/index/create":           true,
+	"/index/create/sortable":  true,
+	"/index/drop":             true,
+	"/auth/update":            true,
+	"/auth/disable":           true,
+	"/auth/admin/update":      true,
+	"/user/add":               true,
+	"/user/remove":            true,
+	"/token/create":           true,
+	"/token/revoke":           true,
+	"/encryption/enable":      true,
+	"/encryption/rotate":      true,
+	"/backup/create":          true,
+	"/backup/restore":         true,
+	"/backup/prune":           true,
+	"/backup/job/cancel":      true,
+	"/backup/schedule/add":    true,
+	"/backup/schedule/remove": true,
+}
+
+// auditedWriteEndpoints are the set writes, recorded only if configured
+var auditedWriteEndpoints = map[string]bool{
+	"/set/put":    true,
+	"/set/delete": true,
+	"/import":     true,
+}
+
+// maxAuditErrorBody is how much of an error response is kept to find its code
+const maxAuditErrorBody = 4096
+
+// audited reports whether requests to an endpoint are recorded in the audit log
+func (s *Server) audited(path string) bool {
+	return auditedEndpoints[path] || (s.Config.Audit.Writes && auditedWriteEndpoints[path])
+}
+
+// auditRequests is a middleware that records audited requests in the audit log, with their result
+// It wraps the rate limits, so requests they reject are recorded too.
+func (s *Server) auditRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.auditLog == nil || !s.audited(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		target := readAuditTarget(r)
+		event := audit.Event{
+			Time:      time.Now(),
+			RequestID: requestID(r),
+			Identity:  s.requestActor(r, target),
+			Source:    clientIP(r),
+			Endpoint:  r.URL.Path,
+			Database:  target.Database,
+			Set:       target.Set,
+			Key:       target.Key,
+			Target:    target.object(),
+		}
+
+		rec := &auditRecorder{responseRecorder: newResponseRecorder(w)}
+		next.ServeHTTP(rec, r)
+
+		event.Status = rec.status
+		event.Result = audit.ResultSuccess
+		if rec.status >= http.StatusBadRequest {
+			event.Result = audit.ResultFailure
+			var errResp ErrorResponse
+			if json.Unmarshal(rec.body.Bytes(), &errResp) == nil {
+				event.Code = errResp.Code
+			}
+		}
+
+		if err := s.auditLog.Record(event); err != nil {
+			logger.Error("Failed to record %s by %s in the audit log: %v", event.Endpoint, event.Identity, err)
+		}
+	})
+}
+
+// auditRecorder records the status code and the start of an error response
+type auditRecorder struct {
+	*responseRecorder
+	body bytes.Buffer
+}
+
+// Write keeps the start of an error response and writes it
+func (r *auditRecorder) Write(b []byte) (int, error) {
+	if r.status >= http.StatusBadRequest && r.body.Len() < maxAuditErrorBody {
+		r.body.Write(b[:min(len(b), maxAuditErrorBody-r.body.Len())])
+	}
+	return r.responseRecorder.Write(b)
+}
+
+// auditTarget is what an audited request operates on, and the credentials in its body
+type auditTarget struct {
+	Database       string `json:"database"`
+	Set            string `json:"set"`
+	Key            string `json:"key"`
+	Name           string `json:"name"`
+	BackupName     string `json:"backup_name"`
+	TargetDatabase string `json:"target_database"`
+	JobID          string `json:"job_id"`
+	ID             string `json:"id"`
+	Username       string `json:"username"`
+	Auth           struct {
+		Username string `json:"username"`
+	} `json:"auth"`
+	AdminAuth struct {
+		Username string `json:"username"`
+	} `json:"admin_auth"`
+}
+
+// object returns the object other than the database, set and key that a request operates on,
+// such as an index, backup, job, schedule, token or user
+func (t *auditTarget) object() string {
+	for _, name := range []string{t.Name, t.BackupName, t.JobID, t.ID, t.Username} {
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// readAuditTarget reads what a request operates on from its body
+// /import takes its parameters from the query string instead, as its body is the data.
+func readAuditTarget(r *http.Request) auditTarget {
+	var target auditTarget
+	if r.URL.Path == "/import" {
+		query := r.URL.Query()
+		target.Database = query.Get("database")
+		target.Set = query.Get("set")
+		return target
+	}
+
+	if body, err := peekBody(r); err == nil {
+		json.Unmarshal(body, &target)
+	}
+
+	switch {
+	case r.URL.Path == "/create" || r.URL.Path == "/drop":
+		// The name is the database's, and the auth of /create is the new database's owner
+		target.Database = target.Name
+		target.Name = ""
+		target.Auth.Username = ""
+	case target.TargetDatabase != "":
+		// A restore into another database changes that one
+		target.Database = target.TargetDatabase
+	}
+	return target
+}
+
+// requestActor returns who a request is from, for the audit log
+// The identity is the one the request presents, whether or not it was accepted: a database user
+// as "user:<database>/<username>", an API token as "token:<id>", a JWT as "jwt:<subject>", other
+// bearer tokens as "bearer:<hash>", admin credentials as "admin:<username>" and a client
+// certificate as "cert:<subject>". Requests without credentials are "anonymous".
+func (s *Server) requestActor(r *http.Request, target auditTarget) string {
+	if bearer, ok := ExtractBearerToken(r); ok {
+		if strings.HasPrefix(bearer, token.Prefix) && s.tokens != nil {
+			if tok, ok := s.tokens.Authenticate(bearer); ok {
+				return "token:" + tok.ID
+			}
+		} else if s.jwtVerifier != nil && jwt.LooksLikeToken(bearer) {
+			if claims, err := s.jwtVerifier.Verify(bearer); err == nil && claims.Subject != "" {
+				return "jwt:" + claims.Subject
+			}
+		}
+		sum := sha256.Sum256([]byte(bearer))
+		return "bearer:" + hex.EncodeToString(sum[:8])
+	}
+
+	if username, _, ok := ExtractDatabaseAuth(r); ok {
+		return "user:" + target.Database + "/" + username
+	}
+	if target.Auth.Username != "" {
+		return "user:" + target.Database + "/" + target.Auth.Username
+	}
+	if encoded, ok := strings.CutPrefix(r.Header.Get("X-Admin-Authorization"), "Basic "); ok {
+		decoded, _ := base64.StdEncoding.DecodeString(encoded)
+		username, _, _ := strings.Cut(string(decoded), ":")
+		return "admin:" + username
+	}
+	if target.AdminAuth.Username != "" {
+		return "admin:" + target.AdminAuth.Username
+	}
+	if id := s.tls.identity(r); id != nil {
+		return "cert:" + id.Subject
+	}
+	return "anonymous"
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/ssig33/fuckbase/internal/audit"
+)
+
+// Limits on the number of events an audit log query returns
+const (
+	defaultAuditQueryLimit = 100
+	maxAuditQueryLimit     = 1000
+)
+
+// handleAuditQuery handles the /audit/query endpoint
+func (s *Server) handleAuditQuery(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleAuditQueryImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleAuditQueryImpl(w, r)
+}
+
+// handleAuditQueryImpl implements the audit log query logic
+func (s *Server) handleAuditQueryImpl(w http.ResponseWriter, r *http.Request) {
+	if s.auditLog == nil {
+		writeErrorResponse(w, http.StatusBadRequest, "AUDIT_NOT_CONFIGURED", "No audit log configured")
+		return
+	}
+
+	// Parse request body
+	var req QueryAuditRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Validate request
+	if req.Result != "" && req.Result != audit.ResultSuccess && req.Result != audit.ResultFailure {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Result must be success or failure")
+		return
+	}
+	if req.Limit < 0 || req.Limit > maxAuditQueryLimit {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Limit must be between 0 and 1000")
+		return
+	}
+
+	filter := audit.Filter{
+		Identity: req.Identity,
+		Endpoint: req.Endpoint,
+		Database: req.Database,
+		Result:   req.Result,
+		Limit:    req.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditQueryLimit
+	}
+	if req.Since != nil {
+		filter.Since = *req.Since
+	}
+	if req.Until != nil {
+		filter.Until = *req.Until
+	}
+
+	events, err := s.auditLog.Query(filter)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	// Return success response
+	response := QueryAuditResponse{
+		Status: "success",
+		Events: events,
+		Count:  len(events),
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
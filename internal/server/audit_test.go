@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ssig33/fuckbase/internal/audit"
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/credential"
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+// newAuditTestServer creates a server with admin auth and an audit log, and its router in the middleware pipeline
+func newAuditTestServer(t *testing.T, writes bool) (*Server, http.Handler) {
+	dbManager := database.NewManager()
+	auth, _ := database.NewAuthConfig("owner", "password")
+	db, _ := dbManager.CreateDatabase("orders", auth)
+	db.CreateSet("items")
+
+	hash, _ := credential.HashPassword("admin-password")
+	cfg := config.NewServerConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.AdminAuth = &config.AdminAuthConfig{Username: "admin", PasswordHash: hash, Enabled: true}
+	cfg.Audit.File = filepath.Join(cfg.DataDir, "audit.log")
+	cfg.Audit.Writes = writes
+	srv := newTestServer(t, cfg, dbManager)
+	t.Cleanup(func() { srv.auditLog.Close() })
+
+	router := http.NewServeMux()
+	srv.registerEndpoints(router)
+	return srv, srv.handler(router)
+}
+
+// sendAudited sends a JSON request with admin or database credentials
+func sendAudited(handler http.Handler, path, header, username, password string, reqBody interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.RemoteAddr = "192.0.2.10:12345"
+	if username != "" {
+		req.Header.Set(header, "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAuditLog(t *testing.T) {
+	srv, handler := newAuditTestServer(t, false)
+
+	create := CreateDatabaseRequest{Name: "shop"}
+	create.Auth.Username = "shop-owner"
+	create.Auth.Password = "password"
+	if rr := sendAudited(handler, "/create", "X-Admin-Authorization", "admin", "admin-password", create); rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	index := CreateIndexRequest{Database: "orders", Set: "items", Name: "by_name", Field: "name"}
+	if rr := sendAudited(handler, "/index/create", "Authorization", "owner", "wrong", index); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	// Reads and, by default, set writes are not recorded
+	get := GetSetRequest{Database: "orders", Set: "items", Key: "i1"}
+	sendAudited(handler, "/set/get", "Authorization", "owner", "password", get)
+	put := PutSetRequest{Database: "orders", Set: "items", Key: "i1", Value: json.RawMessage(`{"name":"Widget"}`)}
+	sendAudited(handler, "/set/put", "Authorization", "owner", "password", put)
+
+	events, err := srv.auditLog.Query(audit.Filter{})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d: %+v", len(events), events)
+	}
+
+	failed, created := events[0], events[1]
+	if created.Identity != "admin:admin" || created.Endpoint != "/create" || created.Database != "shop" ||
+		created.Result != audit.ResultSuccess || created.Status != http.StatusOK || created.Source != "192.0.2.10" {
+		t.Errorf("Unexpected create event: %+v", created)
+	}
+	if failed.Identity != "user:orders/owner" || failed.Set != "items" || failed.Target != "by_name" ||
+		failed.Result != audit.ResultFailure || failed.Status != http.StatusUnauthorized || failed.Code != "AUTH_FAILED" {
+		t.Errorf("Unexpected index event: %+v", failed)
+	}
+
+	// Querying requires admin credentials
+	query := QueryAuditRequest{Result: audit.ResultFailure}
+	if rr := sendAudited(handler, "/audit/query", "X-Admin-Authorization", "admin", "wrong", query); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	rr := sendAudited(handler, "/audit/query", "X-Admin-Authorization", "admin", "admin-password", query)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var resp QueryAuditResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Count != 1 || resp.Events[0].Endpoint != "/index/create" {
+		t.Errorf("Expected the failed index creation, got %+v", resp)
+	}
+}
+
+func TestAuditWrites(t *testing.T) {
+	srv, handler := newAuditTestServer(t, true)
+
+	put := PutSetRequest{Database: "orders", Set: "items", Key: "i1", Value: json.RawMessage(`{"name":"Widget"}`)}
+	if rr := sendAudited(handler, "/set/put", "Authorization", "owner", "password", put); rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	events, _ := srv.auditLog.Query(audit.Filter{Endpoint: "/set/put"})
+	if len(events) != 1 || events[0].Key != "i1" || events[0].Identity != "user:orders/owner" || events[0].Result != audit.ResultSuccess {
+		t.Errorf("Expected the write to be recorded, got %+v", events)
+	}
+}
+
+func TestAuditLogUnavailable(t *testing.T) {
+	// A file where the audit log directory should be
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "logs"), nil, 0600)
+
+	cfg := config.NewServerConfig()
+	cfg.DataDir = dir
+	cfg.Audit.File = filepath.Join(dir, "logs", "audit.log")
+	if _, err := NewServer(cfg, database.NewManager()); err == nil {
+		t.Errorf("Expected the server to refuse to start without its audit log")
+	}
+}
+
+func TestAuditNotConfigured(t *testing.T) {
+	cfg := config.NewServerConfig()
+	cfg.DataDir = t.TempDir()
+	srv := newTestServer(t, cfg, database.NewManager())
+
+	rr := postJSON(srv.handleAuditQuery, "/audit/query", QueryAuditRequest{})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
@@ -2,16 +2,41 @@ package server
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/credential"
+	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/ssig33/fuckbase/internal/jwt"
 	"github.com/ssig33/fuckbase/internal/logger"
+	"github.com/ssig33/fuckbase/internal/token"
 )
 
+// AdminAuthFileName is the file in the data directory holding admin credentials rotated at runtime
+const AdminAuthFileName = "admin_auth.json"
+
 // AdminAuth handles admin authentication
+// The credentials can be rotated at runtime, so Config is only read under the lock.
 type AdminAuth struct {
 	Config *config.AdminAuthConfig
+	path   string      // File rotated credentials are saved to; empty keeps them in memory only
+	certs  *tlsManager // Client certificate identities, if TLS is enabled
+	mu     sync.RWMutex
+}
+
+// rotatedAdminAuth is the saved form of admin credentials rotated at runtime
+type rotatedAdminAuth struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"`
+	RotatedAt    time.Time `json:"rotated_at"`
 }
 
 // NewAdminAuth creates a new admin authentication handler
@@ -21,48 +46,141 @@ func NewAdminAuth(cfg *config.AdminAuthConfig) *AdminAuth {
 	}
 }
 
+// Enabled reports whether admin authentication is required
+func (a *AdminAuth) Enabled() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.Config != nil && a.Config.Enabled
+}
+
 // Authenticate authenticates an admin user
 func (a *AdminAuth) Authenticate(username, password string) bool {
-	if a.Config == nil || !a.Config.Enabled {
+	a.mu.RLock()
+	cfg := a.Config
+	a.mu.RUnlock()
+
+	if cfg == nil || !cfg.Enabled {
+		return true
+	}
+
+	// Check both so a wrong username takes as long as a wrong password
+	usernameOK := credential.EqualStrings(cfg.Username, username)
+	passwordOK := credential.VerifyPassword(cfg.PasswordHash, password)
+	return usernameOK && passwordOK
+}
+
+// AuthenticateRequest reports whether a request carries valid admin credentials
+// It is true for every request when admin authentication is not enabled. A client
+// certificate mapped to an admin identity counts as admin credentials.
+func (a *AdminAuth) AuthenticateRequest(r *http.Request) bool {
+	if !a.Enabled() {
+		return true
+	}
+	if id := a.certs.identity(r); id != nil && id.Admin {
 		return true
 	}
 
-	return a.Config.Username == username && a.Config.Password == password
+	// Check for admin auth in header
+	authHeader := r.Header.Get("X-Admin-Authorization")
+	if authHeader != "" {
+		if strings.HasPrefix(authHeader, "Basic ") {
+			credentials, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authHeader, "Basic "))
+			if err == nil {
+				parts := strings.SplitN(string(credentials), ":", 2)
+				if len(parts) == 2 {
+					return a.Authenticate(parts[0], parts[1])
+				}
+			}
+		}
+	}
+
+	return false
 }
 
 // RequireAdminAuth is a middleware that requires admin authentication
 func (a *AdminAuth) RequireAdminAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if a.Config == nil || !a.Config.Enabled {
+		if a.AuthenticateRequest(r) {
 			next(w, r)
 			return
 		}
 
-		// Check for admin auth in header
-		authHeader := r.Header.Get("X-Admin-Authorization")
-		if authHeader != "" {
-			if strings.HasPrefix(authHeader, "Basic ") {
-				credentials, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authHeader, "Basic "))
-				if err == nil {
-					parts := strings.SplitN(string(credentials), ":", 2)
-					if len(parts) == 2 {
-						username := parts[0]
-						password := parts[1]
-						if a.Authenticate(username, password) {
-							next(w, r)
-							return
-						}
-					}
-				}
-			}
-		}
-
 		// If we get here, authentication failed
 		logger.Warn("Admin authentication failed")
 		writeErrorResponse(w, http.StatusUnauthorized, "ADMIN_AUTH_REQUIRED", "Admin authentication required")
 	}
 }
 
+// LoadRotated loads admin credentials rotated at runtime from path, replacing the configured ones
+// Later rotations are saved to the same path. It reports whether rotated credentials were found.
+func (a *AdminAuth) LoadRotated(path string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read admin credentials: %w", err)
+	}
+
+	var rotated rotatedAdminAuth
+	if err := json.Unmarshal(data, &rotated); err != nil {
+		return false, fmt.Errorf("failed to parse admin credentials: %w", err)
+	}
+	if rotated.Username == "" || !credential.IsPasswordHash(rotated.PasswordHash) {
+		return false, fmt.Errorf("invalid admin credentials in %s", path)
+	}
+
+	a.Config = &config.AdminAuthConfig{Username: rotated.Username, PasswordHash: rotated.PasswordHash, Enabled: true}
+	return true, nil
+}
+
+// Update replaces the admin credentials, enabling admin authentication
+// The credentials are saved if LoadRotated was given a path, so they survive a restart.
+func (a *AdminAuth) Update(username, passwordHash string) error {
+	if username == "" || !credential.IsPasswordHash(passwordHash) {
+		return fmt.Errorf("a username and a password hash are required")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.path != "" {
+		data, err := json.MarshalIndent(rotatedAdminAuth{
+			Username:     username,
+			PasswordHash: passwordHash,
+			RotatedAt:    time.Now().UTC(),
+		}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal admin credentials: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+			return fmt.Errorf("failed to create data directory: %w", err)
+		}
+
+		// Write to a temporary file first so a failed write leaves the old credentials intact
+		tmp := a.path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0600); err != nil {
+			return fmt.Errorf("failed to save admin credentials: %w", err)
+		}
+		if err := os.Rename(tmp, a.path); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to save admin credentials: %w", err)
+		}
+	}
+
+	if a.Config != nil && a.Config.PasswordHash != "" {
+		credential.ForgetPassword(a.Config.PasswordHash)
+	}
+
+	// Replace rather than modify the configuration, which may be shared
+	a.Config = &config.AdminAuthConfig{Username: username, PasswordHash: passwordHash, Enabled: true}
+	return nil
+}
+
 // ExtractDatabaseAuth extracts database authentication from a request
 func ExtractDatabaseAuth(r *http.Request) (string, string, bool) {
 	// Check for auth in header
@@ -80,4 +198,82 @@ func ExtractDatabaseAuth(r *http.Request) (string, string, bool) {
 	}
 
 	return "", "", false
-}
\ No newline at end of file
+}
+
+// ExtractBearerToken extracts an API token from the Authorization header
+func ExtractBearerToken(r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		if secret := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer ")); secret != "" {
+			return secret, true
+		}
+	}
+
+	return "", false
+}
+
+// authorizeDatabase checks that a request's credentials grant the required role on a set
+// A mapped client certificate, or an API token or JWT in the Authorization header, is checked
+// against its scopes; otherwise the database credentials are taken from the header, or failing
+// that from the request body. An empty set name stands for the database as a whole. It
+// writes the error response and returns false if the request is not allowed.
+func (s *Server) authorizeDatabase(w http.ResponseWriter, r *http.Request, db *database.Database, setName string, bodyUsername, bodyPassword string, required database.Role) bool {
+	// A client certificate whose identity has a matching scope needs no other credentials
+	if id := s.tls.identity(r); id != nil && token.ScopesAllow(id.Scopes, db.Name, setName, required) {
+		return true
+	}
+
+	if bearer, ok := ExtractBearerToken(r); ok {
+		scopes, ok := s.bearerScopes(bearer)
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+			return false
+		}
+		if !token.ScopesAllow(scopes, db.Name, setName, required) {
+			writeErrorResponse(w, http.StatusForbidden, "PERMISSION_DENIED", "The token's scopes do not allow this operation")
+			return false
+		}
+		return true
+	}
+
+	username, password, hasAuth := ExtractDatabaseAuth(r)
+	if !hasAuth {
+		username = bodyUsername
+		password = bodyPassword
+	}
+
+	role, ok := db.UserRole(username, password)
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+		return false
+	}
+	if !role.Allows(required) {
+		writeErrorResponse(w, http.StatusForbidden, "PERMISSION_DENIED", fmt.Sprintf("The %s role is required", required))
+		return false
+	}
+	return true
+}
+
+// bearerScopes authenticates an API token or JWT and returns its scopes
+func (s *Server) bearerScopes(bearer string) ([]token.Scope, bool) {
+	if strings.HasPrefix(bearer, token.Prefix) {
+		if s.tokens == nil {
+			return nil, false
+		}
+		tok, ok := s.tokens.Authenticate(bearer)
+		if !ok {
+			return nil, false
+		}
+		return tok.Scopes, true
+	}
+
+	if s.jwtVerifier == nil || !jwt.LooksLikeToken(bearer) {
+		return nil, false
+	}
+	claims, err := s.jwtVerifier.Verify(bearer)
+	if err != nil {
+		logger.Warn("Rejected JWT: %v", err)
+		return nil, false
+	}
+	return claims.Scopes, true
+}
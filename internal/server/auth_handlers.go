@@ -0,0 +1,196 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ssig33/fuckbase/internal/credential"
+	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/ssig33/fuckbase/internal/logger"
+)
+
+// handleAuthUpdate handles the /auth/update endpoint
+// It sets the database's own credentials, enabling authentication if it was disabled.
+func (s *Server) handleAuthUpdate(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Parse request body
+	var req UpdateAuthRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Validate request
+	if req.Database == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Database name is required")
+		return
+	}
+	if req.Username == "" || req.Password == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Username and password are required")
+		return
+	}
+
+	// Get database
+	db, err := s.DBManager.GetDatabase(req.Database)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "DB_NOT_FOUND", "Database not found")
+		return
+	}
+
+	// Check admin or current database authentication
+	if !s.authorizeAuthChange(w, r, db, req.Auth.Username, req.Auth.Password) {
+		return
+	}
+
+	// Update credentials
+	if err := db.SetOwner(req.Username, req.Password); err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			writeErrorResponse(w, http.StatusConflict, "USER_ALREADY_EXISTS", err.Error())
+		} else {
+			writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		}
+		return
+	}
+
+	logger.Info("Updated credentials of database: %s", req.Database)
+
+	// Return success response
+	response := Response{
+		Status:  "success",
+		Message: "Authentication updated successfully",
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// handleAuthDisable handles the /auth/disable endpoint
+func (s *Server) handleAuthDisable(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Parse request body
+	var req DisableAuthRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Validate request
+	if req.Database == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Database name is required")
+		return
+	}
+
+	// Get database
+	db, err := s.DBManager.GetDatabase(req.Database)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "DB_NOT_FOUND", "Database not found")
+		return
+	}
+
+	// Check admin or current database authentication
+	if !s.authorizeAuthChange(w, r, db, req.Auth.Username, req.Auth.Password) {
+		return
+	}
+
+	db.DisableAuth()
+
+	logger.Warn("Disabled authentication of database: %s", req.Database)
+
+	// Return success response
+	response := Response{
+		Status:  "success",
+		Message: "Authentication disabled successfully",
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// authorizeAuthChange checks that a request may change a database's authentication
+// Admin credentials allow it when admin authentication is enabled; otherwise the current
+// database credentials must have the admin role. A database without authentication has no
+// current credentials, so it needs admin credentials whenever admin authentication is enabled.
+func (s *Server) authorizeAuthChange(w http.ResponseWriter, r *http.Request, db *database.Database, username, password string) bool {
+	if s.adminAuth.Enabled() && s.adminAuth.AuthenticateRequest(r) {
+		return true
+	}
+	if !db.AuthEnabled() {
+		if s.adminAuth.Enabled() {
+			writeErrorResponse(w, http.StatusUnauthorized, "ADMIN_AUTH_REQUIRED", "Admin authentication required")
+			return false
+		}
+		return true
+	}
+	return s.authorizeDatabase(w, r, db, "", username, password, database.RoleAdmin)
+}
+
+// handleAdminAuthUpdate handles the /auth/admin/update endpoint
+func (s *Server) handleAdminAuthUpdate(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleAdminAuthUpdateImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleAdminAuthUpdateImpl(w, r)
+}
+
+// handleAdminAuthUpdateImpl implements the admin credential rotation logic
+func (s *Server) handleAdminAuthUpdateImpl(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var req UpdateAdminAuthRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Validate request
+	if req.Username == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Username is required")
+		return
+	}
+	if (req.Password == "") == (req.PasswordHash == "") {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Either a password or a password hash is required")
+		return
+	}
+
+	hash := req.PasswordHash
+	if req.Password != "" {
+		var err error
+		hash, err = credential.HashPassword(req.Password)
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+	} else if !credential.IsPasswordHash(hash) {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid password hash")
+		return
+	}
+
+	// Rotate credentials
+	if err := s.adminAuth.Update(req.Username, hash); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	logger.Info("Rotated admin credentials for user: %s", req.Username)
+
+	// Return success response
+	response := Response{
+		Status:  "success",
+		Message: "Admin credentials updated successfully",
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
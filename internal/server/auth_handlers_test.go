@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/credential"
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+// postAsAdmin calls a handler with a JSON request body and admin credentials
+func postAsAdmin(handler http.HandlerFunc, username, password string, reqBody interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestDatabaseAuthUpdate(t *testing.T) {
+	dbManager := database.NewManager()
+	auth, _ := database.NewAuthConfig("owner", "first")
+	db, _ := dbManager.CreateDatabase("test_db", auth)
+	db.AddUser("reporter", "secret", database.RoleReader)
+	dbManager.CreateDatabase("open_db", nil)
+	srv := newTestServer(t, config.NewServerConfig(), dbManager)
+
+	update := UpdateAuthRequest{Database: "test_db", Username: "owner", Password: "second"}
+	tests := []struct {
+		name     string
+		username string
+		password string
+		status   int
+	}{
+		{"wrong password", "owner", "wrong", http.StatusUnauthorized},
+		{"reader", "reporter", "secret", http.StatusForbidden},
+		{"current credentials", "owner", "first", http.StatusOK},
+		{"old credentials", "owner", "first", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if rr := postAs(srv.handleAuthUpdate, tt.username, tt.password, update); rr.Code != tt.status {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tt.name, rr.Code, tt.status)
+		}
+	}
+	if _, ok := db.UserRole("owner", "second"); !ok {
+		t.Errorf("Expected the new password to be accepted")
+	}
+
+	// Disabling authentication opens the database
+	if rr := postAs(srv.handleAuthDisable, "owner", "first", DisableAuthRequest{Database: "test_db"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := postAs(srv.handleAuthDisable, "owner", "second", DisableAuthRequest{Database: "test_db"}); rr.Code != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := postJSON(srv.handleSetList, "/set/list", ListSetsRequest{Database: "test_db"}); rr.Code != http.StatusOK {
+		t.Errorf("Expected the database to be open, got %v", rr.Code)
+	}
+
+	// Authentication can be enabled on an open database
+	if rr := postJSON(srv.handleAuthUpdate, "/auth/update", UpdateAuthRequest{Database: "open_db", Username: "owner", Password: "pw"}); rr.Code != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := postJSON(srv.handleSetList, "/set/list", ListSetsRequest{Database: "open_db"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected authentication to be required, got %v", rr.Code)
+	}
+
+	if rr := postJSON(srv.handleAuthUpdate, "/auth/update", UpdateAuthRequest{Database: "missing", Username: "a", Password: "b"}); rr.Code != http.StatusNotFound {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestAdminAuthRotation(t *testing.T) {
+	hash, _ := credential.HashPassword("admin-first")
+	cfg := config.NewServerConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.AdminAuth = &config.AdminAuthConfig{Username: "admin", PasswordHash: hash, Enabled: true}
+
+	dbManager := database.NewManager()
+	auth, _ := database.NewAuthConfig("owner", "first")
+	dbManager.CreateDatabase("test_db", auth)
+	srv := newTestServer(t, cfg, dbManager)
+
+	// Admin credentials can change a database's credentials without the current ones
+	update := UpdateAuthRequest{Database: "test_db", Username: "owner", Password: "second"}
+	if rr := postAsAdmin(srv.handleAuthUpdate, "admin", "wrong", update); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := postAsAdmin(srv.handleAuthUpdate, "admin", "admin-first", update); rr.Code != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Open databases have no current credentials, so only the admin can set them
+	dbManager.CreateDatabase("open_db", nil)
+	takeover := UpdateAuthRequest{Database: "open_db", Username: "intruder", Password: "mine"}
+	rr := postJSON(srv.handleAuthUpdate, "/auth/update", takeover)
+	var errResp ErrorResponse
+	json.Unmarshal(rr.Body.Bytes(), &errResp)
+	if rr.Code != http.StatusUnauthorized || errResp.Code != "ADMIN_AUTH_REQUIRED" {
+		t.Errorf("Expected ADMIN_AUTH_REQUIRED, got %v %s", rr.Code, rr.Body.String())
+	}
+	if rr := postAs(srv.handleAuthDisable, "intruder", "mine", DisableAuthRequest{Database: "open_db"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := postAsAdmin(srv.handleAuthUpdate, "admin", "admin-first", takeover); rr.Code != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Rotate the admin credentials
+	rotate := UpdateAdminAuthRequest{Username: "root", Password: "admin-second"}
+	if rr := postJSON(srv.handleAdminAuthUpdate, "/auth/admin/update", rotate); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := postAsAdmin(srv.handleAdminAuthUpdate, "admin", "admin-first", UpdateAdminAuthRequest{Username: "root", PasswordHash: "plain"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr := postAsAdmin(srv.handleAdminAuthUpdate, "admin", "admin-first", rotate); rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if srv.adminAuth.Authenticate("admin", "admin-first") || !srv.adminAuth.Authenticate("root", "admin-second") {
+		t.Errorf("Expected only the rotated admin credentials to be accepted")
+	}
+	if cfg.AdminAuth.Username != "admin" {
+		t.Errorf("Expected the configuration not to be modified")
+	}
+
+	// Rotated credentials survive a restart
+	srv = newTestServer(t, cfg, dbManager)
+	if !srv.adminAuth.Authenticate("root", "admin-second") {
+		t.Errorf("Expected the rotated admin credentials after a restart")
+	}
+}
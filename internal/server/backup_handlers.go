@@ -1,22 +1,18 @@
 package server
 
 import (
-	"encoding/json"
-	"io"
+	"context"
+	"errors"
 	"net/http"
 	"strings"
-	"time"
 
+	"github.com/ssig33/fuckbase/internal/config"
 	"github.com/ssig33/fuckbase/internal/logger"
+	"github.com/ssig33/fuckbase/internal/s3"
 )
 
 // handleBackupCreate handles the /backup/create endpoint
 func (s *Server) handleBackupCreate(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -24,7 +20,7 @@ func (s *Server) handleBackupCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check admin authentication if enabled
-	if s.adminAuth.Config != nil && s.adminAuth.Config.Enabled {
+	if s.adminAuth.Enabled() {
 		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
 			s.handleBackupCreateImpl(w, r)
 		})(w, r)
@@ -38,25 +34,18 @@ func (s *Server) handleBackupCreate(w http.ResponseWriter, r *http.Request) {
 // handleBackupCreateImpl implements the backup creation logic
 func (s *Server) handleBackupCreateImpl(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req CreateBackupRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
-	// Check if S3 is enabled
+	// Check if backup storage is configured
 	if s.backupManager == nil {
-		writeErrorResponse(w, http.StatusServiceUnavailable, "S3_NOT_ENABLED", "S3 backup is not enabled")
+		writeErrorResponse(w, http.StatusServiceUnavailable, "S3_NOT_ENABLED", "Backup storage is not configured")
 		return
 	}
 
-	var backupErr error
+	var job *s3.Job
 	var message string
 
 	// If database is specified, backup only that database
@@ -68,22 +57,36 @@ func (s *Server) handleBackupCreateImpl(w http.ResponseWriter, r *http.Request)
 		}
 
 		// Backup the database
-		backupErr = s.backupManager.BackupDatabase(req.Database)
+		dbName := req.Database
+		job = s.backupJobs.Start(s3.JobTypeBackup, dbName, "", func(ctx context.Context, progress *s3.Progress) (string, error) {
+			return s.backupManager.BackupDatabaseContext(ctx, dbName, progress)
+		})
 		message = "Database backed up successfully"
 		logger.Info("Backing up database: %s", req.Database)
 	} else {
 		// Backup all databases
-		backupErr = s.backupManager.BackupAllDatabases()
+		job = s.backupJobs.Start(s3.JobTypeBackup, "", "", s.backupManager.BackupAllDatabasesContext)
 		message = "All databases backed up successfully"
 		logger.Info("Backing up all databases")
 	}
 
-	if backupErr != nil {
+	// Asynchronous requests return the job at once
+	if req.Async {
+		writeJSONResponse(w, http.StatusAccepted, JobResponse{Status: "success", Job: job.Info()})
+		return
+	}
+
+	if backupErr := job.Wait(); backupErr != nil {
 		logger.Error("Backup failed: %v", backupErr)
 		writeErrorResponse(w, http.StatusInternalServerError, "BACKUP_FAILED", "Failed to create backup: "+backupErr.Error())
 		return
 	}
 
+	// Report targets the backup could not be replicated to
+	if warnings := job.Info().Warnings; len(warnings) > 0 {
+		message += " with warnings: " + strings.Join(warnings, "; ")
+	}
+
 	// Return success response
 	response := Response{
 		Status:  "success",
@@ -94,11 +97,6 @@ func (s *Server) handleBackupCreateImpl(w http.ResponseWriter, r *http.Request)
 
 // handleBackupList handles the /backup/list endpoint
 func (s *Server) handleBackupList(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -106,7 +104,7 @@ func (s *Server) handleBackupList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check admin authentication if enabled
-	if s.adminAuth.Config != nil && s.adminAuth.Config.Enabled {
+	if s.adminAuth.Enabled() {
 		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
 			s.handleBackupListImpl(w, r)
 		})(w, r)
@@ -120,107 +118,71 @@ func (s *Server) handleBackupList(w http.ResponseWriter, r *http.Request) {
 // handleBackupListImpl implements the backup listing logic
 func (s *Server) handleBackupListImpl(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req ListBackupsRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
-	// Check if S3 is enabled
+	// Check if backup storage is configured
 	if s.backupManager == nil {
-		writeErrorResponse(w, http.StatusServiceUnavailable, "S3_NOT_ENABLED", "S3 backup is not enabled")
+		writeErrorResponse(w, http.StatusServiceUnavailable, "S3_NOT_ENABLED", "Backup storage is not configured")
 		return
 	}
 
-	var backups []string
-	var listErr error
-
-	// If database is specified, list backups for that database
-	if req.Database != "" {
-		// Check if database exists
-		if !s.DBManager.DatabaseExists(req.Database) {
-			writeErrorResponse(w, http.StatusNotFound, "DB_NOT_FOUND", "Database not found")
-			return
-		}
-
-		// List backups for the database
-		backups, listErr = s.backupManager.ListDatabaseBackups(req.Database)
-		logger.Info("Listing backups for database: %s", req.Database)
-	} else {
-		// List all backups
-		backups, listErr = s.backupManager.ListBackups()
-		logger.Info("Listing all backups")
+	if req.Pagination.Offset < 0 || req.Pagination.Limit < 0 {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Offset and limit must not be negative")
+		return
 	}
 
-	if listErr != nil {
-		logger.Error("Failed to list backups: %v", listErr)
-		writeErrorResponse(w, http.StatusInternalServerError, "LIST_FAILED", "Failed to list backups: "+listErr.Error())
+	query := s3.CatalogQuery{
+		Database: req.Database,
+		Offset:   req.Pagination.Offset,
+		Limit:    req.Pagination.Limit,
+	}
+	if req.Since != nil {
+		query.Since = *req.Since
+	}
+	if req.Until != nil {
+		query.Until = *req.Until
+	}
+	if !query.Since.IsZero() && !query.Until.IsZero() && !query.Since.Before(query.Until) {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "since must be before until")
 		return
 	}
 
-	// Convert to backup info objects
-	backupInfos := make([]BackupInfo, 0, len(backups))
-	for _, backup := range backups {
-		// Get file info
-		info, err := s.s3Client.GetFileInfo(backup)
-		if err != nil {
-			logger.Error("Failed to get info for backup %s: %v", backup, err)
-			continue
-		}
-
-		// Parse database name from path
-		dbName := ""
-		if strings.HasPrefix(backup, "backups/full/") {
-			dbName = "all"
-		} else {
-			parts := strings.Split(backup, "/")
-			if len(parts) >= 2 {
-				dbName = parts[1]
-			}
-		}
+	// If database is specified, check that it exists
+	if req.Database != "" && req.Database != s3.AllDatabases && !s.DBManager.DatabaseExists(req.Database) {
+		writeErrorResponse(w, http.StatusNotFound, "DB_NOT_FOUND", "Database not found")
+		return
+	}
 
-		// Parse timestamp from filename
-		timestamp := time.Now() // Default to now if parsing fails
-		parts := strings.Split(backup, "/")
-		if len(parts) > 0 {
-			fileName := parts[len(parts)-1]
-			if len(fileName) > 15 { // Assuming format: YYYYMMDD-HHMMSS.json
-				dateStr := strings.TrimSuffix(fileName, ".json")
-				if t, err := time.Parse("20060102-150405", dateStr); err == nil {
-					timestamp = t
-				}
-			}
-		}
+	backups, total, err := s.backupManager.Catalog(query)
+	if err != nil {
+		logger.Error("Failed to list backups: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "LIST_FAILED", "Failed to list backups: "+err.Error())
+		return
+	}
 
-		backupInfos = append(backupInfos, BackupInfo{
-			Name:      backup,
-			Timestamp: timestamp,
-			Size:      info.Size,
-			Database:  dbName,
-		})
+	if req.Database != "" {
+		logger.Info("Listing backups for database: %s", req.Database)
+	} else {
+		logger.Info("Listing all backups")
 	}
 
 	// Return success response
 	response := ListBackupsResponse{
 		Status:  "success",
-		Backups: backupInfos,
+		Backups: backups,
+		Count:   len(backups),
+		Total:   total,
+		Offset:  req.Pagination.Offset,
+		Limit:   req.Pagination.Limit,
 	}
 	writeJSONResponse(w, http.StatusOK, response)
 }
 
 // handleBackupRestore handles the /backup/restore endpoint
 func (s *Server) handleBackupRestore(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -228,7 +190,7 @@ func (s *Server) handleBackupRestore(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check admin authentication if enabled
-	if s.adminAuth.Config != nil && s.adminAuth.Config.Enabled {
+	if s.adminAuth.Enabled() {
 		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
 			s.handleBackupRestoreImpl(w, r)
 		})(w, r)
@@ -242,15 +204,8 @@ func (s *Server) handleBackupRestore(w http.ResponseWriter, r *http.Request) {
 // handleBackupRestoreImpl implements the backup restore logic
 func (s *Server) handleBackupRestoreImpl(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req RestoreBackupRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -260,29 +215,70 @@ func (s *Server) handleBackupRestoreImpl(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Check if S3 is enabled
+	// Check if backup storage is configured
 	if s.backupManager == nil {
-		writeErrorResponse(w, http.StatusServiceUnavailable, "S3_NOT_ENABLED", "S3 backup is not enabled")
+		writeErrorResponse(w, http.StatusServiceUnavailable, "S3_NOT_ENABLED", "Backup storage is not configured")
 		return
 	}
 
-	var restoreErr error
+	var run s3.JobFunc
 	var message string
 
+	// Validate restore options
+	if req.Mode != "" && req.Mode != s3.RestoreModeReplace && req.Mode != s3.RestoreModeMerge {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Mode must be 'replace' or 'merge'")
+		return
+	}
+	hasOptions := req.Database != "" || req.TargetDatabase != "" || len(req.Sets) > 0 || req.Mode != ""
+	if s3.IsFullBackupObject(req.BackupName) && hasOptions && req.Database == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Database is required to restore selectively from a full backup")
+		return
+	}
+
 	// Check if it's a full backup or a single database backup
-	if strings.HasPrefix(req.BackupName, "backups/full/") {
+	backupName := req.BackupName
+	if hasOptions {
+		// Restore a single database with options
+		opts := s3.RestoreOptions{
+			Database:   req.Database,
+			TargetName: req.TargetDatabase,
+			Sets:       req.Sets,
+			Mode:       req.Mode,
+		}
+		run = func(ctx context.Context, progress *s3.Progress) (string, error) {
+			return backupName, s.backupManager.RestoreDatabaseContext(ctx, backupName, opts, progress)
+		}
+		message = "Database restored successfully"
+		logger.Info("Restoring database from backup: %s with options", req.BackupName)
+	} else if s3.IsFullBackupObject(req.BackupName) {
 		// Restore all databases
-		restoreErr = s.backupManager.RestoreAllDatabases(req.BackupName)
+		run = func(ctx context.Context, progress *s3.Progress) (string, error) {
+			return backupName, s.backupManager.RestoreAllDatabasesContext(ctx, backupName, progress)
+		}
 		message = "All databases restored successfully"
 		logger.Info("Restoring all databases from backup: %s", req.BackupName)
 	} else {
 		// Restore single database
-		restoreErr = s.backupManager.RestoreDatabase(req.BackupName)
+		run = func(ctx context.Context, progress *s3.Progress) (string, error) {
+			return backupName, s.backupManager.RestoreDatabaseContext(ctx, backupName, s3.RestoreOptions{}, progress)
+		}
 		message = "Database restored successfully"
 		logger.Info("Restoring database from backup: %s", req.BackupName)
 	}
 
-	if restoreErr != nil {
+	dbName := req.TargetDatabase
+	if dbName == "" {
+		dbName = req.Database
+	}
+	job := s.backupJobs.Start(s3.JobTypeRestore, dbName, req.BackupName, run)
+
+	// Asynchronous requests return the job at once
+	if req.Async {
+		writeJSONResponse(w, http.StatusAccepted, JobResponse{Status: "success", Job: job.Info()})
+		return
+	}
+
+	if restoreErr := job.Wait(); restoreErr != nil {
 		logger.Error("Restore failed: %v", restoreErr)
 		writeErrorResponse(w, http.StatusInternalServerError, "RESTORE_FAILED", "Failed to restore backup: "+restoreErr.Error())
 		return
@@ -294,4 +290,446 @@ func (s *Server) handleBackupRestoreImpl(w http.ResponseWriter, r *http.Request)
 		Message: message,
 	}
 	writeJSONResponse(w, http.StatusOK, response)
-}
\ No newline at end of file
+}
+
+// handleBackupPrune handles the /backup/prune endpoint
+func (s *Server) handleBackupPrune(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleBackupPruneImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleBackupPruneImpl(w, r)
+}
+
+// handleBackupPruneImpl implements the backup pruning logic
+func (s *Server) handleBackupPruneImpl(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var req PruneBackupsRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Check if backup storage is configured
+	if s.backupManager == nil {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "S3_NOT_ENABLED", "Backup storage is not configured")
+		return
+	}
+
+	// Use the policy from the request if one is given, otherwise the configured one
+	policy := s.backupManager.RetentionPolicy()
+	if req.KeepLast > 0 || req.KeepHourly > 0 || req.KeepDaily > 0 {
+		policy = &config.RetentionConfig{
+			KeepLast:   req.KeepLast,
+			KeepHourly: req.KeepHourly,
+			KeepDaily:  req.KeepDaily,
+		}
+	}
+	if !policy.Enabled() {
+		writeErrorResponse(w, http.StatusBadRequest, "RETENTION_NOT_CONFIGURED", "No retention policy configured")
+		return
+	}
+
+	result, err := s.backupManager.PruneBackupsWithPolicy(policy, req.Database, req.DryRun)
+	if err != nil {
+		logger.Error("Prune failed: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "PRUNE_FAILED", "Failed to prune backups: "+err.Error())
+		return
+	}
+
+	logger.Info("Pruned backups (dry run: %v)", req.DryRun)
+
+	// Return success response
+	response := PruneBackupsResponse{
+		Status:   "success",
+		DryRun:   result.DryRun,
+		Pruned:   result.Pruned,
+		Retained: result.Retained,
+		Failed:   result.Failed,
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// handleBackupVerify handles the /backup/verify endpoint
+func (s *Server) handleBackupVerify(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleBackupVerifyImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleBackupVerifyImpl(w, r)
+}
+
+// handleBackupVerifyImpl implements the backup verification logic
+func (s *Server) handleBackupVerifyImpl(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var req VerifyBackupRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Validate request
+	if req.BackupName == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Backup name is required")
+		return
+	}
+
+	// Check if backup storage is configured
+	if s.backupManager == nil {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "S3_NOT_ENABLED", "Backup storage is not configured")
+		return
+	}
+
+	report, err := s.backupManager.VerifyBackup(req.BackupName)
+	if err != nil {
+		logger.Error("Verify failed: %v", err)
+		writeErrorResponse(w, http.StatusNotFound, "BACKUP_NOT_FOUND", "Failed to read backup: "+err.Error())
+		return
+	}
+
+	logger.Info("Verified backup: %s", req.BackupName)
+
+	// Return success response; the report tells whether the backup is consistent
+	response := VerifyBackupResponse{
+		Status: "success",
+		Report: report,
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// handleBackupJobs handles the /backup/jobs endpoint
+func (s *Server) handleBackupJobs(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleBackupJobsImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleBackupJobsImpl(w, r)
+}
+
+// handleBackupJobsImpl implements the job listing logic
+func (s *Server) handleBackupJobsImpl(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var req ListJobsRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Check if backup storage is configured
+	if s.backupManager == nil {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "S3_NOT_ENABLED", "Backup storage is not configured")
+		return
+	}
+
+	// Return success response
+	response := ListJobsResponse{
+		Status: "success",
+		Jobs:   s.backupJobs.List(),
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// handleBackupJobStatus handles the /backup/job/status endpoint
+func (s *Server) handleBackupJobStatus(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleBackupJobStatusImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleBackupJobStatusImpl(w, r)
+}
+
+// handleBackupJobStatusImpl implements the job status logic
+func (s *Server) handleBackupJobStatusImpl(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.parseJobRequest(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := s.backupJobs.Get(req.JobID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "JOB_NOT_FOUND", "Job not found")
+		return
+	}
+
+	// Return success response
+	response := JobResponse{
+		Status: "success",
+		Job:    job.Info(),
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// handleBackupJobCancel handles the /backup/job/cancel endpoint
+func (s *Server) handleBackupJobCancel(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleBackupJobCancelImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleBackupJobCancelImpl(w, r)
+}
+
+// handleBackupJobCancelImpl implements the job cancellation logic
+func (s *Server) handleBackupJobCancelImpl(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.parseJobRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.backupJobs.Cancel(req.JobID); err != nil {
+		if errors.Is(err, s3.ErrJobFinished) {
+			writeErrorResponse(w, http.StatusConflict, "JOB_FINISHED", "Job has already finished")
+		} else {
+			writeErrorResponse(w, http.StatusNotFound, "JOB_NOT_FOUND", "Job not found")
+		}
+		return
+	}
+
+	// Return success response
+	response := Response{
+		Status:  "success",
+		Message: "Job cancellation requested",
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// parseJobRequest reads and validates a job request, writing an error response on failure
+func (s *Server) parseJobRequest(w http.ResponseWriter, r *http.Request) (*JobRequest, bool) {
+	// Parse request body
+	var req JobRequest
+	if !readJSONRequest(w, r, &req) {
+		return nil, false
+	}
+
+	// Validate request
+	if req.JobID == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Job ID is required")
+		return nil, false
+	}
+
+	// Check if backup storage is configured
+	if s.backupManager == nil {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "S3_NOT_ENABLED", "Backup storage is not configured")
+		return nil, false
+	}
+
+	return &req, true
+}
+
+// handleBackupScheduleList handles the /backup/schedule/list endpoint
+func (s *Server) handleBackupScheduleList(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleBackupScheduleListImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleBackupScheduleListImpl(w, r)
+}
+
+// handleBackupScheduleListImpl implements the schedule listing logic
+func (s *Server) handleBackupScheduleListImpl(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var req ListSchedulesRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Check if backup storage is configured
+	if s.scheduler == nil {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "S3_NOT_ENABLED", "Backup storage is not configured")
+		return
+	}
+
+	// Return success response
+	response := ListSchedulesResponse{
+		Status:    "success",
+		Schedules: s.scheduler.List(),
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// handleBackupScheduleAdd handles the /backup/schedule/add endpoint
+func (s *Server) handleBackupScheduleAdd(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleBackupScheduleAddImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleBackupScheduleAddImpl(w, r)
+}
+
+// handleBackupScheduleAddImpl implements the schedule creation logic
+func (s *Server) handleBackupScheduleAddImpl(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var req AddScheduleRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Validate request
+	if req.Name == "" || req.Cron == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Schedule name and cron expression are required")
+		return
+	}
+
+	// Check if backup storage is configured
+	if s.scheduler == nil {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "S3_NOT_ENABLED", "Backup storage is not configured")
+		return
+	}
+
+	// Check if database exists
+	if req.Database != "" && !s.DBManager.DatabaseExists(req.Database) {
+		writeErrorResponse(w, http.StatusNotFound, "DB_NOT_FOUND", "Database not found")
+		return
+	}
+
+	schedule := s3.BackupSchedule{
+		Name:     req.Name,
+		Database: req.Database,
+		Cron:     req.Cron,
+	}
+	if err := s.scheduler.Add(schedule); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_SCHEDULE", "Failed to add schedule: "+err.Error())
+		return
+	}
+
+	logger.Info("Added backup schedule: %s", req.Name)
+
+	// Return success response
+	response := Response{
+		Status:  "success",
+		Message: "Schedule added successfully",
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// handleBackupScheduleRemove handles the /backup/schedule/remove endpoint
+func (s *Server) handleBackupScheduleRemove(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleBackupScheduleRemoveImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleBackupScheduleRemoveImpl(w, r)
+}
+
+// handleBackupScheduleRemoveImpl implements the schedule removal logic
+func (s *Server) handleBackupScheduleRemoveImpl(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var req RemoveScheduleRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Validate request
+	if req.Name == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Schedule name is required")
+		return
+	}
+
+	// Check if backup storage is configured
+	if s.scheduler == nil {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "S3_NOT_ENABLED", "Backup storage is not configured")
+		return
+	}
+
+	if err := s.scheduler.Remove(req.Name); err != nil {
+		if errors.Is(err, s3.ErrScheduleNotFound) {
+			writeErrorResponse(w, http.StatusNotFound, "SCHEDULE_NOT_FOUND", "Schedule not found")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "SCHEDULE_FAILED", "Failed to remove schedule: "+err.Error())
+		}
+		return
+	}
+
+	logger.Info("Removed backup schedule: %s", req.Name)
+
+	// Return success response
+	response := Response{
+		Status:  "success",
+		Message: "Schedule removed successfully",
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/ssig33/fuckbase/internal/s3"
+)
+
+// newBackupTestServer creates a server backing up to a temporary directory
+func newBackupTestServer(t *testing.T) *Server {
+	cfg := config.NewServerConfig()
+	cfg.BackupDir = t.TempDir()
+	dbManager := database.NewManager()
+	db, _ := dbManager.CreateDatabase("test_db", nil)
+	db.CreateSet("users")
+	db.Put("users", "u1", map[string]interface{}{"name": "Alice"})
+	db.Put("users", "u2", map[string]interface{}{"name": "Bob"})
+
+	srv := newTestServer(t, cfg, dbManager)
+	if srv.backupManager == nil {
+		t.Fatalf("Expected backups to be enabled with a backup directory")
+	}
+	return srv
+}
+
+// postJSON calls a handler with a JSON request body
+func postJSON(handler http.HandlerFunc, path string, reqBody interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestBackupJobs(t *testing.T) {
+	srv := newBackupTestServer(t)
+
+	// Start an asynchronous backup
+	rr := postJSON(srv.handleBackupCreate, "/backup/create", CreateBackupRequest{Database: "test_db", Async: true})
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+	var created JobResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+	if created.Job.ID == "" || created.Job.Type != s3.JobTypeBackup {
+		t.Fatalf("Unexpected job: %+v", created.Job)
+	}
+
+	// Poll the job until it finishes
+	var status JobResponse
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rr = postJSON(srv.handleBackupJobStatus, "/backup/job/status", JobRequest{JobID: created.Job.ID})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		json.Unmarshal(rr.Body.Bytes(), &status)
+		if status.Job.Status != s3.JobStatusRunning || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.Job.Status != s3.JobStatusSucceeded {
+		t.Fatalf("Expected job to succeed, got %+v", status.Job)
+	}
+	if status.Job.SetsProcessed != 1 || status.Job.EntriesProcessed != 2 || status.Job.BackupName == "" {
+		t.Errorf("Unexpected job progress: %+v", status.Job)
+	}
+
+	// A synchronous restore is tracked as a job too
+	rr = postJSON(srv.handleBackupRestore, "/backup/restore", RestoreBackupRequest{BackupName: status.Job.BackupName})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = postJSON(srv.handleBackupJobs, "/backup/jobs", ListJobsRequest{})
+	var jobs ListJobsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &jobs); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+	if len(jobs.Jobs) != 2 || jobs.Jobs[0].Type != s3.JobTypeRestore {
+		t.Errorf("Expected the restore and backup jobs, newest first, got %+v", jobs.Jobs)
+	}
+
+	// Finished and unknown jobs cannot be cancelled
+	rr = postJSON(srv.handleBackupJobCancel, "/backup/job/cancel", JobRequest{JobID: created.Job.ID})
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusConflict)
+	}
+	rr = postJSON(srv.handleBackupJobCancel, "/backup/job/cancel", JobRequest{JobID: "missing"})
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestBackupSchedules(t *testing.T) {
+	srv := newBackupTestServer(t)
+
+	rr := postJSON(srv.handleBackupScheduleAdd, "/backup/schedule/add", AddScheduleRequest{Name: "hourly", Database: "test_db", Cron: "@hourly"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	rr = postJSON(srv.handleBackupScheduleAdd, "/backup/schedule/add", AddScheduleRequest{Name: "bad", Cron: "61 * * * *"})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	rr = postJSON(srv.handleBackupScheduleAdd, "/backup/schedule/add", AddScheduleRequest{Name: "missing", Database: "missing", Cron: "@daily"})
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	rr = postJSON(srv.handleBackupScheduleList, "/backup/schedule/list", ListSchedulesRequest{})
+	var list ListSchedulesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+	// The default backup interval is a schedule too
+	if len(list.Schedules) != 2 || list.Schedules[0].Name != s3.DefaultScheduleName || list.Schedules[1].Name != "hourly" {
+		t.Errorf("Unexpected schedules: %+v", list.Schedules)
+	}
+
+	rr = postJSON(srv.handleBackupScheduleRemove, "/backup/schedule/remove", RemoveScheduleRequest{Name: "hourly"})
+	if rr.Code != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	rr = postJSON(srv.handleBackupScheduleRemove, "/backup/schedule/remove", RemoveScheduleRequest{Name: "hourly"})
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestRestoreOnStart(t *testing.T) {
+	srv := newBackupTestServer(t)
+	if err := srv.backupManager.BackupAllDatabases(); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+
+	// A fresh server using the same backup directory
+	cfg := config.NewServerConfig()
+	cfg.BackupDir = srv.Config.BackupDir
+	cfg.RestoreOnStart = config.RestoreLatest
+	restored := newTestServer(t, cfg, database.NewManager())
+
+	if err := restored.restoreOnStart(); err != nil {
+		t.Fatalf("Failed to restore on start: %v", err)
+	}
+	db, err := restored.DBManager.GetDatabase("test_db")
+	if err != nil {
+		t.Fatalf("Expected database to be restored: %v", err)
+	}
+	if users, _ := db.GetSet("users"); users.Size() != 2 {
+		t.Errorf("Expected 2 restored entries, got %d", users.Size())
+	}
+
+	// An explicit object that does not exist stops the server from starting
+	cfg.RestoreOnStart = "backups/full/20000101-000000.json"
+	if err := newTestServer(t, cfg, database.NewManager()).restoreOnStart(); err == nil {
+		t.Errorf("Expected error restoring a missing backup")
+	}
+
+	// With no backups yet, the server starts empty
+	empty := config.NewServerConfig()
+	empty.BackupDir = t.TempDir()
+	empty.RestoreOnStart = config.RestoreLatest
+	if err := newTestServer(t, empty, database.NewManager()).restoreOnStart(); err != nil {
+		t.Errorf("Expected no error when there are no backups, got %v", err)
+	}
+}
+
+func TestBackupListCatalog(t *testing.T) {
+	srv := newBackupTestServer(t)
+
+	rr := postJSON(srv.handleBackupCreate, "/backup/create", CreateBackupRequest{Database: "test_db"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	srv.backupStorage.UploadFile(context.Background(), "backups/test_db/20230601-120000.json", []byte("{}"), "application/json", nil)
+
+	rr = postJSON(srv.handleBackupList, "/backup/list", ListBackupsRequest{Database: "test_db", Pagination: Pagination{Limit: 1}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var response ListBackupsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+	if response.Total != 2 || response.Count != 1 || response.Limit != 1 {
+		t.Fatalf("Expected the first of 2 backups, got %+v", response)
+	}
+	if backup := response.Backups[0]; backup.Database != "test_db" || backup.SetCount != 1 || backup.EntryCount != 2 || backup.FormatVersion != s3.BackupFormatVersion {
+		t.Errorf("Unexpected backup metadata: %+v", backup)
+	}
+
+	until := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rr = postJSON(srv.handleBackupList, "/backup/list", ListBackupsRequest{Until: &until})
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if response.Total != 1 || response.Backups[0].Name != "backups/test_db/20230601-120000.json" {
+		t.Errorf("Expected only the old backup, got %+v", response)
+	}
+
+	since := until.Add(time.Hour)
+	rr = postJSON(srv.handleBackupList, "/backup/list", ListBackupsRequest{Since: &since, Until: &until})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
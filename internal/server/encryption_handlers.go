@@ -0,0 +1,143 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/ssig33/fuckbase/internal/logger"
+)
+
+// handleEncryptionEnable handles the /encryption/enable endpoint
+// New values are sealed at once; the values already stored are sealed in the background.
+func (s *Server) handleEncryptionEnable(w http.ResponseWriter, r *http.Request) {
+	db, ok := s.encryptionDatabase(w, r)
+	if !ok {
+		return
+	}
+
+	wrapper := s.DBManager.KeyWrapper()
+	if wrapper == nil {
+		writeErrorResponse(w, http.StatusBadRequest, "ENCRYPTION_NOT_CONFIGURED", "No data encryption key configured")
+		return
+	}
+	if err := db.EnableEncryption(wrapper); err != nil {
+		writeErrorResponse(w, http.StatusConflict, "ALREADY_ENCRYPTED", err.Error())
+		return
+	}
+
+	logger.Info("Enabled encryption of database: %s", db.Name)
+	s.reencryptInBackground(db)
+
+	writeJSONResponse(w, http.StatusOK, encryptionStatus(db))
+}
+
+// handleEncryptionRotate handles the /encryption/rotate endpoint
+// A new data key seals new values and every data key is wrapped with the active master key;
+// the values are re-sealed with the new key in the background.
+func (s *Server) handleEncryptionRotate(w http.ResponseWriter, r *http.Request) {
+	db, ok := s.encryptionDatabase(w, r)
+	if !ok {
+		return
+	}
+
+	if !db.Encrypted() {
+		writeErrorResponse(w, http.StatusBadRequest, "NOT_ENCRYPTED", "Database is not encrypted")
+		return
+	}
+	key, err := db.RotateDataKey()
+	if err != nil {
+		logger.Error("Failed to rotate data key of database %s: %v", db.Name, err)
+		writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to rotate data key")
+		return
+	}
+
+	logger.Info("Rotated data key of database %s to %d", db.Name, key.ID)
+	s.reencryptInBackground(db)
+
+	writeJSONResponse(w, http.StatusOK, encryptionStatus(db))
+}
+
+// handleEncryptionStatus handles the /encryption/status endpoint
+func (s *Server) handleEncryptionStatus(w http.ResponseWriter, r *http.Request) {
+	db, ok := s.encryptionDatabase(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, encryptionStatus(db))
+}
+
+// encryptionDatabase reads an encryption request and returns its database
+// Like credential changes, it needs admin credentials or a database user with the admin role.
+func (s *Server) encryptionDatabase(w http.ResponseWriter, r *http.Request) (*database.Database, bool) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return nil, false
+	}
+
+	// Parse request body
+	var req EncryptionRequest
+	if !readJSONRequest(w, r, &req) {
+		return nil, false
+	}
+
+	// Validate request
+	if req.Database == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Database name is required")
+		return nil, false
+	}
+
+	// Get database
+	db, err := s.DBManager.GetDatabase(req.Database)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "DB_NOT_FOUND", "Database not found")
+		return nil, false
+	}
+
+	// Check admin or database admin authentication
+	if !s.authorizeAuthChange(w, r, db, req.Auth.Username, req.Auth.Password) {
+		return nil, false
+	}
+
+	return db, true
+}
+
+// encryptionStatus describes the encryption of a database
+func encryptionStatus(db *database.Database) EncryptionStatusResponse {
+	response := EncryptionStatusResponse{
+		Status:       "success",
+		Database:     db.Name,
+		Encrypted:    db.Encrypted(),
+		Reencrypting: db.Reencrypting(),
+	}
+
+	keys := db.DataKeys()
+	for i, key := range keys {
+		response.DataKeys = append(response.DataKeys, DataKeyInfo{
+			ID:          key.ID,
+			MasterKeyID: key.MasterKeyID,
+			CreatedAt:   key.CreatedAt,
+			Active:      i == len(keys)-1,
+		})
+	}
+	return response
+}
+
+// reencryptInBackground seals the values of a database with its newest data key
+// If a pass is already running, it picks up the new key itself.
+func (s *Server) reencryptInBackground(db *database.Database) {
+	s.reencryptions.Add(1)
+	go func() {
+		defer s.reencryptions.Done()
+		sealed, err := db.ReencryptValues()
+		switch {
+		case errors.Is(err, database.ErrReencryptionRunning):
+		case err != nil:
+			logger.Error("Failed to re-encrypt database %s: %v", db.Name, err)
+		default:
+			logger.Info("Re-encrypted %d values of database %s", sealed, db.Name)
+		}
+	}()
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+// newEncryptionTestServer creates a server with a data encryption key
+func newEncryptionTestServer(t *testing.T) *Server {
+	cfg := config.NewServerConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.DataEncryption.Key = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	cfg.DataEncryption.KeyID = "data-1"
+	return newTestServer(t, cfg, database.NewManager())
+}
+
+func TestCreateEncryptedDatabase(t *testing.T) {
+	srv := newEncryptionTestServer(t)
+
+	rr := postJSON(srv.handleDatabaseCreate, "/create", CreateDatabaseRequest{Name: "customers", Encrypted: true})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	db, _ := srv.DBManager.GetDatabase("customers")
+	db.CreateSet("people")
+	put := PutSetRequest{Database: "customers", Set: "people", Key: "p1", Value: json.RawMessage(`{"email":"alice@example.com"}`)}
+	if rr := postJSON(srv.handleSetPut, "/set/put", put); rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	set, _ := db.GetSet("people")
+	if bytes.Contains(set.Data["p1"], []byte("alice@example.com")) {
+		t.Errorf("Expected the value to be stored sealed")
+	}
+	rr = postJSON(srv.handleSetGet, "/set/get", GetSetRequest{Database: "customers", Set: "people", Key: "p1"})
+	if rr.Code != http.StatusOK || !bytes.Contains(rr.Body.Bytes(), []byte("alice@example.com")) {
+		t.Errorf("Expected the value to be returned in plaintext, got %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestEncryptionEnableAndRotate(t *testing.T) {
+	srv := newEncryptionTestServer(t)
+	auth, _ := database.NewAuthConfig("owner", "password")
+	db, _ := srv.DBManager.CreateDatabase("customers", auth)
+	db.AddUser("reporter", "secret", database.RoleReader)
+	db.CreateSet("people")
+	db.Put("people", "p1", map[string]interface{}{"email": "alice@example.com"})
+
+	req := EncryptionRequest{Database: "customers"}
+	if rr := postAs(srv.handleEncryptionEnable, "reporter", "secret", req); rr.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if rr := postAs(srv.handleEncryptionRotate, "owner", "password", req); rr.Code != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	// Values stored before are sealed in the background
+	if rr := postAs(srv.handleEncryptionEnable, "owner", "password", req); rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	srv.reencryptions.Wait()
+	set, _ := db.GetSet("people")
+	if bytes.Contains(set.Data["p1"], []byte("alice@example.com")) {
+		t.Errorf("Expected the existing value to be sealed")
+	}
+	if rr := postAs(srv.handleEncryptionEnable, "owner", "password", req); rr.Code != http.StatusConflict {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusConflict)
+	}
+
+	// Rotation re-seals the values with a new key and drops the old one
+	before := db.DataKeys()
+	if rr := postAs(srv.handleEncryptionRotate, "owner", "password", req); rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	srv.reencryptions.Wait()
+
+	rr := postAs(srv.handleEncryptionStatus, "owner", "password", req)
+	var status EncryptionStatusResponse
+	json.Unmarshal(rr.Body.Bytes(), &status)
+	if !status.Encrypted || status.Reencrypting || len(status.DataKeys) != 1 {
+		t.Fatalf("Unexpected encryption status: %+v", status)
+	}
+	if key := status.DataKeys[0]; key.ID == before[0].ID || !key.Active || key.MasterKeyID != "data-1" {
+		t.Errorf("Expected only the new data key, got %+v", key)
+	}
+}
+
+func TestEncryptionNotConfigured(t *testing.T) {
+	cfg := config.NewServerConfig()
+	cfg.DataDir = t.TempDir()
+	srv := newTestServer(t, cfg, database.NewManager())
+	srv.DBManager.CreateDatabase("customers", nil)
+
+	rr := postJSON(srv.handleDatabaseCreate, "/create", CreateDatabaseRequest{Name: "secrets", Encrypted: true})
+	if rr.Code != http.StatusBadRequest || srv.DBManager.DatabaseExists("secrets") {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	rr = postJSON(srv.handleEncryptionEnable, "/encryption/enable", EncryptionRequest{Database: "customers"})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
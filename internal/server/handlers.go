@@ -3,21 +3,16 @@ package server
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"time"
 
 	"github.com/ssig33/fuckbase/internal/database"
 	"github.com/ssig33/fuckbase/internal/logger"
+	"github.com/ssig33/fuckbase/internal/version"
 )
 
 // handleDatabaseCreate handles the /create endpoint
 func (s *Server) handleDatabaseCreate(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -25,7 +20,7 @@ func (s *Server) handleDatabaseCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check admin authentication if enabled
-	if s.adminAuth.Config != nil && s.adminAuth.Config.Enabled {
+	if s.adminAuth.Enabled() {
 		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
 			s.handleDatabaseCreateImpl(w, r)
 		})(w, r)
@@ -39,15 +34,8 @@ func (s *Server) handleDatabaseCreate(w http.ResponseWriter, r *http.Request) {
 // handleDatabaseCreateImpl implements the database creation logic
 func (s *Server) handleDatabaseCreateImpl(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req CreateDatabaseRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -63,19 +51,35 @@ func (s *Server) handleDatabaseCreateImpl(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Encrypted databases need a data encryption key
+	wrapper := s.DBManager.KeyWrapper()
+	if req.Encrypted && wrapper == nil {
+		writeErrorResponse(w, http.StatusBadRequest, "ENCRYPTION_NOT_CONFIGURED", "No data encryption key configured")
+		return
+	}
+
 	// Create auth config if provided
 	var authConfig *database.AuthConfig
 	if req.Auth.Username != "" && req.Auth.Password != "" {
-		authConfig = &database.AuthConfig{
-			Username: req.Auth.Username,
-			Password: req.Auth.Password,
-			Enabled:  true,
+		var err error
+		authConfig, err = database.NewAuthConfig(req.Auth.Username, req.Auth.Password)
+		if err != nil {
+			logger.Error("Failed to hash database password: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create database")
+			return
 		}
 	}
 
-	// Create database
-	_, err = s.DBManager.CreateDatabase(req.Name, authConfig)
-	if err != nil {
+	// Create database, encrypted before it is added so no value is stored in plaintext
+	db := database.NewDatabase(req.Name, authConfig)
+	if req.Encrypted {
+		if err := db.EnableEncryption(wrapper); err != nil {
+			logger.Error("Failed to encrypt database: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create database")
+			return
+		}
+	}
+	if err := s.DBManager.AddDatabase(db); err != nil {
 		logger.Error("Failed to create database: %v", err)
 		writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create database")
 		return
@@ -96,11 +100,6 @@ func (s *Server) handleDatabaseCreateImpl(w http.ResponseWriter, r *http.Request
 
 // handleDatabaseDrop handles the /drop endpoint
 func (s *Server) handleDatabaseDrop(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -108,7 +107,7 @@ func (s *Server) handleDatabaseDrop(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check admin authentication if enabled
-	if s.adminAuth.Config != nil && s.adminAuth.Config.Enabled {
+	if s.adminAuth.Enabled() {
 		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
 			s.handleDatabaseDropImpl(w, r)
 		})(w, r)
@@ -122,15 +121,8 @@ func (s *Server) handleDatabaseDrop(w http.ResponseWriter, r *http.Request) {
 // handleDatabaseDropImpl implements the database drop logic
 func (s *Server) handleDatabaseDropImpl(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req DropDatabaseRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -147,7 +139,7 @@ func (s *Server) handleDatabaseDropImpl(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Drop database
-	err = s.DBManager.DeleteDatabase(req.Name)
+	err := s.DBManager.DeleteDatabase(req.Name)
 	if err != nil {
 		logger.Error("Failed to drop database: %v", err)
 		writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to drop database")
@@ -166,11 +158,6 @@ func (s *Server) handleDatabaseDropImpl(w http.ResponseWriter, r *http.Request)
 
 // handleSetCreate handles the /set/create endpoint
 func (s *Server) handleSetCreate(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -178,15 +165,8 @@ func (s *Server) handleSetCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req CreateSetRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -208,13 +188,7 @@ func (s *Server) handleSetCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check database authentication
-	username, password, hasAuth := ExtractDatabaseAuth(r)
-	if !hasAuth {
-		username = req.Auth.Username
-		password = req.Auth.Password
-	}
-	if !db.Authenticate(username, password) {
-		writeErrorResponse(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+	if !s.authorizeDatabase(w, r, db, req.Name, req.Auth.Username, req.Auth.Password, database.RoleWriter) {
 		return
 	}
 
@@ -241,11 +215,6 @@ func (s *Server) handleSetCreate(w http.ResponseWriter, r *http.Request) {
 
 // handleServerInfo handles the /server/info endpoint
 func (s *Server) handleServerInfo(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -253,7 +222,7 @@ func (s *Server) handleServerInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check admin authentication if enabled
-	if s.adminAuth.Config != nil && s.adminAuth.Config.Enabled {
+	if s.adminAuth.Enabled() {
 		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
 			s.handleServerInfoImpl(w, r)
 		})(w, r)
@@ -276,7 +245,7 @@ func (s *Server) handleServerInfoImpl(w http.ResponseWriter, r *http.Request) {
 	// Create response
 	response := ServerInfoResponse{
 		Status:         "success",
-		Version:        "0.0.1",
+		Version:        version.Version,
 		Uptime:         uptimeStr,
 		DatabasesCount: s.DBManager.GetDatabaseCount(),
 	}
@@ -287,11 +256,6 @@ func (s *Server) handleServerInfoImpl(w http.ResponseWriter, r *http.Request) {
 
 // handleSetGet handles the /set/get endpoint
 func (s *Server) handleSetGet(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -299,15 +263,8 @@ func (s *Server) handleSetGet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req GetSetRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -333,13 +290,7 @@ func (s *Server) handleSetGet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check database authentication
-	username, password, hasAuth := ExtractDatabaseAuth(r)
-	if !hasAuth {
-		username = req.Auth.Username
-		password = req.Auth.Password
-	}
-	if !db.Authenticate(username, password) {
-		writeErrorResponse(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+	if !s.authorizeDatabase(w, r, db, req.Set, req.Auth.Username, req.Auth.Password, database.RoleReader) {
 		return
 	}
 
@@ -369,11 +320,6 @@ func (s *Server) handleSetGet(w http.ResponseWriter, r *http.Request) {
 
 // handleSetPut handles the /set/put endpoint
 func (s *Server) handleSetPut(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -381,15 +327,8 @@ func (s *Server) handleSetPut(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req PutSetRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -419,13 +358,7 @@ func (s *Server) handleSetPut(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check database authentication
-	username, password, hasAuth := ExtractDatabaseAuth(r)
-	if !hasAuth {
-		username = req.Auth.Username
-		password = req.Auth.Password
-	}
-	if !db.Authenticate(username, password) {
-		writeErrorResponse(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+	if !s.authorizeDatabase(w, r, db, req.Set, req.Auth.Username, req.Auth.Password, database.RoleWriter) {
 		return
 	}
 
@@ -496,11 +429,6 @@ func (s *Server) handleSetPut(w http.ResponseWriter, r *http.Request) {
 
 // handleSetDelete handles the /set/delete endpoint
 func (s *Server) handleSetDelete(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -508,15 +436,8 @@ func (s *Server) handleSetDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req DeleteSetRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -542,13 +463,7 @@ func (s *Server) handleSetDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check database authentication
-	username, password, hasAuth := ExtractDatabaseAuth(r)
-	if !hasAuth {
-		username = req.Auth.Username
-		password = req.Auth.Password
-	}
-	if !db.Authenticate(username, password) {
-		writeErrorResponse(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+	if !s.authorizeDatabase(w, r, db, req.Set, req.Auth.Username, req.Auth.Password, database.RoleWriter) {
 		return
 	}
 
@@ -594,11 +509,6 @@ func (s *Server) handleSetDelete(w http.ResponseWriter, r *http.Request) {
 
 // handleSetList handles the /set/list endpoint
 func (s *Server) handleSetList(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -606,15 +516,8 @@ func (s *Server) handleSetList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req ListSetsRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -632,13 +535,7 @@ func (s *Server) handleSetList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check database authentication
-	username, password, hasAuth := ExtractDatabaseAuth(r)
-	if !hasAuth {
-		username = req.Auth.Username
-		password = req.Auth.Password
-	}
-	if !db.Authenticate(username, password) {
-		writeErrorResponse(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+	if !s.authorizeDatabase(w, r, db, "", req.Auth.Username, req.Auth.Password, database.RoleReader) {
 		return
 	}
 
@@ -659,11 +556,6 @@ func (s *Server) handleSetList(w http.ResponseWriter, r *http.Request) {
 
 // handleIndexCreate handles the /index/create endpoint
 func (s *Server) handleIndexCreate(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -671,15 +563,8 @@ func (s *Server) handleIndexCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req CreateIndexRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -709,13 +594,7 @@ func (s *Server) handleIndexCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check database authentication
-	username, password, hasAuth := ExtractDatabaseAuth(r)
-	if !hasAuth {
-		username = req.Auth.Username
-		password = req.Auth.Password
-	}
-	if !db.Authenticate(username, password) {
-		writeErrorResponse(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+	if !s.authorizeDatabase(w, r, db, req.Set, req.Auth.Username, req.Auth.Password, database.RoleAdmin) {
 		return
 	}
 
@@ -742,11 +621,6 @@ func (s *Server) handleIndexCreate(w http.ResponseWriter, r *http.Request) {
 
 // handleIndexDrop handles the /index/drop endpoint
 func (s *Server) handleIndexDrop(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -754,15 +628,8 @@ func (s *Server) handleIndexDrop(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req DropIndexRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -788,19 +655,13 @@ func (s *Server) handleIndexDrop(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check database authentication
-	username, password, hasAuth := ExtractDatabaseAuth(r)
-	if !hasAuth {
-		username = req.Auth.Username
-		password = req.Auth.Password
-	}
-	if !db.Authenticate(username, password) {
-		writeErrorResponse(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+	if !s.authorizeDatabase(w, r, db, req.Set, req.Auth.Username, req.Auth.Password, database.RoleAdmin) {
 		return
 	}
 
-	// Check if index exists
-	_, err = db.GetIndex(req.Name)
-	if err != nil {
+	// Check if index exists in the set
+	index, err := db.GetIndex(req.Name)
+	if err != nil || index.GetSetName() != req.Set {
 		writeErrorResponse(w, http.StatusNotFound, "INDEX_NOT_FOUND", "Index not found")
 		return
 	}
@@ -824,11 +685,6 @@ func (s *Server) handleIndexDrop(w http.ResponseWriter, r *http.Request) {
 
 // handleIndexQuery handles the /index/query endpoint
 func (s *Server) handleIndexQuery(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -836,15 +692,8 @@ func (s *Server) handleIndexQuery(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req QueryIndexRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -876,13 +725,7 @@ func (s *Server) handleIndexQuery(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check database authentication
-	username, password, hasAuth := ExtractDatabaseAuth(r)
-	if !hasAuth {
-		username = req.Auth.Username
-		password = req.Auth.Password
-	}
-	if !db.Authenticate(username, password) {
-		writeErrorResponse(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+	if !s.authorizeDatabase(w, r, db, req.Set, req.Auth.Username, req.Auth.Password, database.RoleReader) {
 		return
 	}
 
@@ -893,9 +736,9 @@ func (s *Server) handleIndexQuery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get index
+	// Get index of the set
 	index, err := db.GetIndex(req.Index)
-	if err != nil {
+	if err != nil || index.GetSetName() != req.Set {
 		writeErrorResponse(w, http.StatusNotFound, "INDEX_NOT_FOUND", "Index not found")
 		return
 	}
@@ -939,11 +782,6 @@ func (s *Server) handleIndexQuery(w http.ResponseWriter, r *http.Request) {
 
 // handleSortableIndexCreate handles the /index/create/sortable endpoint
 func (s *Server) handleSortableIndexCreate(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -951,15 +789,8 @@ func (s *Server) handleSortableIndexCreate(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req CreateSortableIndexRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -993,13 +824,7 @@ func (s *Server) handleSortableIndexCreate(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Check database authentication
-	username, password, hasAuth := ExtractDatabaseAuth(r)
-	if !hasAuth {
-		username = req.Auth.Username
-		password = req.Auth.Password
-	}
-	if !db.Authenticate(username, password) {
-		writeErrorResponse(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+	if !s.authorizeDatabase(w, r, db, req.Set, req.Auth.Username, req.Auth.Password, database.RoleAdmin) {
 		return
 	}
 
@@ -1027,11 +852,6 @@ func (s *Server) handleSortableIndexCreate(w http.ResponseWriter, r *http.Reques
 
 // handleSortedIndexQuery handles the /index/query/sorted endpoint
 func (s *Server) handleSortedIndexQuery(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -1039,15 +859,8 @@ func (s *Server) handleSortedIndexQuery(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req QuerySortedIndexRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -1089,13 +902,7 @@ func (s *Server) handleSortedIndexQuery(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Check database authentication
-	username, password, hasAuth := ExtractDatabaseAuth(r)
-	if !hasAuth {
-		username = req.Auth.Username
-		password = req.Auth.Password
-	}
-	if !db.Authenticate(username, password) {
-		writeErrorResponse(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+	if !s.authorizeDatabase(w, r, db, req.Set, req.Auth.Username, req.Auth.Password, database.RoleReader) {
 		return
 	}
 
@@ -1106,9 +913,9 @@ func (s *Server) handleSortedIndexQuery(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get index
+	// Get index of the set
 	index, err := db.GetIndex(req.Index)
-	if err != nil {
+	if err != nil || index.GetSetName() != req.Set {
 		writeErrorResponse(w, http.StatusNotFound, "INDEX_NOT_FOUND", "Index not found")
 		return
 	}
@@ -1178,11 +985,6 @@ func (s *Server) handleSortedIndexQuery(w http.ResponseWriter, r *http.Request)
 
 // handleMultiSortedIndexQuery handles the /index/query/multi-sorted endpoint
 func (s *Server) handleMultiSortedIndexQuery(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		logRequest(r, start, http.StatusOK)
-	}()
-
 	// Check if this is a POST request
 	if r.Method != http.MethodPost {
 		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
@@ -1190,15 +992,8 @@ func (s *Server) handleMultiSortedIndexQuery(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Parse request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
-		return
-	}
-
 	var req QueryMultiSortedIndexRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+	if !readJSONRequest(w, r, &req) {
 		return
 	}
 
@@ -1237,13 +1032,7 @@ func (s *Server) handleMultiSortedIndexQuery(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Check database authentication
-	username, password, hasAuth := ExtractDatabaseAuth(r)
-	if !hasAuth {
-		username = req.Auth.Username
-		password = req.Auth.Password
-	}
-	if !db.Authenticate(username, password) {
-		writeErrorResponse(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+	if !s.authorizeDatabase(w, r, db, req.Set, req.Auth.Username, req.Auth.Password, database.RoleReader) {
 		return
 	}
 
@@ -1254,9 +1043,9 @@ func (s *Server) handleMultiSortedIndexQuery(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Get index
+	// Get index of the set
 	index, err := db.GetIndex(req.Index)
-	if err != nil {
+	if err != nil || index.GetSetName() != req.Set {
 		writeErrorResponse(w, http.StatusNotFound, "INDEX_NOT_FOUND", "Index not found")
 		return
 	}
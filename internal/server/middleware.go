@@ -0,0 +1,253 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/logger"
+)
+
+// RequestIDHeader is the header carrying the ID of a request, set on every response
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest request ID accepted from a client
+const maxRequestIDLength = 128
+
+// CORS headers allowed in and exposed from cross-origin requests
+var (
+	corsAllowedHeaders = "Authorization, Content-Type, X-Admin-Authorization, " + RequestIDHeader
+	corsExposedHeaders = "Retry-After, " + RequestIDHeader
+)
+
+// contextKey is the type of the request context keys set by the middleware
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+// handler wraps the router in the middleware pipeline
+// From the outside in, requests are given an ID, logged, answered if they are CORS preflights,
+// limited in size, audited and rate limited, and panics in the handlers are recovered.
+func (s *Server) handler(router http.Handler) http.Handler {
+	h := recoverPanics(router)
+	h = s.rateLimit(h)
+	h = s.auditRequests(h)
+	h = s.limitBody(h)
+	h = s.cors(h)
+	h = logRequests(h)
+	return assignRequestID(h)
+}
+
+// responseRecorder records the status code and size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+// newResponseRecorder creates a recorder of a response that has not been written yet
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// WriteHeader records the status code and writes it
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the size of the data and writes it
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying response writer, for http.ResponseController
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// assignRequestID is a middleware that gives each request an ID
+// A valid X-Request-ID from the client is kept, so requests can be traced across services;
+// otherwise a random one is generated. The ID is set on the response and the request context.
+func assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// requestID returns the ID of a request, or an empty string if it has none
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether a request ID from a client is safe to log and return
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// logRequests is a middleware that logs each request with its status, response size and duration
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+		logRequest(r, start, rec)
+	})
+}
+
+// logRequest logs information about an HTTP request
+func logRequest(r *http.Request, start time.Time, rec *responseRecorder) {
+	duration := time.Since(start)
+	logger.Info("%s %s %d %dB %s [%s]", r.Method, r.URL.Path, rec.status, rec.bytes, duration, requestID(r))
+}
+
+// recoverPanics is a middleware that turns a panic in a handler into an INTERNAL_ERROR response
+// If the handler had already started its response, the response is left as it is.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := newResponseRecorder(w)
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// Aborting a response is a deliberate panic, handled by net/http
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			logger.Error("Panic serving %s %s [%s]: %v\n%s", r.Method, r.URL.Path, requestID(r), err, debug.Stack())
+			if !rec.wroteHeader {
+				writeErrorResponse(rec, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// cors is a middleware that allows the configured origins to call the API from browsers
+// Preflight requests from allowed origins are answered here, before the rate limits.
+func (s *Server) cors(next http.Handler) http.Handler {
+	cfg := s.Config.CORS
+	if !cfg.Enabled() {
+		return next
+	}
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !(anyOrigin || slices.Contains(cfg.AllowedOrigins, origin)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// "*" never allows credentials; only origins listed by name are sent them
+		if slices.Contains(cfg.AllowedOrigins, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			if cfg.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", fmt.Sprintf("%d", int(cfg.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitBody is a middleware that limits the size of request bodies
+// /import has its own limit, as its body is the data being imported. Bodies declared larger
+// than the limit are rejected at once; others fail with REQUEST_TOO_LARGE once read past it.
+func (s *Server) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := int64(s.Config.MaxBodySize) * 1024 * 1024
+		if r.URL.Path == "/import" {
+			limit = int64(s.Config.MaxImportSize) * 1024 * 1024
+		}
+		if limit <= 0 || r.Body == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > limit {
+			writeErrorResponse(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", fmt.Sprintf("Request body exceeds %d bytes", limit))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// peekBody reads a request body and replaces it, so the handler can read it again
+// If reading fails, such as when the body is over the size limit, the replaced body returns the
+// same error once the data that was read, so the handler reports it.
+func peekBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errorReader{err}))
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// errorReader is a reader that always fails with an error
+type errorReader struct {
+	err error
+}
+
+// Read returns the reader's error
+func (r errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+// newMiddlewareTestServer creates a server and its router in the middleware pipeline, with an
+// extra /panic endpoint
+func newMiddlewareTestServer(t *testing.T, cfg *config.ServerConfig) http.Handler {
+	dbManager := database.NewManager()
+	db, _ := dbManager.CreateDatabase("test_db", nil)
+	db.CreateSet("items")
+
+	srv := newTestServer(t, cfg, dbManager)
+	router := http.NewServeMux()
+	srv.registerEndpoints(router)
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	return srv.handler(router)
+}
+
+func TestRequestID(t *testing.T) {
+	handler := newMiddlewareTestServer(t, config.NewServerConfig())
+
+	tests := []struct {
+		name string
+		id   string
+		keep bool
+	}{
+		{"none", "", false},
+		{"valid", "trace-1234.abc:5", true},
+		{"invalid", "bad id\r\n", false},
+		{"too long", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/set/list", strings.NewReader(`{"database":"test_db"}`))
+		if tt.id != "" {
+			req.Header.Set(RequestIDHeader, tt.id)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		got := rr.Header().Get(RequestIDHeader)
+		if tt.keep && got != tt.id {
+			t.Errorf("%s: expected request ID %q, got %q", tt.name, tt.id, got)
+		}
+		if !tt.keep && (len(got) != 32 || got == tt.id) {
+			t.Errorf("%s: expected a generated request ID, got %q", tt.name, got)
+		}
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	handler := newMiddlewareTestServer(t, config.NewServerConfig())
+
+	req := httptest.NewRequest(http.MethodPost, "/panic", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+	var resp ErrorResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Code != "INTERNAL_ERROR" {
+		t.Errorf("Expected error code INTERNAL_ERROR, got %s", resp.Code)
+	}
+	if rr.Header().Get(RequestIDHeader) == "" {
+		t.Errorf("Expected the request ID to be set on the error response")
+	}
+}
+
+func TestResponseRecorder(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rec := newResponseRecorder(rr)
+	writeErrorResponse(rec, http.StatusNotFound, "DB_NOT_FOUND", "Database not found")
+
+	if rec.status != http.StatusNotFound || !rec.wroteHeader {
+		t.Errorf("Expected status %v to be recorded, got %v", http.StatusNotFound, rec.status)
+	}
+	if rec.bytes != int64(rr.Body.Len()) {
+		t.Errorf("Expected %d bytes to be recorded, got %d", rr.Body.Len(), rec.bytes)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	cfg := config.NewServerConfig()
+	cfg.CORS.AllowedOrigins = []string{"https://app.example.com"}
+	handler := newMiddlewareTestServer(t, cfg)
+
+	// Preflight from an allowed origin
+	req := httptest.NewRequest(http.MethodOptions, "/set/list", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Expected the origin to be allowed, got %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Authorization") || rr.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Unexpected preflight headers: %v", rr.Header())
+	}
+
+	// Requests from an allowed origin can read the request ID
+	req = httptest.NewRequest(http.MethodPost, "/set/list", strings.NewReader(`{"database":"test_db"}`))
+	req.Header.Set("Origin", "https://app.example.com")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Header().Get("Access-Control-Expose-Headers"), RequestIDHeader) {
+		t.Errorf("Expected the request ID to be exposed, got %v %v", rr.Code, rr.Header())
+	}
+
+	// Other origins are not allowed
+	req = httptest.NewRequest(http.MethodOptions, "/set/list", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected the origin not to be allowed, got %v", rr.Header())
+	}
+}
+
+func TestCORSAnyOriginWithoutCredentials(t *testing.T) {
+	cfg := config.NewServerConfig()
+	cfg.CORS.AllowedOrigins = []string{"*", "https://app.example.com"}
+	cfg.CORS.AllowCredentials = true
+	handler := newMiddlewareTestServer(t, cfg)
+
+	tests := []struct {
+		origin      string
+		allowOrigin string
+		credentials string
+	}{
+		{"https://evil.example.com", "*", ""},
+		{"https://app.example.com", "https://app.example.com", "true"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodOptions, "/set/list", nil)
+		req.Header.Set("Origin", tt.origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Header().Get("Access-Control-Allow-Origin") != tt.allowOrigin || rr.Header().Get("Access-Control-Allow-Credentials") != tt.credentials {
+			t.Errorf("%s: unexpected CORS headers: %v", tt.origin, rr.Header())
+		}
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	cfg := config.NewServerConfig()
+	cfg.MaxBodySize = 1
+	cfg.MaxImportSize = 2
+	handler := newMiddlewareTestServer(t, cfg)
+
+	large := `{"database":"test_db","set":"items","key":"k","value":"` + strings.Repeat("x", 1024*1024) + `"}`
+
+	// Declared and undeclared sizes are both limited
+	for _, declared := range []bool{true, false} {
+		var body io.Reader = strings.NewReader(large)
+		if !declared {
+			body = io.MultiReader(body) // Hides the length, as with a chunked body
+		}
+		req := httptest.NewRequest(http.MethodPost, "/set/put", body)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var resp ErrorResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if rr.Code != http.StatusRequestEntityTooLarge || resp.Code != "REQUEST_TOO_LARGE" {
+			t.Errorf("Declared %v: expected REQUEST_TOO_LARGE, got %v %s", declared, rr.Code, rr.Body.String())
+		}
+	}
+
+	// /import has its own limit
+	data := bytes.Repeat([]byte(`{"key":"k","value":{"name":"Widget"}}`+"\n"), 40000)
+	req := httptest.NewRequest(http.MethodPost, "/import?database=test_db&set=items", bytes.NewReader(data))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected an import under its own limit to succeed, got %v: %s", rr.Code, rr.Body.String())
+	}
+}
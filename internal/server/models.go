@@ -3,6 +3,11 @@ package server
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/ssig33/fuckbase/internal/audit"
+	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/ssig33/fuckbase/internal/s3"
+	"github.com/ssig33/fuckbase/internal/token"
 )
 
 // Response is the base response structure
@@ -21,8 +26,9 @@ type ErrorResponse struct {
 
 // CreateDatabaseRequest is the request structure for creating a database
 type CreateDatabaseRequest struct {
-	Name string `json:"name"`
-	Auth struct {
+	Name      string `json:"name"`
+	Encrypted bool   `json:"encrypted,omitempty"` // Seal the values with a data encryption key
+	Auth      struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
 	} `json:"auth"`
@@ -94,6 +100,19 @@ type ListSetsRequest struct {
 	} `json:"auth"`
 }
 
+// ExportRequest is the request structure for exporting a set
+type ExportRequest struct {
+	Database  string   `json:"database"`
+	Set       string   `json:"set"`
+	Format    string   `json:"format"`               // "ndjson" (default) or "csv"
+	Columns   []string `json:"columns,omitempty"`    // CSV value columns; every top-level field if empty
+	KeyColumn string   `json:"key_column,omitempty"` // CSV key column name; "key" if empty
+	Auth      struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auth"`
+}
+
 // CreateIndexRequest is the request structure for creating an index
 type CreateIndexRequest struct {
 	Database string `json:"database"`
@@ -148,6 +167,7 @@ type ServerInfoResponse struct {
 // CreateBackupRequest is the request structure for creating a backup
 type CreateBackupRequest struct {
 	Database  string `json:"database,omitempty"` // If empty, backup all databases
+	Async     bool   `json:"async,omitempty"`    // Return a job at once instead of waiting for the backup
 	AdminAuth struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
@@ -156,29 +176,65 @@ type CreateBackupRequest struct {
 
 // ListBackupsRequest is the request structure for listing backups
 type ListBackupsRequest struct {
-	Database  string `json:"database,omitempty"` // If empty, list all backups
-	AdminAuth struct {
+	Database   string     `json:"database,omitempty"` // If empty, list all backups; "all" lists full backups
+	Since      *time.Time `json:"since,omitempty"`    // Only backups taken at or after this time
+	Until      *time.Time `json:"until,omitempty"`    // Only backups taken before this time
+	Pagination Pagination `json:"pagination,omitempty"`
+	AdminAuth  struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
 	} `json:"admin_auth"`
 }
 
-// BackupInfo represents information about a backup
-type BackupInfo struct {
-	Name      string    `json:"name"`
-	Timestamp time.Time `json:"timestamp"`
-	Size      int64     `json:"size"`
-	Database  string    `json:"database,omitempty"`
-}
-
 // ListBackupsResponse is the response structure for listing backups
 type ListBackupsResponse struct {
-	Status  string       `json:"status"`
-	Backups []BackupInfo `json:"backups"`
+	Status  string           `json:"status"`
+	Backups []s3.BackupEntry `json:"backups"`
+	Count   int              `json:"count"`
+	Total   int              `json:"total"`
+	Offset  int              `json:"offset"`
+	Limit   int              `json:"limit"`
 }
 
 // RestoreBackupRequest is the request structure for restoring a backup
 type RestoreBackupRequest struct {
+	BackupName     string   `json:"backup_name"`
+	Database       string   `json:"database,omitempty"`        // Database to restore from a full backup
+	TargetDatabase string   `json:"target_database,omitempty"` // Restore into this database instead
+	Sets           []string `json:"sets,omitempty"`            // Restore only these sets
+	Mode           string   `json:"mode,omitempty"`            // "replace" (default) or "merge"
+	Async          bool     `json:"async,omitempty"`           // Return a job at once instead of waiting for the restore
+	AdminAuth      struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// PruneBackupsRequest is the request structure for pruning backups
+// Retention fields override the configured policy when any of them is set
+type PruneBackupsRequest struct {
+	Database   string `json:"database,omitempty"` // If empty, prune all backups; "full" selects full backups
+	DryRun     bool   `json:"dry_run"`
+	KeepLast   int    `json:"keep_last,omitempty"`
+	KeepHourly int    `json:"keep_hourly,omitempty"`
+	KeepDaily  int    `json:"keep_daily,omitempty"`
+	AdminAuth  struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// PruneBackupsResponse is the response structure for pruning backups
+type PruneBackupsResponse struct {
+	Status   string   `json:"status"`
+	DryRun   bool     `json:"dry_run"`
+	Pruned   []string `json:"pruned"`
+	Retained []string `json:"retained"`
+	Failed   []string `json:"failed,omitempty"`
+}
+
+// VerifyBackupRequest is the request structure for verifying a backup
+type VerifyBackupRequest struct {
 	BackupName string `json:"backup_name"`
 	AdminAuth  struct {
 		Username string `json:"username"`
@@ -186,6 +242,75 @@ type RestoreBackupRequest struct {
 	} `json:"admin_auth"`
 }
 
+// VerifyBackupResponse is the response structure for verifying a backup
+type VerifyBackupResponse struct {
+	Status string           `json:"status"`
+	Report *s3.VerifyReport `json:"report"`
+}
+
+// JobResponse is the response structure for a single backup or restore job
+type JobResponse struct {
+	Status string     `json:"status"`
+	Job    s3.JobInfo `json:"job"`
+}
+
+// ListJobsRequest is the request structure for listing backup and restore jobs
+type ListJobsRequest struct {
+	AdminAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// ListJobsResponse is the response structure for listing backup and restore jobs
+type ListJobsResponse struct {
+	Status string       `json:"status"`
+	Jobs   []s3.JobInfo `json:"jobs"`
+}
+
+// JobRequest is the request structure for querying or cancelling a job
+type JobRequest struct {
+	JobID     string `json:"job_id"`
+	AdminAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// ListSchedulesRequest is the request structure for listing backup schedules
+type ListSchedulesRequest struct {
+	AdminAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// ListSchedulesResponse is the response structure for listing backup schedules
+type ListSchedulesResponse struct {
+	Status    string              `json:"status"`
+	Schedules []s3.ScheduleStatus `json:"schedules"`
+}
+
+// AddScheduleRequest is the request structure for adding or replacing a backup schedule
+type AddScheduleRequest struct {
+	Name      string `json:"name"`
+	Database  string `json:"database,omitempty"` // If empty, back up all databases
+	Cron      string `json:"cron"`
+	AdminAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// RemoveScheduleRequest is the request structure for removing a backup schedule
+type RemoveScheduleRequest struct {
+	Name      string `json:"name"`
+	AdminAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
 // CreateSortableIndexRequest is the request structure for creating a sortable index
 type CreateSortableIndexRequest struct {
 	Database     string   `json:"database"`
@@ -237,4 +362,165 @@ type QueryMultiSortedIndexRequest struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
 	} `json:"auth"`
-}
\ No newline at end of file
+}
+// AddUserRequest is the request structure for adding a database user
+type AddUserRequest struct {
+	Database  string `json:"database"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Role      string `json:"role"` // "reader", "writer" or "admin"
+	AdminAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// RemoveUserRequest is the request structure for removing a database user
+type RemoveUserRequest struct {
+	Database  string `json:"database"`
+	Username  string `json:"username"`
+	AdminAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// ListUsersRequest is the request structure for listing database users
+type ListUsersRequest struct {
+	Database  string `json:"database"`
+	AdminAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// ListUsersResponse is the response structure for listing database users
+type ListUsersResponse struct {
+	Status string              `json:"status"`
+	Users  []database.UserInfo `json:"users"`
+}
+
+// CreateTokenRequest is the request structure for creating an API token
+type CreateTokenRequest struct {
+	Name      string        `json:"name"`
+	Scopes    []token.Scope `json:"scopes"`
+	ExpiresAt time.Time     `json:"expires_at"` // Optional; the token never expires if not set
+	AdminAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// CreateTokenResponse is the response structure for creating an API token
+// The token is only ever returned here.
+type CreateTokenResponse struct {
+	Status string     `json:"status"`
+	Token  string     `json:"token"`
+	Info   token.Info `json:"info"`
+}
+
+// ListTokensRequest is the request structure for listing API tokens
+type ListTokensRequest struct {
+	AdminAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// ListTokensResponse is the response structure for listing API tokens
+type ListTokensResponse struct {
+	Status string       `json:"status"`
+	Tokens []token.Info `json:"tokens"`
+}
+
+// RevokeTokenRequest is the request structure for revoking an API token
+type RevokeTokenRequest struct {
+	ID        string `json:"id"`
+	AdminAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// UpdateAuthRequest is the request structure for changing a database's credentials
+// The current credentials, or admin credentials, authorize the change.
+type UpdateAuthRequest struct {
+	Database string `json:"database"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auth"`
+}
+
+// DisableAuthRequest is the request structure for disabling a database's authentication
+type DisableAuthRequest struct {
+	Database string `json:"database"`
+	Auth     struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auth"`
+}
+
+// UpdateAdminAuthRequest is the request structure for rotating the admin credentials
+// Either the password or a hash from "fuckbase hash-password" is given.
+type UpdateAdminAuthRequest struct {
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	PasswordHash string `json:"password_hash"`
+	AdminAuth    struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// QueryAuditRequest is the request structure for querying the audit log
+// Empty filters match every event.
+type QueryAuditRequest struct {
+	Identity  string     `json:"identity,omitempty"`
+	Endpoint  string     `json:"endpoint,omitempty"`
+	Database  string     `json:"database,omitempty"`
+	Result    string     `json:"result,omitempty"` // "success" or "failure"
+	Since     *time.Time `json:"since,omitempty"`  // Only events at or after this time
+	Until     *time.Time `json:"until,omitempty"`  // Only events before this time
+	Limit     int        `json:"limit,omitempty"`  // Maximum number of events, newest first; 100 if not set
+	AdminAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin_auth"`
+}
+
+// QueryAuditResponse is the response structure for querying the audit log
+type QueryAuditResponse struct {
+	Status string        `json:"status"`
+	Events []audit.Event `json:"events"`
+	Count  int           `json:"count"`
+}
+
+// EncryptionRequest is the request structure for enabling, rotating and inspecting the
+// encryption of a database
+type EncryptionRequest struct {
+	Database string `json:"database"`
+	Auth     struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auth"`
+}
+
+// DataKeyInfo describes a data key of an encrypted database, without the key itself
+type DataKeyInfo struct {
+	ID          uint32    `json:"id"`
+	MasterKeyID string    `json:"master_key_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Active      bool      `json:"active"` // Seals new values
+}
+
+// EncryptionStatusResponse is the response structure for the encryption of a database
+type EncryptionStatusResponse struct {
+	Status       string        `json:"status"`
+	Database     string        `json:"database"`
+	Encrypted    bool          `json:"encrypted"`
+	Reencrypting bool          `json:"reencrypting"` // Values are being sealed with the active data key
+	DataKeys     []DataKeyInfo `json:"data_keys,omitempty"`
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/logger"
+	"github.com/ssig33/fuckbase/internal/ratelimit"
+)
+
+// readEndpoints are the endpoints limited by the read rates; every other endpoint is a write
+var readEndpoints = map[string]bool{
+	"/set/get":                  true,
+	"/set/list":                 true,
+	"/index/query":              true,
+	"/index/query/sorted":       true,
+	"/index/query/multi-sorted": true,
+	"/export":                   true,
+	"/server/info":              true,
+	"/user/list":                true,
+	"/token/list":               true,
+	"/audit/query":              true,
+	"/encryption/status":        true,
+	"/backup/list":              true,
+	"/backup/jobs":              true,
+	"/backup/job/status":        true,
+	"/backup/schedule/list":     true,
+}
+
+// limiterPair holds the limiters of read and write endpoints, either of which may be nil
+type limiterPair struct {
+	read  *ratelimit.Limiter
+	write *ratelimit.Limiter
+}
+
+// newLimiterPair creates the limiters for the given rates, leaving out those that are zero
+func newLimiterPair(readRate, writeRate float64) limiterPair {
+	var pair limiterPair
+	if readRate > 0 {
+		pair.read = ratelimit.NewLimiter(readRate, 0)
+	}
+	if writeRate > 0 {
+		pair.write = ratelimit.NewLimiter(writeRate, 0)
+	}
+	return pair
+}
+
+// get returns the limiter for read or write endpoints
+func (p limiterPair) get(read bool) *ratelimit.Limiter {
+	if read {
+		return p.read
+	}
+	return p.write
+}
+
+// limitKey is a limiter with the key a request is limited by
+type limitKey struct {
+	limiter *ratelimit.Limiter
+	key     string
+}
+
+// rateLimits holds the request limiters and the authentication lockout
+type rateLimits struct {
+	ip         limiterPair
+	credential limiterPair
+	database   limiterPair
+	lockout    *ratelimit.Lockout
+}
+
+// newRateLimits creates the limiters of the configuration
+func newRateLimits(cfg *config.RateLimitConfig) *rateLimits {
+	limits := &rateLimits{
+		ip:         newLimiterPair(cfg.IPRead, cfg.IPWrite),
+		credential: newLimiterPair(cfg.CredentialRead, cfg.CredentialWrite),
+		database:   newLimiterPair(cfg.DatabaseRead, cfg.DatabaseWrite),
+	}
+	if cfg.LockoutThreshold > 0 && cfg.LockoutDuration > 0 {
+		limits.lockout = ratelimit.NewLockout(cfg.LockoutThreshold, cfg.LockoutWindow, cfg.LockoutDuration)
+	}
+	return limits
+}
+
+// needsBody reports whether the limits need the database or credentials from the request body
+func (l *rateLimits) needsBody() bool {
+	return l.credential.read != nil || l.credential.write != nil || l.database.read != nil || l.database.write != nil
+}
+
+// rateLimit is a middleware that applies the rate limits and locks out clients after repeated
+// failed authentication
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits := s.limits
+		ip := clientIP(r)
+
+		if limits.lockout != nil {
+			if remaining, locked := limits.lockout.Locked(ip); locked {
+				setRetryAfter(w, remaining)
+				writeErrorResponse(w, http.StatusTooManyRequests, "LOCKED_OUT", "Too many failed authentication attempts")
+				return
+			}
+		}
+
+		read := readEndpoints[r.URL.Path]
+		keys := []limitKey{{limits.ip.get(read), ip}}
+		credential := limitKey{}
+		if limits.needsBody() {
+			database, name := requestIdentity(r)
+			keys = append(keys, limitKey{limits.database.get(read), database})
+			credential = limitKey{limits.credential.get(read), name}
+		}
+
+		// The credential is only claimed until the handler authenticates it, so its bucket is
+		// checked here but charged only once authentication succeeds; otherwise anyone could
+		// drain another user's bucket with wrong passwords.
+		if credential.limiter != nil && credential.key != "" {
+			if ok, wait := credential.limiter.Check(credential.key); !ok {
+				setRetryAfter(w, wait)
+				writeErrorResponse(w, http.StatusTooManyRequests, "RATE_LIMITED", "Rate limit exceeded")
+				return
+			}
+		}
+		for _, k := range keys {
+			if k.limiter == nil || k.key == "" {
+				continue
+			}
+			if ok, wait := k.limiter.Allow(k.key); !ok {
+				setRetryAfter(w, wait)
+				writeErrorResponse(w, http.StatusTooManyRequests, "RATE_LIMITED", "Rate limit exceeded")
+				return
+			}
+		}
+
+		rec := newResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		// AUTH_FAILED and ADMIN_AUTH_REQUIRED are both 401
+		if rec.status == http.StatusUnauthorized {
+			if limits.lockout != nil && limits.lockout.Fail(ip) {
+				logger.Warn("Locked out %s after repeated failed authentication", ip)
+			}
+		} else if credential.limiter != nil && credential.key != "" {
+			credential.limiter.Allow(credential.key)
+		}
+	})
+}
+
+// clientIP returns the IP address of the client that sent a request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestIdentity returns the database and credential a request is for, as rate limit keys
+// The request body is peeked at, except for /import, whose body is the data and whose
+// database is in the query string. Either value is empty if the request does not name it.
+func requestIdentity(r *http.Request) (string, string) {
+	var req struct {
+		Database string `json:"database"`
+		Auth     struct {
+			Username string `json:"username"`
+		} `json:"auth"`
+	}
+	if r.URL.Path == "/import" {
+		req.Database = r.URL.Query().Get("database")
+	} else if body, err := peekBody(r); err == nil {
+		json.Unmarshal(body, &req)
+	}
+
+	credential := ""
+	if bearer, ok := ExtractBearerToken(r); ok {
+		sum := sha256.Sum256([]byte(bearer))
+		credential = "bearer:" + hex.EncodeToString(sum[:8])
+	} else if username, _, ok := ExtractDatabaseAuth(r); ok {
+		credential = "user:" + req.Database + "/" + username
+	} else if req.Auth.Username != "" {
+		credential = "user:" + req.Database + "/" + req.Auth.Username
+	} else if encoded, ok := strings.CutPrefix(r.Header.Get("X-Admin-Authorization"), "Basic "); ok {
+		decoded, _ := base64.StdEncoding.DecodeString(encoded)
+		username, _, _ := strings.Cut(string(decoded), ":")
+		credential = "admin:" + username
+	}
+	return req.Database, credential
+}
+
+// setRetryAfter sets the Retry-After header to a wait in whole seconds, rounded up
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(wait.Seconds()))))
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/ssig33/fuckbase/internal/ratelimit"
+)
+
+// newRateLimitTestServer creates a server with the given limits and its middleware-wrapped router
+func newRateLimitTestServer(t *testing.T, limits config.RateLimitConfig) http.Handler {
+	dbManager := database.NewManager()
+	auth, _ := database.NewAuthConfig("owner", "password")
+	db, _ := dbManager.CreateDatabase("limited", auth)
+	db.CreateSet("items")
+	db.Put("items", "i1", map[string]interface{}{"name": "Widget"})
+	dbManager.CreateDatabase("other", nil)
+
+	cfg := config.NewServerConfig()
+	cfg.RateLimit = &limits
+	srv := newTestServer(t, cfg, dbManager)
+
+	// Buckets do not refill while the test runs, however slow password verification is
+	now := time.Now()
+	for _, pair := range []limiterPair{srv.limits.ip, srv.limits.credential, srv.limits.database} {
+		for _, limiter := range []*ratelimit.Limiter{pair.read, pair.write} {
+			if limiter != nil {
+				limiter.SetClock(func() time.Time { return now })
+			}
+		}
+	}
+
+	router := http.NewServeMux()
+	srv.registerEndpoints(router)
+	return srv.rateLimit(router)
+}
+
+// sendFrom sends a JSON request from a client IP with database credentials
+func sendFrom(handler http.Handler, ip, path, password string, reqBody interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.RemoteAddr = ip + ":12345"
+	req.SetBasicAuth("owner", password)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRateLimits(t *testing.T) {
+	handler := newRateLimitTestServer(t, config.RateLimitConfig{IPRead: 2, IPWrite: 1, DatabaseRead: 3})
+	get := GetSetRequest{Database: "limited", Set: "items", Key: "i1"}
+	put := PutSetRequest{Database: "limited", Set: "items", Key: "i2", Value: json.RawMessage(`{}`)}
+
+	// Reads and writes have separate limits per client IP
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if rr := sendFrom(handler, "192.0.2.1", "/set/get", "password", get); rr.Code != want {
+			t.Errorf("Read %d: got status %v want %v", i+1, rr.Code, want)
+		}
+	}
+	rr := sendFrom(handler, "192.0.2.1", "/set/put", "password", put)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected the write limit to be separate, got %v", rr.Code)
+	}
+	rr = sendFrom(handler, "192.0.2.1", "/set/put", "password", put)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected RATE_LIMITED with Retry-After 1, got %v %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	// The database limit applies across client IPs, and the body still reaches the handler
+	if rr := sendFrom(handler, "192.0.2.2", "/set/get", "password", get); rr.Code != http.StatusOK {
+		t.Errorf("Expected another IP to be allowed, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := sendFrom(handler, "192.0.2.3", "/set/get", "password", get); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the database limit to apply, got %v", rr.Code)
+	}
+	if rr := sendFrom(handler, "192.0.2.3", "/set/list", "", ListSetsRequest{Database: "other"}); rr.Code != http.StatusOK {
+		t.Errorf("Expected another database to be allowed, got %v", rr.Code)
+	}
+}
+
+func TestCredentialRateLimit(t *testing.T) {
+	handler := newRateLimitTestServer(t, config.RateLimitConfig{CredentialRead: 1})
+	get := GetSetRequest{Database: "limited", Set: "items", Key: "i1"}
+
+	if rr := sendFrom(handler, "192.0.2.1", "/set/get", "password", get); rr.Code != http.StatusOK {
+		t.Errorf("Got status %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := sendFrom(handler, "192.0.2.2", "/set/get", "password", get); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the credential limit to apply across client IPs, got %v", rr.Code)
+	}
+}
+
+func TestCredentialRateLimitIgnoresFailedAuth(t *testing.T) {
+	handler := newRateLimitTestServer(t, config.RateLimitConfig{CredentialRead: 1})
+	get := GetSetRequest{Database: "limited", Set: "items", Key: "i1"}
+
+	// Wrong passwords for a user do not use up the user's limit
+	for i := 0; i < 3; i++ {
+		if rr := sendFrom(handler, "198.51.100.1", "/set/get", "wrong", get); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Attempt %d: got status %v want %v", i+1, rr.Code, http.StatusUnauthorized)
+		}
+	}
+	if rr := sendFrom(handler, "192.0.2.1", "/set/get", "password", get); rr.Code != http.StatusOK {
+		t.Errorf("Expected the user to be allowed, got %v", rr.Code)
+	}
+}
+
+func TestAuthLockout(t *testing.T) {
+	handler := newRateLimitTestServer(t, config.RateLimitConfig{LockoutThreshold: 3, LockoutWindow: time.Minute, LockoutDuration: time.Minute})
+	get := GetSetRequest{Database: "limited", Set: "items", Key: "i1"}
+
+	for i := 0; i < 3; i++ {
+		if rr := sendFrom(handler, "192.0.2.1", "/set/get", "wrong", get); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Attempt %d: got status %v want %v", i+1, rr.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// Locked out even with the right password, until the lockout ends
+	rr := sendFrom(handler, "192.0.2.1", "/set/get", "password", get)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected LOCKED_OUT with Retry-After 60, got %v %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := sendFrom(handler, "192.0.2.2", "/set/get", "password", get); rr.Code != http.StatusOK {
+		t.Errorf("Expected other client IPs not to be locked out, got %v", rr.Code)
+	}
+}
@@ -3,52 +3,197 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"path/filepath"
+	"sync"
 	"time"
 
+	"github.com/ssig33/fuckbase/internal/audit"
 	"github.com/ssig33/fuckbase/internal/config"
 	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/ssig33/fuckbase/internal/jwt"
 	"github.com/ssig33/fuckbase/internal/logger"
 	"github.com/ssig33/fuckbase/internal/s3"
+	"github.com/ssig33/fuckbase/internal/token"
 )
 
 // Server represents the HTTP server for FuckBase
 type Server struct {
-	Config         *config.ServerConfig
-	DBManager      *database.Manager
-	httpServer     *http.Server
-	adminAuth      *AdminAuth
-	s3Client       *s3.Client
-	backupManager  *s3.BackupManager
-	backupTicker   *time.Ticker
-	stopBackupChan chan struct{}
-	startTime      time.Time
+	Config        *config.ServerConfig
+	DBManager     *database.Manager
+	httpServer    *http.Server
+	adminAuth     *AdminAuth
+	backupStorage s3.Storage
+	backupManager *s3.BackupManager
+	backupJobs    *s3.JobManager
+	scheduler     *s3.Scheduler
+	tokens        *token.Store
+	jwtVerifier   *jwt.Verifier
+	tls           *tlsManager
+	limits        *rateLimits
+	auditLog      *audit.Log
+	reencryptions sync.WaitGroup // Background re-encryption of databases
+	startTime     time.Time
 }
 
 // NewServer creates a new server with the given configuration and database manager
-func NewServer(cfg *config.ServerConfig, dbManager *database.Manager) *Server {
+// It fails if the configured TLS certificates cannot be loaded or the audit log cannot be opened.
+func NewServer(cfg *config.ServerConfig, dbManager *database.Manager) (*Server, error) {
 	server := &Server{
-		Config:         cfg,
-		DBManager:      dbManager,
-		adminAuth:      NewAdminAuth(cfg.AdminAuth),
-		stopBackupChan: make(chan struct{}),
-		startTime:      time.Now(),
+		Config:     cfg,
+		DBManager:  dbManager,
+		adminAuth:  NewAdminAuth(cfg.AdminAuth),
+		limits:     newRateLimits(cfg.RateLimit),
+		backupJobs: s3.NewJobManager(),
+		startTime:  time.Now(),
 	}
 
-	// Initialize S3 client if enabled
+	// Admin credentials rotated at runtime take precedence over the configured ones
+	rotated, err := server.adminAuth.LoadRotated(filepath.Join(cfg.DataDir, AdminAuthFileName))
+	if err != nil {
+		logger.Error("Failed to load rotated admin credentials, using the configured ones: %v", err)
+	} else if rotated {
+		logger.Warn("Using admin credentials rotated at runtime from %s instead of the admin username and password from flags or environment; delete the file to use those", filepath.Join(cfg.DataDir, AdminAuthFileName))
+	}
+
+	// Load the API tokens kept in the data directory
+	// Bearer tokens are rejected rather than the server failing to start when they cannot be loaded
+	tokens, err := token.NewStore(filepath.Join(cfg.DataDir, token.FileName))
+	if err != nil {
+		logger.Error("Failed to load API tokens, token authentication is disabled: %v", err)
+	} else {
+		server.tokens = tokens
+	}
+
+	// Load the JWT verification keys if configured
+	// JWTs are rejected rather than the server failing to start when the keys cannot be loaded
+	if cfg.JWT.Enabled() {
+		verifier, err := jwt.LoadVerifier(cfg.JWT)
+		if err != nil {
+			logger.Error("Failed to load JWT keys, JWT authentication is disabled: %v", err)
+		} else {
+			logger.Info("JWT authentication enabled with keys from %s", cfg.JWT.KeysFile)
+			server.jwtVerifier = verifier
+		}
+	}
+
+	// Load the TLS certificates if configured
+	// The server does not fall back to plain HTTP when they cannot be loaded
+	if cfg.TLS.Enabled() {
+		manager, err := newTLSManager(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		server.tls = manager
+		server.adminAuth.certs = manager
+	}
+
+	// Open the audit log if configured
+	// The server refuses to start rather than serve operations that would go unrecorded
+	if cfg.Audit.Enabled() {
+		auditLog, err := audit.Open(cfg.Audit.File, int64(cfg.Audit.MaxSize)*1024*1024, cfg.Audit.MaxFiles)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("Recording audit events in %s", cfg.Audit.File)
+		server.auditLog = auditLog
+	}
+
+	// Initialize backup storage: S3 if enabled, otherwise a local directory if configured,
+	// followed by any replicas
+	var targets []s3.StorageTarget
 	if cfg.S3Config != nil && cfg.S3Config.Enabled {
-		var err error
-		server.s3Client, err = s3.NewClient(cfg.S3Config)
+		s3Client, err := s3.NewClient(cfg.S3Config)
 		if err != nil {
 			logger.Error("Failed to initialize S3 client: %v", err)
 		} else {
 			logger.Info("S3 client initialized successfully")
-			server.backupManager = s3.NewBackupManager(server.s3Client, dbManager)
+			targets = append(targets, s3.StorageTarget{
+				Name:    fmt.Sprintf("s3://%s/%s", cfg.S3Config.Endpoint, cfg.S3Config.Bucket),
+				Storage: s3Client,
+			})
+		}
+	} else if cfg.BackupDir != "" {
+		localStorage, err := s3.NewLocalStorage(cfg.BackupDir)
+		if err != nil {
+			logger.Error("Failed to initialize local backup storage: %v", err)
+		} else {
+			logger.Info("Local backup storage initialized in %s", cfg.BackupDir)
+			targets = append(targets, s3.StorageTarget{Name: "file://" + cfg.BackupDir, Storage: localStorage})
 		}
 	}
 
-	return server
+	for _, replica := range cfg.BackupReplicas {
+		target, err := s3.NewStorageFromURL(replica, cfg.S3Config)
+		if err != nil {
+			logger.Error("Failed to initialize backup replica: %v", err)
+			continue
+		}
+		logger.Info("Backup replica %s initialized", target.Name)
+		targets = append(targets, target)
+	}
+
+	switch len(targets) {
+	case 0:
+	case 1:
+		server.backupStorage = targets[0].Storage
+	default:
+		logger.Info("Replicating backups to %d targets", len(targets))
+		server.backupStorage = s3.NewMultiStorage(targets...)
+	}
+
+	if server.backupStorage != nil {
+		server.backupManager = s3.NewBackupManager(server.backupStorage, dbManager)
+		server.backupManager.SetRetentionPolicy(cfg.Retention)
+		if err := server.backupManager.SetCompression(cfg.Compression); err != nil {
+			logger.Error("Invalid backup compression, backups will not be compressed: %v", err)
+		}
+	}
+
+	// Load the backup encryption keys if configured
+	// Backups are disabled rather than written in plaintext when the keys cannot be loaded
+	if server.backupManager != nil && cfg.Encryption.Enabled() {
+		keyring, err := s3.LoadKeyring(cfg.Encryption)
+		if err != nil {
+			logger.Error("Failed to load backup encryption key, backups are disabled: %v", err)
+			server.backupManager = nil
+		} else {
+			logger.Info("Backup encryption enabled with key %s", keyring.ActiveKeyID())
+			server.backupManager.SetKeyring(keyring)
+		}
+	}
+
+	// Load the master keys of databases encrypted at rest if configured
+	// Encrypted databases cannot be created or restored, rather than the server failing to start,
+	// when the keys cannot be loaded
+	if cfg.DataEncryption.Enabled() {
+		keyring, err := s3.LoadKeyring(cfg.DataEncryption)
+		if err != nil {
+			logger.Error("Failed to load data encryption key, encrypted databases are unavailable: %v", err)
+		} else {
+			logger.Info("Data encryption enabled with key %s", keyring.ActiveKeyID())
+			dbManager.SetKeyWrapper(keyring)
+		}
+	}
+
+	// The backup interval becomes the default schedule, backing up all databases
+	if server.backupManager != nil {
+		server.scheduler = s3.NewScheduler(server.backupManager, server.backupJobs)
+		if cfg.BackupInterval > 0 {
+			schedule := s3.BackupSchedule{
+				Name: s3.DefaultScheduleName,
+				Cron: fmt.Sprintf("@every %dm", cfg.BackupInterval),
+			}
+			if err := server.scheduler.SetDefault(schedule); err != nil {
+				logger.Error("Invalid backup interval: %v", err)
+			}
+		}
+	}
+
+	return server, nil
 }
 
 // Start starts the HTTP server
@@ -63,52 +208,113 @@ func (s *Server) Start() error {
 	addr := fmt.Sprintf("%s:%d", s.Config.Host, s.Config.Port)
 	s.httpServer = &http.Server{
 		Addr:    addr,
-		Handler: router,
+		Handler: s.handler(router),
 	}
 
-	// Start automatic backups if S3 is enabled
-	if s.backupManager != nil && s.Config.BackupInterval > 0 {
-		s.startAutomaticBackups()
+	// Restore data before serving traffic if requested
+	if err := s.restoreOnStart(); err != nil {
+		return fmt.Errorf("restore on start failed: %w", err)
+	}
+
+	// Start scheduled backups if backup storage is configured
+	if s.scheduler != nil {
+		if err := s.scheduler.Load(); err != nil {
+			logger.Error("Failed to load backup schedules: %v", err)
+		}
+		s.scheduler.Start()
 	}
 
 	// Start the server
+	if s.tls != nil {
+		s.httpServer.TLSConfig = s.tls.serverConfig()
+		logger.Info("Starting server on %s with TLS", addr)
+		return s.httpServer.ListenAndServeTLS("", "")
+	}
 	logger.Info("Starting server on %s", addr)
 	return s.httpServer.ListenAndServe()
 }
 
+// ReloadTLS reloads the TLS certificates and client identities
+// New connections use them once loaded; on error the previous ones stay in use.
+func (s *Server) ReloadTLS() error {
+	if s.tls == nil {
+		return nil
+	}
+	if err := s.tls.reload(); err != nil {
+		return err
+	}
+	logger.Info("Reloaded TLS certificates")
+	return nil
+}
+
 // Stop stops the HTTP server
 func (s *Server) Stop(ctx context.Context) error {
 	logger.Info("Stopping server")
-	
-	// Stop automatic backups
-	if s.backupTicker != nil {
-		s.stopBackupChan <- struct{}{}
-		s.backupTicker.Stop()
-	}
-	
-	return s.httpServer.Shutdown(ctx)
+
+	// Stop scheduled backups
+	if s.scheduler != nil {
+		s.scheduler.Stop()
+	}
+
+	// Stop running backup and restore jobs; restores that have not swapped in their data leave it untouched
+	s.backupJobs.CancelAll()
+
+	err := s.httpServer.Shutdown(ctx)
+
+	// Close the audit log once in-flight requests have been recorded
+	if s.auditLog != nil {
+		s.auditLog.Close()
+	}
+	return err
 }
 
-// startAutomaticBackups starts a ticker to perform automatic backups
-func (s *Server) startAutomaticBackups() {
-	interval := time.Duration(s.Config.BackupInterval) * time.Minute
-	s.backupTicker = time.NewTicker(interval)
-	
-	go func() {
-		logger.Info("Starting automatic backups every %d minutes", s.Config.BackupInterval)
-		for {
-			select {
-			case <-s.backupTicker.C:
-				logger.Info("Running scheduled backup")
-				if err := s.backupManager.BackupAllDatabases(); err != nil {
-					logger.Error("Scheduled backup failed: %v", err)
-				}
-			case <-s.stopBackupChan:
-				logger.Info("Stopping automatic backups")
-				return
-			}
+// restoreOnStart restores the backup selected by the restore-on-start setting
+// With "latest", the newest full backup is restored; if there are no backups yet, the
+// server starts empty. Any other failure is returned so the server does not start
+// serving, or backing up, an empty database by mistake.
+func (s *Server) restoreOnStart() error {
+	objectName := s.Config.RestoreOnStart
+	if objectName == "" {
+		return nil
+	}
+
+	if s.backupManager == nil {
+		return fmt.Errorf("backup storage is not configured")
+	}
+
+	if objectName == config.RestoreLatest {
+		latest, err := s.backupManager.LatestFullBackup()
+		if errors.Is(err, s3.ErrNoBackups) {
+			logger.Warn("No full backup to restore on start, starting with no data")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		objectName = latest
+	}
+
+	logger.Info("Restoring from backup %s before serving", objectName)
+
+	var run s3.JobFunc
+	if s3.IsFullBackupObject(objectName) {
+		run = func(ctx context.Context, progress *s3.Progress) (string, error) {
+			return objectName, s.backupManager.RestoreAllDatabasesContext(ctx, objectName, progress)
+		}
+	} else {
+		run = func(ctx context.Context, progress *s3.Progress) (string, error) {
+			return objectName, s.backupManager.RestoreDatabaseContext(ctx, objectName, s3.RestoreOptions{}, progress)
 		}
-	}()
+	}
+
+	job := s.backupJobs.Start(s3.JobTypeRestore, "", objectName, run)
+	if err := job.Wait(); err != nil {
+		return err
+	}
+
+	info := job.Info()
+	logger.Info("Restored %d sets and %d entries from backup %s", info.SetsProcessed, info.EntriesProcessed, objectName)
+	return nil
 }
 
 // registerEndpoints registers all API endpoints
@@ -124,6 +330,33 @@ func (s *Server) registerEndpoints(router *http.ServeMux) {
 	router.HandleFunc("/set/delete", s.handleSetDelete)
 	router.HandleFunc("/set/list", s.handleSetList)
 
+	// Credential management
+	router.HandleFunc("/auth/update", s.handleAuthUpdate)
+	router.HandleFunc("/auth/disable", s.handleAuthDisable)
+	router.HandleFunc("/auth/admin/update", s.handleAdminAuthUpdate)
+
+	// Database user management
+	router.HandleFunc("/user/add", s.handleUserAdd)
+	router.HandleFunc("/user/remove", s.handleUserRemove)
+	router.HandleFunc("/user/list", s.handleUserList)
+
+	// API token management
+	router.HandleFunc("/token/create", s.handleTokenCreate)
+	router.HandleFunc("/token/list", s.handleTokenList)
+	router.HandleFunc("/token/revoke", s.handleTokenRevoke)
+
+	// Audit log endpoints
+	router.HandleFunc("/audit/query", s.handleAuditQuery)
+
+	// Encryption at rest
+	router.HandleFunc("/encryption/enable", s.handleEncryptionEnable)
+	router.HandleFunc("/encryption/rotate", s.handleEncryptionRotate)
+	router.HandleFunc("/encryption/status", s.handleEncryptionStatus)
+
+	// Bulk export and import of a set
+	router.HandleFunc("/export", s.handleExport)
+	router.HandleFunc("/import", s.handleImport)
+
 	// Index operations
 	router.HandleFunc("/index/create", s.handleIndexCreate)
 	router.HandleFunc("/index/create/sortable", s.handleSortableIndexCreate)
@@ -134,26 +367,58 @@ func (s *Server) registerEndpoints(router *http.ServeMux) {
 
 	// Server info
 	router.HandleFunc("/server/info", s.handleServerInfo)
-	
-	// Backup and restore operations (only if S3 is enabled)
+
+	// Backup and restore operations (only if backup storage is configured)
 	if s.backupManager != nil {
 		router.HandleFunc("/backup/create", s.handleBackupCreate)
 		router.HandleFunc("/backup/list", s.handleBackupList)
 		router.HandleFunc("/backup/restore", s.handleBackupRestore)
+		router.HandleFunc("/backup/prune", s.handleBackupPrune)
+		router.HandleFunc("/backup/verify", s.handleBackupVerify)
+		router.HandleFunc("/backup/jobs", s.handleBackupJobs)
+		router.HandleFunc("/backup/job/status", s.handleBackupJobStatus)
+		router.HandleFunc("/backup/job/cancel", s.handleBackupJobCancel)
+		router.HandleFunc("/backup/schedule/list", s.handleBackupScheduleList)
+		router.HandleFunc("/backup/schedule/add", s.handleBackupScheduleAdd)
+		router.HandleFunc("/backup/schedule/remove", s.handleBackupScheduleRemove)
 	}
 }
 
-// logRequest logs information about an HTTP request
-func logRequest(r *http.Request, start time.Time, statusCode int) {
-	duration := time.Since(start)
-	logger.Info("%s %s %d %s", r.Method, r.URL.Path, statusCode, duration)
+// readRequestBody reads a request body, writing the error response and returning false if it cannot
+// A body over the size limit is REQUEST_TOO_LARGE.
+func readRequestBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeErrorResponse(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", fmt.Sprintf("Request body exceeds %d bytes", maxErr.Limit))
+			return nil, false
+		}
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
+		return nil, false
+	}
+	return body, true
+}
+
+// readJSONRequest reads a JSON request body into v, writing the error response and returning
+// false if it cannot be read or parsed
+func readJSONRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, ok := readRequestBody(w, r)
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body")
+		return false
+	}
+	return true
 }
 
 // writeJSONResponse writes a JSON response with the given status code
 func writeJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	
+
 	if data != nil {
 		if err := json.NewEncoder(w).Encode(data); err != nil {
 			logger.Error("Failed to encode JSON response: %v", err)
@@ -169,4 +434,4 @@ func writeErrorResponse(w http.ResponseWriter, statusCode int, code string, mess
 		Message: message,
 	}
 	writeJSONResponse(w, statusCode, response)
-}
\ No newline at end of file
+}
@@ -17,11 +17,21 @@ func init() {
 	logger.InitLogger("info", "stdout")
 }
 
+// newTestServer creates a server, failing the test if it cannot be created
+func newTestServer(t *testing.T, cfg *config.ServerConfig, dbManager *database.Manager) *Server {
+	t.Helper()
+	srv, err := NewServer(cfg, dbManager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	return srv
+}
+
 func TestServerEndpoints(t *testing.T) {
 	// Create a new server
 	cfg := config.NewServerConfig()
 	dbManager := database.NewManager()
-	srv := NewServer(cfg, dbManager)
+	srv := newTestServer(t, cfg, dbManager)
 
 	// Test database creation
 	t.Run("CreateDatabase", func(t *testing.T) {
@@ -229,7 +239,7 @@ func TestMethodNotAllowed(t *testing.T) {
 	// Create a new server
 	cfg := config.NewServerConfig()
 	dbManager := database.NewManager()
-	srv := NewServer(cfg, dbManager)
+	srv := newTestServer(t, cfg, dbManager)
 
 	// Test GET request to /create
 	req := httptest.NewRequest(http.MethodGet, "/create", nil)
@@ -258,7 +268,7 @@ func TestInvalidRequest(t *testing.T) {
 	// Create a new server
 	cfg := config.NewServerConfig()
 	dbManager := database.NewManager()
-	srv := NewServer(cfg, dbManager)
+	srv := newTestServer(t, cfg, dbManager)
 
 	// Test invalid JSON
 	req := httptest.NewRequest(http.MethodPost, "/create", bytes.NewReader([]byte("invalid json")))
@@ -288,7 +298,7 @@ func TestMissingRequiredFields(t *testing.T) {
 	// Create a new server
 	cfg := config.NewServerConfig()
 	dbManager := database.NewManager()
-	srv := NewServer(cfg, dbManager)
+	srv := newTestServer(t, cfg, dbManager)
 
 	// Test missing database name
 	reqBody := CreateDatabaseRequest{
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/token"
+)
+
+// ClientIdentity maps a client certificate subject to admin access or database scopes
+type ClientIdentity struct {
+	Subject string        `json:"subject"` // Full subject, such as "CN=reporting,O=Example", or only the common name
+	Admin   bool          `json:"admin"`   // Allows the admin endpoints
+	Scopes  []token.Scope `json:"scopes"`  // Database access, as for API tokens
+}
+
+// matches reports whether the identity is for a certificate
+func (id *ClientIdentity) matches(cert *x509.Certificate) bool {
+	if strings.Contains(id.Subject, "=") {
+		return id.Subject == cert.Subject.String()
+	}
+	return id.Subject == cert.Subject.CommonName
+}
+
+// tlsManager holds the TLS configuration built from the certificate files
+// Reloading replaces the whole configuration, so a failed reload keeps the previous one.
+type tlsManager struct {
+	cfg        *config.TLSConfig
+	mu         sync.RWMutex
+	tlsConfig  *tls.Config
+	identities []ClientIdentity
+}
+
+// newTLSManager loads the certificates and client identities of the configuration
+func newTLSManager(cfg *config.TLSConfig) (*tlsManager, error) {
+	m := &tlsManager{cfg: cfg}
+	if err := m.reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// reload loads the certificates and client identities again
+func (m *tlsManager) reload() error {
+	cert, err := tls.LoadX509KeyPair(m.cfg.CertFile, m.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if m.cfg.ClientCAFile != "" {
+		data, err := os.ReadFile(m.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read TLS client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in TLS client CA file %s", m.cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if m.cfg.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if m.cfg.RequireClientCert {
+		return fmt.Errorf("a TLS client CA file is required to require client certificates")
+	}
+
+	var identities []ClientIdentity
+	if m.cfg.ClientIdentities != "" {
+		data, err := os.ReadFile(m.cfg.ClientIdentities)
+		if err != nil {
+			return fmt.Errorf("failed to read TLS client identities: %w", err)
+		}
+		if err := json.Unmarshal(data, &identities); err != nil {
+			return fmt.Errorf("failed to parse TLS client identities: %w", err)
+		}
+		for _, id := range identities {
+			if id.Subject == "" {
+				return fmt.Errorf("TLS client identity without a subject")
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tlsConfig = tlsConfig
+	m.identities = identities
+	return nil
+}
+
+// serverConfig returns a TLS configuration that uses the latest loaded certificates
+func (m *tlsManager) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			m.mu.RLock()
+			defer m.mu.RUnlock()
+			return m.tlsConfig, nil
+		},
+	}
+}
+
+// identity returns the identity of a request's verified client certificate, or nil if it has none
+func (m *tlsManager) identity(r *http.Request) *ClientIdentity {
+	if m == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for i := range m.identities {
+		if m.identities[i].matches(cert) {
+			id := m.identities[i]
+			return &id
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/credential"
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+// testCA issues certificates for TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCA creates a self-signed CA
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue creates a certificate for a subject, returning the PEM certificate and key
+func (ca *testCA) issue(t *testing.T, serial int64, subject pkix.Name, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes a file in dir and returns its path
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, 2, pkix.Name{CommonName: "fuckbase"}, x509.ExtKeyUsageServerAuth)
+	adminCert, adminKey := ca.issue(t, 3, pkix.Name{CommonName: "ops"}, x509.ExtKeyUsageClientAuth)
+	readerCert, readerKey := ca.issue(t, 4, pkix.Name{CommonName: "reporting", Organization: []string{"Example"}}, x509.ExtKeyUsageClientAuth)
+
+	hash, _ := credential.HashPassword("admin-password")
+	cfg := config.NewServerConfig()
+	cfg.DataDir = dir
+	cfg.AdminAuth = &config.AdminAuthConfig{Username: "admin", PasswordHash: hash, Enabled: true}
+	cfg.TLS.CertFile = writeFile(t, dir, "server.pem", serverCert)
+	cfg.TLS.KeyFile = writeFile(t, dir, "server-key.pem", serverKey)
+	cfg.TLS.ClientCAFile = writeFile(t, dir, "ca.pem", ca.pem)
+	cfg.TLS.ClientIdentities = writeFile(t, dir, "identities.json", []byte(`[
+		{"subject": "ops", "admin": true},
+		{"subject": "CN=reporting,O=Example", "scopes": ["reader:orders/*"]}
+	]`))
+
+	dbManager := database.NewManager()
+	auth, _ := database.NewAuthConfig("owner", "password")
+	db, _ := dbManager.CreateDatabase("orders", auth)
+	db.CreateSet("items")
+	db.Put("items", "i1", map[string]interface{}{"name": "Widget"})
+
+	srv := newTestServer(t, cfg, dbManager)
+	router := http.NewServeMux()
+	srv.registerEndpoints(router)
+	ts := httptest.NewUnstartedServer(router)
+	ts.TLS = srv.tls.serverConfig()
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+	client := func(certPEM, keyPEM []byte) *http.Client {
+		tlsConfig := &tls.Config{RootCAs: roots}
+		if certPEM != nil {
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				t.Fatalf("Failed to load client certificate: %v", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+	post := func(c *http.Client, path string, reqBody interface{}) (*http.Response, error) {
+		body, _ := json.Marshal(reqBody)
+		return c.Post(ts.URL+path, "application/json", bytes.NewReader(body))
+	}
+
+	get := GetSetRequest{Database: "orders", Set: "items", Key: "i1"}
+	tests := []struct {
+		name   string
+		client *http.Client
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"reader certificate", client(readerCert, readerKey), "/set/get", get, http.StatusOK},
+		{"reader certificate writing", client(readerCert, readerKey), "/set/put", PutSetRequest{Database: "orders", Set: "items", Key: "i2", Value: json.RawMessage(`{}`)}, http.StatusUnauthorized},
+		{"reader certificate on admin endpoint", client(readerCert, readerKey), "/token/list", ListTokensRequest{}, http.StatusUnauthorized},
+		{"admin certificate", client(adminCert, adminKey), "/token/list", ListTokensRequest{}, http.StatusOK},
+		{"admin certificate on database", client(adminCert, adminKey), "/set/get", get, http.StatusUnauthorized},
+		{"no certificate", client(nil, nil), "/set/get", get, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		resp, err := post(tt.client, tt.path, tt.body)
+		if err != nil {
+			t.Errorf("%s: request failed: %v", tt.name, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: got status %v want %v", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+
+	// Requiring client certificates rejects clients without one
+	cfg.TLS.RequireClientCert = true
+	if err := srv.ReloadTLS(); err != nil {
+		t.Fatalf("Failed to reload TLS: %v", err)
+	}
+	if _, err := post(client(nil, nil), "/set/get", get); err == nil {
+		t.Errorf("Expected a client without a certificate to be rejected")
+	}
+
+	// Reloading picks up a new server certificate, and a failed reload keeps the current one
+	newCert, newKey := ca.issue(t, 5, pkix.Name{CommonName: "fuckbase"}, x509.ExtKeyUsageServerAuth)
+	writeFile(t, dir, "server.pem", newCert)
+	writeFile(t, dir, "server-key.pem", newKey)
+	if err := srv.ReloadTLS(); err != nil {
+		t.Fatalf("Failed to reload TLS: %v", err)
+	}
+	writeFile(t, dir, "server-key.pem", []byte("invalid"))
+	if err := srv.ReloadTLS(); err == nil {
+		t.Errorf("Expected an invalid key to fail to reload")
+	}
+	resp, err := post(client(readerCert, readerKey), "/set/get", get)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if serial := resp.TLS.PeerCertificates[0].SerialNumber.Int64(); serial != 5 {
+		t.Errorf("Expected the reloaded server certificate, got serial %d", serial)
+	}
+}
+
+func TestNewServerInvalidTLS(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.NewServerConfig()
+	cfg.DataDir = dir
+	cfg.TLS.CertFile = writeFile(t, dir, "server.pem", []byte("invalid"))
+	cfg.TLS.KeyFile = writeFile(t, dir, "server-key.pem", []byte("invalid"))
+
+	// The server refuses to start rather than serve plain HTTP
+	if _, err := NewServer(cfg, database.NewManager()); err == nil {
+		t.Errorf("Expected an invalid certificate to fail server creation")
+	}
+}
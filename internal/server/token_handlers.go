@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/logger"
+	"github.com/ssig33/fuckbase/internal/token"
+)
+
+// handleTokenCreate handles the /token/create endpoint
+func (s *Server) handleTokenCreate(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleTokenCreateImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleTokenCreateImpl(w, r)
+}
+
+// handleTokenCreateImpl implements the token create logic
+func (s *Server) handleTokenCreateImpl(w http.ResponseWriter, r *http.Request) {
+	if s.tokens == nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "API tokens are not available")
+		return
+	}
+
+	// Parse request body
+	body, ok := readRequestBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateTokenRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body: "+err.Error())
+		return
+	}
+
+	// Validate request
+	if len(req.Scopes) == 0 {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "At least one scope is required")
+		return
+	}
+	for _, scope := range req.Scopes {
+		if err := scope.Validate(); err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+			return
+		}
+	}
+	if !req.ExpiresAt.IsZero() && !req.ExpiresAt.After(time.Now()) {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Expiry time must be in the future")
+		return
+	}
+
+	// Create token
+	secret, info, err := s.tokens.Create(req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	logger.Info("Created API token %s (%s)", info.ID, info.Name)
+
+	// Return success response
+	response := CreateTokenResponse{
+		Status: "success",
+		Token:  secret,
+		Info:   info,
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// handleTokenList handles the /token/list endpoint
+func (s *Server) handleTokenList(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleTokenListImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleTokenListImpl(w, r)
+}
+
+// handleTokenListImpl implements the token list logic
+func (s *Server) handleTokenListImpl(w http.ResponseWriter, r *http.Request) {
+	tokens := []token.Info{}
+	if s.tokens != nil {
+		tokens = s.tokens.List()
+	}
+
+	// Return success response
+	response := ListTokensResponse{
+		Status: "success",
+		Tokens: tokens,
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// handleTokenRevoke handles the /token/revoke endpoint
+func (s *Server) handleTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleTokenRevokeImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleTokenRevokeImpl(w, r)
+}
+
+// handleTokenRevokeImpl implements the token revoke logic
+func (s *Server) handleTokenRevokeImpl(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var req RevokeTokenRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Validate request
+	if req.ID == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Token ID is required")
+		return
+	}
+
+	// Revoke token
+	err := token.ErrTokenNotFound
+	if s.tokens != nil {
+		err = s.tokens.Revoke(req.ID)
+	}
+	if errors.Is(err, token.ErrTokenNotFound) {
+		writeErrorResponse(w, http.StatusNotFound, "TOKEN_NOT_FOUND", "Token not found")
+		return
+	}
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	logger.Info("Revoked API token %s", req.ID)
+
+	// Return success response
+	response := Response{
+		Status:  "success",
+		Message: "Token revoked successfully",
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/ssig33/fuckbase/internal/token"
+)
+
+// postWithToken calls a handler with a JSON request body and an API token
+func postWithToken(handler http.HandlerFunc, secret string, reqBody interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+secret)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestAPITokens(t *testing.T) {
+	dbManager := database.NewManager()
+	auth, _ := database.NewAuthConfig("owner", "password")
+	db, _ := dbManager.CreateDatabase("orders", auth)
+	db.CreateSet("items")
+	db.CreateSet("secrets")
+	db.Put("items", "i1", map[string]interface{}{"name": "Widget"})
+	db.Put("secrets", "s1", map[string]interface{}{"name": "Hidden"})
+
+	cfg := config.NewServerConfig()
+	cfg.DataDir = t.TempDir()
+	srv := newTestServer(t, cfg, dbManager)
+
+	// Create a read-only token for the items set
+	rr := postJSON(srv.handleTokenCreate, "/token/create", map[string]interface{}{
+		"name":   "reporting",
+		"scopes": []string{"reader:orders/item*"},
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var created CreateTokenResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+	if !strings.HasPrefix(created.Token, token.Prefix) || created.Info.Name != "reporting" {
+		t.Errorf("Unexpected token: %+v", created)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		secret  string
+		body    interface{}
+		status  int
+	}{
+		{"read in scope", srv.handleSetGet, created.Token, GetSetRequest{Database: "orders", Set: "items", Key: "i1"}, http.StatusOK},
+		{"list sets", srv.handleSetList, created.Token, ListSetsRequest{Database: "orders"}, http.StatusOK},
+		{"set out of scope", srv.handleSetGet, created.Token, GetSetRequest{Database: "orders", Set: "secrets", Key: "s1"}, http.StatusForbidden},
+		{"write", srv.handleSetPut, created.Token, PutSetRequest{Database: "orders", Set: "items", Key: "i2", Value: json.RawMessage(`{}`)}, http.StatusForbidden},
+		{"unknown token", srv.handleSetGet, created.Token + "x", GetSetRequest{Database: "orders", Set: "items", Key: "i1"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if rr := postWithToken(tt.handler, tt.secret, tt.body); rr.Code != tt.status {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v: %s", tt.name, rr.Code, tt.status, rr.Body.String())
+		}
+	}
+
+	// Tokens are saved without their secrets and survive a restart
+	data, err := os.ReadFile(filepath.Join(cfg.DataDir, token.FileName))
+	if err != nil || strings.Contains(string(data), created.Token) {
+		t.Errorf("Expected the token file to hold only a hash of the token (%v)", err)
+	}
+	srv = newTestServer(t, cfg, dbManager)
+	rr = postJSON(srv.handleTokenList, "/token/list", ListTokensRequest{})
+	var list ListTokensResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list.Tokens) != 1 || list.Tokens[0].ID != created.Info.ID {
+		t.Errorf("Expected the created token to be listed, got %s", rr.Body.String())
+	}
+
+	// Revoked tokens are rejected
+	if rr := postJSON(srv.handleTokenRevoke, "/token/revoke", RevokeTokenRequest{ID: created.Info.ID}); rr.Code != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := postJSON(srv.handleTokenRevoke, "/token/revoke", RevokeTokenRequest{ID: created.Info.ID}); rr.Code != http.StatusNotFound {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if rr := postWithToken(srv.handleSetGet, created.Token, GetSetRequest{Database: "orders", Set: "items", Key: "i1"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	// Invalid scopes are rejected
+	for _, body := range []string{`{"scopes": []}`, `{"scopes": ["owner:orders"]}`, `{"scopes": ["reader:orders"], "expires_at": "2000-01-01T00:00:00Z"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/token/create", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		srv.handleTokenCreate(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestScopedTokenIndexes(t *testing.T) {
+	dbManager := database.NewManager()
+	auth, _ := database.NewAuthConfig("owner", "password")
+	db, _ := dbManager.CreateDatabase("orders", auth)
+	db.CreateSet("items")
+	db.CreateSet("secrets")
+	db.Put("secrets", "s1", map[string]interface{}{"name": "Hidden", "rank": 1})
+	db.CreateIndex("secret_names", "secrets", "name")
+	db.CreateSortableIndex("secret_ranks", "secrets", "name", []string{"rank"})
+
+	cfg := config.NewServerConfig()
+	cfg.DataDir = t.TempDir()
+	srv := newTestServer(t, cfg, dbManager)
+
+	// An admin token for the items set cannot reach indexes of other sets by naming its own set
+	rr := postJSON(srv.handleTokenCreate, "/token/create", map[string]interface{}{
+		"name":   "items-admin",
+		"scopes": []string{"admin:orders/items"},
+	})
+	var created CreateTokenResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+
+	sort := []SortField{{Field: "rank", Order: "asc"}}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    interface{}
+	}{
+		{"query", srv.handleIndexQuery, QueryIndexRequest{Database: "orders", Set: "items", Index: "secret_names", Value: "Hidden"}},
+		{"sorted query", srv.handleSortedIndexQuery, QuerySortedIndexRequest{Database: "orders", Set: "items", Index: "secret_ranks", Value: "Hidden", Sort: sort[0]}},
+		{"multi-sorted query", srv.handleMultiSortedIndexQuery, QueryMultiSortedIndexRequest{Database: "orders", Set: "items", Index: "secret_ranks", Value: "Hidden", Sort: sort}},
+		{"drop", srv.handleIndexDrop, DropIndexRequest{Database: "orders", Set: "items", Name: "secret_names"}},
+	}
+	for _, tt := range tests {
+		rr := postWithToken(tt.handler, created.Token, tt.body)
+		if rr.Code != http.StatusNotFound || strings.Contains(rr.Body.String(), "Hidden") {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v: %s", tt.name, rr.Code, http.StatusNotFound, rr.Body.String())
+		}
+	}
+	if _, err := db.GetIndex("secret_names"); err != nil {
+		t.Errorf("Expected the index of another set not to be dropped")
+	}
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	dbManager := database.NewManager()
+	auth, _ := database.NewAuthConfig("owner", "password")
+	db, _ := dbManager.CreateDatabase("orders", auth)
+	db.CreateSet("items")
+	db.Put("items", "i1", map[string]interface{}{"name": "Widget"})
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	keysFile := filepath.Join(t.TempDir(), "jwks.json")
+	jwks := `{"keys": [{"kty": "oct", "k": "` + base64.RawURLEncoding.EncodeToString(secret) + `"}]}`
+	if err := os.WriteFile(keysFile, []byte(jwks), 0600); err != nil {
+		t.Fatalf("Failed to write JWKS: %v", err)
+	}
+
+	cfg := config.NewServerConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.JWT.KeysFile = keysFile
+	cfg.JWT.Issuer = "https://idp.example.com"
+	srv := newTestServer(t, cfg, dbManager)
+
+	// signHS256 creates a token with the given claims
+	signHS256 := func(claims map[string]interface{}) string {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+		payload, _ := json.Marshal(claims)
+		signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+	claims := func(iss string, exp time.Time) map[string]interface{} {
+		return map[string]interface{}{"sub": "service-a", "iss": iss, "exp": exp.Unix(), "fuckbase": []string{"reader:orders/items"}}
+	}
+
+	valid := signHS256(claims("https://idp.example.com", time.Now().Add(time.Hour)))
+	get := GetSetRequest{Database: "orders", Set: "items", Key: "i1"}
+	tests := []struct {
+		name   string
+		bearer string
+		body   interface{}
+		status int
+	}{
+		{"valid token", valid, get, http.StatusOK},
+		{"out of scope", valid, PutSetRequest{Database: "orders", Set: "items", Key: "i2", Value: json.RawMessage(`{}`)}, http.StatusForbidden},
+		{"expired", signHS256(claims("https://idp.example.com", time.Now().Add(-time.Hour))), get, http.StatusUnauthorized},
+		{"wrong issuer", signHS256(claims("https://evil.example.com", time.Now().Add(time.Hour))), get, http.StatusUnauthorized},
+		{"tampered", valid[:len(valid)-2] + "AA", get, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		handler := srv.handleSetGet
+		if _, ok := tt.body.(PutSetRequest); ok {
+			handler = srv.handleSetPut
+		}
+		if rr := postWithToken(handler, tt.bearer, tt.body); rr.Code != tt.status {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v: %s", tt.name, rr.Code, tt.status, rr.Body.String())
+		}
+	}
+}
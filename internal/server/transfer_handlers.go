@@ -0,0 +1,174 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/ssig33/fuckbase/internal/logger"
+	"github.com/ssig33/fuckbase/internal/transfer"
+)
+
+// handleExport handles the /export endpoint
+// The set is streamed as NDJSON or CSV rather than wrapped in a JSON response.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Parse request body
+	var req ExportRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Validate request
+	if req.Database == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Database name is required")
+		return
+	}
+	if req.Set == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Set name is required")
+		return
+	}
+	if req.Format == "" {
+		req.Format = transfer.FormatNDJSON
+	}
+	if err := transfer.ValidateFormat(req.Format); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+
+	// Get database
+	db, err := s.DBManager.GetDatabase(req.Database)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "DB_NOT_FOUND", "Database not found")
+		return
+	}
+
+	// Check database authentication
+	if !s.authorizeDatabase(w, r, db, req.Set, req.Auth.Username, req.Auth.Password, database.RoleReader) {
+		return
+	}
+
+	// Get set
+	set, err := db.GetSet(req.Set)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "SET_NOT_FOUND", "Set not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", transfer.ContentType(req.Format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", req.Set+"."+req.Format))
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent, so a failure part way through can only be logged
+	count, err := transfer.Export(w, set, transfer.Options{
+		Format:    req.Format,
+		Columns:   req.Columns,
+		KeyColumn: req.KeyColumn,
+	})
+	if err != nil {
+		logger.Error("Export of %s/%s stopped after %d entries: %v", req.Database, req.Set, count, err)
+		return
+	}
+
+	logger.Info("Exported %d entries from %s/%s", count, req.Database, req.Set)
+}
+
+// handleImport handles the /import endpoint
+// The request body is the NDJSON or CSV data, so the parameters are taken from the query
+// string and credentials from the Authorization header.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Validate request
+	query := r.URL.Query()
+	dbName := query.Get("database")
+	setName := query.Get("set")
+	if dbName == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Database name is required")
+		return
+	}
+	if setName == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Set name is required")
+		return
+	}
+
+	opts := transfer.Options{
+		Format:     query.Get("format"),
+		KeyColumn:  query.Get("key_column"),
+		InferTypes: true,
+	}
+	if opts.Format == "" {
+		opts.Format = transfer.FormatFromContentType(r.Header.Get("Content-Type"))
+	}
+	if err := transfer.ValidateFormat(opts.Format); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	for name, dest := range map[string]*bool{"infer_types": &opts.InferTypes, "skip_errors": &opts.SkipErrors} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", fmt.Sprintf("Invalid %s: %s", name, value))
+				return
+			}
+			*dest = parsed
+		}
+	}
+
+	// Get database
+	db, err := s.DBManager.GetDatabase(dbName)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "DB_NOT_FOUND", "Database not found")
+		return
+	}
+
+	// Check database authentication
+	if !s.authorizeDatabase(w, r, db, setName, "", "", database.RoleWriter) {
+		return
+	}
+
+	result, err := transfer.Import(r.Body, db, setName, opts)
+	if err != nil {
+		imported := 0
+		if result != nil {
+			imported = result.Imported
+		}
+		logger.Error("Import into %s/%s stopped after %d entries: %v", dbName, setName, imported, err)
+
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeErrorResponse(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE",
+				fmt.Sprintf("Import body exceeds %d bytes after %d entries were imported", maxErr.Limit, imported))
+			return
+		}
+		var lineErr *transfer.LineError
+		if errors.As(err, &lineErr) {
+			writeErrorResponse(w, http.StatusBadRequest, "INVALID_DATA",
+				fmt.Sprintf("Import stopped at %v after %d entries were imported", err, imported))
+			return
+		}
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST",
+			fmt.Sprintf("Import failed after %d entries were imported: %v", imported, err))
+		return
+	}
+
+	logger.Info("Imported %d entries into %s/%s (%d skipped)", result.Imported, dbName, setName, result.Skipped)
+
+	// Return success response
+	response := Response{
+		Status: "success",
+		Data:   result,
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
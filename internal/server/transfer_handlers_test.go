@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+// newTransferTestServer creates a server with a password-protected database
+func newTransferTestServer(t *testing.T) (*Server, *database.Database) {
+	dbManager := database.NewManager()
+	auth, _ := database.NewAuthConfig("user", "pass")
+	db, _ := dbManager.CreateDatabase("test_db", auth)
+	db.CreateSet("users")
+	db.CreateIndex("city_idx", "users", "city")
+	db.Put("users", "u1", map[string]interface{}{"name": "Alice", "city": "Tokyo"})
+	db.Put("users", "u2", map[string]interface{}{"name": "Bob", "city": "Osaka"})
+	return newTestServer(t, config.NewServerConfig(), dbManager), db
+}
+
+func TestExportEndpoint(t *testing.T) {
+	srv, _ := newTransferTestServer(t)
+
+	req := ExportRequest{Database: "test_db", Set: "users", Format: "csv", Columns: []string{"name"}}
+	req.Auth.Username = "user"
+	req.Auth.Password = "pass"
+	rr := postJSON(srv.handleExport, "/export", req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("Expected CSV content type, got %s", ct)
+	}
+	if rr.Body.String() != "key,name\nu1,Alice\nu2,Bob\n" {
+		t.Errorf("Unexpected CSV export: %q", rr.Body.String())
+	}
+
+	// NDJSON is the default format
+	req.Format = ""
+	rr = postJSON(srv.handleExport, "/export", req)
+	if ct := rr.Header().Get("Content-Type"); ct != "application/x-ndjson" || strings.Count(rr.Body.String(), "\n") != 2 {
+		t.Errorf("Unexpected NDJSON export (%s): %q", ct, rr.Body.String())
+	}
+
+	// Errors are reported before streaming starts
+	tests := []struct {
+		name   string
+		modify func(r *ExportRequest)
+		status int
+	}{
+		{"wrong password", func(r *ExportRequest) { r.Auth.Password = "wrong" }, http.StatusUnauthorized},
+		{"missing set", func(r *ExportRequest) { r.Set = "missing" }, http.StatusNotFound},
+		{"unknown format", func(r *ExportRequest) { r.Format = "xml" }, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := req
+		tt.modify(&r)
+		rr := postJSON(srv.handleExport, "/export", r)
+		if rr.Code != tt.status {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tt.name, rr.Code, tt.status)
+		}
+	}
+}
+
+func TestImportEndpoint(t *testing.T) {
+	srv, db := newTransferTestServer(t)
+
+	importData := func(query string, contentType string, body string, auth bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/import?"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if auth {
+			req.SetBasicAuth("user", "pass")
+		}
+		rr := httptest.NewRecorder()
+		srv.handleImport(rr, req)
+		return rr
+	}
+
+	// The format follows the content type when not given
+	csvData := "key,name,city\nu2,Bob,Kyoto\nu3,Carol,Kyoto\n"
+	rr := importData("database=test_db&set=users", "text/csv", csvData, true)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var resp struct {
+		Status string `json:"status"`
+		Data   struct {
+			Imported int `json:"imported"`
+			Skipped  int `json:"skipped"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+	if resp.Status != "success" || resp.Data.Imported != 2 {
+		t.Errorf("Expected 2 entries imported, got %+v", resp)
+	}
+
+	// Imported entries maintain the index
+	index, _ := db.GetIndex("city_idx")
+	if keys, _ := index.Query("Kyoto"); len(keys) != 2 {
+		t.Errorf("Expected 2 indexed entries for Kyoto, got %v", keys)
+	}
+	if keys, _ := index.Query("Osaka"); len(keys) != 0 {
+		t.Errorf("Expected u2 to be removed from the Osaka index, got %v", keys)
+	}
+
+	// Invalid lines stop the import unless skipped
+	ndjson := "{\"key\":\"u4\",\"value\":{}}\nnot json\n"
+	rr = importData("database=test_db&set=users&format=ndjson", "application/x-ndjson", ndjson, true)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "INVALID_DATA") {
+		t.Errorf("Expected INVALID_DATA, got %v: %s", rr.Code, rr.Body.String())
+	}
+	rr = importData("database=test_db&set=users&skip_errors=true", "application/x-ndjson", ndjson, true)
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK || resp.Data.Skipped != 1 {
+		t.Errorf("Expected 1 line skipped, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		auth   bool
+		status int
+	}{
+		{"no credentials", "database=test_db&set=users", false, http.StatusUnauthorized},
+		{"missing database", "database=missing&set=users", true, http.StatusNotFound},
+		{"missing set name", "database=test_db", true, http.StatusBadRequest},
+		{"unknown format", "database=test_db&set=users&format=xml", true, http.StatusBadRequest},
+		{"invalid flag", "database=test_db&set=users&skip_errors=maybe", true, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rr := importData(tt.query, "text/csv", csvData, tt.auth)
+		if rr.Code != tt.status {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tt.name, rr.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/ssig33/fuckbase/internal/logger"
+)
+
+// handleUserAdd handles the /user/add endpoint
+func (s *Server) handleUserAdd(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleUserAddImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleUserAddImpl(w, r)
+}
+
+// handleUserAddImpl implements the user add logic
+func (s *Server) handleUserAddImpl(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var req AddUserRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Validate request
+	if req.Database == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Database name is required")
+		return
+	}
+	if req.Username == "" || req.Password == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Username and password are required")
+		return
+	}
+	role, err := database.ParseRole(req.Role)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+
+	// Get database
+	db, err := s.DBManager.GetDatabase(req.Database)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "DB_NOT_FOUND", "Database not found")
+		return
+	}
+
+	// Add user
+	if err := db.AddUser(req.Username, req.Password, role); err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			writeErrorResponse(w, http.StatusConflict, "USER_ALREADY_EXISTS", err.Error())
+		} else {
+			writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		}
+		return
+	}
+
+	logger.Info("Added %s user %s to database: %s", role, req.Username, req.Database)
+
+	// Return success response
+	response := Response{
+		Status:  "success",
+		Message: "User added successfully",
+		Data:    database.UserInfo{Username: req.Username, Role: role},
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// handleUserRemove handles the /user/remove endpoint
+func (s *Server) handleUserRemove(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleUserRemoveImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleUserRemoveImpl(w, r)
+}
+
+// handleUserRemoveImpl implements the user remove logic
+func (s *Server) handleUserRemoveImpl(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var req RemoveUserRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Validate request
+	if req.Database == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Database name is required")
+		return
+	}
+	if req.Username == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Username is required")
+		return
+	}
+
+	// Get database
+	db, err := s.DBManager.GetDatabase(req.Database)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "DB_NOT_FOUND", "Database not found")
+		return
+	}
+
+	// Remove user
+	if err := db.RemoveUser(req.Username); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeErrorResponse(w, http.StatusNotFound, "USER_NOT_FOUND", err.Error())
+		} else {
+			writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		}
+		return
+	}
+
+	logger.Info("Removed user %s from database: %s", req.Username, req.Database)
+
+	// Return success response
+	response := Response{
+		Status:  "success",
+		Message: "User removed successfully",
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// handleUserList handles the /user/list endpoint
+func (s *Server) handleUserList(w http.ResponseWriter, r *http.Request) {
+	// Check if this is a POST request
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is allowed")
+		return
+	}
+
+	// Check admin authentication if enabled
+	if s.adminAuth.Enabled() {
+		s.adminAuth.RequireAdminAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.handleUserListImpl(w, r)
+		})(w, r)
+		return
+	}
+
+	// No admin auth required
+	s.handleUserListImpl(w, r)
+}
+
+// handleUserListImpl implements the user list logic
+func (s *Server) handleUserListImpl(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var req ListUsersRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	// Validate request
+	if req.Database == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Database name is required")
+		return
+	}
+
+	// Get database
+	db, err := s.DBManager.GetDatabase(req.Database)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "DB_NOT_FOUND", "Database not found")
+		return
+	}
+
+	// Return success response
+	response := ListUsersResponse{
+		Status: "success",
+		Users:  db.ListUsers(),
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
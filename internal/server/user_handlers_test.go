@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ssig33/fuckbase/internal/config"
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+// postAs calls a handler with a JSON request body and database credentials
+func postAs(handler http.HandlerFunc, username, password string, reqBody interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(username, password)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestDatabaseUserRoles(t *testing.T) {
+	dbManager := database.NewManager()
+	auth, _ := database.NewAuthConfig("owner", "password")
+	db, _ := dbManager.CreateDatabase("test_db", auth)
+	db.CreateSet("users")
+	db.Put("users", "u1", map[string]interface{}{"name": "Alice"})
+	srv := newTestServer(t, config.NewServerConfig(), dbManager)
+
+	// Add users through the admin API
+	for _, user := range []AddUserRequest{
+		{Database: "test_db", Username: "reporter", Password: "r", Role: "reader"},
+		{Database: "test_db", Username: "loader", Password: "w", Role: "writer"},
+	} {
+		if rr := postJSON(srv.handleUserAdd, "/user/add", user); rr.Code != http.StatusOK {
+			t.Fatalf("Handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+	}
+	if rr := postJSON(srv.handleUserAdd, "/user/add", AddUserRequest{Database: "test_db", Username: "reporter", Password: "x", Role: "reader"}); rr.Code != http.StatusConflict {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusConflict)
+	}
+	if rr := postJSON(srv.handleUserAdd, "/user/add", AddUserRequest{Database: "test_db", Username: "x", Password: "x", Role: "root"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	rr := postJSON(srv.handleUserList, "/user/list", ListUsersRequest{Database: "test_db"})
+	var list ListUsersResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list.Users) != 3 {
+		t.Errorf("Expected 3 users, got %s", rr.Body.String())
+	}
+	if bytes.Contains(rr.Body.Bytes(), []byte("pbkdf2")) {
+		t.Errorf("Expected no password hashes in the user list")
+	}
+
+	get := GetSetRequest{Database: "test_db", Set: "users", Key: "u1"}
+	put := PutSetRequest{Database: "test_db", Set: "users", Key: "u2", Value: json.RawMessage(`{"name":"Bob"}`)}
+	index := CreateIndexRequest{Database: "test_db", Set: "users", Name: "name_idx", Field: "name"}
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		username string
+		password string
+		body     interface{}
+		status   int
+	}{
+		{"reader gets", srv.handleSetGet, "reporter", "r", get, http.StatusOK},
+		{"reader puts", srv.handleSetPut, "reporter", "r", put, http.StatusForbidden},
+		{"writer puts", srv.handleSetPut, "loader", "w", put, http.StatusOK},
+		{"writer creates index", srv.handleIndexCreate, "loader", "w", index, http.StatusForbidden},
+		{"owner creates index", srv.handleIndexCreate, "owner", "password", index, http.StatusOK},
+		{"wrong password", srv.handleSetGet, "reporter", "w", get, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		rr := postAs(tt.handler, tt.username, tt.password, tt.body)
+		if rr.Code != tt.status {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v: %s", tt.name, rr.Code, tt.status, rr.Body.String())
+		}
+	}
+
+	// Removed users can no longer authenticate
+	if rr := postJSON(srv.handleUserRemove, "/user/remove", RemoveUserRequest{Database: "test_db", Username: "reporter"}); rr.Code != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := postAs(srv.handleSetGet, "reporter", "r", get); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := postJSON(srv.handleUserRemove, "/user/remove", RemoveUserRequest{Database: "test_db", Username: "reporter"}); rr.Code != http.StatusNotFound {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
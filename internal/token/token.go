@@ -0,0 +1,331 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/credential"
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+// Prefix starts every token, so tokens are easy to recognize in configuration and logs
+const Prefix = "fbt_"
+
+// FileName is the name of the token file in the data directory
+const FileName = "tokens.json"
+
+// Wildcard matches every database or set in a scope
+const Wildcard = "*"
+
+// ErrTokenNotFound is returned when revoking a token that does not exist
+var ErrTokenNotFound = errors.New("token not found")
+
+// Scope grants a class of operations on the matching sets of a database
+type Scope struct {
+	Database string        `json:"database"` // Database name, or "*" for every database
+	Sets     string        `json:"sets"`     // Set name pattern as in path.Match, such as "orders_*"
+	Access   database.Role `json:"access"`   // "reader", "writer" or "admin"
+}
+
+// ParseScope parses a scope written as "access:database/sets", such as "reader:orders/*"
+// The set pattern may be left out to match every set.
+func ParseScope(s string) (Scope, error) {
+	access, target, found := strings.Cut(s, ":")
+	if !found {
+		return Scope{}, fmt.Errorf("invalid scope %q: expected access:database/sets", s)
+	}
+	dbName, sets, found := strings.Cut(target, "/")
+	if !found {
+		sets = Wildcard
+	}
+	scope := Scope{Database: dbName, Sets: sets, Access: database.Role(access)}
+	return scope, scope.Validate()
+}
+
+// Validate checks that a scope names a database, a valid set pattern and a known access class
+func (sc Scope) Validate() error {
+	if sc.Database == "" {
+		return fmt.Errorf("scope database is required")
+	}
+	if sc.Sets == "" {
+		return fmt.Errorf("scope set pattern is required")
+	}
+	if _, err := path.Match(sc.Sets, ""); err != nil {
+		return fmt.Errorf("invalid set pattern %q: %w", sc.Sets, err)
+	}
+	if _, err := database.ParseRole(string(sc.Access)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// String returns the scope in the form accepted by ParseScope
+func (sc Scope) String() string {
+	return fmt.Sprintf("%s:%s/%s", sc.Access, sc.Database, sc.Sets)
+}
+
+// UnmarshalJSON accepts a scope either as an object or as a string in the form accepted by ParseScope
+func (sc *Scope) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		scope, err := ParseScope(s)
+		if err != nil {
+			return err
+		}
+		*sc = scope
+		return nil
+	}
+
+	type plain Scope
+	return json.Unmarshal(data, (*plain)(sc))
+}
+
+// allows reports whether the scope grants the required access to a set of a database
+// An empty set name stands for operations on the database as a whole, such as listing sets.
+func (sc Scope) allows(dbName, setName string, required database.Role) bool {
+	if sc.Database != Wildcard && sc.Database != dbName {
+		return false
+	}
+	if setName != "" {
+		if matched, _ := path.Match(sc.Sets, setName); !matched {
+			return false
+		}
+	}
+	return sc.Access.Allows(required)
+}
+
+// Token is an API token as stored, identified by its ID and holding only a hash of its secret
+type Token struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Hash      string     `json:"hash"` // SHA-256 of the secret, hex encoded
+	Scopes    []Scope    `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Info describes a token without its hash
+type Info struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scopes    []Scope    `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Info returns the description of a token
+func (t *Token) Info() Info {
+	return Info{ID: t.ID, Name: t.Name, Scopes: t.Scopes, CreatedAt: t.CreatedAt, ExpiresAt: t.ExpiresAt}
+}
+
+// Allows reports whether any of the token's scopes grants the required access to a set of a database
+func (t *Token) Allows(dbName, setName string, required database.Role) bool {
+	return ScopesAllow(t.Scopes, dbName, setName, required)
+}
+
+// ScopesAllow reports whether any of the scopes grants the required access to a set of a database
+func ScopesAllow(scopes []Scope, dbName, setName string, required database.Role) bool {
+	for _, scope := range scopes {
+		if scope.allows(dbName, setName, required) {
+			return true
+		}
+	}
+	return false
+}
+
+// expired reports whether the token has expired at the given time
+func (t *Token) expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// Store holds the API tokens, saving them to a file when a path is given
+type Store struct {
+	path   string
+	mu     sync.RWMutex
+	tokens map[string]*Token
+}
+
+// NewStore creates a token store, loading the tokens saved at path if it exists
+// An empty path keeps tokens in memory only.
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:   path,
+		tokens: make(map[string]*Token),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens: %w", err)
+	}
+
+	var tokens []*Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens: %w", err)
+	}
+	for _, t := range tokens {
+		s.tokens[t.ID] = t
+	}
+	return s, nil
+}
+
+// Create creates a token with the given scopes and returns its secret with its description
+// The secret is returned only here; the store keeps a hash of it. A zero expiresAt never expires.
+func (s *Store) Create(name string, scopes []Scope, expiresAt time.Time) (string, Info, error) {
+	if len(scopes) == 0 {
+		return "", Info{}, fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if err := scope.Validate(); err != nil {
+			return "", Info{}, err
+		}
+	}
+
+	idBytes := make([]byte, 8)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", Info{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", Info{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+	id := hex.EncodeToString(idBytes)
+	secret := Prefix + id + "_" + base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	t := &Token{
+		ID:        id,
+		Name:      name,
+		Hash:      hashSecret(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if !expiresAt.IsZero() {
+		expires := expiresAt.UTC()
+		t.ExpiresAt = &expires
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[id] = t
+	if err := s.saveLocked(); err != nil {
+		delete(s.tokens, id)
+		return "", Info{}, err
+	}
+	return secret, t.Info(), nil
+}
+
+// Revoke deletes a token by ID
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, exists := s.tokens[id]
+	if !exists {
+		return ErrTokenNotFound
+	}
+
+	delete(s.tokens, id)
+	if err := s.saveLocked(); err != nil {
+		s.tokens[id] = t
+		return err
+	}
+	return nil
+}
+
+// List returns the descriptions of all tokens, oldest first
+func (s *Store) List() []Info {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	infos := make([]Info, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		infos = append(infos, t.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].CreatedAt.Equal(infos[j].CreatedAt) {
+			return infos[i].CreatedAt.Before(infos[j].CreatedAt)
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// Authenticate returns the token with the given secret, unless it is unknown or expired
+func (s *Store) Authenticate(secret string) (*Token, bool) {
+	rest, found := strings.CutPrefix(secret, Prefix)
+	if !found {
+		return nil, false
+	}
+	id, _, found := strings.Cut(rest, "_")
+	if !found {
+		return nil, false
+	}
+
+	s.mu.RLock()
+	t, exists := s.tokens[id]
+	s.mu.RUnlock()
+
+	if !exists || !credential.EqualStrings(t.Hash, hashSecret(secret)) || t.expired(time.Now()) {
+		return nil, false
+	}
+	return t, true
+}
+
+// saveLocked writes the tokens to the store's file, readable only by the owner
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	tokens := make([]*Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		tokens = append(tokens, t)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].ID < tokens[j].ID
+	})
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal tokens: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create token directory: %w", err)
+	}
+
+	// Write to a temporary file first so a failed write leaves the old tokens intact
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	return nil
+}
+
+// hashSecret returns the hex SHA-256 of a token secret
+// Secrets are random, so a fast hash is enough to keep them out of the token file.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
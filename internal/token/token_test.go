@@ -0,0 +1,150 @@
+package token
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+func TestParseScope(t *testing.T) {
+	scope, err := ParseScope("reader:orders/*")
+	if err != nil || scope != (Scope{Database: "orders", Sets: "*", Access: database.RoleReader}) {
+		t.Errorf("Unexpected scope: %+v (%v)", scope, err)
+	}
+	if scope.String() != "reader:orders/*" {
+		t.Errorf("Expected the scope to format as it was parsed, got %s", scope)
+	}
+
+	scope, err = ParseScope("writer:shop")
+	if err != nil || scope.Sets != Wildcard {
+		t.Errorf("Expected a missing set pattern to match every set, got %+v (%v)", scope, err)
+	}
+
+	for _, s := range []string{"orders/*", "owner:orders/*", "reader:/*", "reader:orders/[", "reader:orders/"} {
+		if _, err := ParseScope(s); err == nil {
+			t.Errorf("Expected error for scope %q", s)
+		}
+	}
+
+	// Scopes can be given in JSON as strings or objects
+	var scopes []Scope
+	data := `["reader:orders/*", {"database": "shop", "sets": "cart_*", "access": "writer"}]`
+	if err := json.Unmarshal([]byte(data), &scopes); err != nil || len(scopes) != 2 || scopes[0].Database != "orders" || scopes[1].Sets != "cart_*" {
+		t.Errorf("Unexpected scopes from JSON: %+v (%v)", scopes, err)
+	}
+	if err := json.Unmarshal([]byte(`["owner:orders"]`), &scopes); err == nil {
+		t.Errorf("Expected error for an unknown access class in JSON")
+	}
+}
+
+func TestTokenAllows(t *testing.T) {
+	tok := &Token{Scopes: []Scope{
+		{Database: "orders", Sets: "*", Access: database.RoleReader},
+		{Database: "shop", Sets: "cart_*", Access: database.RoleWriter},
+	}}
+
+	tests := []struct {
+		database string
+		set      string
+		required database.Role
+		want     bool
+	}{
+		{"orders", "items", database.RoleReader, true},
+		{"orders", "items", database.RoleWriter, false},
+		{"orders", "", database.RoleReader, true},
+		{"shop", "cart_1", database.RoleWriter, true},
+		{"shop", "cart_1", database.RoleAdmin, false},
+		{"shop", "users", database.RoleReader, false},
+		{"other", "items", database.RoleReader, false},
+	}
+	for _, tt := range tests {
+		if got := tok.Allows(tt.database, tt.set, tt.required); got != tt.want {
+			t.Errorf("Expected %s access to %s/%s to be %v, got %v", tt.required, tt.database, tt.set, tt.want, got)
+		}
+	}
+
+	all := &Token{Scopes: []Scope{{Database: Wildcard, Sets: Wildcard, Access: database.RoleAdmin}}}
+	if !all.Allows("any", "set", database.RoleAdmin) {
+		t.Errorf("Expected wildcards to match every database and set")
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	scopes := []Scope{{Database: "orders", Sets: "*", Access: database.RoleReader}}
+	secret, info, err := store.Create("reports", scopes, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if !strings.HasPrefix(secret, Prefix+info.ID+"_") || info.Name != "reports" || info.ExpiresAt != nil {
+		t.Errorf("Unexpected token %s: %+v", secret, info)
+	}
+
+	if tok, ok := store.Authenticate(secret); !ok || tok.ID != info.ID {
+		t.Errorf("Expected the secret to authenticate")
+	}
+	for _, bad := range []string{secret + "x", "fbt_" + info.ID + "_wrong", "fbt_unknown_x", "secret", ""} {
+		if _, ok := store.Authenticate(bad); ok {
+			t.Errorf("Expected %q not to authenticate", bad)
+		}
+	}
+
+	// Only the hash is saved, readable only by the owner
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), secret[len(Prefix)+len(info.ID)+1:]) {
+		t.Errorf("Expected the secret not to be saved")
+	}
+	if stat, err := os.Stat(path); err != nil || stat.Mode().Perm() != 0600 {
+		t.Errorf("Expected the token file to have mode 0600, got %v (%v)", stat.Mode().Perm(), err)
+	}
+
+	// Tokens survive a restart
+	reloaded, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reload store: %v", err)
+	}
+	if _, ok := reloaded.Authenticate(secret); !ok || len(reloaded.List()) != 1 {
+		t.Errorf("Expected the token to be loaded")
+	}
+
+	// Expired tokens do not authenticate
+	expired, _, err := store.Create("old", scopes, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if _, ok := store.Authenticate(expired); ok {
+		t.Errorf("Expected an expired token not to authenticate")
+	}
+	if list := store.List(); len(list) != 2 || list[0].ID != info.ID {
+		t.Errorf("Expected tokens oldest first, got %+v", list)
+	}
+
+	if err := store.Revoke(info.ID); err != nil {
+		t.Errorf("Failed to revoke token: %v", err)
+	}
+	if _, ok := store.Authenticate(secret); ok {
+		t.Errorf("Expected a revoked token not to authenticate")
+	}
+	if err := store.Revoke(info.ID); err != ErrTokenNotFound {
+		t.Errorf("Expected ErrTokenNotFound, got %v", err)
+	}
+
+	if _, _, err := store.Create("none", nil, time.Time{}); err == nil {
+		t.Errorf("Expected error for a token without scopes")
+	}
+
+	os.WriteFile(path, []byte("not json"), 0600)
+	if _, err := NewStore(path); err == nil {
+		t.Errorf("Expected error loading an invalid token file")
+	}
+}
@@ -0,0 +1,391 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ssig33/fuckbase/internal/database"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Supported export and import formats
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// DefaultKeyColumn is the CSV column holding each entry's key
+const DefaultKeyColumn = "key"
+
+// maxLineSize is the longest NDJSON line accepted on import
+const maxLineSize = 16 * 1024 * 1024
+
+// maxReportedErrors caps the line errors kept in an import result
+const maxReportedErrors = 100
+
+// Record is one entry of an export or import
+type Record struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// Options controls the encoding of an export or import
+type Options struct {
+	Format     string
+	Columns    []string // CSV value columns; dotted names select nested fields
+	KeyColumn  string   // CSV column holding the key; defaults to "key"
+	InferTypes bool     // Parse CSV numbers, booleans and JSON objects on import
+	SkipErrors bool     // Skip invalid lines on import instead of stopping
+}
+
+// ImportResult reports the outcome of an import
+type ImportResult struct {
+	Imported int         `json:"imported"`
+	Skipped  int         `json:"skipped"`
+	Errors   []LineError `json:"errors,omitempty"`
+}
+
+// LineError describes a line that could not be imported
+type LineError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// ValidateFormat checks that a format is supported
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatNDJSON, FormatCSV:
+		return nil
+	default:
+		return fmt.Errorf("unsupported format: %s (expected ndjson or csv)", format)
+	}
+}
+
+// ContentType returns the HTTP content type of a format
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv"
+	}
+	return "application/x-ndjson"
+}
+
+// FormatFromContentType returns the format matching an HTTP content type, defaulting to NDJSON
+func FormatFromContentType(contentType string) string {
+	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), "text/csv") {
+		return FormatCSV
+	}
+	return FormatNDJSON
+}
+
+// Export writes every entry of a set to w, sorted by key
+// CSV exports without columns use every top-level field found in the set.
+func Export(w io.Writer, set *database.Set, opts Options) (int, error) {
+	if err := ValidateFormat(opts.Format); err != nil {
+		return 0, err
+	}
+
+	keys := set.Keys()
+	sort.Strings(keys)
+
+	buffered := bufio.NewWriter(w)
+	var write func(key string, value interface{}) error
+
+	switch opts.Format {
+	case FormatNDJSON:
+		encoder := json.NewEncoder(buffered)
+		write = func(key string, value interface{}) error {
+			return encoder.Encode(Record{Key: key, Value: value})
+		}
+	case FormatCSV:
+		columns := opts.Columns
+		if len(columns) == 0 {
+			var err error
+			if columns, err = fieldNames(set, keys); err != nil {
+				return 0, err
+			}
+		}
+		writer := csv.NewWriter(buffered)
+		if err := writer.Write(append([]string{keyColumn(opts)}, columns...)); err != nil {
+			return 0, err
+		}
+		row := make([]string, len(columns)+1)
+		write = func(key string, value interface{}) error {
+			row[0] = key
+			for i, column := range columns {
+				cell, err := formatCell(lookupField(value, column))
+				if err != nil {
+					return fmt.Errorf("key %s, column %s: %w", key, column, err)
+				}
+				row[i+1] = cell
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+			writer.Flush()
+			return writer.Error()
+		}
+	}
+
+	count := 0
+	for _, key := range keys {
+		value, ok, err := readValue(set, key)
+		if err != nil {
+			return count, err
+		}
+		if !ok {
+			continue
+		}
+		if err := write(key, value); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, buffered.Flush()
+}
+
+// Import loads the records read from r into a set through Database.Put, so indexes stay current
+// The set is created if it does not exist. Without SkipErrors the import stops at the first
+// invalid line, returning a *LineError; records before it remain imported.
+func Import(r io.Reader, db *database.Database, setName string, opts Options) (*ImportResult, error) {
+	if err := ValidateFormat(opts.Format); err != nil {
+		return nil, err
+	}
+	if _, err := db.GetSet(setName); err != nil {
+		if _, err := db.CreateSet(setName); err != nil {
+			return nil, fmt.Errorf("failed to create set: %w", err)
+		}
+	}
+
+	result := &ImportResult{}
+	fail := func(line int, err error) error {
+		lineErr := &LineError{Line: line, Message: err.Error()}
+		if !opts.SkipErrors {
+			return lineErr
+		}
+		result.Skipped++
+		if len(result.Errors) < maxReportedErrors {
+			result.Errors = append(result.Errors, *lineErr)
+		}
+		return nil
+	}
+	put := func(line int, key string, value interface{}) error {
+		if key == "" {
+			return fail(line, errors.New("key is required"))
+		}
+		if err := db.Put(setName, key, value); err != nil {
+			return fail(line, err)
+		}
+		result.Imported++
+		return nil
+	}
+
+	switch opts.Format {
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+		line := 0
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			var record Record
+			if err := json.Unmarshal(text, &record); err != nil {
+				if err := fail(line, fmt.Errorf("invalid JSON: %w", err)); err != nil {
+					return result, err
+				}
+				continue
+			}
+			if err := put(line, record.Key, record.Value); err != nil {
+				return result, err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return result, fmt.Errorf("failed to read input: %w", err)
+		}
+
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		header, err := reader.Read()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		keyIndex := -1
+		for i, column := range header {
+			if column == keyColumn(opts) {
+				keyIndex = i
+				break
+			}
+		}
+		if keyIndex < 0 {
+			return result, fmt.Errorf("CSV header has no %s column", keyColumn(opts))
+		}
+
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				var parseErr *csv.ParseError
+				if !errors.As(err, &parseErr) {
+					return result, fmt.Errorf("failed to read input: %w", err)
+				}
+				if err := fail(parseErr.StartLine, parseErr.Err); err != nil {
+					return result, err
+				}
+				continue
+			}
+			line, _ := reader.FieldPos(0)
+			if len(row) != len(header) {
+				if err := fail(line, fmt.Errorf("expected %d columns, got %d", len(header), len(row))); err != nil {
+					return result, err
+				}
+				continue
+			}
+
+			doc := make(map[string]interface{})
+			for i, cell := range row {
+				if i == keyIndex || cell == "" {
+					continue
+				}
+				value := interface{}(cell)
+				if opts.InferTypes {
+					value = parseCell(cell)
+				}
+				setField(doc, header[i], value)
+			}
+			if err := put(line, row[keyIndex], doc); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// readValue decodes the value of a key, reporting false if the key was deleted since the keys were listed
+func readValue(set *database.Set, key string) (interface{}, bool, error) {
+	raw, err := set.GetRaw(key)
+	if err != nil {
+		if !set.Has(key) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to read key %s: %w", key, err)
+	}
+	var value interface{}
+	if err := msgpack.Unmarshal(raw, &value); err != nil {
+		return nil, false, fmt.Errorf("failed to decode key %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// keyColumn returns the CSV key column name
+func keyColumn(opts Options) string {
+	if opts.KeyColumn != "" {
+		return opts.KeyColumn
+	}
+	return DefaultKeyColumn
+}
+
+// fieldNames returns the sorted top-level field names of the objects in a set
+func fieldNames(set *database.Set, keys []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		value, _, err := readValue(set, key)
+		if err != nil {
+			return nil, err
+		}
+		if doc, ok := value.(map[string]interface{}); ok {
+			for field := range doc {
+				seen[field] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for field := range seen {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// lookupField returns the value of a field, following dots into nested objects
+// A field whose name contains a dot is matched whole before its parts are tried.
+func lookupField(value interface{}, path string) interface{} {
+	doc, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if v, ok := doc[path]; ok {
+		return v
+	}
+	head, rest, found := strings.Cut(path, ".")
+	if !found {
+		return nil
+	}
+	return lookupField(doc[head], rest)
+}
+
+// setField sets a field, creating nested objects for dotted names
+func setField(doc map[string]interface{}, path string, value interface{}) {
+	head, rest, found := strings.Cut(path, ".")
+	if !found || head == "" || rest == "" {
+		doc[path] = value
+		return
+	}
+	child, ok := doc[head].(map[string]interface{})
+	if !ok {
+		child = make(map[string]interface{})
+		doc[head] = child
+	}
+	setField(child, rest, value)
+}
+
+// formatCell returns the CSV text of a value
+// Strings are written as is, missing values as empty cells and everything else as JSON.
+func formatCell(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
+
+// parseCell returns the value of a CSV cell, reading JSON numbers, booleans, null, objects and arrays
+// Anything else, including numbers with leading zeros such as postal codes, stays a string.
+func parseCell(cell string) interface{} {
+	switch cell[0] {
+	case '{', '[', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', 't', 'f', 'n':
+		var value interface{}
+		if err := json.Unmarshal([]byte(cell), &value); err == nil {
+			return value
+		}
+	}
+	return cell
+}
@@ -0,0 +1,232 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ssig33/fuckbase/internal/database"
+)
+
+// newTestDatabase creates a database with a users set indexed by city
+func newTestDatabase(t *testing.T) *database.Database {
+	db := database.NewDatabase("test_db", nil)
+	db.CreateSet("users")
+	if _, err := db.CreateIndex("city_idx", "users", "city"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	return db
+}
+
+func TestExport(t *testing.T) {
+	db := newTestDatabase(t)
+	db.Put("users", "u2", map[string]interface{}{"name": "Bob", "age": 25, "address": map[string]interface{}{"city": "Osaka"}})
+	db.Put("users", "u1", map[string]interface{}{"name": "Alice, A.", "age": 30, "tags": []string{"admin"}})
+	set, _ := db.GetSet("users")
+
+	var out bytes.Buffer
+	count, err := Export(&out, set, Options{Format: FormatNDJSON})
+	if err != nil || count != 2 {
+		t.Fatalf("Expected 2 entries exported, got %d (%v)", count, err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"key":"u1","value":{`) {
+		t.Errorf("Expected one NDJSON line per entry sorted by key, got %q", out.String())
+	}
+
+	// Chosen columns, following dots into nested objects
+	out.Reset()
+	if _, err := Export(&out, set, Options{Format: FormatCSV, Columns: []string{"name", "address.city", "tags"}}); err != nil {
+		t.Fatalf("Failed to export CSV: %v", err)
+	}
+	expected := "key,name,address.city,tags\nu1,\"Alice, A.\",,\"[\"\"admin\"\"]\"\nu2,Bob,Osaka,\n"
+	if out.String() != expected {
+		t.Errorf("Expected CSV %q, got %q", expected, out.String())
+	}
+
+	// Every top-level field when no columns are chosen
+	out.Reset()
+	if _, err := Export(&out, set, Options{Format: FormatCSV, KeyColumn: "id"}); err != nil {
+		t.Fatalf("Failed to export CSV: %v", err)
+	}
+	if header, _, _ := strings.Cut(out.String(), "\n"); header != "id,address,age,name,tags" {
+		t.Errorf("Expected header of every field, got %q", header)
+	}
+
+	if _, err := Export(&out, set, Options{Format: "xml"}); err == nil {
+		t.Errorf("Expected error for an unsupported format")
+	}
+}
+
+// plainWrapper is a KeyWrapper that leaves data keys unwrapped
+type plainWrapper struct{}
+
+func (plainWrapper) ActiveKeyID() string { return "test" }
+
+func (plainWrapper) WrapKey(dataKey []byte) (string, []byte, error) {
+	return "test", append([]byte(nil), dataKey...), nil
+}
+
+func (plainWrapper) UnwrapKey(masterKeyID string, wrapped []byte) ([]byte, error) {
+	return append([]byte(nil), wrapped...), nil
+}
+
+func TestExportUnreadableValue(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.EnableEncryption(plainWrapper{}); err != nil {
+		t.Fatalf("Failed to enable encryption: %v", err)
+	}
+	db.Put("users", "u1", map[string]interface{}{"name": "Alice"})
+	db.Put("users", "u2", map[string]interface{}{"name": "Bob"})
+	set, _ := db.GetSet("users")
+
+	// A value that no longer opens fails the export instead of being left out
+	sealed := set.Data["u2"]
+	sealed[len(sealed)-1] ^= 0xff
+
+	var out bytes.Buffer
+	count, err := Export(&out, set, Options{Format: FormatNDJSON})
+	if err == nil || !strings.Contains(err.Error(), "u2") {
+		t.Fatalf("Expected error naming key u2, got %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 entry exported before the error, got %d", count)
+	}
+
+	if _, err := Export(&out, set, Options{Format: FormatCSV}); err == nil {
+		t.Errorf("Expected error exporting CSV")
+	}
+}
+
+func TestImportNDJSON(t *testing.T) {
+	db := newTestDatabase(t)
+	db.Put("users", "u1", map[string]interface{}{"name": "Alice", "city": "Tokyo"})
+
+	input := `{"key":"u1","value":{"name":"Alice","city":"Osaka"}}
+
+{"key":"u2","value":{"name":"Bob","city":"Osaka"}}
+`
+	result, err := Import(strings.NewReader(input), db, "users", Options{Format: FormatNDJSON})
+	if err != nil || result.Imported != 2 {
+		t.Fatalf("Expected 2 entries imported, got %+v (%v)", result, err)
+	}
+
+	// Imported entries are indexed, and the old value of u1 is no longer
+	index, _ := db.GetIndex("city_idx")
+	if keys, _ := index.Query("Osaka"); len(keys) != 2 {
+		t.Errorf("Expected 2 indexed entries for Osaka, got %v", keys)
+	}
+	if keys, _ := index.Query("Tokyo"); len(keys) != 0 {
+		t.Errorf("Expected the replaced value to be removed from the index, got %v", keys)
+	}
+
+	// Stops at the first invalid line
+	input = `{"key":"u3","value":{}}
+not json
+{"key":"u4","value":{}}
+`
+	result, err = Import(strings.NewReader(input), db, "users", Options{Format: FormatNDJSON})
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 2 || result.Imported != 1 {
+		t.Errorf("Expected to stop at line 2 after 1 entry, got %+v (%v)", result, err)
+	}
+
+	// Skips invalid lines when asked
+	input = `{"key":"","value":{}}
+not json
+{"key":"u4","value":{}}
+`
+	result, err = Import(strings.NewReader(input), db, "users", Options{Format: FormatNDJSON, SkipErrors: true})
+	if err != nil || result.Imported != 1 || result.Skipped != 2 || len(result.Errors) != 2 || result.Errors[0].Line != 1 {
+		t.Errorf("Expected 2 lines skipped, got %+v (%v)", result, err)
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	db := newTestDatabase(t)
+
+	input := "id,name,age,active,zip,address.city,tags\n" +
+		"u1,Alice,30,true,007,Tokyo,\"[\"\"admin\"\"]\"\n" +
+		"u2,Bob,,false,,,\n"
+	result, err := Import(strings.NewReader(input), db, "people", Options{Format: FormatCSV, KeyColumn: "id", InferTypes: true})
+	if err != nil || result.Imported != 2 {
+		t.Fatalf("Expected 2 entries imported, got %+v (%v)", result, err)
+	}
+
+	// The set is created on import
+	set, err := db.GetSet("people")
+	if err != nil {
+		t.Fatalf("Expected the set to be created: %v", err)
+	}
+	var alice map[string]interface{}
+	set.Get("u1", &alice)
+	if alice["name"] != "Alice" || alice["active"] != true || alice["zip"] != "007" {
+		t.Errorf("Unexpected typed values: %v", alice)
+	}
+	if age, ok := alice["age"].(float64); !ok || age != 30 {
+		t.Errorf("Expected age to be a number, got %#v", alice["age"])
+	}
+	if address, ok := alice["address"].(map[string]interface{}); !ok || address["city"] != "Tokyo" {
+		t.Errorf("Expected a nested address, got %#v", alice["address"])
+	}
+	if tags, ok := alice["tags"].([]interface{}); !ok || len(tags) != 1 {
+		t.Errorf("Expected tags to be an array, got %#v", alice["tags"])
+	}
+
+	var bob map[string]interface{}
+	set.Get("u2", &bob)
+	if _, ok := bob["age"]; ok || len(bob) != 2 {
+		t.Errorf("Expected empty cells to be omitted, got %v", bob)
+	}
+
+	// Without type inference every value is a string
+	Import(strings.NewReader(input), db, "people", Options{Format: FormatCSV, KeyColumn: "id"})
+	set.Get("u1", &alice)
+	if alice["age"] != "30" || alice["active"] != "true" {
+		t.Errorf("Expected string values, got %v", alice)
+	}
+
+	// A row with the wrong number of columns is reported by line
+	input = "key,name\nu1,Alice\nu2,Bob,extra\n"
+	result, err = Import(strings.NewReader(input), db, "people", Options{Format: FormatCSV})
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 3 || result.Imported != 1 {
+		t.Errorf("Expected to stop at line 3 after 1 entry, got %+v (%v)", result, err)
+	}
+
+	if _, err := Import(strings.NewReader("name\nAlice\n"), db, "people", Options{Format: FormatCSV}); err == nil {
+		t.Errorf("Expected error for a header without a key column")
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src := newTestDatabase(t)
+	src.Put("users", "u1", map[string]interface{}{"name": "Alice", "city": "Tokyo", "age": 30})
+	src.Put("users", "u2", map[string]interface{}{"name": "Bob", "city": "Osaka", "age": 25})
+	set, _ := src.GetSet("users")
+
+	for _, format := range []string{FormatNDJSON, FormatCSV} {
+		var out bytes.Buffer
+		if _, err := Export(&out, set, Options{Format: format}); err != nil {
+			t.Fatalf("Failed to export %s: %v", format, err)
+		}
+
+		dst := newTestDatabase(t)
+		result, err := Import(&out, dst, "users", Options{Format: format, InferTypes: true})
+		if err != nil || result.Imported != 2 {
+			t.Fatalf("Expected 2 entries imported from %s, got %+v (%v)", format, result, err)
+		}
+
+		dstSet, _ := dst.GetSet("users")
+		var bob map[string]interface{}
+		dstSet.Get("u2", &bob)
+		if bob["name"] != "Bob" || bob["age"] != float64(25) {
+			t.Errorf("Unexpected value after %s round trip: %v", format, bob)
+		}
+		index, _ := dst.GetIndex("city_idx")
+		if keys, _ := index.Query("Osaka"); len(keys) != 1 || keys[0] != "u2" {
+			t.Errorf("Expected the %s import to be indexed, got %v", format, keys)
+		}
+	}
+}
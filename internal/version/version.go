@@ -0,0 +1,6 @@
+// Package version holds the version of the FuckBase server
+package version
+
+// Version is the server version
+// It can be overridden at build time with -ldflags "-X github.com/ssig33/fuckbase/internal/version.Version=...".
+var Version = "0.0.1"